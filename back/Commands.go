@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
+	"github.com/mimminou/BookIT-ByFood/back/cli"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/settings"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exit codes shared by the commands, on top of cli.ExitOk and cli.ExitUsage
+const (
+	exitError        = 1
+	exitConfigError  = 2
+	exitInvalidInput = 4
+	exitSetupError   = 5
+)
+
+// app holds the global flags, the commands read the config through it
+type app struct {
+	configPath string
+	logLevel   string
+	dbPath     string
+	// key=value of --set, and of the command flags that are shortcuts for a setting
+	settings settingFlags
+}
+
+// settingFlags is a flag that can be repeated, each one sets a setting
+type settingFlags []string
+
+func (flags *settingFlags) String() string { return strings.Join(*flags, " ") }
+
+func (flags *settingFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	*flags = append(*flags, value)
+	return nil
+}
+
+// loads the config layer by layer, validates it and sets up the logs
+func (app *app) loadConfig() (*config, error) {
+	config := defaultConfig()
+
+	// config.json of the current directory is optional, a file that is asked for isn't
+	filename := app.configPath
+	if filename == "" {
+		filename = os.Getenv(envPrefix + "_CONFIG")
+	}
+	explicit := filename != ""
+	if !explicit {
+		filename = "config.json"
+	}
+	if err := readConfig(filename, config); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if err := settings.ApplyEnv(config, envPrefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	for _, setting := range app.settings {
+		key, value, _ := strings.Cut(setting, "=")
+		if err := settings.Set(config, strings.TrimSpace(key), value); err != nil {
+			return nil, err
+		}
+	}
+	if app.dbPath != "" {
+		config.Db.Path = filepath.Dir(app.dbPath) + string(filepath.Separator)
+		config.Db.Name = filepath.Base(app.dbPath)
+	}
+	if app.logLevel != "" {
+		config.Log.Level = app.logLevel
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	var level slog.Level
+	level.UnmarshalText([]byte(config.Log.Level))
+	// the log package writes through slog once it is the default, at the info level
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	return config, nil
+}
+
+// with turns a function of the config into the Run of a command
+func (app *app) with(run func(config *config, args []string) int) func(args []string) int {
+	return func(args []string) int {
+		config, err := app.loadConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading config: ", err)
+			return exitConfigError
+		}
+		return run(config, args)
+	}
+}
+
+// legacyArgs maps the flags of the previous command line to their commands
+func legacyArgs(args []string) []string {
+	if len(args) == 1 && args[0] == "-s" {
+		fmt.Fprintln(os.Stderr, "Warning: -s is deprecated, use 'bookit db setup'")
+		return []string{"db", "setup"}
+	}
+	return args
+}
+
+// newCli builds the command tree, running the root without a command serves
+func newCli() *cli.Command {
+	app := &app{}
+	root := &cli.Command{
+		Name:  "bookit",
+		Short: "BookIT server and maintenance commands, serves when no command is given",
+	}
+	flags := root.Flags()
+	flags.StringVar(&app.configPath, "config", "", "config file, .json, .yaml, .yml or .toml, $BOOKIT_CONFIG or config.json when it exists by default")
+	flags.StringVar(&app.logLevel, "log-level", "", "lowest level of the logs written to stderr, overrides log.level")
+	flags.StringVar(&app.dbPath, "db", "", "sqlite file of the DB, overrides the database section of the config")
+	flags.Var(&app.settings, "set", "sets a setting of the config, e.g. `url_fetch.max_hops=5`, can be repeated")
+	root.SetChoices("log-level", logLevels...)
+
+	serve := serveCommand(app)
+	root.Run = func(args []string) int {
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", args[0])
+			root.PrintHelp()
+			return cli.ExitUsage
+		}
+		return serve.Run(args)
+	}
+
+	return root.Add(
+		serve,
+		configCommand(app),
+		dbCommand(app),
+		importCommand(app),
+		exportCommand(app),
+		userCommand(app),
+		urlCommand(app),
+		sitemapCommand(app),
+	)
+}
+
+func serveCommand(app *app) *cli.Command {
+	command := &cli.Command{Name: "serve", Args: "[flags]", Short: "Runs the HTTP and gRPC servers"}
+	flags := command.Flags()
+	port := flags.String("port", "", "HTTP port, overrides server.port")
+	grpcPort := flags.String("grpc-port", "", "gRPC port, overrides server.grpc_port, 0 disables the gRPC server")
+	serve := app.with(func(config *config, args []string) int {
+		if len(args) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: serve takes no arguments")
+			return cli.ExitUsage
+		}
+		return runServe(config)
+	})
+	command.Run = func(args []string) int {
+		// shortcuts of --set, so that they are validated with the rest of the config
+		if *port != "" {
+			app.settings = append(app.settings, "server.port="+*port)
+		}
+		if *grpcPort != "" {
+			app.settings = append(app.settings, "server.grpc_port="+*grpcPort)
+		}
+		return serve(args)
+	}
+	return command
+}
+
+func configCommand(app *app) *cli.Command {
+	printCommand := &cli.Command{
+		Name:  "print",
+		Args:  "[flags]",
+		Short: "Prints the effective config, once every layer is applied, with the secrets redacted",
+	}
+	format := printCommand.Flags().String("format", "json", "output format")
+	printCommand.SetChoices("format", settings.Formats...)
+	printCommand.Run = app.with(func(config *config, args []string) int {
+		values, err := settings.Redacted(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			return exitError
+		}
+		var output []byte
+		switch *format {
+		case "json":
+			// "<redacted>" stays readable
+			var buffer bytes.Buffer
+			encoder := json.NewEncoder(&buffer)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "    ")
+			err = encoder.Encode(values)
+			output = buffer.Bytes()
+		case "yaml":
+			output, err = yaml.Marshal(values)
+		case "toml":
+			output, err = toml.Marshal(values)
+		default:
+			fmt.Fprintln(os.Stderr, "Error: unsupported format:", *format)
+			return exitInvalidInput
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			return exitError
+		}
+		os.Stdout.Write(output)
+		return cli.ExitOk
+	})
+
+	return (&cli.Command{
+		Name:  "config",
+		Short: "Inspects the config",
+		Long:  "Inspects the config, made of the defaults, the config file, the BOOKIT_* environment variables and the flags, in that order",
+	}).Add(printCommand)
+}
+
+func dbCommand(app *app) *cli.Command {
+	setup := &cli.Command{
+		Name:  "setup",
+		Short: "Creates the DB, needs to run once before the server runs the first time",
+		Run: app.with(func(config *config, args []string) int {
+			if err := SetupDatabase(config); err != nil {
+				fmt.Fprintln(os.Stderr, "Error setting up database: ", err)
+				return exitSetupError
+			}
+			fmt.Println("DB Setup Complete")
+			return cli.ExitOk
+		}),
+	}
+
+	migrate := &cli.Command{
+		Name:  "migrate",
+		Short: "Applies the schema changes the DB is missing, the server also does on start",
+		Run: app.with(func(config *config, args []string) int {
+			if err := checkDB(config.Db.Name, config.Db.Path); err != nil {
+				fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+				return exitError
+			}
+			db, err := database.ConnectDb(config.Db.Name, config.Db.Path, config.Db.Options)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error connecting to database: ", err)
+				return exitError
+			}
+			defer database.Close(db)
+			from, err := database.GetSchemaVersion(db)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error reading schema version: ", err)
+				return exitError
+			}
+			if err := database.Migrate(db); err != nil {
+				fmt.Fprintln(os.Stderr, "Error migrating database: ", err)
+				return exitError
+			}
+			if from == database.SchemaVersion {
+				fmt.Println("DB is up to date, schema version", from)
+			} else {
+				fmt.Printf("Migrated DB from schema version %d to %d\n", from, database.SchemaVersion)
+			}
+			return cli.ExitOk
+		}),
+	}
+
+	backupCommand := &cli.Command{
+		Name:  "backup",
+		Args:  "[flags]",
+		Short: "Writes a compressed and checksummed copy of the DB, safe while the server runs",
+		Long:  "Writes a compressed and checksummed copy of the DB to the backup directory, safe while the server runs, then removes the backups over backup.keep",
+	}
+	dir := backupCommand.Flags().String("dir", "", "backup directory, overrides backup.dir")
+	compression := backupCommand.Flags().String("compression", "", "compression of the backup, overrides backup.compression")
+	backupCommand.SetChoices("compression", backup.Compressions...)
+	runBackup := app.with(func(config *config, args []string) int {
+		db, err := openDb(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+			return exitError
+		}
+		defer database.Close(db)
+		info, err := backup.Create(db, config.Backup)
+		if info.Name != "" {
+			fmt.Printf("Backed up DB to %s (%d bytes, sha256 %s)\n", filepath.Join(config.Backup.Dir, info.Name), info.Size, info.Sha256)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error backing up database: ", err)
+			return exitError
+		}
+		return cli.ExitOk
+	})
+	backupCommand.Run = func(args []string) int {
+		if *dir != "" {
+			app.settings = append(app.settings, "backup.dir="+*dir)
+		}
+		if *compression != "" {
+			app.settings = append(app.settings, "backup.compression="+*compression)
+		}
+		return runBackup(args)
+	}
+
+	restore := &cli.Command{
+		Name:  "restore",
+		Args:  "[flags] file",
+		Short: "Replaces the DB with a backup, once it is verified",
+		Long: "Replaces the DB with a backup once its checksum, its integrity and its schema version are verified, then migrates it\n" +
+			"Stop the server first, the replaced DB is kept next to it as <file>.before-restore",
+	}
+	noChecksum := restore.Flags().Bool("no-checksum", false, "restores a backup without a .sha256 file, its integrity is still checked")
+	restore.Run = app.with(func(config *config, args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Error: restore expects exactly one backup")
+			return cli.ExitUsage
+		}
+		dbFile := config.Db.Path + config.Db.Name
+		version, err := backup.Restore(args[0], dbFile, !*noChecksum)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error restoring database: ", err)
+			if _, statErr := os.Stat(args[0]); statErr == nil && errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintln(os.Stderr, "The backup has no .sha256 file, --no-checksum restores it without one")
+			}
+			if errors.Is(err, backup.ErrChecksumMismatch) || errors.Is(err, backup.ErrCorrupt) || errors.Is(err, backup.ErrNewerSchema) {
+				return exitInvalidInput
+			}
+			return exitError
+		}
+		fmt.Printf("Restored %s to %s, schema version %d\n", args[0], dbFile, version)
+		if _, err := os.Stat(dbFile + ".before-restore"); err == nil {
+			fmt.Println("The replaced DB is kept as", dbFile+".before-restore")
+		}
+
+		db, err := openDb(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error migrating the restored database: ", err)
+			return exitError
+		}
+		database.Close(db)
+		if version < database.SchemaVersion {
+			fmt.Printf("Migrated the restored DB from schema version %d to %d\n", version, database.SchemaVersion)
+		}
+		return cli.ExitOk
+	})
+
+	return (&cli.Command{Name: "db", Short: "Sets up, migrates, backs up and restores the DB"}).Add(setup, migrate, backupCommand, restore)
+}
+
+func userCommand(app *app) *cli.Command {
+	add := &cli.Command{Name: "add", Args: "[flags] name", Short: "Adds a user and prints its API token"}
+	role := add.Flags().String("role", models.RoleStaff, "role of the user")
+	add.SetChoices("role", models.RoleAdmin, models.RoleStaff)
+	add.Run = app.with(func(config *config, args []string) int {
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			fmt.Fprintln(os.Stderr, "Error: user add expects exactly one name")
+			return cli.ExitUsage
+		}
+		if *role != models.RoleAdmin && *role != models.RoleStaff {
+			fmt.Fprintln(os.Stderr, "Error: unknown role:", *role)
+			return exitInvalidInput
+		}
+		db, err := openDb(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+			return exitError
+		}
+		defer database.Close(db)
+
+		token, err := utils.NewToken()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error generating token: ", err)
+			return exitError
+		}
+		user := models.User{Name: strings.TrimSpace(args[0]), Role: *role, CreatedAt: time.Now().UTC()}
+		if _, err := database.AddUser(db, user, utils.HashToken(token)); err != nil {
+			if errors.Is(err, database.ErrUserExists) {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return exitInvalidInput
+			}
+			fmt.Fprintln(os.Stderr, "Error adding user: ", err)
+			return exitError
+		}
+		// only the hash is stored, the token can't be shown again
+		fmt.Fprintf(os.Stderr, "Added %s user %s, its API token is only shown once:\n", user.Role, user.Name)
+		fmt.Println(token)
+		return cli.ExitOk
+	})
+
+	return (&cli.Command{Name: "user", Short: "Manages the users of the API"}).Add(add)
+}
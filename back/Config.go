@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	"github.com/mimminou/BookIT-ByFood/back/epub"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/settings"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/webhooks"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+/**
+The config is layered, each layer overrides the settings the previous ones set:
+the defaults, the config file (JSON, YAML or TOML), the BOOKIT_* environment variables, then the flags
+A setting has the same name everywhere, e.g. url_fetch.max_hops, BOOKIT_URL_FETCH_MAX_HOPS and --set url_fetch.max_hops=5
+**/
+
+// prefix of the environment variables of the settings, BOOKIT_CONFIG names the config file
+const envPrefix = "BOOKIT"
+
+type server_config struct {
+	Port uint16 `json:"port"`
+	// the gRPC server is not started when 0
+	GrpcPort uint16 `json:"grpc_port"`
+}
+
+type db_config struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// connections of the server to the DB, its keys are in the same section
+	database.Options
+}
+
+type log_config struct {
+	// lowest level of the logs written to stderr, one of logLevels
+	Level string `json:"level"`
+}
+
+type url_rules_config struct {
+	// rule file of the URL cleaner, the default rules are used when empty
+	Path string `json:"path"`
+	// how often the rule file is checked for changes, not watched when 0
+	ReloadSeconds int `json:"reload_seconds"`
+}
+
+type config struct {
+	Server   server_config    `json:"server"`
+	Db       db_config        `json:"database"`
+	Log      log_config       `json:"log"`
+	UrlRules url_rules_config `json:"url_rules"`
+	// limits of POST /url/batch
+	UrlBatch services.BatchLimits `json:"url_batch"`
+	// client of the URL operations that fetch the URL (resolve, html-canonical)
+	UrlFetch urlfetch.Options `json:"url_fetch"`
+	// short links of /links and /l
+	ShortLinks services.ShortLinkOptions `json:"short_links"`
+	// backups of the DB, made by the server, db backup and POST /admin/backups
+	Backup backup.Options `json:"backup"`
+	// how long the deleted books stay in the trash
+	Trash services.TrashOptions `json:"trash"`
+	// dispatcher of the webhook deliveries
+	Webhooks webhooks.Options `json:"webhooks"`
+	// event log and streams of GET /events
+	Events events.Options `json:"events"`
+	// where the files of the books are kept, e.g. their covers
+	Storage storage.Options `json:"storage"`
+	// limits of the cover uploads
+	Covers covers.Options `json:"covers"`
+	// limits of the EPUB uploads
+	Epubs epub.Options `json:"epubs"`
+	// catalogue the books are filled out of, POST /books/enrich and /books/{id}/enrich
+	Enrichment enrich.Options `json:"enrichment"`
+}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// the first layer, what a config file doesn't set
+func defaultConfig() *config {
+	return &config{
+		Server:     server_config{Port: 8046},
+		Db:         db_config{Name: "testdb.sqlite", Path: "./DB/", Options: database.DefaultOptions},
+		Log:        log_config{Level: "info"},
+		UrlBatch:   services.DefaultBatchLimits,
+		UrlFetch:   urlfetch.DefaultOptions,
+		ShortLinks: services.DefaultShortLinkOptions,
+		Backup:     backup.DefaultOptions,
+		Trash:      services.DefaultTrashOptions,
+		Webhooks:   webhooks.DefaultOptions,
+		Events:     events.DefaultOptions,
+		Storage:    storage.DefaultOptions,
+		Covers:     covers.DefaultOptions,
+		Epubs:      epub.DefaultOptions,
+		Enrichment: enrich.DefaultOptions,
+	}
+}
+
+// reads the config file onto the config, its format is picked by its extension
+func readConfig(filename string, config *config) error {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return settings.Decode(filename, bytes, config)
+}
+
+// validate reports every invalid setting, not only the first one
+func (config *config) validate() error {
+	var problems []string
+	invalid := func(key, format string, args ...any) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+	const notNegative = "must not be negative, 0 uses the default"
+
+	if config.Server.Port == 0 {
+		invalid("server.port", "must be set")
+	}
+	if config.Server.GrpcPort != 0 && config.Server.GrpcPort == config.Server.Port {
+		invalid("server.grpc_port", "must differ from server.port, or be 0 to disable the gRPC server")
+	}
+	if config.Db.Name == "" {
+		invalid("database.name", "must be set")
+	}
+	if !slices.Contains(database.JournalModes, config.Db.JournalMode) {
+		invalid("database.journal_mode", "must be one of %s, got %q", strings.Join(database.JournalModes, ", "), config.Db.JournalMode)
+	}
+	if !slices.Contains(database.SynchronousLevels, config.Db.Synchronous) {
+		invalid("database.synchronous", "must be one of %s, got %q", strings.Join(database.SynchronousLevels, ", "), config.Db.Synchronous)
+	}
+	if config.Db.BusyTimeoutMs < 0 {
+		invalid("database.busy_timeout_ms", "must not be negative, 0 fails at once on a locked DB")
+	}
+	if config.Db.MaxReaders < 1 {
+		invalid("database.max_readers", "must be at least 1")
+	}
+	if !slices.Contains(logLevels, config.Log.Level) {
+		invalid("log.level", "must be one of %s, got %q", strings.Join(logLevels, ", "), config.Log.Level)
+	}
+	if config.UrlRules.Path != "" {
+		if _, err := os.Stat(config.UrlRules.Path); err != nil {
+			invalid("url_rules.path", "%v", err)
+		}
+	}
+	if config.UrlRules.ReloadSeconds < 0 {
+		invalid("url_rules.reload_seconds", "must not be negative, 0 disables the reloads")
+	}
+	if config.UrlBatch.MaxItems < 0 {
+		invalid("url_batch.max_items", notNegative)
+	}
+	if config.UrlBatch.MaxBodyBytes < 0 {
+		invalid("url_batch.max_body_bytes", notNegative)
+	}
+	if config.UrlBatch.Workers < 0 {
+		invalid("url_batch.workers", notNegative)
+	}
+	if config.UrlFetch.MaxHops < 0 {
+		invalid("url_fetch.max_hops", notNegative)
+	}
+	if config.UrlFetch.HopTimeoutSeconds < 0 {
+		invalid("url_fetch.hop_timeout_seconds", notNegative)
+	}
+	if config.UrlFetch.MaxBodyBytes < 0 {
+		invalid("url_fetch.max_body_bytes", notNegative)
+	}
+	// slugs shorter than 3 characters would run out quickly, and custom slugs can't be either
+	if length := config.ShortLinks.SlugLength; length != 0 && (length < 3 || length > 64) {
+		invalid("short_links.slug_length", "must be between 3 and 64, got %d", length)
+	}
+	if config.ShortLinks.BaseUrl != "" {
+		if base, err := url.Parse(config.ShortLinks.BaseUrl); err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			invalid("short_links.base_url", "must be an http or https URL, got %q", config.ShortLinks.BaseUrl)
+		}
+	}
+	if config.Backup.Dir == "" {
+		invalid("backup.dir", "must be set")
+	}
+	if config.Backup.IntervalMinutes < 0 {
+		invalid("backup.interval_minutes", "must not be negative, 0 disables the scheduled backups")
+	}
+	if config.Backup.Keep < 0 {
+		invalid("backup.keep", "must not be negative, 0 keeps every backup")
+	}
+	if !slices.Contains(backup.Compressions, config.Backup.Compression) {
+		invalid("backup.compression", "must be one of %s, got %q", strings.Join(backup.Compressions, ", "), config.Backup.Compression)
+	}
+	if config.Trash.RetentionDays < 0 {
+		invalid("trash.retention_days", "must not be negative, 0 keeps the deleted books until they are purged by hand")
+	}
+	if config.Trash.RetentionDays > 0 && config.Trash.PurgeIntervalMinutes <= 0 {
+		invalid("trash.purge_interval_minutes", "must be positive when trash.retention_days is set")
+	}
+	if config.Webhooks.PollIntervalSeconds < 0 {
+		invalid("webhooks.poll_interval_seconds", "must not be negative, 0 stops the deliveries")
+	}
+	if config.Webhooks.MaxAttempts < 0 {
+		invalid("webhooks.max_attempts", notNegative)
+	}
+	if config.Webhooks.InitialBackoffSeconds < 0 {
+		invalid("webhooks.initial_backoff_seconds", notNegative)
+	}
+	if config.Webhooks.MaxBackoffSeconds < 0 {
+		invalid("webhooks.max_backoff_seconds", notNegative)
+	}
+	if config.Webhooks.TimeoutSeconds < 0 {
+		invalid("webhooks.timeout_seconds", notNegative)
+	}
+	if config.Webhooks.Workers < 0 {
+		invalid("webhooks.workers", notNegative)
+	}
+	if config.Events.BufferSize < 0 {
+		invalid("events.buffer_size", notNegative)
+	}
+	if config.Events.HeartbeatSeconds < 0 {
+		invalid("events.heartbeat_seconds", notNegative)
+	}
+	if config.Events.ClientQueue < 0 {
+		invalid("events.client_queue", notNegative)
+	}
+	if !slices.Contains(storage.Backends, config.Storage.Backend) {
+		invalid("storage.backend", "must be one of %s, got %q", strings.Join(storage.Backends, ", "), config.Storage.Backend)
+	}
+	if config.Storage.Backend == "local" && config.Storage.Dir == "" {
+		invalid("storage.dir", "must be set for the local backend")
+	}
+	if config.Storage.Backend == "s3" {
+		if endpoint, err := url.Parse(config.Storage.S3.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			invalid("storage.s3.endpoint", "must be an http or https URL, got %q", config.Storage.S3.Endpoint)
+		}
+		if config.Storage.S3.Bucket == "" {
+			invalid("storage.s3.bucket", "must be set for the s3 backend")
+		}
+		if config.Storage.S3.Region == "" {
+			invalid("storage.s3.region", "must be set for the s3 backend")
+		}
+		if config.Storage.S3.AccessKeyId == "" || config.Storage.S3.SecretAccessKey == "" {
+			invalid("storage.s3.access_key_id", "must be set for the s3 backend, with storage.s3.secret_access_key")
+		}
+	}
+	if config.Covers.MaxBytes < 0 {
+		invalid("covers.max_bytes", notNegative)
+	}
+	if config.Covers.MaxPixels < 0 {
+		invalid("covers.max_pixels", notNegative)
+	}
+	if quality := config.Covers.JpegQuality; quality < 0 || quality > 100 {
+		invalid("covers.jpeg_quality", "must be between 1 and 100, 0 uses the default, got %d", quality)
+	}
+	if config.Epubs.MaxBytes < 0 {
+		invalid("epubs.max_bytes", notNegative)
+	}
+	if config.Epubs.MaxEntries < 0 {
+		invalid("epubs.max_entries", notNegative)
+	}
+	if config.Epubs.MaxUncompressedBytes < 0 {
+		invalid("epubs.max_uncompressed_bytes", notNegative)
+	}
+	if !slices.Contains(enrich.Providers, config.Enrichment.Provider) {
+		invalid("enrichment.provider", "must be one of %s, got %q", strings.Join(enrich.Providers, ", "), config.Enrichment.Provider)
+	}
+	if config.Enrichment.BaseUrl != "" {
+		if base, err := url.Parse(config.Enrichment.BaseUrl); err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			invalid("enrichment.base_url", "must be an http or https URL, empty for the public API, got %q", config.Enrichment.BaseUrl)
+		}
+	}
+	if config.Enrichment.TimeoutSeconds < 0 {
+		invalid("enrichment.timeout_seconds", notNegative)
+	}
+	if config.Enrichment.CacheMinutes < 0 {
+		invalid("enrichment.cache_minutes", notNegative)
+	}
+	if config.Enrichment.CacheEntries < 0 {
+		invalid("enrichment.cache_entries", notNegative)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
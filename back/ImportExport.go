@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/cli"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/formats"
+	"io"
+	"os"
+)
+
+// export command, writes the catalogue to a file or stdout
+func exportCommand(app *app) *cli.Command {
+	command := &cli.Command{Name: "export", Args: "[flags]", Short: "Exports the catalogue to a file or stdout"}
+	flags := command.Flags()
+	format := flags.String("format", "csv", "export format")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	title := flags.String("title", "", "only export books whose title contains this")
+	author := flags.String("author", "", "only export books whose author contains this")
+	from := flags.String("from", "", "only export books published on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only export books published on or before this date (YYYY-MM-DD)")
+	command.SetChoices("format", formats.ExportFormats...)
+	command.Run = app.with(func(config *config, args []string) int {
+		return runExport(config, args, *format, *output, database.BookFilter{Title: *title, Author: *author, FromDate: *from, ToDate: *to})
+	})
+	return command
+}
+
+// returns the exit code
+func runExport(config *config, args []string, format, output string, filter database.BookFilter) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: export takes no arguments")
+		return cli.ExitUsage
+	}
+	if !formats.IsExportFormat(format) {
+		fmt.Fprintln(os.Stderr, "Error: unsupported export format:", format)
+		return exitInvalidInput
+	}
+
+	db, err := openDb(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+		return exitError
+	}
+	defer database.Close(db)
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating output file: ", err)
+			return exitError
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer, err := formats.NewBookWriter(format, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error exporting books: ", err)
+		return exitError
+	}
+	if err := database.StreamBooks(db, filter, writer.Write); err != nil {
+		fmt.Fprintln(os.Stderr, "Error exporting books: ", err)
+		return exitError
+	}
+	if err := writer.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error exporting books: ", err)
+		return exitError
+	}
+	return cli.ExitOk
+}
+
+// actor of the changes made from the command line, in the audit log
+const cliActor = "cli"
+
+// import command, reads a spreadsheet or MARC file and adds its valid rows to the catalogue
+// the report is printed as json on stdout
+func importCommand(app *app) *cli.Command {
+	command := &cli.Command{Name: "import", Args: "[flags] file", Short: "Imports books from a spreadsheet or MARC file"}
+	flags := command.Flags()
+	format := flags.String("format", "", "import format, guessed from the file extension when missing")
+	mappingSpec := flags.String("map", "", "column mapping, e.g. title=Book Title,author=Writer")
+	dryRun := flags.Bool("dry-run", false, "validate and preview without writing to the DB")
+	command.SetChoices("format", "csv", "xlsx", "marc", "marcxml")
+	command.Run = app.with(func(config *config, args []string) int {
+		return runImport(config, args, *format, *mappingSpec, *dryRun)
+	})
+	return command
+}
+
+// returns the exit code
+func runImport(config *config, args []string, format, mappingSpec string, dryRun bool) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: import expects exactly one file")
+		return cli.ExitUsage
+	}
+	filename := args[0]
+
+	if format == "" {
+		format = formats.FormatFromFilename(filename)
+		if format == "" {
+			fmt.Fprintln(os.Stderr, "Error: could not guess the format of", filename, "please use -format")
+			return exitInvalidInput
+		}
+	}
+	mapping, err := formats.ParseMapping(mappingSpec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		return exitInvalidInput
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file: ", err)
+		return exitError
+	}
+	rows, err := formats.ReadBooks(format, data, mapping)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file: ", err)
+		return exitError
+	}
+	report := formats.NewImportReport(rows, dryRun)
+
+	if !dryRun && len(report.Books) > 0 {
+		db, err := openDb(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+			return exitError
+		}
+		defer database.Close(db)
+
+		// recorded in the audit log and the webhook outbox like the imports of the API, the server sends them
+		ids, err := database.AddBooksAudited(db, report.Books, database.Change{Actor: cliActor})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error importing books: ", err)
+			return exitError
+		}
+		for i, id := range ids {
+			report.Books[i].Book_Id = id
+		}
+		report.Imported = len(ids)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	fmt.Fprintf(os.Stderr, "%d rows read, %d imported, %d rejected\n", report.Total, report.Imported, report.Failed)
+	if len(report.Unmapped) > 0 {
+		fmt.Fprintf(os.Stderr, "%d MARC tags were not mapped to a book field, see unmapped_fields\n", len(report.Unmapped))
+	}
+	return cli.ExitOk
+}
@@ -2,48 +2,41 @@ package main
 
 import (
 	"database/sql"
+	_ "embed"
 	_ "github.com/glebarez/go-sqlite"
-	"log"
+	"github.com/mimminou/BookIT-ByFood/back/database"
 	"os"
 )
 
-// SetupDB Will create the necessary sqlite DB file with the provided schema
-func SetupDatabase() error {
-
-	config, err := readConfig("config.json")
-	if err != nil {
-		if err == os.ErrNotExist {
-			log.Fatalln("Error reading config.json: File does not exist")
-		}
-		log.Fatalln("Error reading config.json:", err)
-	}
+// the initial schema is built in, so that a DB can be set up anywhere --db points to
+//
+//go:embed DB/schema.sql
+var schema string
 
+// SetupDB Will create the necessary sqlite DB file with the provided schema
+func SetupDatabase(config *config) error {
 	path := config.Db.Path
 	dbname := config.Db.Name
 
-	//Load the DB Schema
-	schema, err := os.ReadFile(path + "schema.sql")
-	if err != nil {
-		log.Fatal(err)
-		return err
+	// the schema only creates what is missing, setting up an existing DB is harmless
+	if path != "" {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
 	}
 
 	//Connect to Sqlite DB, if it doesn't exist it will be created
 	db, err := sql.Open("sqlite", path+dbname)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	defer db.Close()
 
 	//Create DB Structure from Schema
-
-	_, err = db.Exec(string(schema))
-	if err != nil {
-		log.Fatalln(err)
+	if _, err := db.Exec(schema); err != nil {
+		return err
 	}
 
-	//DB Setup Complete
-	log.Println("DB Setup Complete")
-	os.Exit(0)
-	return nil
+	//Apply the changes made to the schema since
+	return database.Migrate(db)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/cli"
+	"github.com/mimminou/BookIT-ByFood/back/sitemap"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// sitemap command, audits a sitemap file with the URL cleaner and writes the corrected sitemap
+// the report is printed as json on stdout
+func sitemapCommand(app *app) *cli.Command {
+	command := &cli.Command{Name: "sitemap", Args: "[flags] file", Short: "Audits a sitemap and writes the corrected one"}
+	flags := command.Flags()
+	operation := flags.String("operation", "redirection", "operation of the URL cleaner run on every <loc>")
+	outputDir := flags.String("o", "", "directory the corrected sitemap is written to, not written when empty")
+	baseUrl := flags.String("base-url", "", "URL the parts of a split sitemap are published at, needed to split it")
+	command.Run = app.with(func(config *config, args []string) int {
+		return runSitemap(config, args, *operation, *outputDir, *baseUrl)
+	})
+	return command
+}
+
+// returns the exit code
+func runSitemap(config *config, args []string, operation, outputDir, baseUrl string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: sitemap expects exactly one file")
+		return cli.ExitUsage
+	}
+
+	rules, err := loadUrlRules(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading URL rules: ", err)
+		return exitError
+	}
+	if !rules.HasOperation(operation) {
+		fmt.Fprintln(os.Stderr, "Error: unknown operation:", operation)
+		return exitInvalidInput
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file: ", err)
+		return exitError
+	}
+	defer file.Close()
+	parsed, err := sitemap.Parse(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file: ", err)
+		return exitError
+	}
+	report, corrected, err := sitemap.Audit(context.Background(), parsed, rules, operation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error auditing sitemap: ", err)
+		return exitError
+	}
+
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating output directory: ", err)
+			return exitError
+		}
+		names, err := sitemap.Write(corrected, sitemap.DefaultLimits, baseUrl, func(name string) (io.WriteCloser, error) {
+			return os.Create(filepath.Join(outputDir, name))
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing sitemap: ", err)
+			return exitError
+		}
+		fmt.Fprintf(os.Stderr, "corrected sitemap written to %s: %v\n", outputDir, names)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	fmt.Fprintf(os.Stderr, "%d entries read, %d kept, %d issues\n", report.Entries, report.Kept, len(report.Issues))
+	return cli.ExitOk
+}
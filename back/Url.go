@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/cli"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlcleaner"
+	"io"
+	"os"
+	"strings"
+)
+
+// url command, processes the URLs given as arguments, or read from stdin one per line, like POST /url
+// failures are reported on stderr
+func urlCommand(app *app) *cli.Command {
+	command := &cli.Command{Name: "url", Args: "[flags] [url...]", Short: "Processes URLs with the URL cleaner"}
+	flags := command.Flags()
+	operation := flags.String("op", "all", "operation run on the URLs, see GET /url/operations")
+	format := flags.String("format", "plain", "output format")
+	command.SetChoices("format", urlcleaner.OutputFormats...)
+	command.Run = app.with(func(config *config, args []string) int {
+		return runUrl(config, args, *operation, *format)
+	})
+	return command
+}
+
+// returns the exit code
+func runUrl(config *config, args []string, operation, format string) int {
+
+	writer, err := urlcleaner.NewResultWriter(format, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		return cli.ExitUsage
+	}
+	rules, err := loadUrlRules(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading URL rules: ", err)
+		return exitError
+	}
+	if !rules.HasOperation(operation) {
+		fmt.Fprintln(os.Stderr, "Error: unknown operation:", operation)
+		return cli.ExitUsage
+	}
+
+	next := urlsFrom(args, os.Stdin)
+	exitCode := cli.ExitOk
+	for index := 0; ; index++ {
+		link, more := next()
+		if !more {
+			break
+		}
+		result := models.BatchResult{Index: index, Url: link, Operation: operation}
+		response, err := urlcleaner.Process(context.Background(), rules, models.RequestStruct{Url: link, Operation: operation})
+		switch urlcleaner.FailureOf(err) {
+		case urlcleaner.NoFailure:
+			result.ProcessedUrl = response.ProcessedUrl
+		case urlcleaner.Unreachable:
+			// a URL that could not be fetched takes precedence over an invalid one
+			exitCode = exitError
+		case urlcleaner.InvalidInput:
+			if exitCode == cli.ExitOk {
+				exitCode = exitInvalidInput
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			fmt.Fprintf(os.Stderr, "%s: %v\n", link, err)
+		}
+		if err := writer.Write(result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output: ", err)
+			return exitError
+		}
+	}
+	if err := writer.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing output: ", err)
+		return exitError
+	}
+	return exitCode
+}
+
+// iterates over the arguments, or over the lines of stdin when there are none, blank lines are skipped
+func urlsFrom(args []string, stdin io.Reader) func() (string, bool) {
+	if len(args) > 0 {
+		return func() (string, bool) {
+			if len(args) == 0 {
+				return "", false
+			}
+			link := args[0]
+			args = args[1:]
+			return link, true
+		}
+	}
+	scanner := bufio.NewScanner(stdin)
+	return func() (string, bool) {
+		for scanner.Scan() {
+			if link := strings.TrimSpace(scanner.Text()); link != "" {
+				return link, true
+			}
+		}
+		return "", false
+	}
+}
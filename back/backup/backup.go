@@ -0,0 +1,393 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+)
+
+/**
+Backups of the sqlite DB, safe while the server uses it: VACUUM INTO writes a consistent copy, which is then compressed and checksummed
+A backup is a file named bookit-<UTC time>.sqlite, or .sqlite.gz or .sqlite.zst, with a <file>.sha256 next to it in the format of sha256sum
+A restore checks the checksum, the integrity and the schema version of a backup before it replaces the DB
+**/
+
+// Options of the backups, the config section "backup"
+type Options struct {
+	// directory the backups are written to, and listed from
+	Dir string `json:"dir"`
+	// how often the server makes a backup, not scheduled when 0
+	IntervalMinutes int `json:"interval_minutes"`
+	// how many backups are kept, the oldest ones are removed after a new one is made, all are kept when 0
+	Keep int `json:"keep"`
+	// gzip, zstd or none
+	Compression string `json:"compression"`
+}
+
+var DefaultOptions = Options{Dir: "./DB/backups/", Keep: 7, Compression: "gzip"}
+
+// Compressions lists the values of Options.Compression
+var Compressions = []string{"gzip", "zstd", "none"}
+
+const (
+	prefix         = "bookit-"
+	extension      = ".sqlite"
+	gzipExtension  = ".gz"
+	zstdExtension  = ".zst"
+	checksumSuffix = ".sha256"
+	// names are written with microseconds, so that backups made within the same second don't collide
+	// parsing takes them, and the names of the backups made before, without
+	timeLayout = "20060102-150405"
+	nameLayout = timeLayout + ".000000"
+)
+
+var (
+	ErrNotFound         = errors.New("backup not found")
+	ErrChecksumMismatch = errors.New("backup does not match its checksum")
+	ErrCorrupt          = errors.New("backup failed the integrity check")
+	ErrNewerSchema      = errors.New("backup has a newer schema than this build supports")
+)
+
+// @Description	A backup of the DB
+type Info struct {
+	// @Property	name string true "File name, bookit-<UTC time>.sqlite, .sqlite.gz or .sqlite.zst"
+	Name string `json:"name"`
+	// @Property	size int true "Size of the file, in bytes"
+	Size int64 `json:"size"`
+	// @Property	sha256 string true "Checksum of the file, hex"
+	Sha256 string `json:"sha256"`
+	// @Property	created_at string true "Time of the backup, RFC 3339"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Create makes a backup of the DB in the directory of the options, then removes the backups over Keep
+func Create(db *sql.DB, options Options) (Info, error) {
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return Info{}, err
+	}
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	name := prefix + createdAt.Format(nameLayout) + extension
+	switch options.Compression {
+	case "gzip":
+		name += gzipExtension
+	case "zstd":
+		name += zstdExtension
+	}
+	path := filepath.Join(options.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return Info{}, fmt.Errorf("%s already exists", name)
+	}
+
+	// VACUUM INTO refuses to overwrite a file, and leaves a partial one when it fails
+	copyPath := filepath.Join(options.Dir, "."+prefix+createdAt.Format(nameLayout)+extension+".tmp")
+	os.Remove(copyPath)
+	defer os.Remove(copyPath)
+	if err := database.Backup(db, copyPath); err != nil {
+		return Info{}, err
+	}
+
+	size, checksum, err := writeFile(path, copyPath, options.Compression)
+	if err != nil {
+		os.Remove(path)
+		return Info{}, err
+	}
+	if err := os.WriteFile(path+checksumSuffix, []byte(checksum+"  "+name+"\n"), 0644); err != nil {
+		os.Remove(path)
+		return Info{}, err
+	}
+
+	info := Info{Name: name, Size: size, Sha256: checksum, CreatedAt: createdAt}
+	if options.Keep > 0 {
+		if err := Prune(options.Dir, options.Keep); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// writes the copy to path, compressed as given, returns the size and the checksum of what was written
+func writeFile(path, copyPath, compression string) (int64, string, error) {
+	source, err := os.Open(copyPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer source.Close()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{writer: io.MultiWriter(file, hash)}
+	var writer io.Writer = counter
+	var compressor io.WriteCloser
+	switch compression {
+	case "gzip":
+		compressor = gzip.NewWriter(counter)
+	case "zstd":
+		if compressor, err = zstd.NewWriter(counter); err != nil {
+			return 0, "", err
+		}
+	}
+	if compressor != nil {
+		writer = compressor
+	}
+	if _, err := io.Copy(writer, source); err != nil {
+		return 0, "", err
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return 0, "", err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return 0, "", err
+	}
+	return counter.count, hex.EncodeToString(hash.Sum(nil)), file.Close()
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (counter *countingWriter) Write(p []byte) (int, error) {
+	n, err := counter.writer.Write(p)
+	counter.count += int64(n)
+	return n, err
+}
+
+// List returns the backups of the directory, the newest first
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Info{}, nil
+		}
+		return nil, err
+	}
+	backups := []Info{}
+	for _, entry := range entries {
+		createdAt, ok := parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		checksum, _ := readChecksum(filepath.Join(dir, entry.Name()))
+		backups = append(backups, Info{Name: entry.Name(), Size: info.Size(), Sha256: checksum, CreatedAt: createdAt})
+	}
+	// by time, the names of the backups made before microseconds sort after the ones made since
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Find returns the path of a backup of the directory, names that aren't backups are never looked up
+func Find(dir, name string) (string, error) {
+	if _, ok := parseName(name); !ok || filepath.Base(name) != name {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// Prune removes the oldest backups of the directory, keeping the newest ones
+func Prune(dir string, keep int) error {
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for index := keep; index < len(backups); index++ {
+		path := filepath.Join(dir, backups[index].Name)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		os.Remove(path + checksumSuffix)
+	}
+	return nil
+}
+
+// Schedule makes a backup every IntervalMinutes until the context is done, report is called after each one
+func Schedule(ctx context.Context, db *sql.DB, options Options, report func(Info, error)) {
+	if options.IntervalMinutes <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(options.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report(Create(db, options))
+		}
+	}
+}
+
+// bookit-<time>.sqlite, bookit-<time>.sqlite.gz or bookit-<time>.sqlite.zst
+func parseName(name string) (time.Time, bool) {
+	stamp, found := strings.CutPrefix(name, prefix)
+	if !found {
+		return time.Time{}, false
+	}
+	stamp, found = strings.CutSuffix(strings.TrimSuffix(strings.TrimSuffix(stamp, gzipExtension), zstdExtension), extension)
+	if !found {
+		return time.Time{}, false
+	}
+	createdAt, err := time.Parse(timeLayout, stamp)
+	return createdAt, err == nil
+}
+
+// the checksum of the .sha256 file next to a backup
+func readChecksum(path string) (string, error) {
+	content, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		return "", err
+	}
+	checksum, _, _ := strings.Cut(strings.TrimSpace(string(content)), " ")
+	return checksum, nil
+}
+
+// Verify checks a backup against its checksum, a backup without a .sha256 file can't be verified
+func Verify(path string) error {
+	expected, err := readChecksum(path)
+	if err != nil {
+		return fmt.Errorf("reading checksum: %w", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != strings.ToLower(expected) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Restore replaces the DB file with a backup, once the backup is verified, against its checksum when verifyChecksum is set
+// the server must not be running, the replaced DB is kept next to it as <file>.before-restore
+// returns the schema version of the backup, the server migrates it up on start
+func Restore(path, dbFile string, verifyChecksum bool) (int, error) {
+	if verifyChecksum {
+		if err := Verify(path); err != nil {
+			return 0, err
+		}
+	}
+
+	// decompressed next to the DB, so that the final rename doesn't cross file systems
+	restored := dbFile + ".restore"
+	os.Remove(restored)
+	defer os.Remove(restored)
+	if err := decompress(path, restored); err != nil {
+		return 0, err
+	}
+
+	version, err := check(restored)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := os.Stat(dbFile); err == nil {
+		if err := os.Rename(dbFile, dbFile+".before-restore"); err != nil {
+			return 0, err
+		}
+	}
+	// files of the replaced DB's journal would be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbFile + suffix)
+	}
+	return version, os.Rename(restored, dbFile)
+}
+
+func decompress(path, destination string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	var reader io.Reader = source
+	switch {
+	case strings.HasSuffix(path, gzipExtension):
+		decompressor, err := gzip.NewReader(source)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	case strings.HasSuffix(path, zstdExtension):
+		decompressor, err := zstd.NewReader(source)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, reader); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// check runs sqlite's integrity check on a DB file and returns its schema version
+func check(path string) (int, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%w: %s", ErrCorrupt, result)
+	}
+	version, err := database.GetSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version > database.SchemaVersion {
+		return 0, fmt.Errorf("%w: version %d, this build supports %d", ErrNewerSchema, version, database.SchemaVersion)
+	}
+	return version, nil
+}
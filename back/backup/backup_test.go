@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/database"
+)
+
+// a DB file with the schema of this build and one book
+func testDb(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE Books (book_id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, author TEXT NOT NULL, num_pages INTEGER, pub_date DATE NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Books (title, author, pub_date) VALUES ('1984', 'George Orwell', '1949-06-08')`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countBooks(t *testing.T, path string) int {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Books").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	for _, compression := range Compressions {
+		t.Run("Testing "+compression, func(t *testing.T) {
+			dir := t.TempDir()
+			dbFile := filepath.Join(dir, "bookit.sqlite")
+			db := testDb(t, dbFile)
+			options := Options{Dir: filepath.Join(dir, "backups"), Compression: compression}
+
+			info, err := Create(db, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Log(info)
+			path := filepath.Join(options.Dir, info.Name)
+			if err := Verify(path); err != nil {
+				t.Fatal(err)
+			}
+			if stat, err := os.Stat(path); err != nil || stat.Size() != info.Size {
+				t.Errorf("expected %d bytes, got %v %v", info.Size, stat, err)
+			}
+
+			// a book added after the backup is gone once it is restored
+			db.Exec(`INSERT INTO Books (title, author, pub_date) VALUES ('Emma', 'Jane Austen', '1815-12-23')`)
+			db.Close()
+			version, err := Restore(path, dbFile, true)
+			if err != nil || version != database.SchemaVersion {
+				t.Fatalf("expected version %d, got %d %v", database.SchemaVersion, version, err)
+			}
+			if count := countBooks(t, dbFile); count != 1 {
+				t.Errorf("expected 1 book once restored, got %d", count)
+			}
+			if count := countBooks(t, dbFile+".before-restore"); count != 2 {
+				t.Errorf("expected the replaced DB to be kept with 2 books, got %d", count)
+			}
+		})
+	}
+}
+
+func TestCreateWithinTheSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	db := testDb(t, filepath.Join(dir, "bookit.sqlite"))
+	options := Options{Dir: filepath.Join(dir, "backups"), Compression: "zstd"}
+	first, err := Create(db, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Create(db, options)
+	if err != nil || second.Name == first.Name {
+		t.Fatalf("expected a second backup, got %+v %v", second, err)
+	}
+	if backups, _ := List(options.Dir); len(backups) != 2 || backups[0].Name != second.Name {
+		t.Errorf("expected the 2 backups, the newest first, got %+v", backups)
+	}
+}
+
+func TestRestoreChecks(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "bookit.sqlite")
+	db := testDb(t, dbFile)
+	info, err := Create(db, Options{Dir: dir, Compression: "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, info.Name)
+
+	t.Run("Testing a backup that doesn't match its checksum", func(t *testing.T) {
+		tampered := filepath.Join(dir, "tampered.sqlite.gz")
+		content, _ := os.ReadFile(path)
+		content[len(content)/2] ^= 0xff
+		os.WriteFile(tampered, content, 0644)
+		checksum, _ := os.ReadFile(path + checksumSuffix)
+		os.WriteFile(tampered+checksumSuffix, checksum, 0644)
+		if _, err := Restore(tampered, dbFile, true); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("expected %v, got %v", ErrChecksumMismatch, err)
+		}
+	})
+
+	t.Run("Testing a file that isn't a DB", func(t *testing.T) {
+		junk := filepath.Join(dir, "junk.sqlite")
+		os.WriteFile(junk, []byte("not a database, not a database, not a database, not a database, not a database"), 0644)
+		if _, err := Restore(junk, dbFile, false); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("expected %v, got %v", ErrCorrupt, err)
+		}
+		if _, err := Restore(junk, dbFile, true); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected a missing checksum, got %v", err)
+		}
+	})
+
+	t.Run("Testing a backup of a newer build", func(t *testing.T) {
+		newer := filepath.Join(dir, "newer.sqlite")
+		database.Backup(db, newer)
+		newerDb, _ := sql.Open("sqlite", newer)
+		newerDb.Exec(fmt.Sprintf("PRAGMA user_version = %d", database.SchemaVersion+1))
+		newerDb.Close()
+		if _, err := Restore(newer, dbFile, false); !errors.Is(err, ErrNewerSchema) {
+			t.Errorf("expected %v, got %v", ErrNewerSchema, err)
+		}
+	})
+
+	// none of the failed restores touched the DB
+	if _, err := os.Stat(dbFile + ".before-restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the DB to be left alone, got %v", err)
+	}
+	if count := countBooks(t, dbFile); count != 1 {
+		t.Errorf("expected 1 book, got %d", count)
+	}
+}
+
+func TestListAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"bookit-20240101-000000.sqlite.gz", "bookit-20240301-000000.250000.sqlite.zst", "bookit-20240201-000000.sqlite.gz", "notes.txt", "bookit-latest.sqlite", "bookit-20240301-000000.sqlite"}
+	for _, name := range names {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		os.WriteFile(filepath.Join(dir, name+checksumSuffix), []byte("abc  "+name+"\n"), 0644)
+	}
+
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 4 || backups[0].Name != names[1] || backups[1].Name != names[5] || backups[3].Name != names[0] || backups[0].Sha256 != "abc" {
+		t.Errorf("expected the 4 backups, the newest first, got %+v", backups)
+	}
+
+	if err := Prune(dir, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{names[0], names[0] + checksumSuffix} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be pruned, got %v", name, err)
+		}
+	}
+	if backups, _ := List(dir); len(backups) != 3 {
+		t.Errorf("expected 3 backups left, got %+v", backups)
+	}
+
+	for _, name := range []string{"notes.txt", "../backup.go", "bookit-20240101-000000.sqlite.gz"} {
+		if _, err := Find(dir, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected %v, got %v", name, ErrNotFound, err)
+		}
+	}
+	if path, err := Find(dir, names[1]); err != nil || path != filepath.Join(dir, names[1]) {
+		t.Errorf("expected %s, got %s %v", names[1], path, err)
+	}
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/**
+A small command line framework on top of the flag package
+Commands form a tree, a command either groups subcommands or runs, and may do both (the root runs the server)
+The flags of a command are also accepted by its subcommands, so global flags can go anywhere on the line
+Help and shell completion are generated from the tree, nothing is written by hand
+**/
+
+// exit codes of the framework itself, commands pick their own for the rest
+const (
+	ExitOk    = 0
+	ExitUsage = 3
+)
+
+// Command is a node of the command tree
+type Command struct {
+	Name string
+	// arguments that follow the flags, as shown in the usage line, e.g. "[flags] file"
+	Args string
+	// one line description, shown in the list of commands
+	Short string
+	// longer description, shown in the help of the command
+	Long        string
+	Subcommands []*Command
+	// runs the command with the arguments left after the flags and returns the exit code
+	// a command without Run prints its help when no subcommand is given
+	Run func(args []string) int
+
+	parent  *Command
+	flags   *flag.FlagSet
+	choices map[string][]string
+	// where help and errors are printed, stdout for the help and stderr for the errors when nil
+	Output io.Writer
+}
+
+// Flags are the flags of the command, defined like those of any FlagSet
+func (command *Command) Flags() *flag.FlagSet {
+	if command.flags == nil {
+		command.flags = flag.NewFlagSet(command.Name, flag.ContinueOnError)
+		command.flags.SetOutput(io.Discard)
+	}
+	return command.flags
+}
+
+// SetChoices lists the values a flag takes, for the help and the completion
+func (command *Command) SetChoices(flagName string, choices ...string) {
+	if command.choices == nil {
+		command.choices = map[string][]string{}
+	}
+	command.choices[flagName] = choices
+}
+
+// Add attaches subcommands, returns the command so that trees can be written inline
+func (command *Command) Add(subcommands ...*Command) *Command {
+	for _, subcommand := range subcommands {
+		subcommand.parent = command
+		command.Subcommands = append(command.Subcommands, subcommand)
+	}
+	return command
+}
+
+// Find returns the subcommand with the name, nil when there is none
+func (command *Command) Find(name string) *Command {
+	for _, subcommand := range command.Subcommands {
+		if subcommand.Name == name {
+			return subcommand
+		}
+	}
+	return nil
+}
+
+// Path is the names of the command and its parents, the root first
+func (command *Command) Path() string {
+	if command.parent == nil {
+		return command.Name
+	}
+	return command.parent.Path() + " " + command.Name
+}
+
+func (command *Command) root() *Command {
+	if command.parent == nil {
+		return command
+	}
+	return command.parent.root()
+}
+
+func (command *Command) stdout() io.Writer {
+	if root := command.root(); root.Output != nil {
+		return root.Output
+	}
+	return os.Stdout
+}
+
+func (command *Command) stderr() io.Writer {
+	if root := command.root(); root.Output != nil {
+		return root.Output
+	}
+	return os.Stderr
+}
+
+// Execute parses the arguments, given without the program name, and runs the command they lead to
+// the root answers "help [command...]" and "completion bash|zsh|fish" on top of its subcommands
+func (command *Command) Execute(args []string) int {
+	// the flags of the command and of its parents
+	flags := flag.NewFlagSet(command.Path(), flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	for current := command; current != nil; current = current.parent {
+		current.Flags().VisitAll(func(f *flag.Flag) {
+			if flags.Lookup(f.Name) == nil {
+				flags.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+	args, err := parse(flags, args, len(command.Subcommands) == 0)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			command.PrintHelp()
+			return ExitOk
+		}
+		fmt.Fprintf(command.stderr(), "Error: %v\n\n", err)
+		command.printHelp(command.stderr())
+		return ExitUsage
+	}
+
+	if len(command.Subcommands) > 0 && len(args) > 0 {
+		if subcommand := command.Find(args[0]); subcommand != nil {
+			return subcommand.Execute(args[1:])
+		}
+		if command.parent == nil {
+			switch args[0] {
+			case "help":
+				return command.help(args[1:])
+			case "completion":
+				return command.completion(args[1:])
+			}
+		}
+		if command.Run == nil {
+			fmt.Fprintf(command.stderr(), "Error: unknown command %q\n\n", strings.Join(append(strings.Fields(command.Path())[1:], args[0]), " "))
+			command.printHelp(command.stderr())
+			return ExitUsage
+		}
+	}
+	if command.Run == nil {
+		if len(args) > 0 {
+			fmt.Fprintf(command.stderr(), "Error: unexpected arguments %q\n\n", args)
+			command.printHelp(command.stderr())
+			return ExitUsage
+		}
+		command.PrintHelp()
+		return ExitOk
+	}
+	return command.Run(args)
+}
+
+// parse returns the arguments left after the flags
+// the flags of a command without subcommands may also follow its arguments, up to a "--"
+func parse(flags *flag.FlagSet, args []string, interspersed bool) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		consumed := len(args) - len(rest)
+		if !interspersed || len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// help [command...], prints the help of the command
+func (command *Command) help(path []string) int {
+	target := command
+	for _, name := range path {
+		if target = target.Find(name); target == nil {
+			fmt.Fprintf(command.stderr(), "Error: unknown command %q\n", strings.Join(path, " "))
+			return ExitUsage
+		}
+	}
+	target.PrintHelp()
+	return ExitOk
+}
+
+// PrintHelp prints the usage, the description, the subcommands and the flags of the command
+func (command *Command) PrintHelp() {
+	command.printHelp(command.stdout())
+}
+
+func (command *Command) printHelp(out io.Writer) {
+	usage := command.Path()
+	if len(command.Subcommands) > 0 {
+		usage += " <command>"
+	}
+	if command.Args != "" {
+		usage += " " + command.Args
+	}
+	fmt.Fprintf(out, "Usage: %s\n", usage)
+	if command.Long != "" {
+		fmt.Fprintf(out, "\n%s\n", command.Long)
+	} else if command.Short != "" {
+		fmt.Fprintf(out, "\n%s\n", command.Short)
+	}
+
+	if len(command.Subcommands) > 0 {
+		fmt.Fprintln(out, "\nCommands:")
+		width := 0
+		if command.parent == nil {
+			width = len("completion")
+		}
+		for _, subcommand := range command.Subcommands {
+			width = max(width, len(subcommand.Name))
+		}
+		for _, subcommand := range command.Subcommands {
+			fmt.Fprintf(out, "  %-*s  %s\n", width, subcommand.Name, subcommand.Short)
+		}
+		if command.parent == nil {
+			fmt.Fprintf(out, "  %-*s  %s\n", width, "help", "Prints the help of a command")
+			fmt.Fprintf(out, "  %-*s  %s\n", width, "completion", "Prints the completion script of bash, zsh or fish")
+		}
+	}
+
+	command.printFlags(out, "Flags", command)
+	for parent := command.parent; parent != nil; parent = parent.parent {
+		command.printFlags(out, "Flags of "+parent.Path(), parent)
+	}
+	if len(command.Subcommands) > 0 {
+		fmt.Fprintf(out, "\nRun '%s help <command>' for the help of a command.\n", command.root().Name)
+	}
+}
+
+func (command *Command) printFlags(out io.Writer, title string, owner *Command) {
+	var names []string
+	owner.Flags().VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "\n%s:\n", title)
+	for _, name := range names {
+		f := owner.Flags().Lookup(name)
+		kind, usage := flag.UnquoteUsage(f)
+		line := "  " + flagName(name)
+		if kind != "" {
+			line += " " + kind
+		}
+		fmt.Fprintf(out, "%-28s %s", line, usage)
+		if choices := owner.choices[name]; len(choices) > 0 {
+			fmt.Fprintf(out, " (%s)", strings.Join(choices, "|"))
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			fmt.Fprintf(out, " (default %q)", f.DefValue)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// single letter flags take one dash, the others two, both are accepted
+func flagName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
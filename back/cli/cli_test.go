@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// a tree like the one of the server: a root with a global flag, a group and a leaf with arguments
+func testTree(out *bytes.Buffer, ran *[]string, level *string) *Command {
+	root := &Command{Name: "tool", Short: "Test tool", Output: out}
+	root.Flags().StringVar(level, "log-level", "info", "log level")
+	root.SetChoices("log-level", "debug", "info")
+
+	add := &Command{Name: "add", Args: "[flags] name", Short: "Adds a user"}
+	role := add.Flags().String("role", "staff", "role of the user")
+	add.SetChoices("role", "admin", "staff")
+	add.Run = func(args []string) int {
+		*ran = append([]string{"add", *role}, args...)
+		return ExitOk
+	}
+	return root.Add((&Command{Name: "user", Short: "Manages users"}).Add(add))
+}
+
+func TestExecute(t *testing.T) {
+	for _, test := range []struct {
+		args     []string
+		code     int
+		ran      string
+		level    string
+		contains string
+	}{
+		{[]string{"user", "add", "alice"}, ExitOk, "add staff alice", "info", ""},
+		{[]string{"--log-level", "debug", "user", "add", "--role", "admin", "alice"}, ExitOk, "add admin alice", "debug", ""},
+		{[]string{"user", "add", "alice", "--role", "admin", "--log-level", "debug"}, ExitOk, "add admin alice", "debug", ""},
+		{[]string{"user", "add", "--", "--role"}, ExitOk, "add staff --role", "info", ""},
+		{[]string{"user"}, ExitOk, "", "info", "Usage: tool user <command>"},
+		{[]string{"user", "remove"}, ExitUsage, "", "info", `unknown command "user remove"`},
+		{[]string{"user", "add", "--nope"}, ExitUsage, "", "info", "flag provided but not defined"},
+		{[]string{"help", "user", "add"}, ExitOk, "", "info", "Usage: tool user add [flags] name"},
+		{[]string{"user", "add", "-h"}, ExitOk, "", "info", "role of the user (admin|staff)"},
+		{[]string{"help", "nope"}, ExitUsage, "", "info", "unknown command"},
+	} {
+		t.Run("Testing "+strings.Join(test.args, " "), func(t *testing.T) {
+			var out bytes.Buffer
+			var ran []string
+			var level string
+			code := testTree(&out, &ran, &level).Execute(test.args)
+			if code != test.code {
+				t.Errorf("expected exit code %d, got %d", test.code, code)
+			}
+			if got := strings.Join(ran, " "); got != test.ran {
+				t.Errorf("expected run %q, got %q", test.ran, got)
+			}
+			if level != test.level {
+				t.Errorf("expected log level %q, got %q", test.level, level)
+			}
+			if !strings.Contains(out.String(), test.contains) {
+				t.Errorf("expected output containing %q, got %q", test.contains, out.String())
+			}
+			t.Log(out.String())
+		})
+	}
+}
+
+func TestHelp(t *testing.T) {
+	var out bytes.Buffer
+	var ran []string
+	var level string
+	testTree(&out, &ran, &level).Execute([]string{"help", "user", "add"})
+	for _, expected := range []string{"Adds a user", "Flags:", "--role string", "Flags of tool:", "--log-level string", `(default "info")`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected help containing %q, got %q", expected, out.String())
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for shell, expected := range map[string][]string{
+		"bash": {`"") echo "user help completion" ;;`, `"user add") echo "--log-level --role" ;;`, `"user add --role") echo "admin staff" ;;`, "complete -o filenames -F _tool tool"},
+		"zsh":  {"bashcompinit", "complete -o filenames -F _tool tool"},
+		"fish": {"complete -c tool -f -n '__fish_seen_subcommand_from user' -a add", `-l role -d "role of the user" -xa "admin staff"`},
+	} {
+		t.Run("Testing "+shell, func(t *testing.T) {
+			var out bytes.Buffer
+			var ran []string
+			var level string
+			if code := testTree(&out, &ran, &level).Execute([]string{"completion", shell}); code != ExitOk {
+				t.Fatalf("expected exit code %d, got %d", ExitOk, code)
+			}
+			for _, line := range expected {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("expected script containing %q, got %s", line, out.String())
+				}
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	var ran []string
+	var level string
+	if code := testTree(&out, &ran, &level).Execute([]string{"completion", "powershell"}); code != ExitUsage {
+		t.Errorf("expected exit code %d, got %d", ExitUsage, code)
+	}
+}
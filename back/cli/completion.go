@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// completion bash|zsh|fish, prints the completion script of the shell
+func (command *Command) completion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(command.stderr(), "Error: completion expects one shell: bash, zsh or fish")
+		return ExitUsage
+	}
+	out := command.stdout()
+	switch args[0] {
+	case "bash":
+		command.writeBash(out)
+	case "zsh":
+		// zsh runs bash completions through bashcompinit
+		fmt.Fprintln(out, "autoload -U +X bashcompinit && bashcompinit")
+		command.writeBash(out)
+	case "fish":
+		command.writeFish(out)
+	default:
+		fmt.Fprintf(command.stderr(), "Error: unsupported shell %q, should be bash, zsh or fish\n", args[0])
+		return ExitUsage
+	}
+	return ExitOk
+}
+
+// every command of the tree, the root first
+func (command *Command) walk(visit func(*Command)) {
+	visit(command)
+	for _, subcommand := range command.Subcommands {
+		subcommand.walk(visit)
+	}
+}
+
+// path of the command without the root name, "" for the root
+func (command *Command) subPath() string {
+	return strings.TrimPrefix(strings.TrimPrefix(command.Path(), command.root().Name), " ")
+}
+
+// names of the subcommands, with help and completion for the root
+func (command *Command) subcommandNames() []string {
+	var names []string
+	for _, subcommand := range command.Subcommands {
+		names = append(names, subcommand.Name)
+	}
+	if command.parent == nil {
+		names = append(names, "help", "completion")
+	}
+	return names
+}
+
+// flags accepted by the command, its own and those of its parents
+func (command *Command) allFlags() []string {
+	seen := map[string]bool{}
+	var names []string
+	for current := command; current != nil; current = current.parent {
+		current.Flags().VisitAll(func(f *flag.Flag) {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				names = append(names, flagName(f.Name))
+			}
+		})
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (command *Command) writeBash(out io.Writer) {
+	name := command.Name
+	function := "_" + strings.ReplaceAll(name, "-", "_")
+	fmt.Fprintf(out, "# bash completion of %s, generated by '%s completion bash'\n", name, name)
+
+	fmt.Fprintf(out, "%s_subcommands() {\n  case \"$1\" in\n", function)
+	command.walk(func(c *Command) {
+		fmt.Fprintf(out, "    %q) echo %q ;;\n", c.subPath(), strings.Join(c.subcommandNames(), " "))
+	})
+	fmt.Fprintf(out, "  esac\n}\n")
+
+	fmt.Fprintf(out, "%s_flags() {\n  case \"$1\" in\n", function)
+	command.walk(func(c *Command) {
+		fmt.Fprintf(out, "    %q) echo %q ;;\n", c.subPath(), strings.Join(c.allFlags(), " "))
+	})
+	fmt.Fprintf(out, "  esac\n}\n")
+
+	fmt.Fprintf(out, "%s_choices() {\n  case \"$1\" in\n", function)
+	command.walk(func(c *Command) {
+		for current := c; current != nil; current = current.parent {
+			names := make([]string, 0, len(current.choices))
+			for name := range current.choices {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(out, "    %q) echo %q ;;\n", c.subPath()+" "+flagName(name), strings.Join(current.choices[name], " "))
+			}
+		}
+	})
+	fmt.Fprintf(out, "  esac\n}\n")
+
+	fmt.Fprintf(out, `%[1]s() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" path="" word i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+    if [[ " $(%[1]s_subcommands "$path") " == *" $word "* ]]; then
+      path="${path:+$path }$word"
+    fi
+  done
+  local choices="$(%[1]s_choices "$path $prev")"
+  if [[ "$prev" == -* && -n "$choices" ]]; then
+    COMPREPLY=($(compgen -W "$choices" -- "$cur"))
+  elif [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "$(%[1]s_flags "$path")" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -W "$(%[1]s_subcommands "$path")" -- "$cur"))
+    if [[ ${#COMPREPLY[@]} -eq 0 ]]; then
+      COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+  fi
+}
+complete -o filenames -F %[1]s %[2]s
+`, function, name)
+}
+
+func (command *Command) writeFish(out io.Writer) {
+	name := command.Name
+	fmt.Fprintf(out, "# fish completion of %s, generated by '%s completion fish'\n", name, name)
+	command.walk(func(c *Command) {
+		condition := "__fish_use_subcommand"
+		if c.parent != nil {
+			condition = "__fish_seen_subcommand_from " + c.Name
+		}
+		for _, subcommand := range c.Subcommands {
+			fmt.Fprintf(out, "complete -c %s -f -n '%s' -a %s -d %q\n", name, condition, subcommand.Name, subcommand.Short)
+		}
+		if c.parent == nil {
+			fmt.Fprintf(out, "complete -c %s -f -n '__fish_use_subcommand' -a help -d %q\n", name, "Prints the help of a command")
+			fmt.Fprintf(out, "complete -c %s -f -n '__fish_use_subcommand' -a completion -d %q\n", name, "Prints the completion script of bash, zsh or fish")
+		}
+		c.Flags().VisitAll(func(f *flag.Flag) {
+			option := "-l " + f.Name
+			if len(f.Name) == 1 {
+				option = "-s " + f.Name
+			}
+			line := fmt.Sprintf("complete -c %s %s -d %q", name, option, f.Usage)
+			if c.parent != nil {
+				line = fmt.Sprintf("complete -c %s -n '%s' %s -d %q", name, condition, option, f.Usage)
+			}
+			if choices := c.choices[f.Name]; len(choices) > 0 {
+				line += fmt.Sprintf(" -xa %q", strings.Join(choices, " "))
+			}
+			fmt.Fprintln(out, line)
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"net/http"
+)
+
+// AdminController runs the maintenance operations, for admins only, mounted on /admin
+func AdminController(db *sql.DB, backups backup.Options, files storage.Storage) http.Handler {
+	adminMux := chi.NewRouter()
+	adminMux.Use(services.RequireRole(db, models.RoleAdmin))
+	backupHandler := &services.BackupHandler{Db: db, Options: backups}
+	adminMux.Post("/backups", backupHandler.Create)
+	adminMux.Get("/backups", backupHandler.List)
+	adminMux.Get("/backups/{name}", backupHandler.Download)
+	trashHandler := &services.TrashHandler{Db: db, Storage: files}
+	adminMux.Delete("/trash", trashHandler.Purge)
+	return adminMux
+}
+
+// AuditController serves the audit log of the books, for admins only, mounted on /audit
+func AuditController(db *sql.DB) http.Handler {
+	auditMux := chi.NewRouter()
+	auditMux.Use(services.RequireRole(db, models.RoleAdmin))
+	auditHandler := &services.AuditHandler{Db: db}
+	auditMux.Get("/", auditHandler.List)
+	return auditMux
+}
+
+// WebhookController manages the webhooks and their deliveries, for admins only, mounted on /webhooks
+func WebhookController(db *sql.DB) http.Handler {
+	webhookMux := chi.NewRouter()
+	webhookMux.Use(services.RequireRole(db, models.RoleAdmin))
+	webhookHandler := &services.WebhookHandler{Db: db}
+	webhookMux.Post("/", webhookHandler.Create)
+	webhookMux.Get("/", webhookHandler.List)
+	webhookMux.Get("/{id}", webhookHandler.Get)
+	webhookMux.Patch("/{id}", webhookHandler.Update)
+	webhookMux.Delete("/{id}", webhookHandler.Delete)
+	webhookMux.Get("/{id}/deliveries", webhookHandler.Deliveries)
+	webhookMux.Post("/{id}/deliveries/{delivery_id}/redeliver", webhookHandler.Redeliver)
+	return webhookMux
+}
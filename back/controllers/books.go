@@ -3,26 +3,68 @@ package controllers
 import (
 	"database/sql"
 	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	"github.com/mimminou/BookIT-ByFood/back/epub"
 	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
 	"net/http"
 )
 
-func BookController(db *sql.DB) http.Handler {
+// BookOptions are what the handlers of the books are made of besides the DB
+type BookOptions struct {
+	// where the files of the books are kept
+	Files  storage.Storage
+	Covers covers.Options
+	Epubs  epub.Options
+	// catalogue of POST /books/enrich and /books/{id}/enrich
+	Catalogue enrich.Provider
+}
+
+func BookController(db *sql.DB, options BookOptions) http.Handler {
 	booksMux := chi.NewRouter()
+	// the changes are recorded in the audit log with the user of the token, when there is one
+	booksMux.Use(services.IdentifyUser(db))
 
 	dbRequestHandler := &services.DBRequestHandler{Db: db}
+	trashHandler := &services.TrashHandler{Db: db, Storage: options.Files}
+	auditHandler := &services.AuditHandler{Db: db}
+	coverHandler := &services.CoverHandler{Db: db, Storage: options.Files, Options: options.Covers}
+	epubHandler := &services.EpubHandler{Db: db, Storage: options.Files, Options: options.Epubs, Covers: coverHandler}
+	enrichHandler := &services.EnrichHandler{Db: db, Provider: options.Catalogue, Covers: coverHandler}
 	//Register GET routes
 	booksMux.Get("/", dbRequestHandler.GetAll)
+	booksMux.Get("/export", dbRequestHandler.Export)
+	booksMux.Get("/trash", trashHandler.List)
 	booksMux.Get("/{id}", dbRequestHandler.GetBook)
+	booksMux.Get("/{id}/history", auditHandler.History)
+	booksMux.Get("/{id}/cover", coverHandler.Get)
+	booksMux.Get("/{id}/cover/{size}", coverHandler.Get)
+	booksMux.Get("/{id}/epub", epubHandler.Get)
 
 	//Register POST routes
 	booksMux.Post("/", dbRequestHandler.Add)
+	booksMux.Post("/import", dbRequestHandler.Import)
+	booksMux.Post("/epub", epubHandler.Add)
+	booksMux.Post("/enrich", enrichHandler.Add)
+	booksMux.Post("/{id}/restore", trashHandler.Restore)
+	booksMux.Post("/{id}/revert", auditHandler.Revert)
+	booksMux.Post("/{id}/enrich", enrichHandler.Enrich)
 	booksMux.Put("/{id}", dbRequestHandler.Update)
+	booksMux.Put("/{id}/cover", coverHandler.Put)
+	booksMux.Put("/{id}/epub", epubHandler.Put)
 	booksMux.Delete("/{id}", dbRequestHandler.Delete)
+	booksMux.Delete("/{id}/cover", coverHandler.Delete)
+	booksMux.Delete("/{id}/epub", epubHandler.Delete)
 
 	//Register OPTIONS routes
 	booksMux.Options("/", dbRequestHandler.SendOptions)
 	booksMux.Options("/{id}", dbRequestHandler.SendOptions)
+	booksMux.Options("/{id}/cover", dbRequestHandler.SendOptions)
+	booksMux.Options("/epub", dbRequestHandler.SendOptions)
+	booksMux.Options("/{id}/epub", dbRequestHandler.SendOptions)
+	booksMux.Options("/enrich", dbRequestHandler.SendOptions)
+	booksMux.Options("/{id}/enrich", dbRequestHandler.SendOptions)
 
 	return booksMux
 }
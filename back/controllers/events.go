@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"net/http"
+)
+
+// EventsController streams the changes of the books, mounted on /events
+func EventsController(broker *events.Broker) http.Handler {
+	eventsMux := chi.NewRouter()
+	eventsHandler := &services.EventsHandler{Broker: broker}
+	eventsMux.Get("/", eventsHandler.Stream)
+	return eventsMux
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/graph"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"log"
+	"net/http"
+)
+
+func GraphqlController(db *sql.DB) http.Handler {
+	graphqlMux := chi.NewRouter()
+
+	schema, err := graph.NewSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	graphqlRequestHandler := &services.GraphqlRequestHandler{Db: db, Schema: schema, Limits: graph.DefaultLimits}
+	graphqlMux.Get("/", graphqlRequestHandler.Get)
+	graphqlMux.Post("/", graphqlRequestHandler.Post)
+	graphqlMux.Options("/", graphqlRequestHandler.SendOptions)
+
+	return graphqlMux
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/opds"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"net/http"
+)
+
+// OPDS 1.2 feeds are served at the root, OPDS 2.0 ones under /v2
+func OpdsController(db *sql.DB) http.Handler {
+	opdsMux := chi.NewRouter()
+
+	atomHandler := &services.OpdsRequestHandler{Db: db, Format: opds.Atom}
+	registerOpdsRoutes(opdsMux, atomHandler)
+	opdsMux.Get("/opensearch.xml", atomHandler.OpenSearch)
+
+	opdsMux.Route("/v2", func(v2Mux chi.Router) {
+		registerOpdsRoutes(v2Mux, &services.OpdsRequestHandler{Db: db, Format: opds.Json})
+	})
+
+	return opdsMux
+}
+
+func registerOpdsRoutes(mux chi.Router, handler *services.OpdsRequestHandler) {
+	mux.Get("/", handler.Root)
+	mux.Get("/all", handler.All)
+	mux.Get("/new", handler.NewArrivals)
+	mux.Get("/search", handler.Search)
+	mux.Get("/authors", handler.Authors)
+	mux.Get("/authors/{author}", handler.Author)
+	mux.Get("/years", handler.Years)
+	mux.Get("/years/{year}", handler.Year)
+	mux.Get("/books/{id}", handler.Book)
+}
@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/mimminou/BookIT-ByFood/back/rpc"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"net/http"
+)
+
+// Connect protocol mapping of the gRPC services, mounted on /rpc
+func RpcController(db *sql.DB, rules *urlrules.Engine) http.Handler {
+	return http.StripPrefix("/rpc", rpc.ConnectHandler(db, rules))
+}
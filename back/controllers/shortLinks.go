@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"net/http"
+)
+
+// ShortLinkController manages the short links, mounted on /links, changing one is for staff and admins
+func ShortLinkController(db *sql.DB, rules *urlrules.Engine, options services.ShortLinkOptions) http.Handler {
+	linksMux := chi.NewRouter()
+	shortLinkHandler := &services.ShortLinkHandler{Db: db, Rules: rules, Options: options}
+	linksMux.Post("/", shortLinkHandler.Create)
+	linksMux.Get("/{slug}", shortLinkHandler.Get)
+	linksMux.With(services.RequireRole(db, models.RoleStaff, models.RoleAdmin)).Patch("/{slug}", shortLinkHandler.Update)
+	return linksMux
+}
+
+// ShortLinkRedirectController redirects the short links, mounted on /l
+func ShortLinkRedirectController(db *sql.DB) http.Handler {
+	redirectMux := chi.NewRouter()
+	shortLinkHandler := &services.ShortLinkHandler{Db: db}
+	redirectMux.Get("/{slug}", shortLinkHandler.Follow)
+	return redirectMux
+}
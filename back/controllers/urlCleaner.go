@@ -3,12 +3,16 @@ package controllers
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
 	"net/http"
 )
 
-// implement this
-func UrlCleanerController() http.Handler {
+func UrlCleanerController(rules *urlrules.Engine, batch services.BatchLimits) http.Handler {
 	urlMux := chi.NewRouter()
-	urlMux.Post("/", services.ProcessUrl)
+	urlRequestHandler := &services.UrlRequestHandler{Rules: rules, Batch: batch}
+	urlMux.Post("/", urlRequestHandler.ProcessUrl)
+	urlMux.Post("/batch", urlRequestHandler.ProcessBatch)
+	urlMux.Post("/sitemap", urlRequestHandler.AuditSitemap)
+	urlMux.Get("/operations", urlRequestHandler.Operations)
 	return urlMux
 }
@@ -0,0 +1,206 @@
+package covers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"slices"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+/**
+Cover images of the books: an upload is checked by its content rather than by what the client says it is, decoded
+within limits, and stored without its metadata (EXIF, XMP), which can carry the place and the device a photo was taken with
+JPEG and PNG covers are encoded again, which drops the metadata, a JPEG is turned upright first as its EXIF orientation says
+WebP has no encoder in Go, a WebP cover keeps its image data and loses its metadata chunks, unless its orientation is
+not upright, then it is encoded again as PNG
+The thumbnails are scaled to the widths of Sizes, as JPEG, or PNG for the covers with transparency
+**/
+
+// Options of the covers, the config section "covers", a field left at 0 takes its value from DefaultOptions
+type Options struct {
+	// largest upload accepted
+	MaxBytes int64 `json:"max_bytes"`
+	// largest image accepted, width times height, checked before it is decoded so that a small file can't take all the memory
+	MaxPixels int `json:"max_pixels"`
+	// quality of the JPEG covers and thumbnails, 1 to 100
+	JpegQuality int `json:"jpeg_quality"`
+}
+
+var DefaultOptions = Options{MaxBytes: 10 << 20, MaxPixels: 25_000_000, JpegQuality: 90}
+
+// Size of a thumbnail, scaled to its width, a cover narrower than that is not enlarged
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the thumbnails made of every cover
+var Sizes = []Size{{"small", 160}, {"medium", 320}, {"large", 640}}
+
+// ContentTypes lists the images accepted
+var ContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+var (
+	ErrTooLarge      = errors.New("cover is too large")
+	ErrUnsupported   = errors.New("cover must be a JPEG, PNG or WebP image")
+	ErrTooManyPixels = errors.New("cover has too many pixels")
+	ErrInvalidImage  = errors.New("cover is not a valid image")
+	ErrUnknownSize   = errors.New("unknown cover size")
+)
+
+// Image is an encoded image, a cover or one of its thumbnails
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+// Cover is a processed upload, ready to be stored
+type Cover struct {
+	Original   Image
+	Thumbnails map[string]Image
+}
+
+// WithDefaults returns the options with the fields left at 0 filled in
+func (options Options) WithDefaults() Options {
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = DefaultOptions.MaxBytes
+	}
+	if options.MaxPixels <= 0 {
+		options.MaxPixels = DefaultOptions.MaxPixels
+	}
+	if options.JpegQuality <= 0 || options.JpegQuality > 100 {
+		options.JpegQuality = DefaultOptions.JpegQuality
+	}
+	return options
+}
+
+// SizeOf returns the size named, ErrUnknownSize when there is none
+func SizeOf(name string) (Size, error) {
+	index := slices.IndexFunc(Sizes, func(size Size) bool { return size.Name == name })
+	if index < 0 {
+		return Size{}, fmt.Errorf("%w %q", ErrUnknownSize, name)
+	}
+	return Sizes[index], nil
+}
+
+// Process checks the upload, strips its metadata and makes its thumbnails
+func Process(data []byte, options Options) (Cover, error) {
+	options = options.WithDefaults()
+	if int64(len(data)) > options.MaxBytes {
+		return Cover{}, ErrTooLarge
+	}
+	// the client's Content-Type is not trusted, what the bytes are is
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(ContentTypes, contentType) {
+		return Cover{}, fmt.Errorf("%w, got %s", ErrUnsupported, contentType)
+	}
+
+	var decodeConfig func([]byte) (image.Config, error)
+	var decode func([]byte) (image.Image, error)
+	switch contentType {
+	case "image/jpeg":
+		decodeConfig = func(data []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(data)) }
+		decode = func(data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) }
+	case "image/png":
+		decodeConfig = func(data []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(data)) }
+		decode = func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) }
+	case "image/webp":
+		decodeConfig = func(data []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(data)) }
+		decode = func(data []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(data)) }
+	}
+	config, err := decodeConfig(data)
+	if err != nil {
+		return Cover{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return Cover{}, ErrInvalidImage
+	}
+	if config.Width*config.Height > options.MaxPixels {
+		return Cover{}, fmt.Errorf("%w, %dx%d is over %d", ErrTooManyPixels, config.Width, config.Height, options.MaxPixels)
+	}
+	decoded, err := decode(data)
+	if err != nil {
+		return Cover{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	var original Image
+	switch contentType {
+	case "image/jpeg":
+		decoded = orient(decoded, jpegOrientation(data))
+		original, err = encodeJpeg(decoded, options.JpegQuality)
+	case "image/png":
+		original, err = encodePng(decoded)
+	case "image/webp":
+		if orientation := webpOrientation(data); orientation != 1 {
+			decoded = orient(decoded, orientation)
+			original, err = encodePng(decoded)
+		} else {
+			bounds := decoded.Bounds()
+			original = Image{ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}
+			original.Data, err = stripWebp(data)
+		}
+	}
+	if err != nil {
+		return Cover{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	cover := Cover{Original: original, Thumbnails: map[string]Image{}}
+	for _, size := range Sizes {
+		thumbnail, err := scale(decoded, size.Width, options.JpegQuality)
+		if err != nil {
+			return Cover{}, err
+		}
+		cover.Thumbnails[size.Name] = thumbnail
+	}
+	return cover, nil
+}
+
+// scale makes a thumbnail of the width, the height keeps the ratio of the image
+func scale(source image.Image, width, quality int) (Image, error) {
+	bounds := source.Bounds()
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	thumbnail := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), source, bounds, draw.Src, nil)
+	if opaque(source) {
+		return encodeJpeg(thumbnail, quality)
+	}
+	return encodePng(thumbnail)
+}
+
+// opaque reports whether the image has no transparency, JPEG has none to keep
+func opaque(source image.Image) bool {
+	if image, ok := source.(interface{ Opaque() bool }); ok {
+		return image.Opaque()
+	}
+	return false
+}
+
+func encodeJpeg(source image.Image, quality int) (Image, error) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, source, &jpeg.Options{Quality: quality}); err != nil {
+		return Image{}, err
+	}
+	bounds := source.Bounds()
+	return Image{ContentType: "image/jpeg", Data: buffer.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+func encodePng(source image.Image) (Image, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, source); err != nil {
+		return Image{}, err
+	}
+	bounds := source.Bounds()
+	return Image{ContentType: "image/png", Data: buffer.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
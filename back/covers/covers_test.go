@@ -0,0 +1,206 @@
+package covers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// metadata that must not be found in a processed cover
+const secret = "Secret Camera, 48.8584 N 2.2945 E"
+
+// exif is the EXIF of a photo taken with the orientation, a big-endian TIFF with the orientation and a camera name
+func exif(orientation int) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 2)
+	// orientation, a SHORT
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0x00, 0x00)
+	// make, an ASCII value past the IFD
+	tiff = append(tiff, 0x01, 0x0F, 0x00, 0x02)
+	tiff = binary.BigEndian.AppendUint32(tiff, uint32(len(secret)+1))
+	tiff = binary.BigEndian.AppendUint32(tiff, uint32(8+2+2*12+4))
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	return append(tiff, secret+"\x00"...)
+}
+
+// a 40x20 photo, red on its left half and blue on its right half, with an EXIF segment
+func photo(t *testing.T, orientation int) []byte {
+	picture := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			picture.Set(x, y, map[bool]color.Color{true: color.RGBA{255, 0, 0, 255}, false: color.RGBA{0, 0, 255, 255}}[x < 20])
+		}
+	}
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, picture, nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := append([]byte("Exif\x00\x00"), exif(orientation)...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+	data := buffer.Bytes()
+	return append(append(append([]byte{}, data[:2]...), append(app1, segment...)...), data[2:]...)
+}
+
+// the WebP of the testdata in an extended container, with an EXIF chunk and an XMP chunk
+func extendedWebp(t *testing.T, orientation int) []byte {
+	simple, err := os.ReadFile("testdata/cover.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _ := webp.DecodeConfig(bytes.NewReader(simple))
+	chunk := func(name string, payload []byte) []byte {
+		chunk := binary.LittleEndian.AppendUint32([]byte(name), uint32(len(payload)))
+		chunk = append(chunk, payload...)
+		if len(payload)%2 == 1 {
+			chunk = append(chunk, 0)
+		}
+		return chunk
+	}
+	vp8x := []byte{1<<3 | 1<<2, 0, 0, 0}
+	vp8x = append(vp8x, byte(config.Width-1), byte((config.Width-1)>>8), 0, byte(config.Height-1), byte((config.Height-1)>>8), 0)
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	data = append(data, chunk("VP8X", vp8x)...)
+	data = append(data, simple[12:]...)
+	data = append(data, chunk("EXIF", exif(orientation))...)
+	data = append(data, chunk("XMP ", []byte("<x:xmpmeta>"+secret+"</x:xmpmeta>"))...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("Testing a JPEG is turned upright and stripped", func(t *testing.T) {
+		data := photo(t, 6)
+		if !bytes.Contains(data, []byte(secret)) || jpegOrientation(data) != 6 {
+			t.Fatal("expected the test photo to carry its EXIF")
+		}
+		cover, err := Process(data, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cover.Original.ContentType != "image/jpeg" || bytes.Contains(cover.Original.Data, []byte(secret)) || bytes.Contains(cover.Original.Data, []byte("Exif")) {
+			t.Errorf("expected a JPEG without its EXIF, got %s", cover.Original.ContentType)
+		}
+		upright, err := jpeg.Decode(bytes.NewReader(cover.Original.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rotated clockwise, the left half is now the top half
+		if upright.Bounds().Dx() != 20 || upright.Bounds().Dy() != 40 {
+			t.Fatalf("expected a 20x40 cover, got %v", upright.Bounds())
+		}
+		if red, _, blue, _ := upright.At(10, 5).RGBA(); red < blue {
+			t.Errorf("expected the top of the cover to be red, got %v", upright.At(10, 5))
+		}
+		for _, size := range Sizes {
+			thumbnail := cover.Thumbnails[size.Name]
+			// the cover is narrower than every thumbnail, they are not enlarged
+			if thumbnail.ContentType != "image/jpeg" || thumbnail.Width != 20 || thumbnail.Height != 40 {
+				t.Errorf("%s: expected a 20x40 JPEG, got %s %dx%d", size.Name, thumbnail.ContentType, thumbnail.Width, thumbnail.Height)
+			}
+		}
+	})
+
+	t.Run("Testing the thumbnails of a transparent PNG", func(t *testing.T) {
+		picture := image.NewNRGBA(image.Rect(0, 0, 800, 1200))
+		picture.Set(400, 600, color.NRGBA{0, 128, 0, 255})
+		var buffer bytes.Buffer
+		png.Encode(&buffer, picture)
+		cover, err := Process(buffer.Bytes(), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cover.Original.ContentType != "image/png" || cover.Original.Width != 800 {
+			t.Errorf("expected the PNG, got %s %d", cover.Original.ContentType, cover.Original.Width)
+		}
+		for _, size := range Sizes {
+			thumbnail := cover.Thumbnails[size.Name]
+			if thumbnail.ContentType != "image/png" || thumbnail.Width != size.Width || thumbnail.Height != size.Width*3/2 {
+				t.Errorf("%s: expected a %dx%d PNG, got %s %dx%d", size.Name, size.Width, size.Width*3/2, thumbnail.ContentType, thumbnail.Width, thumbnail.Height)
+			}
+		}
+	})
+
+	t.Run("Testing the metadata chunks of a WebP are removed", func(t *testing.T) {
+		cover, err := Process(extendedWebp(t, 1), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cover.Original.ContentType != "image/webp" || bytes.Contains(cover.Original.Data, []byte(secret)) {
+			t.Fatalf("expected a WebP without its metadata, got %s", cover.Original.ContentType)
+		}
+		chunks, err := webpChunks(cover.Original.Data)
+		if err != nil || len(chunks) != 2 || chunks[0][8] != 0 {
+			t.Errorf("expected the VP8X and VP8 chunks, without the metadata flags, got %d chunks, %v", len(chunks), err)
+		}
+		if _, err := webp.Decode(bytes.NewReader(cover.Original.Data)); err != nil {
+			t.Errorf("expected the stripped WebP to decode, got %v", err)
+		}
+		if thumbnail := cover.Thumbnails["small"]; thumbnail.ContentType != "image/jpeg" || thumbnail.Width != 150 {
+			t.Errorf("expected a 150 pixels wide JPEG, got %s %d", thumbnail.ContentType, thumbnail.Width)
+		}
+	})
+
+	t.Run("Testing a rotated WebP is encoded as PNG", func(t *testing.T) {
+		cover, err := Process(extendedWebp(t, 8), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cover.Original.ContentType != "image/png" || cover.Original.Width != 100 || cover.Original.Height != 150 {
+			t.Errorf("expected a 100x150 PNG, got %s %dx%d", cover.Original.ContentType, cover.Original.Width, cover.Original.Height)
+		}
+	})
+
+	t.Run("Testing the uploads that are refused", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			data     []byte
+			options  Options
+			expected error
+		}{
+			"gif":       {[]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), Options{}, ErrUnsupported},
+			"svg":       {[]byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), Options{}, ErrUnsupported},
+			"truncated": {photo(t, 1)[:200], Options{}, ErrInvalidImage},
+			"too large": {photo(t, 1), Options{MaxBytes: 100}, ErrTooLarge},
+			"too many":  {photo(t, 1), Options{MaxPixels: 40*20 - 1}, ErrTooManyPixels},
+		} {
+			if _, err := Process(test.data, test.options); !errors.Is(err, test.expected) {
+				t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+			}
+		}
+	})
+}
+
+func TestOrient(t *testing.T) {
+	// a 3x2 image, numbered by its pixels
+	source := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(source.Pix, []uint8{1, 2, 3, 4, 5, 6})
+	for orientation, expected := range map[int][]uint8{
+		2: {3, 2, 1, 6, 5, 4},
+		3: {6, 5, 4, 3, 2, 1},
+		4: {4, 5, 6, 1, 2, 3},
+		5: {1, 4, 2, 5, 3, 6},
+		6: {4, 1, 5, 2, 6, 3},
+		7: {6, 3, 5, 2, 4, 1},
+		8: {3, 6, 2, 5, 1, 4},
+	} {
+		upright := orient(source, orientation)
+		var pixels []uint8
+		for y := 0; y < upright.Bounds().Dy(); y++ {
+			for x := 0; x < upright.Bounds().Dx(); x++ {
+				pixels = append(pixels, color.GrayModel.Convert(upright.At(x, y)).(color.Gray).Y)
+			}
+		}
+		if !bytes.Equal(pixels, expected) {
+			t.Errorf("orientation %d: expected %v, got %v", orientation, expected, pixels)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package covers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+/**
+Just enough of EXIF and of the WebP container for the covers: the orientation tag of the EXIF of a JPEG (APP1 segment)
+or of a WebP (EXIF chunk), and the removal of the metadata chunks of a WebP
+**/
+
+// tag of the orientation in the first IFD of the EXIF, 1 to 8, 1 is upright
+const orientationTag = 0x0112
+
+var errInvalidWebp = errors.New("invalid WebP container")
+
+// jpegOrientation reads the orientation of the EXIF of a JPEG, 1 when it has none
+func jpegOrientation(data []byte) int {
+	// the markers after SOI, up to SOS, where the image data starts
+	offset := 2
+	for offset+4 <= len(data) && data[offset] == 0xFF {
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			break
+		}
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+// webpOrientation reads the orientation of the EXIF chunk of a WebP, 1 when it has none
+func webpOrientation(data []byte) int {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return 1
+	}
+	for _, chunk := range chunks {
+		if string(chunk[:4]) == "EXIF" {
+			// some encoders keep the JPEG prefix
+			return tiffOrientation(bytes.TrimPrefix(chunk[8:], []byte("Exif\x00\x00")))
+		}
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of EXIF data, a TIFF header then IFDs, 1 when it is missing or invalid
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for index := 0; index < entries; index++ {
+		entry := ifd + 2 + index*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// a SHORT, stored in the first bytes of the value
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+		}
+	}
+	return 1
+}
+
+// orient turns the image upright as the EXIF orientation says: mirrored for 2 and 4, rotated for 3, 6 and 8, both for 5 and 7
+func orient(source image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return source
+	}
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// the orientations past 4 swap the width and the height
+	size := image.Rect(0, 0, width, height)
+	if orientation >= 5 {
+		size = image.Rect(0, 0, height, width)
+	}
+	upright := image.NewNRGBA(size)
+	for y := 0; y < size.Dy(); y++ {
+		for x := 0; x < size.Dx(); x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			}
+			upright.Set(x, y, source.At(bounds.Min.X+sourceX, bounds.Min.Y+sourceY))
+		}
+	}
+	return upright
+}
+
+// webpChunks splits a WebP in its RIFF chunks, each one with its header and its padding
+func webpChunks(data []byte) ([][]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidWebp
+	}
+	var chunks [][]byte
+	for offset := 12; offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, errInvalidWebp
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		end := offset + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errInvalidWebp
+		}
+		chunks = append(chunks, data[offset:end])
+		offset = end
+	}
+	return chunks, nil
+}
+
+// stripWebp removes the EXIF and XMP chunks of a WebP, and their flags from its VP8X chunk
+func stripWebp(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	const (
+		xmpFlag  = 1 << 2
+		exifFlag = 1 << 3
+	)
+	stripped := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(chunk) < 9 {
+				return nil, errInvalidWebp
+			}
+			chunk = bytes.Clone(chunk)
+			chunk[8] &^= xmpFlag | exifFlag
+		}
+		stripped = append(stripped, chunk...)
+	}
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
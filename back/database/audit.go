@@ -0,0 +1,316 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/**
+Audit log of the books: the *Audited functions make a change and record it inside the same transaction,
+with the book as it was before and after the change, so that an entry exists if and only if the change was made
+The deliveries of the change to the webhooks are queued in the same transaction, and its event is passed to the hooks
+of OnBookChange once it is committed
+Entries are never changed, a revert is a new change that puts back the book of an older entry
+**/
+
+// Change identifies who made a change, and with which request
+type Change struct {
+	Actor     string
+	RequestId string
+}
+
+var ErrNoVersion = errors.New("the change left no version of the book to revert to")
+
+const auditColumns = "audit_id, book_id, operation, actor, request_id, at, before_book, after_book"
+
+// the book as the API shows it, nil when it doesn't exist or is in the trash
+func snapshot(exec execer, id int) (*models.Book, error) {
+	book, err := scanBook(exec.QueryRow("SELECT "+bookColumns+" FROM Books WHERE book_id = ? AND "+notDeleted, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func marshalSnapshot(book *models.Book) (sql.NullString, error) {
+	if book == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(book)
+	return sql.NullString{String: string(data), Valid: true}, err
+}
+
+// audit makes the change of the book inside the transaction and records it, mutate returns the id of the book
+// id is 0 for a book that doesn't exist yet, the event of the change is returned for the hooks, once committed
+func audit(tx *sql.Tx, id int, operation string, change Change, mutate func() (int, error)) (models.BookEvent, error) {
+	var before *models.Book
+	var err error
+	if id != 0 {
+		if before, err = snapshot(tx, id); err != nil {
+			return models.BookEvent{}, err
+		}
+	}
+	if id, err = mutate(); err != nil {
+		return models.BookEvent{}, err
+	}
+	after, err := snapshot(tx, id)
+	if err != nil {
+		return models.BookEvent{}, err
+	}
+	beforeJson, err := marshalSnapshot(before)
+	if err != nil {
+		return models.BookEvent{}, err
+	}
+	afterJson, err := marshalSnapshot(after)
+	if err != nil {
+		return models.BookEvent{}, err
+	}
+	entry := models.AuditEntry{Book_Id: id, Operation: operation, Actor: change.Actor, RequestId: change.RequestId, At: time.Now().UTC().Truncate(time.Second), Before: before, After: after}
+	inserted, err := tx.Exec("INSERT INTO AuditLog (book_id, operation, actor, request_id, at, before_book, after_book) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, operation, change.Actor, sql.NullString{String: change.RequestId, Valid: change.RequestId != ""}, entry.At.Format(time.RFC3339), beforeJson, afterJson)
+	if err != nil {
+		return models.BookEvent{}, err
+	}
+	auditId, err := inserted.LastInsertId()
+	if err != nil {
+		return models.BookEvent{}, err
+	}
+	entry.Audit_Id = int(auditId)
+	if entry.Diff, err = diff(before, after); err != nil {
+		return models.BookEvent{}, err
+	}
+	event := eventOf(entry)
+	return event, enqueueEvent(tx, event)
+}
+
+// the event of the change of an audit entry
+func eventOf(entry models.AuditEntry) models.BookEvent {
+	// a deleted book is sent as it was
+	book := entry.After
+	if book == nil {
+		book = entry.Before
+	}
+	return models.BookEvent{Event: operationEvents[entry.Operation], Audit_Id: entry.Audit_Id, Book_Id: entry.Book_Id, Actor: entry.Actor, At: entry.At, Book: book, Diff: entry.Diff}
+}
+
+// runs audit inside a transaction of its own
+func audited(db *sql.DB, id int, operation string, change Change, mutate func(tx *sql.Tx) (int, error)) (int, error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	event, err := audit(tx, id, operation, change, func() (int, error) { return mutate(tx) })
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	notify(db, event)
+	return event.Book_Id, nil
+}
+
+// AddBook, recorded in the audit log
+func AddBookAudited(db *sql.DB, book models.Book, change Change) (int, error) {
+	return audited(db, 0, models.AuditCreate, change, func(tx *sql.Tx) (int, error) {
+		return addBook(tx, book)
+	})
+}
+
+// AddBooks, each book recorded in the audit log, either all of them are inserted or none
+func AddBooksAudited(db *sql.DB, books []models.Book, change Change) ([]int, error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ids := make([]int, 0, len(books))
+	events := make([]models.BookEvent, 0, len(books))
+	for _, book := range books {
+		event, err := audit(tx, 0, models.AuditCreate, change, func() (int, error) { return addBook(tx, book) })
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, event.Book_Id)
+		events = append(events, event)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	notify(db, events...)
+	return ids, nil
+}
+
+// UpdateBook, recorded in the audit log
+func UpdateBookAudited(db *sql.DB, book models.Book, change Change) error {
+	_, err := audited(db, book.Book_Id, models.AuditUpdate, change, func(tx *sql.Tx) (int, error) {
+		return book.Book_Id, updateBook(tx, book)
+	})
+	return err
+}
+
+// DeleteBook, recorded in the audit log
+func DeleteBookAudited(db *sql.DB, id int, change Change) error {
+	_, err := audited(db, id, models.AuditDelete, change, func(tx *sql.Tx) (int, error) {
+		return id, deleteBook(tx, id)
+	})
+	return err
+}
+
+// RestoreBook, recorded in the audit log
+func RestoreBookAudited(db *sql.DB, id int, change Change) error {
+	_, err := audited(db, id, models.AuditRestore, change, func(tx *sql.Tx) (int, error) {
+		return id, restoreBook(tx, id)
+	})
+	return err
+}
+
+// RevertBook puts back the book as the audit entry left it, out of the trash if it was deleted since
+// sql.ErrNoRows when the entry isn't one of the book or the book was purged, ErrNoVersion when the entry deleted the book
+func RevertBook(db *sql.DB, id, auditId int, change Change) (models.Book, error) {
+	var reverted models.Book
+	_, err := audited(db, id, models.AuditRevert, change, func(tx *sql.Tx) (int, error) {
+		entry, err := scanAuditEntry(tx.QueryRow("SELECT "+auditColumns+" FROM AuditLog WHERE audit_id = ? AND book_id = ?", auditId, id))
+		if err != nil {
+			return 0, err
+		}
+		if entry.After == nil {
+			return 0, ErrNoVersion
+		}
+		reverted = *entry.After
+		operation, err := tx.Exec("UPDATE Books SET title = ?, author = ?, num_pages = ?, pub_date = ?, isbn = ?, deleted_at = NULL WHERE book_id = ?",
+			reverted.Title, reverted.Author, reverted.Num_Pages, reverted.Pub_Date, nullableIsbn(reverted.Isbn), id)
+		if err != nil {
+			return 0, err
+		}
+		if updated, _ := operation.RowsAffected(); updated == 0 {
+			return 0, sql.ErrNoRows
+		}
+		return id, nil
+	})
+	return reverted, err
+}
+
+// AuditFilter narrows down the entries returned by GetAuditLog, empty fields are ignored
+// Since is inclusive and Until exclusive
+type AuditFilter struct {
+	BookId    int
+	Actor     string
+	Operation string
+	Since     time.Time
+	Until     time.Time
+}
+
+// get one page of the entries matching the filter, the most recent first
+func GetAuditLog(db *sql.DB, filter AuditFilter, limit, offset int) ([]models.AuditEntry, error) {
+	var conditions []string
+	var args []any
+	if filter.BookId != 0 {
+		conditions = append(conditions, "book_id = ?")
+		args = append(args, filter.BookId)
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Operation != "" {
+		conditions = append(conditions, "operation = ?")
+		args = append(args, filter.Operation)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "at >= ?")
+		args = append(args, filter.Since.UTC().Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "at < ?")
+		args = append(args, filter.Until.UTC().Format(time.RFC3339))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit, offset)
+	rows, err := db.Query("SELECT "+auditColumns+" FROM AuditLog"+where+" ORDER BY audit_id DESC LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanAuditEntry(row rowScanner) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var requestId, before, after sql.NullString
+	var at string
+	if err := row.Scan(&entry.Audit_Id, &entry.Book_Id, &entry.Operation, &entry.Actor, &requestId, &at, &before, &after); err != nil {
+		return entry, err
+	}
+	entry.RequestId = requestId.String
+	var err error
+	if entry.At, err = time.Parse(time.RFC3339, at); err != nil {
+		return entry, err
+	}
+	for _, snapshot := range []struct {
+		column sql.NullString
+		book   **models.Book
+	}{{before, &entry.Before}, {after, &entry.After}} {
+		if snapshot.column.Valid {
+			*snapshot.book = &models.Book{}
+			if err := json.Unmarshal([]byte(snapshot.column.String), *snapshot.book); err != nil {
+				return entry, err
+			}
+		}
+	}
+	entry.Diff, err = diff(entry.Before, entry.After)
+	return entry, err
+}
+
+// the fields that differ between two versions of a book, by JSON key
+func diff(before, after *models.Book) (map[string]models.FieldChange, error) {
+	fields := func(book *models.Book) (map[string]any, error) {
+		values := map[string]any{}
+		if book == nil {
+			return values, nil
+		}
+		data, err := json.Marshal(book)
+		if err != nil {
+			return nil, err
+		}
+		return values, json.Unmarshal(data, &values)
+	}
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]models.FieldChange{}
+	for _, values := range []map[string]any{from, to} {
+		for key := range values {
+			if !reflect.DeepEqual(from[key], to[key]) {
+				changes[key] = models.FieldChange{From: from[key], To: to[key]}
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	change := Change{Actor: "alice", RequestId: "request-1"}
+	book := models.Book{Title: "Dubliners", Author: "James Joyce", Pub_Date: "1914-06-15"}
+	id, err := AddBookAudited(db, book, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.Book_Id = id
+	// the other tests expect the books of the mock DB only, the entries stay
+	t.Cleanup(func() {
+		writer(db).Exec("DELETE FROM Books WHERE book_id = ?", id)
+	})
+	history := func() []models.AuditEntry {
+		entries, err := GetAuditLog(db, AuditFilter{BookId: id}, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	t.Run("Testing the entries of the changes", func(t *testing.T) {
+		updated := book
+		updated.Title = "Ulysses"
+		if err := UpdateBookAudited(db, updated, Change{Actor: "bob"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteBookAudited(db, id, change); err != nil {
+			t.Fatal(err)
+		}
+		if err := RestoreBookAudited(db, id, change); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := history()
+		operations := []string{models.AuditRestore, models.AuditDelete, models.AuditUpdate, models.AuditCreate}
+		if len(entries) != len(operations) {
+			t.Fatalf("expected %d entries, got %+v", len(operations), entries)
+		}
+		for index, operation := range operations {
+			if entries[index].Operation != operation {
+				t.Errorf("entry %d: expected %s, got %s", index, operation, entries[index].Operation)
+			}
+		}
+		created, update, deleted := entries[3], entries[2], entries[1]
+		if created.Before != nil || created.After == nil || created.Actor != "alice" || created.RequestId != "request-1" {
+			t.Errorf("unexpected create entry %+v", created)
+		}
+		if len(update.Diff) != 1 || update.Diff["title"] != (models.FieldChange{From: "Dubliners", To: "Ulysses"}) || update.Actor != "bob" || update.RequestId != "" {
+			t.Errorf("expected only the title to change, got %+v", update)
+		}
+		if deleted.Before == nil || deleted.After != nil {
+			t.Errorf("expected a deletion to leave no book, got %+v", deleted)
+		}
+		t.Log(update)
+	})
+
+	t.Run("Testing a failed change is not recorded", func(t *testing.T) {
+		if err := UpdateBookAudited(db, models.Book{Book_Id: 100000, Title: "x", Author: "y", Pub_Date: "2000-01-01"}, change); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows, got %v", err)
+		}
+		entries, err := GetAuditLog(db, AuditFilter{BookId: 100000}, 100, 0)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("expected no entries, got %+v %v", entries, err)
+		}
+	})
+
+	t.Run("Testing RevertBook", func(t *testing.T) {
+		entries := history()
+		created, deleted := entries[len(entries)-1], entries[len(entries)-3]
+		reverted, err := RevertBook(db, id, created.Audit_Id, Change{Actor: "carol"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current, _ := GetBook(db, id); reverted.Title != "Dubliners" || current.Title != "Dubliners" {
+			t.Errorf("expected the first version back, got %+v %+v", reverted, current)
+		}
+		if entry := history()[0]; entry.Operation != models.AuditRevert || entry.Diff["title"].To != "Dubliners" {
+			t.Errorf("expected the revert in the history, got %+v", entry)
+		}
+		if _, err := RevertBook(db, id, deleted.Audit_Id, change); !errors.Is(err, ErrNoVersion) {
+			t.Errorf("expected %v, got %v", ErrNoVersion, err)
+		}
+		if _, err := RevertBook(db, id+1, created.Audit_Id, change); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows for an entry of another book, got %v", err)
+		}
+	})
+
+	t.Run("Testing the filters", func(t *testing.T) {
+		entries, err := GetAuditLog(db, AuditFilter{BookId: id, Actor: "bob", Operation: models.AuditUpdate}, 100, 0)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("expected the update of bob, got %+v %v", entries, err)
+		}
+		entries, err = GetAuditLog(db, AuditFilter{BookId: id, Since: time.Now().Add(time.Hour)}, 100, 0)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("expected no entries in the future, got %+v %v", entries, err)
+		}
+		entries, err = GetAuditLog(db, AuditFilter{BookId: id}, 2, 1)
+		if err != nil || len(entries) != 2 {
+			t.Errorf("expected a page of 2, got %+v %v", entries, err)
+		}
+	})
+
+	t.Run("Testing the log is append-only", func(t *testing.T) {
+		if _, err := db.Exec("UPDATE AuditLog SET actor = 'mallory' WHERE book_id = ?", id); err == nil {
+			t.Error("expected the update of an entry to be refused")
+		}
+		if _, err := db.Exec("DELETE FROM AuditLog WHERE book_id = ?", id); err == nil {
+			t.Error("expected the removal of an entry to be refused")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+Covers of the books, the row of a cover says what its images are, the images themselves are in the storage
+The cover of a book in the trash is kept, but not served, until the book is restored or purged
+**/
+
+const coverColumns = "book_id, content_type, width, height, thumbnail_type, etag, updated_at"
+
+func scanCover(row rowScanner) (models.Cover, error) {
+	var cover models.Cover
+	var updatedAt string
+	if err := row.Scan(&cover.Book_Id, &cover.ContentType, &cover.Width, &cover.Height, &cover.ThumbnailType, &cover.Etag, &updatedAt); err != nil {
+		return cover, err
+	}
+	var err error
+	cover.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	return cover, err
+}
+
+// get the cover of a book, sql.ErrNoRows when it has none or is in the trash
+func GetCover(db *sql.DB, bookId int) (models.Cover, error) {
+	return scanCover(db.QueryRow("SELECT "+coverColumns+" FROM Covers WHERE book_id = ? AND book_id IN (SELECT book_id FROM Books WHERE "+notDeleted+")", bookId))
+}
+
+// set the cover of a book, returns the one it replaces, sql.ErrNoRows when the book doesn't exist or is in the trash
+func SetCover(db *sql.DB, cover models.Cover) (previous *models.Cover, err error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM Books WHERE book_id = ? AND "+notDeleted+")", cover.Book_Id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	if replaced, err := scanCover(tx.QueryRow("SELECT "+coverColumns+" FROM Covers WHERE book_id = ?", cover.Book_Id)); err == nil {
+		previous = &replaced
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO Covers ("+coverColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)", cover.Book_Id, cover.ContentType, cover.Width, cover.Height,
+		cover.ThumbnailType, cover.Etag, cover.UpdatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return previous, tx.Commit()
+}
+
+// remove the cover of a book, returns it so that its images can be removed, sql.ErrNoRows when it has none or is in the trash
+func DeleteCover(db *sql.DB, bookId int) (models.Cover, error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return models.Cover{}, err
+	}
+	defer tx.Rollback()
+
+	cover, err := scanCover(tx.QueryRow("SELECT "+coverColumns+" FROM Covers WHERE book_id = ? AND book_id IN (SELECT book_id FROM Books WHERE "+notDeleted+")", bookId))
+	if err != nil {
+		return cover, err
+	}
+	if _, err := tx.Exec("DELETE FROM Covers WHERE book_id = ?", bookId); err != nil {
+		return cover, err
+	}
+	return cover, tx.Commit()
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"testing"
+	"time"
+)
+
+func TestCovers(t *testing.T) {
+	id, err := AddBook(db, models.Book{Title: "Orlando", Author: "Virginia Woolf", Pub_Date: "1928-10-11"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM Covers WHERE book_id = ?", id)
+		db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+	})
+	cover := models.Cover{Book_Id: id, ContentType: "image/jpeg", Width: 600, Height: 900, ThumbnailType: "image/jpeg", Etag: "first", UpdatedAt: time.Now()}
+
+	t.Run("Testing SetCover replaces the cover", func(t *testing.T) {
+		if previous, err := SetCover(db, cover); err != nil || previous != nil {
+			t.Fatalf("expected a first cover, got %v %v", previous, err)
+		}
+		cover.Etag = "second"
+		previous, err := SetCover(db, cover)
+		if err != nil || previous == nil || previous.Etag != "first" {
+			t.Fatalf("expected the first cover to be replaced, got %v %v", previous, err)
+		}
+		if stored, err := GetCover(db, id); err != nil || stored.Etag != "second" || stored.Width != 600 {
+			t.Errorf("expected the second cover, got %+v %v", stored, err)
+		}
+		if _, err := SetCover(db, models.Cover{Book_Id: 999999, Etag: "none", UpdatedAt: time.Now()}); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows for a missing book, got %v", err)
+		}
+	})
+
+	t.Run("Testing the cover of a book in the trash is hidden", func(t *testing.T) {
+		if err := DeleteBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetCover(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows, got %v", err)
+		}
+		if err := RestoreBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetCover(db, id); err != nil {
+			t.Errorf("expected the cover back with the book, got %v", err)
+		}
+	})
+
+	t.Run("Testing DeleteCover", func(t *testing.T) {
+		if deleted, err := DeleteCover(db, id); err != nil || deleted.Etag != "second" {
+			t.Errorf("expected the cover to be deleted, got %+v %v", deleted, err)
+		}
+		if _, err := DeleteCover(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows when deleting twice, got %v", err)
+		}
+	})
+}
@@ -1,18 +1,125 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	_ "github.com/glebarez/go-sqlite"
-	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Connects to the database, returns a pointer to the db and an error value
-func ConnectDb(dbname, path string) (*sql.DB, error) {
+/**
+A DB opened by Open is two pools on the same file: readers, and a writer with a single connection
+sqlite allows one writer at a time, so writes queue up in the writer pool instead of failing with SQLITE_BUSY
+and, with WAL, the readers keep reading while a write is made
+The reader pool is what the rest of the server is given, the write functions of this package look its writer up
+**/
+
+// Options of the connections, part of the config section "database"
+type Options struct {
+	// wal lets the readers read while the writer writes, one of JournalModes
+	JournalMode string `json:"journal_mode"`
+	// how long a connection waits for a lock before it fails with SQLITE_BUSY
+	BusyTimeoutMs int `json:"busy_timeout_ms"`
+	// enforces the foreign keys of the schema
+	ForeignKeys bool `json:"foreign_keys"`
+	// how often sqlite waits for the disk, one of SynchronousLevels, normal is safe with wal
+	Synchronous string `json:"synchronous"`
+	// connections of the reader pool, the writer pool has one
+	MaxReaders int `json:"max_readers"`
+}
+
+var DefaultOptions = Options{JournalMode: "wal", BusyTimeoutMs: 5000, ForeignKeys: true, Synchronous: "normal", MaxReaders: 4}
+
+var (
+	JournalModes      = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+	SynchronousLevels = []string{"off", "normal", "full", "extra"}
+)
+
+// writers of the reader pools returned by Open
+var writers sync.Map
+
+// Open opens the reader and the writer pools of the DB file and pings them, so that a bad path fails here
+// returns the reader pool, close it with Close
+func Open(file string, options Options) (*sql.DB, error) {
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", options.BusyTimeoutMs))
+	pragmas.Add("_pragma", fmt.Sprintf("foreign_keys(%d)", map[bool]int{false: 0, true: 1}[options.ForeignKeys]))
+	pragmas.Add("_pragma", "synchronous("+options.Synchronous+")")
 
-	db, err := sql.Open("sqlite", path+dbname)
+	// an in-memory DB is one per connection, both pools must share the one connection
+	if file == ":memory:" || strings.Contains(file, "mode=memory") {
+		db, err := open(file, pragmas, 1)
+		return db, err
+	}
+
+	// the journal mode is kept in the file, the writer sets it
+	// immediate transactions take the write lock when they begin, not at their first write, when it may be too late to wait for it
+	writerPragmas := url.Values{"_txlock": {"immediate"}}
+	for _, pragma := range pragmas["_pragma"] {
+		writerPragmas.Add("_pragma", pragma)
+	}
+	writerPragmas.Add("_pragma", "journal_mode("+options.JournalMode+")")
+	writer, err := open(file, writerPragmas, 1)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
+	// readers can't write, a write that doesn't go through the writer fails instead of competing with it
+	pragmas.Add("_pragma", "query_only(1)")
+	reader, err := open(file, pragmas, max(options.MaxReaders, 1))
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	writers.Store(reader, writer)
+	return reader, nil
+}
+
+func open(file string, pragmas url.Values, connections int) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", file+"?"+pragmas.Encode())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(connections)
+	db.SetMaxIdleConns(connections)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// sql.Open doesn't connect, a ping makes sure the file can be opened with the pragmas
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", file, err)
+	}
 	return db, nil
 }
+
+// writer is the pool writes go through, the DB itself when it wasn't opened by Open (e.g. in tests)
+func writer(db *sql.DB) *sql.DB {
+	if writer, found := writers.Load(db); found {
+		return writer.(*sql.DB)
+	}
+	return db
+}
+
+// Close closes the pools of a DB opened by Open, and forgets its hooks
+func Close(db *sql.DB) error {
+	if writer, found := writers.LoadAndDelete(db); found {
+		writer.(*sql.DB).Close()
+	}
+	changeHooks.Delete(db)
+	return db.Close()
+}
+
+// Connects to the database, returns a pointer to the db and an error value
+func ConnectDb(dbname, path string, options Options) (*sql.DB, error) {
+	return Open(path+dbname, options)
+}
+
+// Backup writes a consistent copy of the database to a new file, safe while the server runs
+func Backup(db *sql.DB, filename string) error {
+	_, err := writer(db).Exec("VACUUM INTO ?", filename)
+	return err
+}
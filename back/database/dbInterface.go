@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	models "github.com/mimminou/BookIT-ByFood/back/models"
+	"strings"
+	"time"
 )
 
 /**
@@ -11,9 +13,215 @@ Refrained from using an ORM although I'm aware it's almost always better to use
 All queries are done using Prepared Statements to directly mitigate SQL injections
 **/
 
+// columns read for a book, in the order scanBook expects them
+const bookColumns = "book_id, title, author, num_pages, pub_date, isbn"
+
+// anything a book row can be scanned from, *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// what the writes need of *sql.DB and *sql.Tx, so that they can be made inside a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func scanBook(row rowScanner) (models.Book, error) {
+	var book models.Book
+	var isbn sql.NullString
+	err := row.Scan(&book.Book_Id, &book.Title, &book.Author, &book.Num_Pages, &book.Pub_Date, &isbn)
+	book.Isbn = isbn.String
+	return book, err
+}
+
+// ISBNs are optional, an empty one is stored as NULL
+func nullableIsbn(isbn string) sql.NullString {
+	return sql.NullString{String: isbn, Valid: isbn != ""}
+}
+
+// BookFilter narrows down the books returned by GetBooksFiltered, StreamBooks and ListBooks
+// empty fields are ignored, Title, Author and Search are case insensitive substring matches
+// Search matches either the title or the author, ExactAuthor and Year (YYYY) are exact matches
+// FromDate and ToDate are inclusive and expect YYYY-MM-DD
+// the books in the trash are never returned, see trash.go
+type BookFilter struct {
+	Title       string
+	Author      string
+	Search      string
+	ExactAuthor string
+	Year        string
+	FromDate    string
+	ToDate      string
+}
+
+// builds the WHERE clause and its arguments out of a filter
+func (filter BookFilter) where() (string, []any) {
+	conditions := []string{notDeleted}
+	var args []any
+	if filter.Title != "" {
+		conditions = append(conditions, "title LIKE ?")
+		args = append(args, "%"+filter.Title+"%")
+	}
+	if filter.Author != "" {
+		conditions = append(conditions, "author LIKE ?")
+		args = append(args, "%"+filter.Author+"%")
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "(title LIKE ? OR author LIKE ?)")
+		args = append(args, "%"+filter.Search+"%", "%"+filter.Search+"%")
+	}
+	if filter.ExactAuthor != "" {
+		conditions = append(conditions, "author = ?")
+		args = append(args, filter.ExactAuthor)
+	}
+	if filter.Year != "" {
+		conditions = append(conditions, "substr(pub_date, 1, 4) = ?")
+		args = append(args, filter.Year)
+	}
+	if filter.FromDate != "" {
+		conditions = append(conditions, "pub_date >= ?")
+		args = append(args, filter.FromDate)
+	}
+	if filter.ToDate != "" {
+		conditions = append(conditions, "pub_date <= ?")
+		args = append(args, filter.ToDate)
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
 // get all books
 func GetBooks(db *sql.DB) ([]models.Book, error) {
-	rows, err := db.Query("SELECT * FROM Books")
+	return GetBooksFiltered(db, BookFilter{})
+}
+
+// get all books matching the filter
+func GetBooksFiltered(db *sql.DB, filter BookFilter) ([]models.Book, error) {
+	books := make([]models.Book, 0)
+	err := StreamBooks(db, filter, func(book models.Book) error {
+		books = append(books, book)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// calls fn for every book matching the filter, one row at a time, without loading the whole table in memory
+// iteration stops at the first error returned by fn
+func StreamBooks(db *sql.DB, filter BookFilter, fn func(models.Book) error) error {
+	where, args := filter.where()
+	rows, err := db.Query("SELECT "+bookColumns+" FROM Books"+where+" ORDER BY book_id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(book); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// BookOrder is the order ListBooks returns books in
+type BookOrder int
+
+const (
+	// insertion order
+	OrderById BookOrder = iota
+	// most recently added first
+	OrderNewest
+	// alphabetical, then by id
+	OrderTitle
+)
+
+func (order BookOrder) orderBy() string {
+	switch order {
+	case OrderNewest:
+		return " ORDER BY book_id DESC"
+	case OrderTitle:
+		return " ORDER BY title COLLATE NOCASE, book_id"
+	default:
+		return " ORDER BY book_id"
+	}
+}
+
+// get one page of the books matching the filter, limit and offset work like their SQL counterparts
+func ListBooks(db *sql.DB, filter BookFilter, order BookOrder, limit, offset int) ([]models.Book, error) {
+	where, args := filter.where()
+	args = append(args, limit, offset)
+	return queryBooks(db, "SELECT "+bookColumns+" FROM Books"+where+order.orderBy()+" LIMIT ? OFFSET ?", args...)
+}
+
+// count the books matching the filter
+func CountBooks(db *sql.DB, filter BookFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM Books"+where, args...).Scan(&count)
+	return count, err
+}
+
+// get every author with the number of books they wrote, sorted by name
+func GetAuthors(db *sql.DB) ([]models.Facet, error) {
+	return getFacets(db, "SELECT author, COUNT(*) FROM Books WHERE "+notDeleted+" GROUP BY author ORDER BY author COLLATE NOCASE")
+}
+
+// get every publication year with the number of books published that year, most recent first
+func GetPublicationYears(db *sql.DB) ([]models.Facet, error) {
+	return getFacets(db, "SELECT substr(pub_date, 1, 4) AS year, COUNT(*) FROM Books WHERE "+notDeleted+" GROUP BY year ORDER BY year DESC")
+}
+
+// runs a query returning (value, count) rows
+func getFacets(db *sql.DB, query string) ([]models.Facet, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := make([]models.Facet, 0)
+	for rows.Next() {
+		var facet models.Facet
+		if err := rows.Scan(&facet.Value, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
+
+// get the books with the ids, in no particular order, unknown ids are skipped
+func GetBooksByIds(db *sql.DB, ids []int) ([]models.Book, error) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return queryBooks(db, "SELECT "+bookColumns+" FROM Books WHERE book_id IN ("+placeholders(len(ids))+") AND "+notDeleted, args...)
+}
+
+// get the books written by any of the authors, ordered by title
+func GetBooksByAuthors(db *sql.DB, authors []string) ([]models.Book, error) {
+	args := make([]any, len(authors))
+	for i, author := range authors {
+		args[i] = author
+	}
+	return queryBooks(db, "SELECT "+bookColumns+" FROM Books WHERE author IN ("+placeholders(len(authors))+") AND "+notDeleted+OrderTitle.orderBy(), args...)
+}
+
+// "?, ?, ?" for an IN clause of count values
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+func queryBooks(db *sql.DB, query string, args ...any) ([]models.Book, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -21,25 +229,32 @@ func GetBooks(db *sql.DB) ([]models.Book, error) {
 
 	books := make([]models.Book, 0)
 	for rows.Next() {
-		var book models.Book
-		if err := rows.Scan(&book.Book_Id, &book.Title, &book.Author, &book.Num_Pages, &book.Pub_Date); err != nil {
+		book, err := scanBook(rows)
+		if err != nil {
 			return nil, err
 		}
 		books = append(books, book)
 	}
-	return books, nil
+	return books, rows.Err()
 }
 
 // get single book
 func GetBook(db *sql.DB, Book_id int) (models.Book, error) {
-	var book models.Book
-	err := db.QueryRow("SELECT * FROM Books WHERE Book_id = ?", Book_id).Scan(&book.Book_Id, &book.Title, &book.Author, &book.Num_Pages, &book.Pub_Date)
-	return book, err
+	return scanBook(db.QueryRow("SELECT "+bookColumns+" FROM Books WHERE Book_id = ? AND "+notDeleted, Book_id))
+}
+
+// get the book with an ISBN, the first one added when several have it, sql.ErrNoRows when none has it
+func GetBookByIsbn(db *sql.DB, isbn string) (models.Book, error) {
+	return scanBook(db.QueryRow("SELECT "+bookColumns+" FROM Books WHERE isbn = ? AND "+notDeleted+" ORDER BY book_id LIMIT 1", isbn))
 }
 
 // add book
 func AddBook(db *sql.DB, book models.Book) (int, error) {
-	operation, err := db.Exec("INSERT INTO Books (title, author, num_pages, pub_date) VALUES (?, ?, ?, ?)", book.Title, book.Author, book.Num_Pages, book.Pub_Date)
+	return addBook(writer(db), book)
+}
+
+func addBook(exec execer, book models.Book) (int, error) {
+	operation, err := exec.Exec("INSERT INTO Books (title, author, num_pages, pub_date, isbn) VALUES (?, ?, ?, ?, ?)", book.Title, book.Author, book.Num_Pages, book.Pub_Date, nullableIsbn(book.Isbn))
 	if err != nil {
 		return 0, err
 	}
@@ -51,9 +266,43 @@ func AddBook(db *sql.DB, book models.Book) (int, error) {
 	return int(RowsInserted), err
 }
 
-// delete book
+// add several books inside a single transaction, either all of them are inserted or none
+// returns the ids of the inserted books in the same order
+func AddBooks(db *sql.DB, books []models.Book) ([]int, error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.Prepare("INSERT INTO Books (title, author, num_pages, pub_date, isbn) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer statement.Close()
+
+	ids := make([]int, 0, len(books))
+	for _, book := range books {
+		operation, err := statement.Exec(book.Title, book.Author, book.Num_Pages, book.Pub_Date, nullableIsbn(book.Isbn))
+		if err != nil {
+			return nil, err
+		}
+		id, err := operation.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int(id))
+	}
+	return ids, tx.Commit()
+}
+
+// delete book, it is moved to the trash, where it can be restored from until it is purged
 func DeleteBook(db *sql.DB, id int) error {
-	operation, err := db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+	return deleteBook(writer(db), id)
+}
+
+func deleteBook(exec execer, id int) error {
+	operation, err := exec.Exec("UPDATE Books SET deleted_at = ? WHERE book_id = ? AND "+notDeleted, time.Now().UTC().Format(time.RFC3339), id)
 	if err != nil {
 		return err
 	}
@@ -67,7 +316,11 @@ func DeleteBook(db *sql.DB, id int) error {
 // update book
 // PUT request, not PATCH, so no need to do partial update
 func UpdateBook(db *sql.DB, book models.Book) error {
-	operation, err := db.Exec("UPDATE Books SET title = ?, author = ?, num_pages = ?, pub_date = ? WHERE Book_id = ?", book.Title, book.Author, book.Num_Pages, book.Pub_Date, book.Book_Id)
+	return updateBook(writer(db), book)
+}
+
+func updateBook(exec execer, book models.Book) error {
+	operation, err := exec.Exec("UPDATE Books SET title = ?, author = ?, num_pages = ?, pub_date = ?, isbn = ? WHERE Book_id = ? AND "+notDeleted, book.Title, book.Author, book.Num_Pages, book.Pub_Date, nullableIsbn(book.Isbn), book.Book_Id)
 	if err != nil {
 		return err
 	}
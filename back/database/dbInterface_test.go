@@ -47,19 +47,22 @@ func setupMockDB() (*sql.DB, error) {
 
 	//apply schema
 	db.Exec(schema)
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
 
 	//creates some mock books
 	books := []models.Book{
-		{0, "To Kill a Mockingbird", "Harper Lee", nil, "1998-08-30T00:00:00Z"},
-		{1, "1984", "George Orwell", nil, "1949-06-08"},
-		{2, "The Great Gatsby", "F. Scott Fitzgerald", nil, "1925-04-10"},
-		{3, "Pride and Prejudice", "Jane Austen", nil, "1813-01-28"},
-		{4, "The Catcher in the Rye", "J.D. Salinger", nil, "1951-07-16"},
-		{5, "The Hobbit", "J.R.R. Tolkien", nil, "1937-09-21"},
-		{6, "To the Lighthouse", "Virginia Woolf", nil, "1927-05-05"},
-		{7, "Moby-Dick", "Herman Melville", nil, "1851-10-18"},
-		{8, "Frankenstein", "Mary Shelley", nil, "1818-01-01"},
-		{9, "The Picture of Dorian Gray", "Oscar Wilde", nil, "1890-07-20"},
+		{Book_Id: 0, Title: "To Kill a Mockingbird", Author: "Harper Lee", Num_Pages: nil, Pub_Date: "1998-08-30T00:00:00Z"},
+		{Book_Id: 1, Title: "1984", Author: "George Orwell", Num_Pages: nil, Pub_Date: "1949-06-08"},
+		{Book_Id: 2, Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Num_Pages: nil, Pub_Date: "1925-04-10"},
+		{Book_Id: 3, Title: "Pride and Prejudice", Author: "Jane Austen", Num_Pages: nil, Pub_Date: "1813-01-28"},
+		{Book_Id: 4, Title: "The Catcher in the Rye", Author: "J.D. Salinger", Num_Pages: nil, Pub_Date: "1951-07-16"},
+		{Book_Id: 5, Title: "The Hobbit", Author: "J.R.R. Tolkien", Num_Pages: nil, Pub_Date: "1937-09-21"},
+		{Book_Id: 6, Title: "To the Lighthouse", Author: "Virginia Woolf", Num_Pages: nil, Pub_Date: "1927-05-05"},
+		{Book_Id: 7, Title: "Moby-Dick", Author: "Herman Melville", Num_Pages: nil, Pub_Date: "1851-10-18"},
+		{Book_Id: 8, Title: "Frankenstein", Author: "Mary Shelley", Num_Pages: nil, Pub_Date: "1818-01-01"},
+		{Book_Id: 9, Title: "The Picture of Dorian Gray", Author: "Oscar Wilde", Num_Pages: nil, Pub_Date: "1890-07-20"},
 	}
 
 	for i, book := range books {
@@ -110,7 +113,7 @@ func TestControllerAdd(t *testing.T) {
 		t.Fatal(dberr)
 	}
 
-	book := models.Book{10, "The Hobbit", "J.R.R. Tolkien", pagesPointers[14], "1937-09-21"}
+	book := models.Book{Book_Id: 10, Title: "The Hobbit", Author: "J.R.R. Tolkien", Num_Pages: pagesPointers[14], Pub_Date: "1937-09-21"}
 	_, err := AddBook(db, book)
 	if err != nil {
 		t.Fatal(err)
@@ -143,7 +146,7 @@ func TestControllerUpdate(t *testing.T) {
 	}
 
 	t.Run("Testing Update Book", func(t *testing.T) {
-		book := models.Book{7, "Moby-Dick", "Test Author", nil, "1851-12-18"}
+		book := models.Book{Book_Id: 7, Title: "Moby-Dick", Author: "Test Author", Num_Pages: nil, Pub_Date: "1851-12-18"}
 		err := UpdateBook(db, book)
 		if err != nil {
 			t.Fatal(err)
@@ -151,10 +154,156 @@ func TestControllerUpdate(t *testing.T) {
 	})
 
 	t.Run("Testing update non Existing book", func(t *testing.T) {
-		book := models.Book{50, "LOTR", "Test Author", nil, "1951-12-18"}
+		book := models.Book{Book_Id: 50, Title: "LOTR", Author: "Test Author", Num_Pages: nil, Pub_Date: "1951-12-18"}
 		err := UpdateBook(db, book)
 		if err != sql.ErrNoRows {
 			t.Errorf("Expected NoRows error, got %v", err)
 		}
 	})
 }
+
+func TestControllerFilter(t *testing.T) {
+	if dberr != nil {
+		t.Fatal(dberr)
+	}
+
+	t.Run("Testing filter by author", func(t *testing.T) {
+		books, err := GetBooksFiltered(db, BookFilter{Author: "shelley"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 1 || books[0].Title != "Frankenstein" {
+			t.Errorf("Expected Frankenstein, got %v", books)
+		}
+	})
+
+	t.Run("Testing filter by date range", func(t *testing.T) {
+		books, err := GetBooksFiltered(db, BookFilter{FromDate: "1880-01-01", ToDate: "1926-12-31"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The Picture of Dorian Gray and The Great Gatsby
+		if len(books) != 2 {
+			t.Errorf("Expected 2 books, got %v", books)
+		}
+	})
+}
+
+func TestControllerAddMany(t *testing.T) {
+	if dberr != nil {
+		t.Fatal(dberr)
+	}
+
+	t.Run("Testing adding several books", func(t *testing.T) {
+		books := []models.Book{
+			{Title: "Dune", Author: "Frank Herbert", Pub_Date: "1965-08-01"},
+			{Title: "Emma", Author: "Jane Austen", Pub_Date: "1815-12-23"},
+		}
+		ids, err := AddBooks(db, books)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 2 || ids[1] != ids[0]+1 {
+			t.Errorf("Expected 2 consecutive ids, got %v", ids)
+		}
+	})
+}
+
+func TestControllerPages(t *testing.T) {
+	if dberr != nil {
+		t.Fatal(dberr)
+	}
+
+	t.Run("Testing pages of books", func(t *testing.T) {
+		total, err := CountBooks(db, BookFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		newest, err := ListBooks(db, BookFilter{}, OrderNewest, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(newest) != 2 || newest[0].Book_Id < newest[1].Book_Id {
+			t.Errorf("Expected the 2 most recent books, got %v", newest)
+		}
+		rest, err := ListBooks(db, BookFilter{}, OrderById, total, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rest) != total-2 {
+			t.Errorf("Expected %d books after the first 2, got %d", total-2, len(rest))
+		}
+	})
+
+	t.Run("Testing exact author, year and search filters", func(t *testing.T) {
+		for filter, expected := range map[BookFilter]int{
+			{ExactAuthor: "Mary Shelley"}: 1,
+			{ExactAuthor: "Shelley"}:      0,
+			{Year: "1818"}:                1,
+			{Search: "frankenstein"}:      1,
+			{Search: "mary shel"}:         1,
+		} {
+			count, err := CountBooks(db, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != expected {
+				t.Errorf("Expected %d books for %+v, got %d", expected, filter, count)
+			}
+		}
+	})
+
+	t.Run("Testing authors and years", func(t *testing.T) {
+		authors, err := GetAuthors(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		years, err := GetPublicationYears(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total, _ := CountBooks(db, BookFilter{})
+		authorsTotal, yearsTotal := 0, 0
+		for _, author := range authors {
+			authorsTotal += author.Count
+		}
+		for i, year := range years {
+			yearsTotal += year.Count
+			if len(year.Value) != 4 || (i > 0 && years[i-1].Value < year.Value) {
+				t.Errorf("Expected years, most recent first, got %v", years)
+			}
+		}
+		if authorsTotal != total || yearsTotal != total {
+			t.Errorf("Expected every book to be counted once, got %d and %d for %d books", authorsTotal, yearsTotal, total)
+		}
+	})
+}
+
+func TestControllerGetMany(t *testing.T) {
+	if dberr != nil {
+		t.Fatal(dberr)
+	}
+
+	t.Run("Testing books by ids", func(t *testing.T) {
+		books, err := GetBooksByIds(db, []int{9, 9, 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 1 || books[0].Title != "Frankenstein" {
+			t.Errorf("Expected Frankenstein only, got %v", books)
+		}
+		if books, err := GetBooksByIds(db, nil); err != nil || len(books) != 0 {
+			t.Errorf("Expected no books, got %v %v", books, err)
+		}
+	})
+
+	t.Run("Testing books by authors", func(t *testing.T) {
+		books, err := GetBooksByAuthors(db, []string{"Mary Shelley", "Oscar Wilde", "Shelley"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 2 || books[0].Title != "Frankenstein" || books[1].Author != "Oscar Wilde" {
+			t.Errorf("Expected the books of Mary Shelley and Oscar Wilde by title, got %v", books)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func openTestFile(t *testing.T) *sql.DB {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "bookit.sqlite")
+	fileDb, err := Open(file, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close(fileDb) })
+	if _, err := writer(fileDb).Exec(`CREATE TABLE Books (
+    book_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    author TEXT NOT NULL,
+    num_pages INTEGER,
+    pub_date DATE NOT NULL
+)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(fileDb); err != nil {
+		t.Fatal(err)
+	}
+	return fileDb
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("Testing the pragmas", func(t *testing.T) {
+		fileDb := openTestFile(t)
+		var journalMode string
+		var busyTimeout, foreignKeys int
+		if err := fileDb.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+			t.Errorf("expected wal, got %q %v", journalMode, err)
+		}
+		if err := fileDb.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil || busyTimeout != DefaultOptions.BusyTimeoutMs {
+			t.Errorf("expected a busy timeout of %d, got %d %v", DefaultOptions.BusyTimeoutMs, busyTimeout, err)
+		}
+		if err := fileDb.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+			t.Errorf("expected the foreign keys on, got %d %v", foreignKeys, err)
+		}
+	})
+
+	t.Run("Testing a write on the readers", func(t *testing.T) {
+		fileDb := openTestFile(t)
+		_, err := fileDb.Exec("INSERT INTO Books (title, author, pub_date) VALUES ('a', 'b', '2024-01-01')")
+		if err == nil {
+			t.Error("expected the reader pool to refuse a write")
+		}
+		t.Log(err)
+	})
+
+	t.Run("Testing a path that can't be opened", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "missing", "bookit.sqlite")
+		if _, err := Open(file, DefaultOptions); err == nil {
+			t.Error("expected an error when the directory doesn't exist")
+		} else {
+			t.Log(err)
+		}
+	})
+}
+
+// writers and readers at the same time, none of them may fail with SQLITE_BUSY
+func TestConcurrency(t *testing.T) {
+	fileDb := openTestFile(t)
+	const workers, writes = 8, 25
+
+	var group sync.WaitGroup
+	errs := make(chan error, 2*workers*writes)
+	for worker := 0; worker < workers; worker++ {
+		group.Add(2)
+		go func(worker int) {
+			defer group.Done()
+			for index := 0; index < writes; index++ {
+				book := models.Book{Title: fmt.Sprintf("Book %d-%d", worker, index), Author: "Author", Pub_Date: "2024-01-01"}
+				id, err := AddBook(fileDb, book)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				book.Book_Id = id
+				book.Title += " (2nd edition)"
+				if err := UpdateBook(fileDb, book); err != nil {
+					errs <- err
+				}
+			}
+		}(worker)
+		go func() {
+			defer group.Done()
+			for index := 0; index < writes; index++ {
+				if _, err := CountBooks(fileDb, BookFilter{}); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	group.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	count, err := CountBooks(fileDb, BookFilter{})
+	if err != nil || count != workers*writes {
+		t.Errorf("expected %d books, got %d %v", workers*writes, count, err)
+	}
+}
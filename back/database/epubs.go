@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+EPUB files of the books, the row of a file says what it is, the file itself is in the storage
+Like a cover, the file of a book in the trash is kept, but not served, until the book is restored or purged
+**/
+
+const epubColumns = "book_id, filename, size, sha256, language, identifiers, etag, uploaded_at"
+
+func scanEpub(row rowScanner) (models.Epub, error) {
+	var epub models.Epub
+	var identifiers, uploadedAt string
+	if err := row.Scan(&epub.Book_Id, &epub.Filename, &epub.Size, &epub.Sha256, &epub.Language, &identifiers, &epub.Etag, &uploadedAt); err != nil {
+		return epub, err
+	}
+	if err := json.Unmarshal([]byte(identifiers), &epub.Identifiers); err != nil {
+		return epub, err
+	}
+	var err error
+	epub.UploadedAt, err = time.Parse(time.RFC3339, uploadedAt)
+	return epub, err
+}
+
+// get the EPUB of a book, sql.ErrNoRows when it has none or is in the trash
+func GetEpub(db *sql.DB, bookId int) (models.Epub, error) {
+	return scanEpub(db.QueryRow("SELECT "+epubColumns+" FROM Epubs WHERE book_id = ? AND book_id IN (SELECT book_id FROM Books WHERE "+notDeleted+")", bookId))
+}
+
+// set the EPUB of a book, returns the one it replaces, sql.ErrNoRows when the book doesn't exist or is in the trash
+func SetEpub(db *sql.DB, epub models.Epub) (previous *models.Epub, err error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if previous, err = setEpub(tx, epub); err != nil {
+		return nil, err
+	}
+	return previous, tx.Commit()
+}
+
+// SaveBookEpub adds the book, or updates it when it has an id, and sets its EPUB in the same transaction, recorded in the audit log
+// returns the id of the book and the EPUB it replaces, the book is never written without its file
+func SaveBookEpub(db *sql.DB, book models.Book, epub models.Epub, change Change) (id int, previous *models.Epub, err error) {
+	operation := models.AuditUpdate
+	if book.Book_Id == 0 {
+		operation = models.AuditCreate
+	}
+	id, err = audited(db, book.Book_Id, operation, change, func(tx *sql.Tx) (int, error) {
+		id := book.Book_Id
+		var err error
+		if id == 0 {
+			id, err = addBook(tx, book)
+		} else {
+			err = updateBook(tx, book)
+		}
+		if err != nil {
+			return 0, err
+		}
+		epub.Book_Id = id
+		previous, err = setEpub(tx, epub)
+		return id, err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, previous, nil
+}
+
+func setEpub(tx *sql.Tx, epub models.Epub) (previous *models.Epub, err error) {
+	identifiers, err := json.Marshal(epub.Identifiers)
+	if err != nil {
+		return nil, err
+	}
+	if epub.Identifiers == nil {
+		identifiers = []byte("[]")
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM Books WHERE book_id = ? AND "+notDeleted+")", epub.Book_Id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	if replaced, err := scanEpub(tx.QueryRow("SELECT "+epubColumns+" FROM Epubs WHERE book_id = ?", epub.Book_Id)); err == nil {
+		previous = &replaced
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO Epubs ("+epubColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)", epub.Book_Id, epub.Filename, epub.Size, epub.Sha256,
+		epub.Language, string(identifiers), epub.Etag, epub.UploadedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// remove the EPUB of a book, returns it so that its file can be removed, sql.ErrNoRows when it has none or is in the trash
+func DeleteEpub(db *sql.DB, bookId int) (models.Epub, error) {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return models.Epub{}, err
+	}
+	defer tx.Rollback()
+
+	epub, err := scanEpub(tx.QueryRow("SELECT "+epubColumns+" FROM Epubs WHERE book_id = ? AND book_id IN (SELECT book_id FROM Books WHERE "+notDeleted+")", bookId))
+	if err != nil {
+		return epub, err
+	}
+	if _, err := tx.Exec("DELETE FROM Epubs WHERE book_id = ?", bookId); err != nil {
+		return epub, err
+	}
+	return epub, tx.Commit()
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEpubs(t *testing.T) {
+	id, err := AddBook(db, models.Book{Title: "Jacob's Room", Author: "Virginia Woolf", Pub_Date: "1922-10-26", Isbn: "9780156030359"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM Epubs WHERE book_id = ?", id)
+		db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+	})
+	epub := models.Epub{Book_Id: id, Filename: "jacobs-room.epub", Size: 1024, Sha256: "ab", Language: "en", Identifiers: []string{"urn:isbn:9780156030359"}, Etag: "first", UploadedAt: time.Now()}
+
+	t.Run("Testing GetBookByIsbn", func(t *testing.T) {
+		if book, err := GetBookByIsbn(db, "9780156030359"); err != nil || book.Book_Id != id {
+			t.Errorf("expected book %d, got %+v %v", id, book, err)
+		}
+		if _, err := GetBookByIsbn(db, "0156949601"); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows, got %v", err)
+		}
+	})
+
+	t.Run("Testing SetEpub replaces the file", func(t *testing.T) {
+		if previous, err := SetEpub(db, epub); err != nil || previous != nil {
+			t.Fatalf("expected a first file, got %v %v", previous, err)
+		}
+		epub.Etag = "second"
+		previous, err := SetEpub(db, epub)
+		if err != nil || previous == nil || previous.Etag != "first" {
+			t.Fatalf("expected the first file to be replaced, got %v %v", previous, err)
+		}
+		if stored, err := GetEpub(db, id); err != nil || stored.Etag != "second" || !reflect.DeepEqual(stored.Identifiers, epub.Identifiers) {
+			t.Errorf("expected the second file, got %+v %v", stored, err)
+		}
+		if _, err := SetEpub(db, models.Epub{Book_Id: 999999, Etag: "none", UploadedAt: time.Now()}); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows for a missing book, got %v", err)
+		}
+	})
+
+	t.Run("Testing SaveBookEpub writes the book with its file", func(t *testing.T) {
+		file := models.Epub{Filename: "the-voyage-out.epub", Etag: "voyage", UploadedAt: time.Now()}
+		created, previous, err := SaveBookEpub(db, models.Book{Title: "The Voyage Out", Author: "Virginia Woolf", Pub_Date: "1915-03-26"}, file, Change{Actor: "alice"})
+		if err != nil || previous != nil {
+			t.Fatalf("expected the book to be created, got %v %v", previous, err)
+		}
+		t.Cleanup(func() {
+			db.Exec("DELETE FROM Epubs WHERE book_id = ?", created)
+			db.Exec("DELETE FROM Books WHERE book_id = ?", created)
+		})
+		if stored, err := GetEpub(db, created); err != nil || stored.Etag != "voyage" {
+			t.Errorf("expected the file of the book, got %+v %v", stored, err)
+		}
+		if entries, err := GetAuditLog(db, AuditFilter{BookId: created}, 10, 0); err != nil || len(entries) != 1 || entries[0].Operation != models.AuditCreate {
+			t.Errorf("expected the creation in the audit log, got %+v %v", entries, err)
+		}
+
+		file.Etag = "voyage-2"
+		if id, previous, err := SaveBookEpub(db, models.Book{Book_Id: created, Title: "The Voyage Out", Author: "Virginia Woolf", Pub_Date: "1915-03-26"}, file, Change{}); err != nil || id != created || previous == nil || previous.Etag != "voyage" {
+			t.Errorf("expected the file to be replaced, got %d %+v %v", id, previous, err)
+		}
+		// nothing is written for a book that doesn't exist
+		if _, _, err := SaveBookEpub(db, models.Book{Book_Id: 999999, Title: "None", Author: "None", Pub_Date: "1915-03-26"}, file, Change{}); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows, got %v", err)
+		}
+	})
+
+	t.Run("Testing the file of a book in the trash is hidden", func(t *testing.T) {
+		if err := DeleteBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetEpub(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows, got %v", err)
+		}
+		if _, err := GetBookByIsbn(db, "9780156030359"); err != sql.ErrNoRows {
+			t.Errorf("expected the book in the trash to be left out, got %v", err)
+		}
+		if err := RestoreBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Testing DeleteEpub", func(t *testing.T) {
+		if deleted, err := DeleteEpub(db, id); err != nil || deleted.Etag != "second" {
+			t.Errorf("expected the file to be deleted, got %+v %v", deleted, err)
+		}
+		if _, err := DeleteEpub(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows when deleting twice, got %v", err)
+		}
+	})
+}
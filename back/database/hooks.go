@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"sync"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+Hooks of the changes of the books, called with the event of each audited change once it is committed,
+whichever API made it (REST, GraphQL, gRPC or an import), e.g. to feed the live updates of GET /events
+the hooks are those of the process, the changes of bookit import reach the webhooks through the outbox, not the hooks of the server
+**/
+
+// hooks of each DB, by the handle given to the *Audited functions
+var changeHooks sync.Map
+
+type hookList struct {
+	lock  sync.RWMutex
+	hooks []func(models.BookEvent)
+}
+
+// OnBookChange calls the hook after each change of a book of the DB, in the goroutine that made the change so it must not block
+// the hooks of a change are called in the order they were added, after the change is committed
+func OnBookChange(db *sql.DB, hook func(models.BookEvent)) {
+	value, _ := changeHooks.LoadOrStore(db, &hookList{})
+	list := value.(*hookList)
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	list.hooks = append(list.hooks, hook)
+}
+
+// passes the committed events to the hooks of the DB
+func notify(db *sql.DB, events ...models.BookEvent) {
+	value, found := changeHooks.Load(db)
+	if !found {
+		return
+	}
+	list := value.(*hookList)
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+	for _, event := range events {
+		for _, hook := range list.hooks {
+			hook(event)
+		}
+	}
+}
+
+// RecentEvents returns the events of the last changes of the books, up to limit, the oldest first
+// they are read back from the audit log, e.g. to fill the event log of GET /events on start
+func RecentEvents(db *sql.DB, limit int) ([]models.BookEvent, error) {
+	entries, err := GetAuditLog(db, AuditFilter{}, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]models.BookEvent, len(entries))
+	for index, entry := range entries {
+		events[len(entries)-1-index] = eventOf(entry)
+	}
+	return events, nil
+}
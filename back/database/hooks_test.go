@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	hooked, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooked.SetMaxOpenConns(1)
+	defer Close(hooked)
+	if _, err := hooked.Exec(`CREATE TABLE Books (book_id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, author TEXT NOT NULL, num_pages INTEGER, pub_date DATE NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(hooked); err != nil {
+		t.Fatal(err)
+	}
+	var received []models.BookEvent
+	OnBookChange(hooked, func(event models.BookEvent) { received = append(received, event) })
+
+	t.Run("Testing the hooks get the committed changes", func(t *testing.T) {
+		ids, err := AddBooksAudited(hooked, []models.Book{
+			{Title: "Emma", Author: "Jane Austen", Pub_Date: "1815-12-23"},
+			{Title: "Persuasion", Author: "Jane Austen", Pub_Date: "1817-12-20"},
+		}, Change{Actor: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteBookAudited(hooked, ids[0], Change{}); err != nil {
+			t.Fatal(err)
+		}
+		// refused, nothing to pass on
+		UpdateBookAudited(hooked, models.Book{Book_Id: 100, Title: "x", Author: "y", Pub_Date: "2000-01-01"}, Change{})
+		if len(received) != 3 || received[0].Event != models.EventBookCreated || received[2].Event != models.EventBookDeleted ||
+			received[2].Book == nil || received[2].Book.Title != "Emma" || received[1].Actor != "alice" {
+			t.Errorf("expected 2 creations and a deletion, got %+v", received)
+		}
+		t.Log(received)
+	})
+
+	t.Run("Testing RecentEvents", func(t *testing.T) {
+		recent, err := RecentEvents(hooked, 2)
+		if err != nil || len(recent) != 2 || recent[0].Audit_Id != received[1].Audit_Id || recent[1].Event != models.EventBookDeleted {
+			t.Errorf("expected the last 2 events in order, got %+v %v", recent, err)
+		}
+	})
+}
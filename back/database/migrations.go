@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+/**
+Schema changes made after the initial schema (DB/schema.sql)
+The version of a DB is kept in sqlite's user_version pragma, each migration bumps it by one
+Never edit or reorder a migration that has been released, append a new one instead
+**/
+
+var migrations = []string{
+	// 1: books can carry an ISBN, needed to exchange records with other library systems
+	`ALTER TABLE Books ADD COLUMN isbn TEXT;`,
+	// 2: short links of the URL cleaner, times are RFC 3339 in UTC so that they sort as text
+	`CREATE TABLE ShortLinks (
+    slug TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    permanent INTEGER NOT NULL DEFAULT 0,
+    disabled INTEGER NOT NULL DEFAULT 0,
+    expires_at TEXT,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    last_clicked_at TEXT,
+    created_at TEXT NOT NULL
+);`,
+	// 3: users of the API, identified by a token of which only the hash is kept
+	`CREATE TABLE Users (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TEXT NOT NULL
+);`,
+	// 4: deleted books go to the trash until they are purged, deleted_at is RFC 3339 in UTC
+	`ALTER TABLE Books ADD COLUMN deleted_at TEXT;
+CREATE INDEX books_deleted_at ON Books (deleted_at);`,
+	// 5: audit log of the changes made to the books, snapshots are the JSON of the book, NULL when it didn't exist or was in the trash
+	// the log is append-only, the triggers refuse to change or remove an entry
+	`CREATE TABLE AuditLog (
+    audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT,
+    at TEXT NOT NULL,
+    before_book TEXT,
+    after_book TEXT
+);
+CREATE INDEX audit_log_book_id ON AuditLog (book_id);
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON AuditLog BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON AuditLog BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;`,
+	// 6: webhooks, events is a comma separated list, and their deliveries, which are both the outbox the dispatcher sends
+	// from and the log of what was sent
+	`CREATE TABLE Webhooks (
+    webhook_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL
+);
+CREATE TABLE WebhookDeliveries (
+    delivery_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES Webhooks (webhook_id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT,
+    last_attempt_at TEXT,
+    response_status INTEGER,
+    error TEXT,
+    redelivery_of INTEGER,
+    created_at TEXT NOT NULL
+);
+CREATE INDEX webhook_deliveries_webhook_id ON WebhookDeliveries (webhook_id);
+CREATE INDEX webhook_deliveries_due ON WebhookDeliveries (status, next_attempt_at);`,
+	// 7: covers of the books, the images are in the storage under the etag, so that an upload never replaces the files being served
+	`CREATE TABLE Covers (
+    book_id INTEGER PRIMARY KEY REFERENCES Books (book_id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    thumbnail_type TEXT NOT NULL,
+    etag TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);`,
+	// 8: EPUB files of the books, stored under the etag like the covers, identifiers is the JSON list of the identifiers of the file
+	`CREATE TABLE Epubs (
+    book_id INTEGER PRIMARY KEY REFERENCES Books (book_id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    language TEXT NOT NULL,
+    identifiers TEXT NOT NULL,
+    etag TEXT NOT NULL,
+    uploaded_at TEXT NOT NULL
+);`,
+}
+
+// SchemaVersion is the version a DB has once all migrations are applied
+var SchemaVersion = len(migrations)
+
+// GetSchemaVersion returns the migration version the DB is at
+func GetSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Migrate applies the migrations the DB is missing, each one inside its own transaction
+func Migrate(db *sql.DB) error {
+	version, err := GetSchemaVersion(writer(db))
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("DB schema version %d is newer than the %d supported by this build", version, SchemaVersion)
+	}
+
+	for version < SchemaVersion {
+		tx, err := writer(db).Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		// pragmas can't take bound parameters, version is an int so formatting it in is safe
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		version++
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+CRUD ops on the short links of the URL cleaner
+**/
+
+var ErrSlugTaken = errors.New("slug is already taken")
+
+// columns read for a short link, in the order scanShortLink expects them
+const shortLinkColumns = "slug, url, permanent, disabled, expires_at, clicks, last_clicked_at, created_at"
+
+func scanShortLink(row rowScanner) (models.ShortLink, error) {
+	var link models.ShortLink
+	var expiresAt, lastClickedAt sql.NullString
+	var createdAt string
+	err := row.Scan(&link.Slug, &link.Url, &link.Permanent, &link.Disabled, &expiresAt, &link.Clicks, &lastClickedAt, &createdAt)
+	if err != nil {
+		return link, err
+	}
+	link.ExpiresAt = parseNullTime(expiresAt)
+	link.LastClickedAt = parseNullTime(lastClickedAt)
+	link.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return link, err
+}
+
+// times are stored as RFC 3339 text in UTC, a nil time as NULL
+func nullTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339), Valid: true}
+}
+
+func parseNullTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// add a short link, returns ErrSlugTaken when its slug is already used
+func AddShortLink(db *sql.DB, link models.ShortLink) error {
+	operation, err := writer(db).Exec("INSERT INTO ShortLinks (slug, url, permanent, disabled, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (slug) DO NOTHING",
+		link.Slug, link.Url, link.Permanent, link.Disabled, nullTime(link.ExpiresAt), link.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	RowsInserted, err := operation.RowsAffected()
+	if err == nil && RowsInserted == 0 {
+		return ErrSlugTaken
+	}
+	return err
+}
+
+// get a short link by its slug
+func GetShortLink(db *sql.DB, slug string) (models.ShortLink, error) {
+	return scanShortLink(db.QueryRow("SELECT "+shortLinkColumns+" FROM ShortLinks WHERE slug = ?", slug))
+}
+
+// update what can change on a short link, its destination and counters can't
+func UpdateShortLink(db *sql.DB, link models.ShortLink) error {
+	operation, err := writer(db).Exec("UPDATE ShortLinks SET permanent = ?, disabled = ?, expires_at = ? WHERE slug = ?", link.Permanent, link.Disabled, nullTime(link.ExpiresAt), link.Slug)
+	if err != nil {
+		return err
+	}
+	RowsUpdated, err := operation.RowsAffected()
+	if RowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// count a click on a short link, made in one statement so that concurrent clicks all count
+func AddShortLinkClick(db *sql.DB, slug string, at time.Time) error {
+	operation, err := writer(db).Exec("UPDATE ShortLinks SET clicks = clicks + 1, last_clicked_at = ? WHERE slug = ?", at.UTC().Format(time.RFC3339), slug)
+	if err != nil {
+		return err
+	}
+	RowsUpdated, err := operation.RowsAffected()
+	if RowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+	"time"
+)
+
+/**
+Deleting a book moves it to the trash: deleted_at is set, and every other query of the books leaves it out
+A book in the trash can be restored, until it is purged, which deletes its row for good
+**/
+
+// condition of the books that are not in the trash
+const notDeleted = "deleted_at IS NULL"
+
+// get the books in the trash, the most recently deleted first
+func GetTrash(db *sql.DB) ([]models.TrashedBook, error) {
+	rows, err := db.Query("SELECT " + bookColumns + ", deleted_at FROM Books WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, book_id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := make([]models.TrashedBook, 0)
+	for rows.Next() {
+		var book models.TrashedBook
+		var isbn sql.NullString
+		var deletedAt string
+		if err := rows.Scan(&book.Book_Id, &book.Title, &book.Author, &book.Num_Pages, &book.Pub_Date, &isbn, &deletedAt); err != nil {
+			return nil, err
+		}
+		book.Isbn = isbn.String
+		if book.DeletedAt, err = time.Parse(time.RFC3339, deletedAt); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// restore a book from the trash, sql.ErrNoRows when it isn't in the trash
+func RestoreBook(db *sql.DB, id int) error {
+	return restoreBook(writer(db), id)
+}
+
+func restoreBook(exec execer, id int) error {
+	operation, err := exec.Exec("UPDATE Books SET deleted_at = NULL WHERE book_id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	restored, err := operation.RowsAffected()
+	if restored == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// the books a purge deletes
+const purgedBooks = "SELECT book_id FROM Books WHERE deleted_at IS NOT NULL AND deleted_at <= ?"
+
+// what a purge deleted, the files of the covers and of the EPUBs are still in the storage, for the caller to remove
+type Purge struct {
+	Books  int
+	Covers []models.Cover
+	Epubs  []models.Epub
+}
+
+// delete for good the books that were moved to the trash at or before the time, with their covers and EPUBs
+func PurgeBooks(db *sql.DB, before time.Time) (Purge, error) {
+	var purge Purge
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return purge, err
+	}
+	defer tx.Rollback()
+
+	deletedAt := before.UTC().Format(time.RFC3339)
+	if err := purgedFiles(tx, deletedAt, &purge); err != nil {
+		return purge, err
+	}
+	// the rows of the files go with their book, without counting on the cascade of the foreign keys
+	for _, table := range []string{"Covers", "Epubs"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE book_id IN ("+purgedBooks+")", deletedAt); err != nil {
+			return purge, err
+		}
+	}
+	operation, err := tx.Exec("DELETE FROM Books WHERE deleted_at IS NOT NULL AND deleted_at <= ?", deletedAt)
+	if err != nil {
+		return purge, err
+	}
+	books, err := operation.RowsAffected()
+	if err != nil {
+		return purge, err
+	}
+	purge.Books = int(books)
+	return purge, tx.Commit()
+}
+
+// the covers and the EPUBs of the books a purge deletes
+func purgedFiles(tx *sql.Tx, deletedAt string, purge *Purge) error {
+	rows, err := tx.Query("SELECT "+coverColumns+" FROM Covers WHERE book_id IN ("+purgedBooks+")", deletedAt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		cover, err := scanCover(rows)
+		if err != nil {
+			return err
+		}
+		purge.Covers = append(purge.Covers, cover)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.Query("SELECT "+epubColumns+" FROM Epubs WHERE book_id IN ("+purgedBooks+")", deletedAt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		epub, err := scanEpub(rows)
+		if err != nil {
+			return err
+		}
+		purge.Epubs = append(purge.Epubs, epub)
+	}
+	return rows.Err()
+}
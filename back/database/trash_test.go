@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	book := models.Book{Title: "The Trial", Author: "Franz Kafka", Pub_Date: "1925-04-26"}
+	id, err := AddBook(db, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTrash := func() bool {
+		books, err := GetTrash(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, trashed := range books {
+			if trashed.Book_Id == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("Testing DeleteBook moves the book to the trash", func(t *testing.T) {
+		if err := DeleteBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetBook(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected a deleted book to be hidden, got %v", err)
+		}
+		books, err := GetBooksFiltered(db, BookFilter{Author: "Kafka"})
+		if err != nil || len(books) != 0 {
+			t.Errorf("expected no books, got %v %v", books, err)
+		}
+		if !inTrash() {
+			t.Error("expected the book in the trash")
+		}
+		if err := DeleteBook(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows when deleting twice, got %v", err)
+		}
+		book.Book_Id = id
+		if err := UpdateBook(db, book); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows when updating a deleted book, got %v", err)
+		}
+	})
+
+	t.Run("Testing RestoreBook", func(t *testing.T) {
+		if err := RestoreBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetBook(db, id); err != nil {
+			t.Errorf("expected the restored book, got %v", err)
+		}
+		if inTrash() {
+			t.Error("expected the book out of the trash")
+		}
+		if err := RestoreBook(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows when the book isn't in the trash, got %v", err)
+		}
+	})
+
+	t.Run("Testing PurgeBooks", func(t *testing.T) {
+		if _, err := SetCover(db, models.Cover{Book_Id: id, ContentType: "image/jpeg", Etag: "trial", UpdatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SetEpub(db, models.Epub{Book_Id: id, Filename: "the-trial.epub", Etag: "trial", UploadedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		// deleted after the time, kept
+		PurgeBooks(db, time.Now().Add(-time.Hour))
+		if !inTrash() {
+			t.Fatal("expected a recently deleted book to be kept")
+		}
+		purged, err := PurgeBooks(db, time.Now())
+		if err != nil || purged.Books == 0 {
+			t.Fatalf("expected books to be purged, got %+v %v", purged, err)
+		}
+		// the files of the book are left to the caller
+		if len(purged.Covers) != 1 || purged.Covers[0].Etag != "trial" || len(purged.Epubs) != 1 || purged.Epubs[0].Filename != "the-trial.epub" {
+			t.Errorf("expected the cover and the EPUB of the book, got %+v", purged)
+		}
+		var left int
+		db.QueryRow("SELECT (SELECT COUNT(*) FROM Covers WHERE book_id = ?) + (SELECT COUNT(*) FROM Epubs WHERE book_id = ?)", id, id).Scan(&left)
+		if left != 0 {
+			t.Errorf("expected the rows of the files to be deleted with the book, %d are left", left)
+		}
+		if inTrash() {
+			t.Error("expected the book to be purged")
+		}
+		if err := RestoreBook(db, id); err != sql.ErrNoRows {
+			t.Errorf("expected a purged book to be gone, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+CRUD ops on the users of the API, a user is found by the hash of its token
+**/
+
+var ErrUserExists = errors.New("a user with this name already exists")
+
+const userColumns = "user_id, name, role, created_at"
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	var createdAt string
+	if err := row.Scan(&user.User_Id, &user.Name, &user.Role, &createdAt); err != nil {
+		return user, err
+	}
+	var err error
+	user.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return user, err
+}
+
+// add a user with the hash of its token, returns ErrUserExists when the name is taken
+func AddUser(db *sql.DB, user models.User, tokenHash string) (int, error) {
+	operation, err := writer(db).Exec("INSERT INTO Users (name, role, token_hash, created_at) VALUES (?, ?, ?, ?) ON CONFLICT (name) DO NOTHING",
+		user.Name, user.Role, tokenHash, user.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	if RowsInserted, err := operation.RowsAffected(); err != nil || RowsInserted == 0 {
+		if err == nil {
+			err = ErrUserExists
+		}
+		return 0, err
+	}
+	id, err := operation.LastInsertId()
+	return int(id), err
+}
+
+// get the user a token belongs to
+func GetUserByToken(db *sql.DB, tokenHash string) (models.User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM Users WHERE token_hash = ?", tokenHash))
+}
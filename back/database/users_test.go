@@ -0,0 +1,33 @@
+package database
+
+import (
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"testing"
+	"time"
+)
+
+func TestUsers(t *testing.T) {
+	user := models.User{Name: "alice", Role: models.RoleAdmin, CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	t.Run("Testing AddUser", func(t *testing.T) {
+		id, err := AddUser(db, user, "hash-alice")
+		if err != nil || id == 0 {
+			t.Fatalf("expected a new user, got %d %v", id, err)
+		}
+		if _, err := AddUser(db, user, "hash-other"); err != ErrUserExists {
+			t.Errorf("expected %v, got %v", ErrUserExists, err)
+		}
+	})
+	t.Run("Testing GetUserByToken", func(t *testing.T) {
+		found, err := GetUserByToken(db, "hash-alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Name != user.Name || found.Role != user.Role || !found.CreatedAt.Equal(user.CreatedAt) {
+			t.Errorf("expected %+v, got %+v", user, found)
+		}
+		t.Log(found)
+		if _, err := GetUserByToken(db, "hash-unknown"); err == nil {
+			t.Error("expected an error for an unknown token")
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	models "github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+CRUD ops on the webhooks, and the outbox of their deliveries
+A change of a book queues a delivery for each active webhook subscribed to its event inside the transaction of the change
+(see audit), so that an event is sent if and only if the change was made, the webhooks package then sends them
+**/
+
+// event sent for each operation of the audit log
+var operationEvents = map[string]string{
+	models.AuditCreate:  models.EventBookCreated,
+	models.AuditUpdate:  models.EventBookUpdated,
+	models.AuditDelete:  models.EventBookDeleted,
+	models.AuditRestore: models.EventBookRestored,
+	models.AuditRevert:  models.EventBookUpdated,
+}
+
+// the secret is left out, it is only read by the dispatcher
+const webhookColumns = "webhook_id, url, events, active, created_at"
+
+const deliveryColumns = "delivery_id, webhook_id, event, status, attempts, next_attempt_at, last_attempt_at, response_status, error, redelivery_of, created_at, payload"
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var events, createdAt string
+	if err := row.Scan(&hook.Webhook_Id, &hook.Url, &events, &hook.Active, &createdAt); err != nil {
+		return hook, err
+	}
+	hook.Events = strings.Split(events, ",")
+	var err error
+	hook.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return hook, err
+}
+
+func scanDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var nextAttemptAt, lastAttemptAt, deliveryError sql.NullString
+	var responseStatus, redeliveryOf sql.NullInt64
+	var createdAt, payload string
+	err := row.Scan(&delivery.Delivery_Id, &delivery.Webhook_Id, &delivery.Event, &delivery.Status, &delivery.Attempts, &nextAttemptAt,
+		&lastAttemptAt, &responseStatus, &deliveryError, &redeliveryOf, &createdAt, &payload)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.NextAttemptAt = parseNullTime(nextAttemptAt)
+	delivery.LastAttemptAt = parseNullTime(lastAttemptAt)
+	delivery.ResponseStatus = int(responseStatus.Int64)
+	delivery.Error = deliveryError.String
+	delivery.RedeliveryOf = int(redeliveryOf.Int64)
+	delivery.Payload = json.RawMessage(payload)
+	delivery.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return delivery, err
+}
+
+// add a webhook, with its secret
+func AddWebhook(db *sql.DB, hook models.Webhook) (int, error) {
+	operation, err := writer(db).Exec("INSERT INTO Webhooks (url, events, secret, active, created_at) VALUES (?, ?, ?, ?, ?)",
+		hook.Url, strings.Join(hook.Events, ","), hook.Secret, hook.Active, hook.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	id, err := operation.LastInsertId()
+	return int(id), err
+}
+
+// get all the webhooks, without their secrets
+func GetWebhooks(db *sql.DB) ([]models.Webhook, error) {
+	rows, err := db.Query("SELECT " + webhookColumns + " FROM Webhooks ORDER BY webhook_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// get a webhook, without its secret
+func GetWebhook(db *sql.DB, id int) (models.Webhook, error) {
+	return scanWebhook(db.QueryRow("SELECT "+webhookColumns+" FROM Webhooks WHERE webhook_id = ?", id))
+}
+
+// update the URL, events and state of a webhook, and its secret when one is given
+func UpdateWebhook(db *sql.DB, hook models.Webhook) error {
+	operation, err := writer(db).Exec("UPDATE Webhooks SET url = ?, events = ?, active = ?, secret = COALESCE(NULLIF(?, ''), secret) WHERE webhook_id = ?",
+		hook.Url, strings.Join(hook.Events, ","), hook.Active, hook.Secret, hook.Webhook_Id)
+	if err != nil {
+		return err
+	}
+	RowsUpdated, err := operation.RowsAffected()
+	if RowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// delete a webhook and its deliveries, the ones not sent yet included
+func DeleteWebhook(db *sql.DB, id int) error {
+	tx, err := writer(db).Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// the foreign key would cascade, but it can be turned off in the config
+	if _, err := tx.Exec("DELETE FROM WebhookDeliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	operation, err := tx.Exec("DELETE FROM Webhooks WHERE webhook_id = ?", id)
+	if err != nil {
+		return err
+	}
+	if RowsDeleted, err := operation.RowsAffected(); err != nil || RowsDeleted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// queues a delivery of the event to each active webhook subscribed to it, due at once
+func enqueueEvent(exec execer, event models.BookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err = exec.Exec(`INSERT INTO WebhookDeliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+SELECT webhook_id, ?, ?, ?, ?, ? FROM Webhooks WHERE active = 1 AND instr(',' || events || ',', ',' || ? || ',') > 0`,
+		event.Event, string(payload), models.DeliveryPending, now, now, event.Event)
+	return err
+}
+
+// get one page of the deliveries of a webhook, the most recent first, of any status when status is empty
+func GetDeliveries(db *sql.DB, webhookId int, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	rows, err := db.Query("SELECT "+deliveryColumns+" FROM WebhookDeliveries WHERE webhook_id = ? AND (? = '' OR status = ?) ORDER BY delivery_id DESC LIMIT ? OFFSET ?",
+		webhookId, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// get a delivery of a webhook
+func GetDelivery(db *sql.DB, webhookId, deliveryId int) (models.WebhookDelivery, error) {
+	return scanDelivery(db.QueryRow("SELECT "+deliveryColumns+" FROM WebhookDeliveries WHERE webhook_id = ? AND delivery_id = ?", webhookId, deliveryId))
+}
+
+// Redeliver queues a new delivery of the payload of a delivery of the webhook, due at once, whatever became of the first one
+// sql.ErrNoRows when the delivery isn't one of the webhook
+func Redeliver(db *sql.DB, webhookId, deliveryId int) (models.WebhookDelivery, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	operation, err := writer(db).Exec(`INSERT INTO WebhookDeliveries (webhook_id, event, payload, status, next_attempt_at, redelivery_of, created_at)
+SELECT webhook_id, event, payload, ?, ?, delivery_id, ? FROM WebhookDeliveries WHERE webhook_id = ? AND delivery_id = ?`,
+		models.DeliveryPending, now, now, webhookId, deliveryId)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if RowsInserted, err := operation.RowsAffected(); err != nil || RowsInserted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return models.WebhookDelivery{}, err
+	}
+	id, err := operation.LastInsertId()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return GetDelivery(db, webhookId, int(id))
+}
+
+// DueDelivery is a pending delivery with what is needed to send it
+type DueDelivery struct {
+	models.WebhookDelivery
+	Url    string
+	Secret string
+}
+
+// get the pending deliveries due at the time, the oldest first, the ones of inactive webhooks wait until they are active again
+func GetDueDeliveries(db *sql.DB, at time.Time, limit int) ([]DueDelivery, error) {
+	rows, err := db.Query(`SELECT d.delivery_id, d.webhook_id, d.event, d.status, d.attempts, d.next_attempt_at, d.last_attempt_at, d.response_status,
+d.error, d.redelivery_of, d.created_at, d.payload, w.url, w.secret FROM WebhookDeliveries d JOIN Webhooks w ON w.webhook_id = d.webhook_id
+WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active = 1 ORDER BY d.delivery_id LIMIT ?`, models.DeliveryPending, at.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []DueDelivery
+	for rows.Next() {
+		var delivery DueDelivery
+		// the webhook columns come after the ones of the delivery, scanDelivery reads them in this wrapper
+		delivery.WebhookDelivery, err = scanDelivery(scanFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &delivery.Url, &delivery.Secret)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, delivery)
+	}
+	return due, rows.Err()
+}
+
+// a rowScanner out of a function
+type scanFunc func(dest ...any) error
+
+func (scan scanFunc) Scan(dest ...any) error {
+	return scan(dest...)
+}
+
+// record the outcome of an attempt of a delivery, its status, attempts, times, response status and error
+func RecordDeliveryAttempt(db *sql.DB, delivery models.WebhookDelivery) error {
+	operation, err := writer(db).Exec("UPDATE WebhookDeliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, response_status = ?, error = ? WHERE delivery_id = ?",
+		delivery.Status, delivery.Attempts, nullTime(delivery.NextAttemptAt), nullTime(delivery.LastAttemptAt),
+		sql.NullInt64{Int64: int64(delivery.ResponseStatus), Valid: delivery.ResponseStatus != 0},
+		sql.NullString{String: delivery.Error, Valid: delivery.Error != ""}, delivery.Delivery_Id)
+	if err != nil {
+		return err
+	}
+	RowsUpdated, err := operation.RowsAffected()
+	if RowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -15,37 +15,46 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/books/": {
+        "/admin/backups": {
             "get": {
-                "description": "Get all books in the DB",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists the backups of the backup directory, the newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "books"
+                    "admin"
+                ],
+                "summary": "List the backups",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
                 ],
-                "summary": "Get all books",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Book"
+                                "$ref": "#/definitions/backup.Info"
                             }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/services.ErrMessage"
                         }
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -56,92 +65,262 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Add a new book",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Writes a consistent copy of the DB to the backup directory, compressed and checksummed like the scheduled backups, then removes the backups over the retention",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "books"
+                    "admin"
                 ],
-                "summary": "Add a new book",
+                "summary": "Create a backup",
                 "parameters": [
                     {
-                        "description": "Book",
-                        "name": "book",
-                        "in": "body",
-                        "required": true,
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.Book"
+                            "$ref": "#/definitions/backup.Info"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
                         }
                     }
+                }
+            }
+        },
+        "/admin/backups/{name}": {
+            "get": {
+                "description": "Sends the file of a backup, its checksum is in the listing",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Download a backup",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File name of the backup",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK"
                     },
-                    "400": {
-                        "description": "Bad Request"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/services.ErrMessage"
                         }
-                    },
-                    "405": {
-                        "description": "Method Not Allowed"
                     }
                 }
             }
         },
-        "/books/{id}": {
-            "get": {
-                "description": "Get a book by ID",
-                "consumes": [
+        "/admin/trash": {
+            "delete": {
+                "description": "Deletes for good the books in the trash, all of them or the ones deleted more than older_than_days days ago, with the files of their covers and EPUBs",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Purge the trash",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only purge the books deleted more than this many days ago",
+                        "name": "older_than_days",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.PurgeReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/audit": {
+            "get": {
+                "description": "Lists the changes made to the books, the most recent first, for admins",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "books"
+                    "admin"
                 ],
-                "summary": "Get a single Book",
+                "summary": "Audit log",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Changes of this book",
+                        "name": "book_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Changes made by this user, anonymous for the changes made without a token",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "create, update, delete, restore or revert",
+                        "name": "operation",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Changes made at or after this time, RFC 3339 or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Changes made at or before this time, RFC 3339 or YYYY-MM-DD (the whole day)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries, 100 by default, 1000 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Book"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditEntry"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request"
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/services.ErrMessage"
                         }
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
                     }
                 }
-            },
-            "put": {
-                "description": "Update a book by ID",
+            }
+        },
+        "/books/": {
+            "get": {
+                "description": "Get all books in the DB, optionally filtered",
                 "consumes": [
                     "application/json"
                 ],
@@ -151,30 +330,41 @@ const docTemplate = `{
                 "tags": [
                     "books"
                 ],
-                "summary": "Update a book",
+                "summary": "Get all books",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Title contains",
+                        "name": "title",
+                        "in": "query"
                     },
                     {
-                        "description": "Book",
-                        "name": "book",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Book"
-                        }
+                        "type": "string",
+                        "description": "Author contains",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Published on or after (YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Published on or before (YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Book"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Book"
+                            }
                         }
                     },
                     "400": {
@@ -200,8 +390,8 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
-                "description": "Delete a book by ID",
+            "post": {
+                "description": "Add a new book",
                 "consumes": [
                     "application/json"
                 ],
@@ -211,14 +401,16 @@ const docTemplate = `{
                 "tags": [
                     "books"
                 ],
-                "summary": "Delete a book",
+                "summary": "Add a new book",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Book",
+                        "name": "book",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
                     }
                 ],
                 "responses": {
@@ -240,26 +432,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/docs/": {
-            "get": {
-                "description": "Serves Swagger Docs",
-                "tags": [
-                    "docs"
-                ],
-                "summary": "Serves Swagger Docs",
-                "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    }
-                }
-            }
-        },
-        "/url/": {
+        "/books/enrich": {
             "post": {
-                "description": "Processes URLs depending on the requested operation",
+                "description": "Looks up the ISBN of the book in the catalogue of the provider (Open Library or Google Books) and answers the changes the record makes to the fields given: title, author, num_pages, pub_date and cover. Nothing is saved until the changes are confirmed: the same request with the digest of the preview, and the fields to take, all of them when empty, creates the book. The records are cached",
                 "consumes": [
                     "application/json"
                 ],
@@ -267,25 +442,31 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "url"
+                    "books"
                 ],
-                "summary": "Process URL",
+                "summary": "Fill a new book out of the catalogue",
                 "parameters": [
                     {
-                        "description": "Request Body",
-                        "name": "RequestStruct",
+                        "description": "Book, with at least its isbn",
+                        "name": "book",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.RequestStruct"
+                            "$ref": "#/definitions/models.EnrichRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Preview, without a digest",
                         "schema": {
-                            "$ref": "#/definitions/models.ResponseStruct"
+                            "$ref": "#/definitions/models.Enrichment"
+                        }
+                    },
+                    "201": {
+                        "description": "The book was created",
+                        "schema": {
+                            "$ref": "#/definitions/models.EnrichResult"
                         }
                     },
                     "400": {
@@ -294,19 +475,3417 @@ const docTemplate = `{
                             "$ref": "#/definitions/services.ErrMessage"
                         }
                     },
-                    "405": {
-                        "description": "Method Not Allowed"
-                    }
-                }
-            }
-        }
-    },
-    "definitions": {
-        "models.Book": {
-            "description": "Book",
-            "type": "object",
-            "properties": {
-                "author": {
+                    "404": {
+                        "description": "The catalogue has no record of the ISBN",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "409": {
+                        "description": "The record changed since the preview",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "The book would lack a field",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "502": {
+                        "description": "The catalogue could not be queried",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/epub": {
+            "post": {
+                "description": "Reads the metadata of an EPUB (title, creators, language, identifiers, publication date and cover) and stores the file. The book with the ISBN of the file is updated when there is one, otherwise a book is created. The creators whose role is author make the author, a year or a month alone is published on the first day. The query parameters take precedence over the metadata, e.g. to give a publication date the file doesn't have. The cover of the file replaces the cover of the book, a cover that can't be used is reported in warnings. The body is the file, or a multipart form with the file in its file field",
+                "consumes": [
+                    "application/epub+zip",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Add a book out of an EPUB file",
+                "parameters": [
+                    {
+                        "description": "EPUB file",
+                        "name": "epub",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title, instead of the one of the file",
+                        "name": "title",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author, instead of the creators of the file",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Publication date, YYYY-MM-DD, instead of the one of the file",
+                        "name": "pub_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISBN, instead of the one of the file",
+                        "name": "isbn",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The book with the ISBN was updated",
+                        "schema": {
+                            "$ref": "#/definitions/models.EpubUpload"
+                        }
+                    },
+                    "201": {
+                        "description": "A book was created",
+                        "schema": {
+                            "$ref": "#/definitions/models.EpubUpload"
+                        }
+                    },
+                    "400": {
+                        "description": "The archive is malformed, or a query parameter is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "413": {
+                        "description": "The file is over the size limits",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "415": {
+                        "description": "The file is not an EPUB",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "The metadata lacks a field the book needs, it can be given in the query parameters",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/export": {
+            "get": {
+                "description": "Streams the catalogue as csv, xlsx, json, ndjson, MARC 21 (ISO 2709) or MARCXML, accepts the same filters as GET /books",
+                "produces": [
+                    "text/csv",
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+                    "application/json",
+                    "application/x-ndjson",
+                    "application/marc",
+                    "application/marcxml+xml"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Export books",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "xlsx",
+                            "json",
+                            "ndjson",
+                            "marc",
+                            "marcxml"
+                        ],
+                        "type": "string",
+                        "default": "json",
+                        "description": "Export format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title contains",
+                        "name": "title",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author contains",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Published on or after (YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Published on or before (YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    }
+                }
+            }
+        },
+        "/books/import": {
+            "post": {
+                "description": "Imports books from a csv, xlsx, MARC 21 (ISO 2709) or MARCXML file, sent either as the raw body or as the \"file\" field of a multipart form.\nEvery row or record is validated like POST /books, valid ones are imported in a single transaction and invalid ones are reported.\nFor MARC files, the tags of the fields that have no book counterpart are reported in unmapped_fields.",
+                "consumes": [
+                    "text/csv",
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+                    "application/marc",
+                    "application/marcxml+xml",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Import books",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "xlsx",
+                            "marc",
+                            "marcxml"
+                        ],
+                        "type": "string",
+                        "description": "Import format, guessed from the Content-Type or the file name when missing",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Column mapping for csv and xlsx, e.g. title=Book Title,author=Writer",
+                        "name": "mapping",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Validate and preview without writing to the DB",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ImportReport"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/trash": {
+            "get": {
+                "description": "Lists the books in the trash, the most recently deleted first, they can be restored until they are purged",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "List the deleted books",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.TrashedBook"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}": {
+            "get": {
+                "description": "Get a book by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Get a single Book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    }
+                }
+            },
+            "put": {
+                "description": "Update a book by ID, the ISBN is kept when the body has none and removed when it is empty",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Update a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Book",
+                        "name": "book",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Moves a book to the trash, where it can be restored from until it is purged, see /books/trash",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Delete a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    }
+                }
+            }
+        },
+        "/books/{id}/cover": {
+            "get": {
+                "description": "Serves the cover of a book, or one of its thumbnails. The response has an ETag and answers 304 to a matching If-None-Match. With v, the etag of the cover as in the URLs given by the upload, the image can be cached for good, without it the cache has to check it is still current",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Get the cover of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Etag of the cover",
+                        "name": "v",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Sets the cover of a book, the body is the image, or a multipart form with the image in its file field. JPEG, PNG and WebP are accepted, recognised by their content rather than their Content-Type. The metadata of the image (EXIF, XMP) is removed, a JPEG is turned upright as its EXIF orientation says, and thumbnails are made in the sizes small (160 pixels wide), medium (320) and large (640). The cover replaces the one the book had",
+                "consumes": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Upload the cover of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Image",
+                        "name": "cover",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Cover"
+                        }
+                    },
+                    "400": {
+                        "description": "The image can't be read",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "413": {
+                        "description": "The image is over the size or pixel limits",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "415": {
+                        "description": "The image is not a JPEG, PNG or WebP",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes the cover of a book and its thumbnails",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Delete the cover of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/cover/{size}": {
+            "get": {
+                "description": "Serves the cover of a book, or one of its thumbnails. The response has an ETag and answers 304 to a matching If-None-Match. With v, the etag of the cover as in the URLs given by the upload, the image can be cached for good, without it the cache has to check it is still current",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Get the cover of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "small",
+                            "medium",
+                            "large"
+                        ],
+                        "type": "string",
+                        "description": "Thumbnail size, the full cover without it",
+                        "name": "size",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Etag of the cover",
+                        "name": "v",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/enrich": {
+            "post": {
+                "description": "Looks up the ISBN of the book in the catalogue and answers the changes its record makes, a cover is only proposed to a book without one. Nothing is saved until the changes are confirmed with the digest of the preview, the fields to take are given in fields, all of them when empty",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Fill a book out of the catalogue",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Digest and fields, the book fields are ignored",
+                        "name": "confirm",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.EnrichRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Preview without a digest, an EnrichResult once confirmed",
+                        "schema": {
+                            "$ref": "#/definitions/models.Enrichment"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "The book doesn't exist, or the catalogue has no record of its ISBN",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "409": {
+                        "description": "The book or the record changed since the preview",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "The book has no ISBN",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "502": {
+                        "description": "The catalogue could not be queried",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/epub": {
+            "get": {
+                "description": "Serves the EPUB of a book as an attachment, with its SHA-256 as ETag, 304 to a matching If-None-Match",
+                "produces": [
+                    "application/epub+zip"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Download the EPUB file of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Stores the EPUB of a book and updates the book out of its metadata, as POST /books/epub does. The fields the file doesn't have keep their value",
+                "consumes": [
+                    "application/epub+zip",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Set the EPUB file of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "EPUB file",
+                        "name": "epub",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title, instead of the one of the file",
+                        "name": "title",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Author, instead of the creators of the file",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Publication date, YYYY-MM-DD, instead of the one of the file",
+                        "name": "pub_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISBN, instead of the one of the file",
+                        "name": "isbn",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.EpubUpload"
+                        }
+                    },
+                    "400": {
+                        "description": "The archive is malformed, or a query parameter is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "413": {
+                        "description": "The file is over the size limits",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "415": {
+                        "description": "The file is not an EPUB",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "422": {
+                        "description": "The book would lack a field",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes the EPUB of a book, the book and its cover are kept",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Delete the EPUB file of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/history": {
+            "get": {
+                "description": "Lists the changes made to a book, the most recent first, with the book before and after each one and the fields that changed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "History of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries, 100 by default, 1000 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditEntry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/restore": {
+            "post": {
+                "description": "Moves a book out of the trash, it is listed and can be edited again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Restore a deleted book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "The book is not in the trash",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/books/{id}/revert": {
+            "post": {
+                "description": "Puts the book back as a change of its history left it, out of the trash if it was deleted since. The revert is itself recorded in the history",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Revert a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Version to revert to",
+                        "name": "RevertRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/services.RevertRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "The entry is not in the history of the book, or the book was purged",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "409": {
+                        "description": "The change deleted the book, there is no version to revert to",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/docs/": {
+            "get": {
+                "description": "Serves Swagger Docs",
+                "tags": [
+                    "docs"
+                ],
+                "summary": "Serves Swagger Docs",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            }
+        },
+        "/events": {
+            "get": {
+                "description": "Streams the changes of the books as server-sent events (text/event-stream), each one a BookEvent with its audit_id as the event ID and its event name (book.created, book.updated, book.deleted or book.restored) as the event type. A client that reconnects with the Last-Event-ID header (browsers send it) gets the events it missed, or a reset event when they are no longer all kept, it should then reload the books. A \": heartbeat\" comment is sent on an idle stream",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "books"
+                ],
+                "summary": "Stream of the changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma separated events or kinds of events to stream, e.g. book.created,book.deleted or book, all of them by default",
+                        "name": "topics",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last event received, for the first connection, the Last-Event-ID header takes precedence",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last event received, sent by the browsers when they reconnect",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BookEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphiql": {
+            "get": {
+                "description": "In-browser editor to write and run queries against /graphql",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "graphql"
+                ],
+                "summary": "GraphiQL playground",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/graphql": {
+            "get": {
+                "description": "Runs a GraphQL query passed in the query string, mutations are refused. Malformed queries, queries that fail validation and queries over the depth or complexity limits are answered with 400",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "graphql"
+                ],
+                "summary": "GraphQL query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "GraphQL query",
+                        "name": "query",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Variables, as a JSON object",
+                        "name": "variables",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Operation to run when the query has several",
+                        "name": "operationName",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    }
+                }
+            },
+            "post": {
+                "description": "Runs a GraphQL query or mutation. Malformed queries, queries that fail validation and queries over the depth or complexity limits are answered with 400",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "graphql"
+                ],
+                "summary": "GraphQL query or mutation",
+                "parameters": [
+                    {
+                        "description": "GraphQL request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/graph.Request"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    }
+                }
+            }
+        },
+        "/l/{slug}": {
+            "get": {
+                "description": "Redirects to the destination of the link, with 301 for a permanent link and 302 otherwise, and counts the click",
+                "tags": [
+                    "links"
+                ],
+                "summary": "Follow a short link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "301": {
+                        "description": "Moved Permanently"
+                    },
+                    "302": {
+                        "description": "Found"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "410": {
+                        "description": "The link is disabled or has expired",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/links/": {
+            "post": {
+                "description": "Processes the URL with the operation of the short links (redirection and canonical by default), then stores it under the slug, generated when none is given",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "links"
+                ],
+                "summary": "Create a short link",
+                "parameters": [
+                    {
+                        "description": "Link to create",
+                        "name": "ShortLinkRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ShortLinkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ShortLink"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "409": {
+                        "description": "The slug is already taken",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "502": {
+                        "description": "The URL could not be fetched by a network operation",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/links/{slug}": {
+            "get": {
+                "description": "Gets a short link with its click counter",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "links"
+                ],
+                "summary": "Get a short link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ShortLink"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Disables or enables a short link, changes its expiry or its redirect status, the fields left out are kept",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "links"
+                ],
+                "summary": "Update a short link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of a staff member or an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changes",
+                        "name": "ShortLinkUpdate",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ShortLinkUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ShortLink"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds": {
+            "get": {
+                "description": "Navigation feed linking to every book, the new arrivals, and the books by author and by year. /opds is OPDS 1.2 (Atom), /opds/v2 is OPDS 2.0 (JSON)",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS start feed",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/opds/all": {
+            "get": {
+                "description": "Acquisition feed of every book sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of every book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/authors": {
+            "get": {
+                "description": "Navigation feed with an entry per author, linking to the books they wrote",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the authors",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/authors/{author}": {
+            "get": {
+                "description": "Acquisition feed of the books of an author, sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the books of an author",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Author, as listed in the authors feed",
+                        "name": "author",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/books/{id}": {
+            "get": {
+                "description": "Complete OPDS 1.2 entry or OPDS 2.0 publication of a book",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds-publication+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS entry of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/new": {
+            "get": {
+                "description": "Acquisition feed of the books, most recently added first",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the new arrivals",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/opensearch.xml": {
+            "get": {
+                "description": "Describes the OPDS 1.2 search feed to e-reader apps",
+                "produces": [
+                    "application/opensearchdescription+xml"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OpenSearch description",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/opds/search": {
+            "get": {
+                "description": "Acquisition feed of the books whose title or author contains the search terms, OPDS 1.2 clients send them as q, OPDS 2.0 clients as query",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search terms (OPDS 1.2)",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search terms (OPDS 2.0)",
+                        "name": "query",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2": {
+            "get": {
+                "description": "Navigation feed linking to every book, the new arrivals, and the books by author and by year. /opds is OPDS 1.2 (Atom), /opds/v2 is OPDS 2.0 (JSON)",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS start feed",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/opds/v2/all": {
+            "get": {
+                "description": "Acquisition feed of every book sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of every book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/authors": {
+            "get": {
+                "description": "Navigation feed with an entry per author, linking to the books they wrote",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the authors",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/authors/{author}": {
+            "get": {
+                "description": "Acquisition feed of the books of an author, sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the books of an author",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Author, as listed in the authors feed",
+                        "name": "author",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/books/{id}": {
+            "get": {
+                "description": "Complete OPDS 1.2 entry or OPDS 2.0 publication of a book",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds-publication+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS entry of a book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/new": {
+            "get": {
+                "description": "Acquisition feed of the books, most recently added first",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the new arrivals",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/search": {
+            "get": {
+                "description": "Acquisition feed of the books whose title or author contains the search terms, OPDS 1.2 clients send them as q, OPDS 2.0 clients as query",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search terms (OPDS 1.2)",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search terms (OPDS 2.0)",
+                        "name": "query",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/years": {
+            "get": {
+                "description": "Navigation feed with an entry per publication year, most recent first",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the publication years",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/v2/years/{year}": {
+            "get": {
+                "description": "Acquisition feed of the books published in a year, sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the books published in a year",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Year (YYYY)",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/years": {
+            "get": {
+                "description": "Navigation feed with an entry per publication year, most recent first",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the publication years",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/opds/years/{year}": {
+            "get": {
+                "description": "Acquisition feed of the books published in a year, sorted by title",
+                "produces": [
+                    "application/atom+xml",
+                    "application/opds+json"
+                ],
+                "tags": [
+                    "opds"
+                ],
+                "summary": "OPDS feed of the books published in a year",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Year (YYYY)",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/url/": {
+            "post": {
+                "description": "Processes URLs depending on the requested operation, the name of a rule set listed by /url/operations",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "url"
+                ],
+                "summary": "Process URL",
+                "parameters": [
+                    {
+                        "description": "Request Body",
+                        "name": "RequestStruct",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RequestStruct"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ResponseStruct"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "502": {
+                        "description": "The URL could not be fetched by a network operation",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/url/batch": {
+            "post": {
+                "description": "Processes a JSON array, or NDJSON (one object per line), of {url, operation} items like POST /url.\nThe response has the format of the request, with one result per item in the order of the request, and is streamed as the items are processed.\nAn item that fails has an error instead of a processed_url, the others are still processed.\nA body that can't be read any further (malformed JSON, too many items, too large) ends the response with a last result holding the error.",
+                "consumes": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "url"
+                ],
+                "summary": "Process URLs in batch",
+                "parameters": [
+                    {
+                        "description": "Items to process",
+                        "name": "items",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.RequestStruct"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.BatchResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/url/operations": {
+            "get": {
+                "description": "Lists the operations POST /url accepts, the rule sets of the rule file",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "url"
+                ],
+                "summary": "List URL operations",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/urlrules.Operation"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/url/sitemap": {
+            "post": {
+                "description": "Reads a sitemap or a sitemap index (gzipped or not), sent either as the raw body or as the \"file\" field of a multipart form, and runs every \u003cloc\u003e through the operation.\nThe report lists the malformed, off-domain, non-canonical and duplicate entries, and the entries with an invalid lastmod, changefreq or priority.\nWith output=sitemap the corrected sitemap is returned instead: fixed entries hold their processed URL, the others are left out.\nA sitemap over the limits of the protocol (50,000 URLs or 50MB) is split, and the response is a zip of the parts and of the index (sitemap.xml) listing them under base_url.",
+                "consumes": [
+                    "text/xml",
+                    "application/gzip",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/zip"
+                ],
+                "tags": [
+                    "url"
+                ],
+                "summary": "Audit a sitemap",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Operation run on every \u003cloc\u003e, redirection by default",
+                        "name": "operation",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "report",
+                            "sitemap"
+                        ],
+                        "type": "string",
+                        "description": "report (default) or sitemap",
+                        "name": "output",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL the parts of a split sitemap are published at, needed to split it",
+                        "name": "base_url",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/sitemap.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed"
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/": {
+            "get": {
+                "description": "Lists the webhooks, without their secrets",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List the webhooks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Webhook"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribes a URL to book events, each event is POSTed to it as a BookEvent with the headers X-Bookit-Event, X-Bookit-Delivery and X-Bookit-Signature, \"t=\u003cunix time\u003e,v1=\u003cHMAC-SHA256 of \"\u003cunix time\u003e.\u003cbody\u003e\" with the secret, hex\u003e\". The secret is only shown in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Webhook to create",
+                        "name": "WebhookRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "description": "Gets a webhook, without its secret",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a webhook with its deliveries, the ones not sent yet are dropped",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes the URL or the events of a webhook, deactivates or reactivates it, or rotates its secret, the fields left out are kept. The new secret is only shown in this response. The deliveries of an inactive webhook wait until it is active again",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changes",
+                        "name": "WebhookUpdate",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Lists the deliveries of a webhook, the most recent first, with their payload and the outcome of their last attempt",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Deliveries of a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, delivered or failed",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of deliveries, 100 by default, 1000 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of deliveries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries/{delivery_id}/redeliver": {
+            "post": {
+                "description": "Queues a new delivery of the payload of a delivery, sent at the next poll of the dispatcher whatever became of the first one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver an event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token of an admin",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Delivery to send again",
+                        "name": "delivery_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/services.ErrMessage"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "backup.Info": {
+            "description": "A backup of the DB",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "@Property\tcreated_at string true \"Time of the backup, RFC 3339\"",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "@Property\tname string true \"File name, bookit-\u003cUTC time\u003e.sqlite, .sqlite.gz or .sqlite.zst\"",
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "@Property\tsha256 string true \"Checksum of the file, hex\"",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "@Property\tsize int true \"Size of the file, in bytes\"",
+                    "type": "integer"
+                }
+            }
+        },
+        "graph.Request": {
+            "type": "object",
+            "properties": {
+                "operationName": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "models.AuditEntry": {
+            "description": "Change made to a book, entries of the audit log are never changed or removed",
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "description": "@Property\t\tactor string true \"Name of the user who made the change, anonymous without a token\"",
+                    "type": "string"
+                },
+                "after": {
+                    "description": "@Property\t\tafter object false \"Book after the change, null when it was deleted\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "at": {
+                    "description": "@Property\t\tat string true \"Time of the change, RFC 3339\"",
+                    "type": "string"
+                },
+                "audit_id": {
+                    "description": "@Property\t\taudit_id int true \"Entry ID, in the order the changes were made\"",
+                    "type": "integer"
+                },
+                "before": {
+                    "description": "@Property\t\tbefore object false \"Book before the change, null when it didn't exist or was in the trash\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "book_id": {
+                    "description": "@Property\t\tbook_id int true \"Changed book\"",
+                    "type": "integer"
+                },
+                "diff": {
+                    "description": "@Property\t\tdiff object true \"Changed fields, by JSON key\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.FieldChange"
+                    }
+                },
+                "operation": {
+                    "description": "@Property\t\toperation string true \"create, update, delete, restore or revert\"",
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "@Property\t\trequest_id string false \"ID of the request that made the change, its X-Request-Id header\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.BatchResult": {
+            "description": "Result of one item of a URL batch, in the order of the request",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "@Property\t\terror string false \"Why the item failed\"",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "@Property\t\tindex int true \"Position of the item in the request, from 0\"",
+                    "type": "integer"
+                },
+                "operation": {
+                    "description": "@Property\t\toperation string false \"Operation of the item\"",
+                    "type": "string"
+                },
+                "processed_url": {
+                    "description": "@Property\t\tprocessed_url string false \"Processed URL, when the item succeeded\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string false \"URL of the item\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Book": {
+            "description": "Book",
+            "type": "object",
+            "properties": {
+                "author": {
+                    "description": "@Property author string true \"Author\"",
+                    "type": "string"
+                },
+                "book_id": {
+                    "description": "@Property book_id int true \"Book ID\"",
+                    "type": "integer"
+                },
+                "isbn": {
+                    "description": "@Property isbn string false \"ISBN-10 or ISBN-13\"",
+                    "type": "string"
+                },
+                "num_pages": {
+                    "description": "@Property num_pages string false \"Number of pages\"",
+                    "type": "integer"
+                },
+                "pub_date": {
+                    "description": "@Property pub_date int true \"Publication date\"",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "@Property title string true \"Title\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.BookEvent": {
+            "description": "Change of a book, the body of a webhook delivery",
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "description": "@Property\t\tactor string true \"Name of the user who made the change, anonymous without a token\"",
+                    "type": "string"
+                },
+                "at": {
+                    "description": "@Property\t\tat string true \"Time of the change, RFC 3339\"",
+                    "type": "string"
+                },
+                "audit_id": {
+                    "description": "@Property\t\taudit_id int true \"Entry of the audit log of the change, unique to the event\"",
+                    "type": "integer"
+                },
+                "book": {
+                    "description": "@Property\t\tbook object true \"Book after the change, before it for book.deleted\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "book_id": {
+                    "description": "@Property\t\tbook_id int true \"Changed book\"",
+                    "type": "integer"
+                },
+                "diff": {
+                    "description": "@Property\t\tdiff object true \"Changed fields, by JSON key\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.FieldChange"
+                    }
+                },
+                "event": {
+                    "description": "@Property\t\tevent string true \"book.created, book.updated, book.deleted or book.restored\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Cover": {
+            "description": "Cover image of a book, served at url, and scaled down at the URLs of its sizes",
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "description": "@Property\t\tbook_id int true \"Book ID\"",
+                    "type": "integer"
+                },
+                "content_type": {
+                    "description": "@Property\t\tcontent_type string true \"image/jpeg, image/png or image/webp\"",
+                    "type": "string"
+                },
+                "etag": {
+                    "description": "@Property\t\tetag string true \"Version of the cover, changed by every upload\"",
+                    "type": "string"
+                },
+                "height": {
+                    "description": "@Property\t\theight int true \"Height in pixels\"",
+                    "type": "integer"
+                },
+                "sizes": {
+                    "description": "@Property\t\tsizes object true \"URLs of the thumbnails, by size (small, medium, large)\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "thumbnail_type": {
+                    "description": "@Property\t\tthumbnail_type string true \"Type of the thumbnails, image/jpeg, or image/png for the covers with transparency\"",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "@Property\t\tupdated_at string true \"Time of the upload, RFC 3339\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"URL of the cover, with its version so that it can be cached for good\"",
+                    "type": "string"
+                },
+                "width": {
+                    "description": "@Property\t\twidth int true \"Width in pixels\"",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.EnrichRequest": {
+            "description": "Book to enrich, and the changes confirmed, without a digest the changes are only previewed",
+            "type": "object",
+            "properties": {
+                "author": {
+                    "description": "@Property author string true \"Author\"",
+                    "type": "string"
+                },
+                "book_id": {
+                    "description": "@Property book_id int true \"Book ID\"",
+                    "type": "integer"
+                },
+                "digest": {
+                    "description": "@Property\t\tdigest string false \"Digest of the preview, confirms the changes\"",
+                    "type": "string"
+                },
+                "fields": {
+                    "description": "@Property\t\tfields array false \"Fields whose change is confirmed, all of them when empty\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "isbn": {
+                    "description": "@Property isbn string false \"ISBN-10 or ISBN-13\"",
+                    "type": "string"
+                },
+                "num_pages": {
+                    "description": "@Property num_pages string false \"Number of pages\"",
+                    "type": "integer"
+                },
+                "pub_date": {
+                    "description": "@Property pub_date int true \"Publication date\"",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "@Property title string true \"Title\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.EnrichResult": {
+            "description": "Changes of the catalogue saved in a book",
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "description": "@Property\t\tapplied array true \"Fields changed\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "book": {
+                    "description": "@Property\t\tbook object true \"The book as saved\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "cover": {
+                    "description": "@Property\t\tcover object false \"Cover downloaded from the catalogue\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Cover"
+                        }
+                    ]
+                },
+                "created": {
+                    "description": "@Property\t\tcreated bool true \"Whether the book was created\"",
+                    "type": "boolean"
+                },
+                "warnings": {
+                    "description": "@Property\t\twarnings array false \"What was left out, e.g. a cover that could not be downloaded\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.Enrichment": {
+            "description": "What the catalogue would change in a book, saved once confirmed with the digest",
+            "type": "object",
+            "properties": {
+                "book": {
+                    "description": "@Property\t\tbook object true \"The book with every change made\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "book_id": {
+                    "description": "@Property\t\tbook_id int false \"Book ID, absent for a new book\"",
+                    "type": "integer"
+                },
+                "changes": {
+                    "description": "@Property\t\tchanges object true \"Changes by field (title, author, num_pages, pub_date, cover), the value of the book and the one of the catalogue\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.FieldChange"
+                    }
+                },
+                "digest": {
+                    "description": "@Property\t\tdigest string true \"Digest of the book and of the record, sent back to confirm the changes\"",
+                    "type": "string"
+                },
+                "isbn": {
+                    "description": "@Property\t\tisbn string true \"ISBN looked up\"",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "@Property\t\tsource string true \"Catalogue of the record, openlibrary or googlebooks\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Epub": {
+            "description": "EPUB file of a book, downloaded at url",
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "description": "@Property\t\tbook_id int true \"Book ID\"",
+                    "type": "integer"
+                },
+                "etag": {
+                    "description": "@Property\t\tetag string true \"Version of the file, changed by every upload\"",
+                    "type": "string"
+                },
+                "filename": {
+                    "description": "@Property\t\tfilename string true \"Name the file is downloaded as\"",
+                    "type": "string"
+                },
+                "identifiers": {
+                    "description": "@Property\t\tidentifiers array false \"Identifiers of the book, ISBN, UUID, DOI...\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "language": {
+                    "description": "@Property\t\tlanguage string false \"Language of the book, as its package document says, e.g. en-GB\"",
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "@Property\t\tsha256 string true \"SHA-256 of the file, hex encoded\"",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "@Property\t\tsize int true \"Size in bytes\"",
+                    "type": "integer"
+                },
+                "uploaded_at": {
+                    "description": "@Property\t\tuploaded_at string true \"Time of the upload, RFC 3339\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"URL of the file\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.EpubUpload": {
+            "description": "Result of an EPUB upload, the book as it was created or updated out of the metadata of the file",
+            "type": "object",
+            "properties": {
+                "book": {
+                    "description": "@Property\t\tbook object true \"Book\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Book"
+                        }
+                    ]
+                },
+                "cover": {
+                    "description": "@Property\t\tcover object false \"Cover taken from the file, when it has one\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Cover"
+                        }
+                    ]
+                },
+                "created": {
+                    "description": "@Property\t\tcreated bool true \"Whether the book was created, rather than updated\"",
+                    "type": "boolean"
+                },
+                "epub": {
+                    "description": "@Property\t\tepub object true \"EPUB file\"",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Epub"
+                        }
+                    ]
+                },
+                "warnings": {
+                    "description": "@Property\t\twarnings array false \"What was left out, e.g. a cover that can't be read\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.FieldChange": {
+            "description": "Value of a field before and after a change",
+            "type": "object",
+            "properties": {
+                "from": {},
+                "to": {}
+            }
+        },
+        "models.ImportError": {
+            "description": "Problems found on a single imported row",
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "row": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ImportReport": {
+            "description": "Import report",
+            "type": "object",
+            "properties": {
+                "books": {
+                    "description": "@Property\t\tbooks array true \"Books imported, or that would be imported on a dry run\"",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Book"
+                    }
+                },
+                "dry_run": {
+                    "description": "@Property\t\tdry_run bool true \"True when nothing was written to the DB\"",
+                    "type": "boolean"
+                },
+                "errors": {
+                    "description": "@Property\t\terrors array true \"Problems found for each rejected row\"",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ImportError"
+                    }
+                },
+                "failed": {
+                    "description": "@Property\t\tfailed int true \"Number of rows rejected\"",
+                    "type": "integer"
+                },
+                "imported": {
+                    "description": "@Property\t\timported int true \"Number of books written to the DB\"",
+                    "type": "integer"
+                },
+                "total_rows": {
+                    "description": "@Property\t\ttotal_rows int true \"Number of rows read from the file\"",
+                    "type": "integer"
+                },
+                "unmapped_fields": {
+                    "description": "@Property\t\tunmapped_fields object false \"MARC tags that have no book counterpart, with the number of records they were found in\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.RequestStruct": {
+            "description": "Process URL",
+            "type": "object",
+            "properties": {
+                "operation": {
+                    "description": "@Property\t\toperation string true \"Operation to perform, a rule set of the URL rules, see GET /url/operations\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"URL to process\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ResponseStruct": {
+            "type": "object",
+            "properties": {
+                "canonical": {
+                    "description": "canonical URLs the page declares, for html-canonical",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/urlfetch.CanonicalReport"
+                        }
+                    ]
+                },
+                "chain": {
+                    "description": "requests made by the resolve and html-canonical operations, in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/urlfetch.Hop"
+                    }
+                },
+                "processed_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ShortLink": {
+            "description": "Short link to a page, GET /l/{slug} redirects to its url",
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "description": "@Property\t\tclicks int false \"Redirects made by the link\"",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "@Property\t\tcreated_at string true \"Creation time, RFC 3339\"",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "@Property\t\tdisabled bool false \"A disabled link answers 410\"",
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "description": "@Property\t\texpires_at string false \"Time the link stops redirecting at, RFC 3339\"",
+                    "type": "string"
+                },
+                "last_clicked_at": {
+                    "description": "@Property\t\tlast_clicked_at string false \"Time of the last redirect, RFC 3339\"",
+                    "type": "string"
+                },
+                "permanent": {
+                    "description": "@Property\t\tpermanent bool false \"Redirects with 301 instead of 302\"",
+                    "type": "boolean"
+                },
+                "short_url": {
+                    "description": "@Property\t\tshort_url string false \"URL that redirects to the destination\"",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "@Property\t\tslug string true \"Slug of the link, the last segment of its short URL\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"Destination, the requested URL once processed by the URL cleaner\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ShortLinkRequest": {
+            "description": "New short link",
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "@Property\t\texpires_at string false \"Time the link stops redirecting at, RFC 3339\"",
+                    "type": "string"
+                },
+                "permanent": {
+                    "description": "@Property\t\tpermanent bool false \"Redirect with 301 instead of 302\"",
+                    "type": "boolean"
+                },
+                "slug": {
+                    "description": "@Property\t\tslug string false \"Custom slug, 3 to 64 letters, digits, - or _, generated when empty\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"URL to shorten\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ShortLinkUpdate": {
+            "description": "Changes to a short link, the fields left out are kept",
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "description": "@Property\t\tdisabled bool false \"Stop or start redirecting\"",
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "description": "@Property\t\texpires_at string false \"New expiry time, RFC 3339\"",
+                    "type": "string"
+                },
+                "no_expiry": {
+                    "description": "@Property\t\tno_expiry bool false \"Remove the expiry time\"",
+                    "type": "boolean"
+                },
+                "permanent": {
+                    "description": "@Property\t\tpermanent bool false \"Redirect with 301 instead of 302\"",
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.TrashedBook": {
+            "description": "Deleted book, in the trash until it is restored or purged",
+            "type": "object",
+            "properties": {
+                "author": {
                     "description": "@Property author string true \"Author\"",
                     "type": "string"
                 },
@@ -314,6 +3893,14 @@ const docTemplate = `{
                     "description": "@Property book_id int true \"Book ID\"",
                     "type": "integer"
                 },
+                "deleted_at": {
+                    "description": "@Property deleted_at string true \"Deletion time, RFC 3339\"",
+                    "type": "string"
+                },
+                "isbn": {
+                    "description": "@Property isbn string false \"ISBN-10 or ISBN-13\"",
+                    "type": "string"
+                },
                 "num_pages": {
                     "description": "@Property num_pages string false \"Number of pages\"",
                     "type": "integer"
@@ -328,24 +3915,135 @@ const docTemplate = `{
                 }
             }
         },
-        "models.RequestStruct": {
-            "description": "Process URL",
+        "models.Webhook": {
+            "description": "Subscription of a URL to book events, each event is POSTed to it signed with the secret",
             "type": "object",
             "properties": {
-                "operation": {
-                    "description": "@Property\t\toperation string true \"Operation to perform\"\n@Enum\t\t\tcanonical, redirection, all",
+                "active": {
+                    "description": "@Property\t\tactive bool true \"No event is sent to an inactive webhook\"",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "description": "@Property\t\tcreated_at string true \"Creation time, RFC 3339\"",
+                    "type": "string"
+                },
+                "events": {
+                    "description": "@Property\t\tevents array true \"Events sent to the receiver\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "@Property\t\tsecret string false \"Key of the signatures, only shown when it is set\"",
                     "type": "string"
                 },
                 "url": {
-                    "description": "@Property\t\turl string true \"URL to process\"",
+                    "description": "@Property\t\turl string true \"Receiver of the events, http or https\"",
                     "type": "string"
+                },
+                "webhook_id": {
+                    "description": "@Property\t\twebhook_id int true \"Webhook ID\"",
+                    "type": "integer"
                 }
             }
         },
-        "models.ResponseStruct": {
+        "models.WebhookDelivery": {
+            "description": "Delivery of an event to a webhook, with the outcome of its last attempt",
             "type": "object",
             "properties": {
-                "processed_url": {
+                "attempts": {
+                    "description": "@Property\t\tattempts int true \"Number of attempts made\"",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "@Property\t\tcreated_at string true \"Creation time, RFC 3339\"",
+                    "type": "string"
+                },
+                "delivery_id": {
+                    "description": "@Property\t\tdelivery_id int true \"Delivery ID, sent in the X-Bookit-Delivery header\"",
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "@Property\t\terror string false \"Why the last attempt failed\"",
+                    "type": "string"
+                },
+                "event": {
+                    "description": "@Property\t\tevent string true \"Event sent\"",
+                    "type": "string"
+                },
+                "last_attempt_at": {
+                    "description": "@Property\t\tlast_attempt_at string false \"Time of the last attempt, RFC 3339\"",
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "description": "@Property\t\tnext_attempt_at string false \"Time of the next attempt of a pending delivery, RFC 3339\"",
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "@Property\t\tpayload object true \"Body sent, a BookEvent\"",
+                    "type": "object"
+                },
+                "redelivery_of": {
+                    "description": "@Property\t\tredelivery_of int false \"Delivery this one sends again\"",
+                    "type": "integer"
+                },
+                "response_status": {
+                    "description": "@Property\t\tresponse_status int false \"HTTP status of the last answer of the receiver\"",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "@Property\t\tstatus string true \"pending until the receiver answers 2xx (delivered) or the attempts run out (failed)\"",
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "description": "@Property\t\twebhook_id int true \"Webhook ID\"",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.WebhookRequest": {
+            "description": "New webhook",
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "@Property\t\tevents array true \"Events to send, from book.created, book.updated, book.deleted and book.restored\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "@Property\t\tsecret string false \"Key of the signatures, at least 16 characters, generated when empty\"",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "@Property\t\turl string true \"Receiver of the events, http or https\"",
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookUpdate": {
+            "description": "Changes to a webhook, the fields left out are kept",
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "@Property\t\tactive bool false \"Stop or start sending events\"",
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "@Property\t\tevents array false \"New events\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "rotate_secret": {
+                    "description": "@Property\t\trotate_secret bool false \"Replace the secret with a generated one, shown in the response\"",
+                    "type": "boolean"
+                },
+                "url": {
+                    "description": "@Property\t\turl string false \"New receiver\"",
                     "type": "string"
                 }
             }
@@ -358,6 +4056,140 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "services.PurgeReport": {
+            "description": "Result of a purge of the trash",
+            "type": "object",
+            "properties": {
+                "purged": {
+                    "description": "@Property\t\tpurged int true \"Number of books deleted for good\"",
+                    "type": "integer"
+                }
+            }
+        },
+        "services.RevertRequest": {
+            "description": "Version of the book to revert to",
+            "type": "object",
+            "properties": {
+                "audit_id": {
+                    "description": "@Property\t\taudit_id int true \"Entry of the history of the book, the book is put back as that change left it\"",
+                    "type": "integer"
+                }
+            }
+        },
+        "sitemap.Issue": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "fixed": {
+                    "description": "processed URL of a non-canonical entry",
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "loc": {
+                    "type": "string"
+                },
+                "problem": {
+                    "type": "string"
+                }
+            }
+        },
+        "sitemap.Report": {
+            "type": "object",
+            "properties": {
+                "counts": {
+                    "description": "issues by problem",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "entries": {
+                    "description": "entries read",
+                    "type": "integer"
+                },
+                "issues": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/sitemap.Issue"
+                    }
+                },
+                "kept": {
+                    "description": "entries of the corrected sitemap",
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "operation": {
+                    "type": "string"
+                }
+            }
+        },
+        "urlfetch.CanonicalReport": {
+            "type": "object",
+            "properties": {
+                "computed": {
+                    "description": "what the canonical operation makes of the URL, set by the caller",
+                    "type": "string"
+                },
+                "disagreements": {
+                    "description": "the declarations, and the computed URL, that don't point to the same URL",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "header": {
+                    "description": "Link: \u003c...\u003e; rel=\"canonical\" HTTP header",
+                    "type": "string"
+                },
+                "link": {
+                    "description": "\u003clink rel=\"canonical\" href=\"...\"\u003e of the HTML",
+                    "type": "string"
+                },
+                "og_url": {
+                    "description": "\u003cmeta property=\"og:url\" content=\"...\"\u003e of the HTML",
+                    "type": "string"
+                },
+                "page": {
+                    "description": "URL the page was read from, after the redirects",
+                    "type": "string"
+                }
+            }
+        },
+        "urlfetch.Hop": {
+            "type": "object",
+            "properties": {
+                "location": {
+                    "description": "where the response redirects to, resolved against Url",
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "urlrules.Operation": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,89 @@
+package enrich
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// cache of the records of a provider, least recently used first out
+type cache struct {
+	provider Provider
+	ttl      time.Duration
+	size     int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	// the most recently used entry in front
+	order *list.List
+	// the clock of the expiries, replaced by the tests
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	isbn    string
+	record  Record
+	err     error
+	expires time.Time
+}
+
+// Cached keeps the records the provider finds for ttl, and the ISBNs it has no record of, at most size of them
+// the other errors are not kept, the next lookup asks the provider again
+func Cached(provider Provider, ttl time.Duration, size int) Provider {
+	return &cache{provider: provider, ttl: ttl, size: size, entries: map[string]*list.Element{}, order: list.New(), now: time.Now}
+}
+
+func (cache *cache) Name() string {
+	return cache.provider.Name()
+}
+
+func (cache *cache) Lookup(ctx context.Context, isbn string) (Record, error) {
+	if entry, ok := cache.get(isbn); ok {
+		return entry.record, entry.err
+	}
+	// two lookups of the same ISBN at the same time both ask the provider, which is harmless
+	record, err := cache.provider.Lookup(ctx, isbn)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		cache.put(cacheEntry{isbn: isbn, record: record, err: err, expires: cache.now().Add(cache.ttl)})
+	}
+	return record, err
+}
+
+func (cache *cache) Cover(ctx context.Context, record Record, maxBytes int64) ([]byte, error) {
+	return cache.provider.Cover(ctx, record, maxBytes)
+}
+
+func (cache *cache) get(isbn string) (cacheEntry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[isbn]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := element.Value.(cacheEntry)
+	if !cache.now().Before(entry.expires) {
+		cache.order.Remove(element)
+		delete(cache.entries, isbn)
+		return cacheEntry{}, false
+	}
+	cache.order.MoveToFront(element)
+	return entry, true
+}
+
+func (cache *cache) put(entry cacheEntry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[entry.isbn]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[entry.isbn] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(cacheEntry).isbn)
+	}
+}
@@ -0,0 +1,212 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
+/**
+Enrichment of the books out of an external catalogue: a Provider finds the record of an ISBN, which gives the title,
+the authors, the number of pages, the publication date and the cover of the book
+Open Library and Google Books are the providers, reached at a base URL that can point to a mirror, or to a stub in tests
+The records are cached, the ISBNs the catalogue doesn't have too, so that previewing a change and confirming it
+ask the catalogue once
+**/
+
+// Options of the enrichment, the config section "enrichment", a field left at 0 takes its value from DefaultOptions
+type Options struct {
+	// openlibrary or googlebooks
+	Provider string `json:"provider"`
+	// where the API of the provider is, its public one when empty
+	BaseUrl string `json:"base_url"`
+	// key of the Google Books API, optional
+	ApiKey string `json:"api_key" secret:"true"`
+	// time given to the catalogue to answer
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// how long a record is kept
+	CacheMinutes int `json:"cache_minutes"`
+	// most records kept, the least recently used ones are dropped first
+	CacheEntries int `json:"cache_entries"`
+	// lets the requests reach private, loopback and link-local addresses, for tests and trusted networks only
+	AllowPrivate bool `json:"allow_private"`
+}
+
+var DefaultOptions = Options{Provider: "openlibrary", TimeoutSeconds: 10, CacheMinutes: 24 * 60, CacheEntries: 1000}
+
+// Providers lists the catalogues that can be configured
+var Providers = []string{"openlibrary", "googlebooks"}
+
+const userAgent = "BookIT-Enrichment/1.0"
+
+var (
+	ErrNotFound = errors.New("the catalogue has no record of the ISBN")
+	// wraps the errors of a catalogue that could not be reached, or gave an answer that can't be read
+	ErrUnavailable   = errors.New("the catalogue could not be queried")
+	ErrCoverTooLarge = errors.New("cover is too large")
+
+	errAnswerTooLarge = errors.New("the answer is too large")
+)
+
+// Record is what a catalogue knows of a book, the fields it doesn't know are left empty
+type Record struct {
+	Isbn    string
+	Title   string
+	Authors []string
+	// 0 when unknown
+	NumPages int
+	// YYYY-MM-DD, a year alone is the first of January
+	PublishDate string
+	CoverUrl    string
+	// name of the provider
+	Source string
+}
+
+// Provider is a catalogue of books, safe for concurrent use
+type Provider interface {
+	// Name of the catalogue, e.g. openlibrary
+	Name() string
+	// Lookup finds the record of an ISBN-10 or ISBN-13, ErrNotFound when the catalogue has none
+	Lookup(ctx context.Context, isbn string) (Record, error)
+	// Cover downloads the cover of a record, ErrNotFound when it has none, ErrCoverTooLarge past maxBytes
+	Cover(ctx context.Context, record Record, maxBytes int64) ([]byte, error)
+}
+
+// WithDefaults returns the options with the fields left at 0 filled in
+func (options Options) WithDefaults() Options {
+	if options.Provider == "" {
+		options.Provider = DefaultOptions.Provider
+	}
+	if options.TimeoutSeconds <= 0 {
+		options.TimeoutSeconds = DefaultOptions.TimeoutSeconds
+	}
+	if options.CacheMinutes <= 0 {
+		options.CacheMinutes = DefaultOptions.CacheMinutes
+	}
+	if options.CacheEntries <= 0 {
+		options.CacheEntries = DefaultOptions.CacheEntries
+	}
+	return options
+}
+
+// Open makes the provider of the options, with its cache
+func Open(options Options) (Provider, error) {
+	options = options.WithDefaults()
+	if options.BaseUrl != "" {
+		if base, err := url.Parse(options.BaseUrl); err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return nil, fmt.Errorf("base URL must be an http or https URL, got %q", options.BaseUrl)
+		}
+	}
+	client := newClient(options)
+	var provider Provider
+	switch options.Provider {
+	case "openlibrary":
+		provider = &OpenLibrary{client: client, baseUrl: baseUrl(options.BaseUrl, "https://openlibrary.org")}
+	case "googlebooks":
+		provider = &GoogleBooks{client: client, baseUrl: baseUrl(options.BaseUrl, "https://www.googleapis.com"), apiKey: options.ApiKey}
+	default:
+		return nil, fmt.Errorf("unknown provider %q, must be one of %s", options.Provider, strings.Join(Providers, ", "))
+	}
+	return Cached(provider, time.Duration(options.CacheMinutes)*time.Minute, options.CacheEntries), nil
+}
+
+func baseUrl(configured, public string) string {
+	if configured == "" {
+		return public
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// client of the catalogues, the addresses are checked like the URLs fetched by the URL cleaner, see urlfetch
+type client struct {
+	http *http.Client
+}
+
+func newClient(options Options) *client {
+	timeout := time.Duration(options.TimeoutSeconds) * time.Second
+	// the covers are often redirected to the host that has them, the redirects are followed
+	return &client{http: &http.Client{Transport: urlfetch.NewTransport(timeout, options.AllowPrivate), Timeout: timeout}}
+}
+
+// get sends a GET and reads at most limit bytes of the answer, ErrNotFound on a 404
+func (client *client) get(ctx context.Context, link string, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %s is not an http or https URL", ErrUnavailable, link)
+	}
+	request.Header.Set("User-Agent", userAgent)
+	response, err := client.http.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %s answered %s", ErrUnavailable, request.URL.Host, response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: %w, %s sent more than %d bytes", ErrUnavailable, errAnswerTooLarge, request.URL.Host, limit)
+	}
+	return body, nil
+}
+
+// downloads the cover of a record, for the providers whose records give the URL of their cover
+func (client *client) cover(ctx context.Context, record Record, maxBytes int64) ([]byte, error) {
+	if record.CoverUrl == "" {
+		return nil, ErrNotFound
+	}
+	cover, err := client.get(ctx, record.CoverUrl, maxBytes)
+	if errors.Is(err, errAnswerTooLarge) {
+		return nil, fmt.Errorf("%w, larger than %d bytes", ErrCoverTooLarge, maxBytes)
+	}
+	return cover, err
+}
+
+// largest answer read from a catalogue, a record is a few kilobytes
+const maxRecordSize = 1 << 20
+
+var (
+	yearRegex = regexp.MustCompile(`\d{4}`)
+	// the forms the catalogues give their dates in, "2004-06-01", "June 2004", "Jun 1, 2004", "1 June 2004"
+	dateLayouts = []string{"2006-01-02", "2006-01", "January 2, 2006", "Jan 2, 2006", "January 2006", "Jan 2006", "2 January 2006", "2 Jan 2006"}
+)
+
+// normalizes a publication date to YYYY-MM-DD, a date without its day or month is the first, empty when it has no year
+func normalizeDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format("2006-01-02")
+		}
+	}
+	if year := yearRegex.FindString(value); year != "" {
+		return year + "-01-01"
+	}
+	return ""
+}
+
+// the title with its subtitle, as the MARC import makes it
+func fullTitle(title, subtitle string) string {
+	title, subtitle = strings.TrimSpace(title), strings.TrimSpace(subtitle)
+	if subtitle == "" {
+		return title
+	}
+	return title + ": " + subtitle
+}
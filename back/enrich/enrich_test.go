@@ -0,0 +1,188 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
+// a catalogue that knows 9780156907392, answers every API the providers use and counts the lookups
+func stub(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var lookups atomic.Int32
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/api/books", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.URL.Query().Get("jscmd") != "data" || r.URL.Query().Get("format") != "json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("bibkeys") {
+		case "ISBN:9780156907392":
+			w.Write([]byte(`{"ISBN:9780156907392": {"title": "Mrs Dalloway", "subtitle": "A Novel", "authors": [{"name": "Virginia Woolf", "url": "https://openlibrary.org/authors/OL19987A"}],
+				"number_of_pages": 194, "publish_date": "May 14, 1925", "cover": {"small": "` + server.URL + `/covers/S.jpg", "large": "` + server.URL + `/covers/L.jpg"}}}`))
+		case "ISBN:0000000000":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+	mux.HandleFunc("/books/v1/volumes", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.URL.Query().Get("q") != "isbn:9780156907392" {
+			w.Write([]byte(`{"kind": "books#volumes", "totalItems": 0}`))
+			return
+		}
+		if r.URL.Query().Get("key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"totalItems": 1, "items": [{"volumeInfo": {"title": "Mrs. Dalloway", "authors": ["Virginia Woolf"], "publishedDate": "1925-05",
+			"pageCount": 216, "imageLinks": {"smallThumbnail": "` + server.URL + `/covers/S.jpg"}}}]}`))
+	})
+	mux.HandleFunc("/covers/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("c", len(r.URL.Path))))
+	})
+	return server, &lookups
+}
+
+func TestProviders(t *testing.T) {
+	server, _ := stub(t)
+
+	t.Run("Testing Open Library", func(t *testing.T) {
+		provider, err := Open(Options{Provider: "openlibrary", BaseUrl: server.URL + "/", AllowPrivate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := provider.Lookup(context.Background(), "9780156907392")
+		expected := Record{Isbn: "9780156907392", Title: "Mrs Dalloway: A Novel", Authors: []string{"Virginia Woolf"}, NumPages: 194, PublishDate: "1925-05-14",
+			CoverUrl: server.URL + "/covers/L.jpg", Source: "openlibrary"}
+		if err != nil || !reflect.DeepEqual(record, expected) {
+			t.Fatalf("expected %+v, got %+v %v", expected, record, err)
+		}
+		if cover, err := provider.Cover(context.Background(), record, 100); err != nil || len(cover) != len("/covers/L.jpg") {
+			t.Errorf("expected the large cover, got %q %v", cover, err)
+		}
+		if _, err := provider.Cover(context.Background(), record, 4); !errors.Is(err, ErrCoverTooLarge) {
+			t.Errorf("expected %v, got %v", ErrCoverTooLarge, err)
+		}
+		if _, err := provider.Lookup(context.Background(), "9780141182605"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %v, got %v", ErrNotFound, err)
+		}
+		if _, err := provider.Lookup(context.Background(), "0000000000"); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected %v, got %v", ErrUnavailable, err)
+		}
+	})
+
+	t.Run("Testing Google Books", func(t *testing.T) {
+		provider, err := Open(Options{Provider: "googlebooks", BaseUrl: server.URL, ApiKey: "secret", AllowPrivate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := provider.Lookup(context.Background(), "9780156907392")
+		expected := Record{Isbn: "9780156907392", Title: "Mrs. Dalloway", Authors: []string{"Virginia Woolf"}, NumPages: 216, PublishDate: "1925-05-01",
+			CoverUrl: server.URL + "/covers/S.jpg", Source: "googlebooks"}
+		if err != nil || !reflect.DeepEqual(record, expected) {
+			t.Fatalf("expected %+v, got %+v %v", expected, record, err)
+		}
+		if _, err := provider.Lookup(context.Background(), "9780141182605"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Testing a catalogue on a private address is blocked", func(t *testing.T) {
+		provider, err := Open(Options{BaseUrl: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.Lookup(context.Background(), "9780156907392"); !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), urlfetch.ErrBlockedAddress.Error()) {
+			t.Errorf("expected the address to be blocked, got %v", err)
+		}
+	})
+
+	t.Run("Testing the options that are refused", func(t *testing.T) {
+		for _, options := range []Options{{Provider: "worldcat"}, {BaseUrl: "ftp://example.com"}, {BaseUrl: "openlibrary.org"}} {
+			if _, err := Open(options); err == nil {
+				t.Errorf("%+v: expected an error", options)
+			}
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	server, lookups := stub(t)
+	provider := &OpenLibrary{client: newClient(Options{TimeoutSeconds: 5, AllowPrivate: true}), baseUrl: server.URL}
+	cached := Cached(provider, time.Minute, 2).(*cache)
+	clock := time.Now()
+	cached.now = func() time.Time { return clock }
+	lookup := func(isbn string) error {
+		_, err := cached.Lookup(context.Background(), isbn)
+		return err
+	}
+
+	t.Run("Testing the records and the unknown ISBNs are kept", func(t *testing.T) {
+		lookup("9780156907392")
+		lookup("9780156907392")
+		lookup("9780141182605")
+		if err := lookup("9780141182605"); !errors.Is(err, ErrNotFound) || lookups.Load() != 2 {
+			t.Errorf("expected 2 lookups and the unknown ISBN to be kept, got %d %v", lookups.Load(), err)
+		}
+	})
+
+	t.Run("Testing the failures are not kept", func(t *testing.T) {
+		lookups.Store(0)
+		lookup("0000000000")
+		lookup("0000000000")
+		if lookups.Load() != 2 {
+			t.Errorf("expected 2 lookups, got %d", lookups.Load())
+		}
+	})
+
+	t.Run("Testing the least recently used record is dropped", func(t *testing.T) {
+		lookups.Store(0)
+		// 9780156907392 is used, 9780141182605 is the least recently used and makes room for a third ISBN
+		lookup("9780156907392")
+		lookup("9780060853983")
+		lookup("9780156907392")
+		lookup("9780141182605")
+		if lookups.Load() != 2 {
+			t.Errorf("expected 2 lookups, got %d", lookups.Load())
+		}
+	})
+
+	t.Run("Testing the records expire", func(t *testing.T) {
+		lookups.Store(0)
+		clock = clock.Add(time.Minute)
+		lookup("9780156907392")
+		if lookups.Load() != 1 {
+			t.Errorf("expected the expired record to be looked up again, got %d lookups", lookups.Load())
+		}
+	})
+}
+
+func TestNormalizeDate(t *testing.T) {
+	for value, expected := range map[string]string{
+		"1925-05-14":   "1925-05-14",
+		"1925-05":      "1925-05-01",
+		"1925":         "1925-01-01",
+		"May 14, 1925": "1925-05-14",
+		"Jun 1, 2004":  "2004-06-01",
+		"June 2004":    "2004-06-01",
+		"1 June 2004":  "2004-06-01",
+		"c1925.":       "1925-01-01",
+		"[n.d.]":       "",
+	} {
+		if date := normalizeDate(value); date != expected {
+			t.Errorf("%q: expected %q, got %q", value, expected, date)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// OpenLibrary is the catalogue of openlibrary.org, read with its Books API
+type OpenLibrary struct {
+	client  *client
+	baseUrl string
+}
+
+type openLibraryBook struct {
+	Title         string `json:"title"`
+	Subtitle      string `json:"subtitle"`
+	NumberOfPages int    `json:"number_of_pages"`
+	PublishDate   string `json:"publish_date"`
+	Authors       []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Cover struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+func (provider *OpenLibrary) Name() string {
+	return "openlibrary"
+}
+
+// Lookup asks /api/books for the ISBN, the answer is an object keyed by ISBN:<isbn>, empty when the ISBN is unknown
+func (provider *OpenLibrary) Lookup(ctx context.Context, isbn string) (Record, error) {
+	key := "ISBN:" + isbn
+	body, err := provider.client.get(ctx, provider.baseUrl+"/api/books?"+url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}.Encode(), maxRecordSize)
+	if err != nil {
+		return Record{}, err
+	}
+	var books map[string]openLibraryBook
+	if err := json.Unmarshal(body, &books); err != nil {
+		return Record{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	book, ok := books[key]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	record := Record{
+		Isbn:        isbn,
+		Title:       fullTitle(book.Title, book.Subtitle),
+		NumPages:    book.NumberOfPages,
+		PublishDate: normalizeDate(book.PublishDate),
+		Source:      provider.Name(),
+	}
+	for _, author := range book.Authors {
+		if author.Name != "" {
+			record.Authors = append(record.Authors, author.Name)
+		}
+	}
+	for _, cover := range []string{book.Cover.Large, book.Cover.Medium, book.Cover.Small} {
+		if cover != "" {
+			record.CoverUrl = cover
+			break
+		}
+	}
+	return record, nil
+}
+
+func (provider *OpenLibrary) Cover(ctx context.Context, record Record, maxBytes int64) ([]byte, error) {
+	return provider.client.cover(ctx, record, maxBytes)
+}
+
+// GoogleBooks is the catalogue of Google Books, read with its volumes search
+type GoogleBooks struct {
+	client  *client
+	baseUrl string
+	apiKey  string
+}
+
+type googleVolumes struct {
+	Items []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Subtitle      string   `json:"subtitle"`
+			Authors       []string `json:"authors"`
+			PublishedDate string   `json:"publishedDate"`
+			PageCount     int      `json:"pageCount"`
+			ImageLinks    struct {
+				SmallThumbnail string `json:"smallThumbnail"`
+				Thumbnail      string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (provider *GoogleBooks) Name() string {
+	return "googlebooks"
+}
+
+// Lookup searches /books/v1/volumes for isbn:<isbn>, the first volume found is the record
+func (provider *GoogleBooks) Lookup(ctx context.Context, isbn string) (Record, error) {
+	query := url.Values{"q": {"isbn:" + isbn}}
+	if provider.apiKey != "" {
+		query.Set("key", provider.apiKey)
+	}
+	body, err := provider.client.get(ctx, provider.baseUrl+"/books/v1/volumes?"+query.Encode(), maxRecordSize)
+	if err != nil {
+		return Record{}, err
+	}
+	var volumes googleVolumes
+	if err := json.Unmarshal(body, &volumes); err != nil {
+		return Record{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if len(volumes.Items) == 0 {
+		return Record{}, ErrNotFound
+	}
+	volume := volumes.Items[0].VolumeInfo
+	record := Record{
+		Isbn:        isbn,
+		Title:       fullTitle(volume.Title, volume.Subtitle),
+		Authors:     volume.Authors,
+		NumPages:    volume.PageCount,
+		PublishDate: normalizeDate(volume.PublishedDate),
+		CoverUrl:    volume.ImageLinks.Thumbnail,
+		Source:      provider.Name(),
+	}
+	if record.CoverUrl == "" {
+		record.CoverUrl = volume.ImageLinks.SmallThumbnail
+	}
+	return record, nil
+}
+
+func (provider *GoogleBooks) Cover(ctx context.Context, record Record, maxBytes int64) ([]byte, error) {
+	return provider.client.cover(ctx, record, maxBytes)
+}
@@ -0,0 +1,410 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+)
+
+/**
+Metadata of the EPUB files: the archive is opened in memory, its META-INF/container.xml points to the package document
+(the OPF), whose metadata gives the title, the creators, the language, the identifiers, the publication date and the cover
+Only the container, the package document and the cover are read. The sizes an archive announces can't be trusted, the
+archive is refused when it announces too many entries or too many bytes, and the parts read are capped all the same,
+so that a zip bomb can't take all the memory
+EPUB 2 and EPUB 3 are read alike, EPUB 3 refines its metadata with <meta refines> elements instead of opf: attributes
+**/
+
+// Options of the EPUB uploads, the config section "epubs", a field left at 0 takes its value from DefaultOptions
+type Options struct {
+	// largest upload accepted
+	MaxBytes int64 `json:"max_bytes"`
+	// most entries an archive can have
+	MaxEntries int `json:"max_entries"`
+	// most bytes the entries of an archive can add up to once uncompressed
+	MaxUncompressedBytes int64 `json:"max_uncompressed_bytes"`
+}
+
+var DefaultOptions = Options{MaxBytes: 100 << 20, MaxEntries: 10_000, MaxUncompressedBytes: 1 << 30}
+
+const (
+	// MediaType is the type of the EPUB files, which their mimetype entry must hold
+	MediaType = "application/epub+zip"
+	// largest container or package document read
+	maxXmlPart = 4 << 20
+	// largest cover read, a larger one is left out with a warning
+	maxCover = 32 << 20
+)
+
+var (
+	ErrNotEpub   = errors.New("file is not an EPUB")
+	ErrMalformed = errors.New("EPUB is malformed")
+	ErrTooLarge  = errors.New("EPUB is too large")
+)
+
+// Identifier of a book, an ISBN, a UUID, a DOI...
+type Identifier struct {
+	Value string
+	// ISBN, UUID, DOI... as the package document says, empty when it doesn't
+	Scheme string
+}
+
+// Metadata of an EPUB
+type Metadata struct {
+	Title string
+	// creators whose role is author, or who have no role
+	Authors []string
+	// every creator, illustrators and translators included
+	Creators    []string
+	Language    string
+	Identifiers []Identifier
+	// the first valid ISBN of the identifiers, normalized, empty when there is none
+	Isbn string
+	// publication date, YYYY-MM-DD, a year alone is the first of January, empty when there is none or it can't be read
+	Date string
+	// the cover image, nil when the package document names none
+	Cover []byte
+	// what was left out, e.g. a cover that is missing from the archive
+	Warnings []string
+}
+
+// WithDefaults returns the options with the fields left at 0 filled in
+func (options Options) WithDefaults() Options {
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = DefaultOptions.MaxBytes
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultOptions.MaxEntries
+	}
+	if options.MaxUncompressedBytes <= 0 {
+		options.MaxUncompressedBytes = DefaultOptions.MaxUncompressedBytes
+	}
+	return options
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageDocument struct {
+	Metadata struct {
+		Titles []struct {
+			Id    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creators []struct {
+			Id    string `xml:"id,attr"`
+			Role  string `xml:"http://www.idpf.org/2007/opf role,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Languages   []string `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Identifiers []struct {
+			Id     string `xml:"id,attr"`
+			Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Dates []struct {
+			Event string `xml:"http://www.idpf.org/2007/opf event,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://purl.org/dc/elements/1.1/ date"`
+		Metas []struct {
+			// EPUB 3
+			Refines  string `xml:"refines,attr"`
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+			// EPUB 2
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+// Parse reads the metadata of an EPUB, the errors are ErrNotEpub, ErrMalformed or ErrTooLarge, wrapped with what was wrong
+func Parse(data []byte, options Options) (Metadata, error) {
+	options = options.WithDefaults()
+	if int64(len(data)) > options.MaxBytes {
+		return Metadata{}, ErrTooLarge
+	}
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return Metadata{}, ErrNotEpub
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Metadata{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	files, err := entries(archive, options)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	mimetype, err := read(files, "mimetype", 64)
+	if err != nil || strings.TrimSpace(string(mimetype)) != MediaType {
+		return Metadata{}, fmt.Errorf("%w, its mimetype entry must be %s", ErrNotEpub, MediaType)
+	}
+	var rootfiles container
+	if err := decodeXml(files, "META-INF/container.xml", &rootfiles); err != nil {
+		return Metadata{}, err
+	}
+	packagePath := ""
+	for _, rootfile := range rootfiles.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			packagePath = rootfile.FullPath
+			break
+		}
+	}
+	if packagePath == "" {
+		return Metadata{}, fmt.Errorf("%w: META-INF/container.xml names no package document", ErrMalformed)
+	}
+	var document packageDocument
+	if err := decodeXml(files, packagePath, &document); err != nil {
+		return Metadata{}, err
+	}
+
+	metadata := metadataOf(document)
+	if href := coverHref(document); href != "" {
+		coverPath, ok := resolve(packagePath, href)
+		if !ok {
+			metadata.Warnings = append(metadata.Warnings, fmt.Sprintf("cover %q is outside of the archive", href))
+		} else if cover, err := read(files, coverPath, maxCover); err != nil {
+			metadata.Warnings = append(metadata.Warnings, "cover left out: "+err.Error())
+		} else {
+			metadata.Cover = cover
+		}
+	}
+	return metadata, nil
+}
+
+// the entries of the archive by name, refused when they are over the limits or their names are ambiguous
+func entries(archive *zip.Reader, options Options) (map[string]*zip.File, error) {
+	if len(archive.File) > options.MaxEntries {
+		return nil, fmt.Errorf("%w: more than %d entries", ErrTooLarge, options.MaxEntries)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	var total uint64
+	for _, file := range archive.File {
+		name := file.Name
+		if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) || strings.Contains("/"+name+"/", "/../") {
+			return nil, fmt.Errorf("%w: invalid entry name %q", ErrMalformed, name)
+		}
+		if _, duplicate := files[name]; duplicate {
+			return nil, fmt.Errorf("%w: entry %q is in the archive twice", ErrMalformed, name)
+		}
+		files[name] = file
+		total += file.UncompressedSize64
+		if total > uint64(options.MaxUncompressedBytes) {
+			return nil, fmt.Errorf("%w: more than %d bytes once uncompressed", ErrTooLarge, options.MaxUncompressedBytes)
+		}
+	}
+	return files, nil
+}
+
+// reads an entry, ErrTooLarge past limit whatever size the archive announces for it
+func read(files map[string]*zip.File, name string, limit int64) ([]byte, error) {
+	file, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is missing", ErrMalformed, name)
+	}
+	if file.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrTooLarge, name, limit)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrMalformed, name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrMalformed, name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrTooLarge, name, limit)
+	}
+	return data, nil
+}
+
+func decodeXml(files map[string]*zip.File, name string, target any) error {
+	data, err := read(files, name, maxXmlPart)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrMalformed, name, err)
+	}
+	return nil
+}
+
+// the path in the archive of an href of the package document, ok is false when it points outside of the archive
+func resolve(packagePath, href string) (string, bool) {
+	href, _, _ = strings.Cut(href, "#")
+	unescaped, err := url.PathUnescape(href)
+	if err != nil || unescaped == "" || strings.HasPrefix(unescaped, "/") || strings.Contains(unescaped, ":") {
+		return "", false
+	}
+	resolved := path.Join(path.Dir(packagePath), unescaped)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	return resolved, true
+}
+
+func metadataOf(document packageDocument) Metadata {
+	var metadata Metadata
+	// EPUB 3 properties of an element, by its id
+	refines := map[string]map[string]string{}
+	for _, meta := range document.Metadata.Metas {
+		if id, ok := strings.CutPrefix(meta.Refines, "#"); ok && meta.Property != "" {
+			if refines[id] == nil {
+				refines[id] = map[string]string{}
+			}
+			refines[id][meta.Property] = strings.TrimSpace(meta.Value)
+		}
+	}
+
+	for _, title := range document.Metadata.Titles {
+		value := clean(title.Value)
+		if value == "" {
+			continue
+		}
+		if metadata.Title == "" || refines[title.Id]["title-type"] == "main" {
+			metadata.Title = value
+		}
+		if refines[title.Id]["title-type"] == "main" {
+			break
+		}
+	}
+
+	for _, creator := range document.Metadata.Creators {
+		name := clean(creator.Value)
+		if name == "" {
+			continue
+		}
+		metadata.Creators = append(metadata.Creators, name)
+		role := creator.Role
+		if role == "" {
+			role = refines[creator.Id]["role"]
+		}
+		if role == "" || role == "aut" {
+			metadata.Authors = append(metadata.Authors, name)
+		}
+	}
+
+	for _, language := range document.Metadata.Languages {
+		if language = strings.TrimSpace(language); language != "" {
+			metadata.Language = language
+			break
+		}
+	}
+
+	for _, identifier := range document.Metadata.Identifiers {
+		value := strings.TrimSpace(identifier.Value)
+		if value == "" {
+			continue
+		}
+		scheme := identifier.Scheme
+		if scheme == "" {
+			scheme = identifierSchemes[refines[identifier.Id]["identifier-type"]]
+		}
+		metadata.Identifiers = append(metadata.Identifiers, Identifier{Value: value, Scheme: scheme})
+		if metadata.Isbn == "" {
+			if isbn := isbnOf(value); isbn != "" {
+				metadata.Isbn = isbn
+			}
+		}
+	}
+
+	// EPUB 2 dates carry the event they are the date of, the one without an event is taken when there is no publication date
+	for _, date := range document.Metadata.Dates {
+		normalized := normalizeDate(date.Value)
+		if normalized == "" || (date.Event != "" && !strings.EqualFold(date.Event, "publication")) {
+			continue
+		}
+		if metadata.Date == "" || strings.EqualFold(date.Event, "publication") {
+			metadata.Date = normalized
+		}
+	}
+	return metadata
+}
+
+// ONIX codes of the EPUB 3 identifier-type refinement
+var identifierSchemes = map[string]string{"02": "ISBN", "15": "ISBN", "06": "DOI", "22": "URN"}
+
+// the ISBN of an identifier, urn:isbn:9780... or 978-0-..., normalized, empty when it isn't a valid ISBN
+func isbnOf(value string) string {
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"urn:isbn:", "isbn:", "isbn"} {
+		if strings.HasPrefix(lower, prefix) {
+			value = strings.TrimSpace(value[len(prefix):])
+			break
+		}
+	}
+	if !utils.ValidateIsbn(value) {
+		return ""
+	}
+	return utils.NormalizeIsbn(value)
+}
+
+var dateRegex = regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?`)
+
+// dates are W3CDTF, YYYY, YYYY-MM or YYYY-MM-DD followed by a time, the missing month and day are the first
+func normalizeDate(value string) string {
+	match := dateRegex.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return ""
+	}
+	month, day := match[2], match[3]
+	if month == "" {
+		month = "01"
+	}
+	if day == "" {
+		day = "01"
+	}
+	date := match[1] + "-" + month + "-" + day
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return ""
+	}
+	return date
+}
+
+// the href of the cover image, the manifest item with the cover-image property (EPUB 3) or the one the cover meta names (EPUB 2)
+func coverHref(document packageDocument) string {
+	for _, item := range document.Manifest {
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") {
+			return item.Href
+		}
+	}
+	for _, meta := range document.Metadata.Metas {
+		if meta.Name != "cover" || meta.Content == "" {
+			continue
+		}
+		for _, item := range document.Manifest {
+			if item.Id == meta.Content {
+				return item.Href
+			}
+		}
+	}
+	return ""
+}
+
+// collapses the white space that pretty printed package documents put in the values
+func clean(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
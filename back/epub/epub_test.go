@@ -0,0 +1,242 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const containerXml = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+const epub3Package = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:8f1c3e4a-2b6d-4f5e-9a7b-1c2d3e4f5a6b</dc:identifier>
+    <dc:identifier id="isbn">urn:isbn:978-0-15-603035-9</dc:identifier>
+    <meta refines="#isbn" property="identifier-type" scheme="onix:codelist5">15</meta>
+    <dc:title id="collection">Penguin Modern Classics</dc:title>
+    <meta refines="#collection" property="title-type">collection</meta>
+    <dc:title id="main">
+      To the
+      Lighthouse
+    </dc:title>
+    <meta refines="#main" property="title-type">main</meta>
+    <dc:creator id="author">Virginia Woolf</dc:creator>
+    <meta refines="#author" property="role" scheme="marc:relators">aut</meta>
+    <dc:creator id="illustrator">Vanessa Bell</dc:creator>
+    <meta refines="#illustrator" property="role" scheme="marc:relators">ill</meta>
+    <dc:language>en-GB</dc:language>
+    <dc:date>1927-05</dc:date>
+    <meta property="dcterms:modified">2024-01-02T03:04:05Z</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="cover" href="images/cover%20art.png" media-type="image/png" properties="cover-image"/>
+  </manifest>
+</package>`
+
+const epub2Package = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:opf="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Waves</dc:title>
+    <dc:creator opf:role="trl">A Translator</dc:creator>
+    <dc:creator opf:role="aut" opf:file-as="Woolf, Virginia">Virginia Woolf</dc:creator>
+    <dc:identifier id="id" opf:scheme="ISBN">0156949601</dc:identifier>
+    <dc:date opf:event="modification">2020-01-01</dc:date>
+    <dc:date opf:event="publication">1931</dc:date>
+    <dc:language>en</dc:language>
+    <meta name="cover" content="cover-image"/>
+  </metadata>
+  <manifest>
+    <item id="cover-image" href="../cover.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`
+
+type entry struct {
+	name string
+	data string
+}
+
+// an archive of the entries, the mimetype first and stored as EPUB files have it
+func archive(t *testing.T, entries ...entry) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		method := zip.Deflate
+		if entry.name == "mimetype" {
+			method = zip.Store
+		}
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: entry.name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(entry.data))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func chapters(count int) []entry {
+	entries := make([]entry, count)
+	for index := range entries {
+		entries[index] = entry{fmt.Sprintf("OEBPS/chapter%d.xhtml", index), "<html/>"}
+	}
+	return entries
+}
+
+func book(t *testing.T, packageDocument string, others ...entry) []byte {
+	entries := []entry{{"mimetype", MediaType}, {"META-INF/container.xml", containerXml}, {"OEBPS/content.opf", packageDocument}}
+	return archive(t, append(entries, others...)...)
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Testing an EPUB 3", func(t *testing.T) {
+		metadata, err := Parse(book(t, epub3Package, entry{"OEBPS/images/cover art.png", "\x89PNG cover"}), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Metadata{
+			Title:    "To the Lighthouse",
+			Authors:  []string{"Virginia Woolf"},
+			Creators: []string{"Virginia Woolf", "Vanessa Bell"},
+			Language: "en-GB",
+			Identifiers: []Identifier{
+				{Value: "urn:uuid:8f1c3e4a-2b6d-4f5e-9a7b-1c2d3e4f5a6b"},
+				{Value: "urn:isbn:978-0-15-603035-9", Scheme: "ISBN"},
+			},
+			Isbn:  "9780156030359",
+			Date:  "1927-05-01",
+			Cover: []byte("\x89PNG cover"),
+		}
+		if !reflect.DeepEqual(metadata, expected) {
+			t.Errorf("expected %+v, got %+v", expected, metadata)
+		}
+	})
+
+	t.Run("Testing an EPUB 2", func(t *testing.T) {
+		metadata, err := Parse(book(t, epub2Package, entry{"cover.jpg", "\xff\xd8 cover"}), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Title != "The Waves" || !reflect.DeepEqual(metadata.Authors, []string{"Virginia Woolf"}) || len(metadata.Creators) != 2 {
+			t.Errorf("expected The Waves by Virginia Woolf, got %+v", metadata)
+		}
+		if metadata.Isbn != "0156949601" || metadata.Date != "1931-01-01" || metadata.Language != "en" || string(metadata.Cover) != "\xff\xd8 cover" {
+			t.Errorf("expected the ISBN, the publication date and the cover, got %+v", metadata)
+		}
+	})
+
+	t.Run("Testing a missing cover is a warning", func(t *testing.T) {
+		metadata, err := Parse(book(t, epub2Package), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Cover != nil || len(metadata.Warnings) != 1 || !strings.Contains(metadata.Warnings[0], "cover.jpg is missing") {
+			t.Errorf("expected a warning about the cover, got %v", metadata.Warnings)
+		}
+	})
+
+	t.Run("Testing the files that are refused", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			data     []byte
+			expected error
+		}{
+			"pdf":              {[]byte("%PDF-1.7"), ErrNotEpub},
+			"zip":              {archive(t, entry{"readme.txt", "hello"}), ErrNotEpub},
+			"other mimetype":   {archive(t, entry{"mimetype", "application/vnd.oasis.opendocument.text"}), ErrNotEpub},
+			"truncated":        {book(t, epub3Package)[:200], ErrMalformed},
+			"no container":     {archive(t, entry{"mimetype", MediaType}), ErrMalformed},
+			"no package":       {archive(t, entry{"mimetype", MediaType}, entry{"META-INF/container.xml", "<container/>"}), ErrMalformed},
+			"invalid package":  {book(t, "<package><metadata>"), ErrMalformed},
+			"missing package":  {archive(t, entry{"mimetype", MediaType}, entry{"META-INF/container.xml", containerXml}), ErrMalformed},
+			"traversal":        {book(t, epub3Package, entry{"../../etc/passwd", "root"}), ErrMalformed},
+			"duplicate":        {book(t, epub3Package, entry{"OEBPS/content.opf", epub2Package}), ErrMalformed},
+			"too many entries": {book(t, epub3Package, chapters(10)...), ErrTooLarge},
+		} {
+			options := Options{}
+			if name == "too many entries" {
+				options.MaxEntries = 10
+			}
+			if _, err := Parse(test.data, options); !errors.Is(err, test.expected) {
+				t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+			}
+		}
+	})
+
+	t.Run("Testing a zip bomb is refused", func(t *testing.T) {
+		zeros := strings.Repeat("\x00", 8<<20)
+		data := book(t, epub3Package, entry{"OEBPS/filler.bin", zeros})
+		if len(data) > 64<<10 {
+			t.Fatalf("expected the zeros to compress, got %d bytes", len(data))
+		}
+		if _, err := Parse(data, Options{MaxUncompressedBytes: 4 << 20}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("expected %v, got %v", ErrTooLarge, err)
+		}
+	})
+
+	t.Run("Testing an entry larger than it says is not read past its size", func(t *testing.T) {
+		// the package document says it is 100 bytes and inflates to 8 MiB
+		var compressed bytes.Buffer
+		deflate, _ := flate.NewWriter(&compressed, flate.BestCompression)
+		deflate.Write([]byte(strings.Repeat(" ", 8<<20)))
+		deflate.Close()
+		var buffer bytes.Buffer
+		writer := zip.NewWriter(&buffer)
+		for _, entry := range []entry{{"mimetype", MediaType}, {"META-INF/container.xml", containerXml}} {
+			file, _ := writer.Create(entry.name)
+			file.Write([]byte(entry.data))
+		}
+		file, err := writer.CreateRaw(&zip.FileHeader{Name: "OEBPS/content.opf", Method: zip.Deflate, CRC32: crc32.ChecksumIEEE(nil),
+			CompressedSize64: uint64(compressed.Len()), UncompressedSize64: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(compressed.Bytes())
+		writer.Close()
+		if _, err := Parse(buffer.Bytes(), Options{}); !errors.Is(err, ErrMalformed) {
+			t.Errorf("expected %v, got %v", ErrMalformed, err)
+		}
+	})
+}
+
+func TestNormalizeDate(t *testing.T) {
+	for value, expected := range map[string]string{
+		"1927":                 "1927-01-01",
+		"1927-05":              "1927-05-01",
+		"1927-05-05":           "1927-05-05",
+		"1927-05-05T10:00:00Z": "1927-05-05",
+		"1927-13":              "",
+		"May 1927":             "",
+		"":                     "",
+	} {
+		if date := normalizeDate(value); date != expected {
+			t.Errorf("%q: expected %q, got %q", value, expected, date)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	for href, expected := range map[string]string{
+		"images/cover.jpg":      "OEBPS/images/cover.jpg",
+		"../cover.jpg":          "cover.jpg",
+		"images/a%20b.jpg#frag": "OEBPS/images/a b.jpg",
+		"../../cover.jpg":       "",
+		"/cover.jpg":            "",
+		"http://example.com/x":  "",
+	} {
+		if resolved, _ := resolve("OEBPS/content.opf", href); resolved != expected {
+			t.Errorf("%q: expected %q, got %q", href, expected, resolved)
+		}
+	}
+}
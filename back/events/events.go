@@ -0,0 +1,166 @@
+package events
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+Event log of the live updates of GET /events: the events of the last changes of the books, kept in memory up to a size,
+and the subscribers the new ones are passed to. The ID of an event is the one of its audit log entry
+A subscriber that reconnects gets the events it missed from the log, by the ID of the last event it got (Last-Event-ID),
+or is told to reset, i.e. to reload what it shows, when some of them are no longer in the log
+**/
+
+// Options of the event log and the streams, the config section "events", a field left at 0 takes its value from DefaultOptions
+type Options struct {
+	// events kept for the clients that reconnect
+	BufferSize int `json:"buffer_size"`
+	// how often a comment is sent on a stream, so that an idle one isn't closed by a proxy
+	HeartbeatSeconds int `json:"heartbeat_seconds"`
+	// events waiting to be sent to a client before it is found too slow and disconnected
+	ClientQueue int `json:"client_queue"`
+}
+
+var DefaultOptions = Options{BufferSize: 1000, HeartbeatSeconds: 15, ClientQueue: 64}
+
+// Broker keeps the event log and passes the new events to the subscribers, safe for concurrent use
+type Broker struct {
+	options Options
+	lock    sync.Mutex
+	// the last events, by ID
+	log []models.BookEvent
+	// highest ID of an event that is not in the log anymore, the events up to it can't be replayed
+	floor       int
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the events published after it was made
+type Subscription struct {
+	// Events is closed when the subscriber was too slow to keep up, or closed the subscription
+	Events <-chan models.BookEvent
+	events chan models.BookEvent
+	broker *Broker
+}
+
+// NewBroker makes an empty broker with the options
+func NewBroker(options Options) *Broker {
+	if options.BufferSize <= 0 {
+		options.BufferSize = DefaultOptions.BufferSize
+	}
+	if options.HeartbeatSeconds <= 0 {
+		options.HeartbeatSeconds = DefaultOptions.HeartbeatSeconds
+	}
+	if options.ClientQueue <= 0 {
+		options.ClientQueue = DefaultOptions.ClientQueue
+	}
+	return &Broker{options: options, subscribers: map[*Subscription]bool{}}
+}
+
+// Options the broker runs with, defaults filled in
+func (broker *Broker) Options() Options {
+	return broker.options
+}
+
+// Load fills the log with the last events before the broker is used, the oldest first, e.g. from database.RecentEvents
+// a full log is taken to have lost the events before it, a shorter one to be the whole history
+func (broker *Broker) Load(events []models.BookEvent) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	if len(events) >= broker.options.BufferSize {
+		events = events[len(events)-broker.options.BufferSize:]
+		broker.floor = events[0].Audit_Id - 1
+	}
+	broker.log = append([]models.BookEvent(nil), events...)
+}
+
+// Publish adds the event to the log and passes it to the subscribers, a subscriber with a full queue is dropped instead
+func (broker *Broker) Publish(event models.BookEvent) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	// the changes are committed one at a time, but two of them can be published in the other order
+	index := sort.Search(len(broker.log), func(i int) bool { return broker.log[i].Audit_Id > event.Audit_Id })
+	broker.log = append(broker.log, models.BookEvent{})
+	copy(broker.log[index+1:], broker.log[index:])
+	broker.log[index] = event
+	if len(broker.log) > broker.options.BufferSize {
+		broker.floor = broker.log[0].Audit_Id
+		broker.log = broker.log[1:]
+	}
+
+	for subscription := range broker.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			// it resumes from the log once it reconnects
+			delete(broker.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+// Subscribe subscribes to the events published from now on, and returns the events after lastId that are in the log
+// reset is true when some of the events after lastId are no longer in the log, the backlog is then empty
+// lastId 0 only subscribes to the next events
+func (broker *Broker) Subscribe(lastId int) (subscription *Subscription, backlog []models.BookEvent, reset bool) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	events := make(chan models.BookEvent, broker.options.ClientQueue)
+	subscription = &Subscription{Events: events, events: events, broker: broker}
+	broker.subscribers[subscription] = true
+
+	if lastId <= 0 {
+		return subscription, nil, false
+	}
+	if lastId < broker.floor {
+		return subscription, nil, true
+	}
+	index := sort.Search(len(broker.log), func(i int) bool { return broker.log[i].Audit_Id > lastId })
+	return subscription, append([]models.BookEvent(nil), broker.log[index:]...), false
+}
+
+// LastId is the ID of the last event of the log, 0 when it is empty
+func (broker *Broker) LastId() int {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	if len(broker.log) == 0 {
+		return broker.floor
+	}
+	return broker.log[len(broker.log)-1].Audit_Id
+}
+
+// Close ends the subscription, its channel is closed
+func (subscription *Subscription) Close() {
+	broker := subscription.broker
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	if broker.subscribers[subscription] {
+		delete(broker.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Subscribers is the number of subscriptions open
+func (broker *Broker) Subscribers() int {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	return len(broker.subscribers)
+}
+
+// Matches reports whether the event is one of the topics: an event name, or the part before its dot for all of its kind
+// ("book" for every book event), every event matches no topics
+func Matches(topics []string, event string) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	kind, _, _ := strings.Cut(event, ".")
+	for _, topic := range topics {
+		if topic == event || topic == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+func event(id int, name string) models.BookEvent {
+	return models.BookEvent{Event: name, Audit_Id: id, Book_Id: 1}
+}
+
+func ids(events []models.BookEvent) []int {
+	ids := make([]int, len(events))
+	for index, event := range events {
+		ids[index] = event.Audit_Id
+	}
+	return ids
+}
+
+func TestBroker(t *testing.T) {
+	t.Run("Testing the resume from the log", func(t *testing.T) {
+		broker := NewBroker(Options{BufferSize: 3})
+		broker.Load([]models.BookEvent{event(1, models.EventBookCreated), event(2, models.EventBookUpdated)})
+		subscription, backlog, reset := broker.Subscribe(1)
+		defer subscription.Close()
+		if reset || len(backlog) != 1 || backlog[0].Audit_Id != 2 {
+			t.Errorf("expected event 2, got %v %v", ids(backlog), reset)
+		}
+		broker.Publish(event(3, models.EventBookDeleted))
+		if received := <-subscription.Events; received.Audit_Id != 3 {
+			t.Errorf("expected event 3 live, got %d", received.Audit_Id)
+		}
+		if _, backlog, _ := broker.Subscribe(0); len(backlog) != 0 {
+			t.Errorf("expected no backlog without a last event, got %v", ids(backlog))
+		}
+	})
+
+	t.Run("Testing a reset once the log is full", func(t *testing.T) {
+		broker := NewBroker(Options{BufferSize: 3})
+		for id := 1; id <= 5; id++ {
+			broker.Publish(event(id, models.EventBookUpdated))
+		}
+		if _, backlog, reset := broker.Subscribe(1); !reset || len(backlog) != 0 {
+			t.Errorf("expected a reset for dropped events, got %v %v", ids(backlog), reset)
+		}
+		if _, backlog, reset := broker.Subscribe(2); reset || len(ids(backlog)) != 3 {
+			t.Errorf("expected events 3 to 5, got %v %v", ids(backlog), reset)
+		}
+		if broker.LastId() != 5 {
+			t.Errorf("expected the last event to be 5, got %d", broker.LastId())
+		}
+		full := NewBroker(Options{BufferSize: 2})
+		full.Load([]models.BookEvent{event(7, models.EventBookCreated), event(8, models.EventBookCreated), event(9, models.EventBookCreated)})
+		if _, backlog, reset := full.Subscribe(6); !reset {
+			t.Errorf("expected a reset before a full log, got %v", ids(backlog))
+		}
+	})
+
+	t.Run("Testing the events are kept in order", func(t *testing.T) {
+		broker := NewBroker(Options{})
+		broker.Publish(event(2, models.EventBookCreated))
+		broker.Publish(event(1, models.EventBookCreated))
+		broker.Publish(event(3, models.EventBookCreated))
+		if _, backlog, _ := broker.Subscribe(1); len(backlog) != 2 || backlog[0].Audit_Id != 2 || backlog[1].Audit_Id != 3 {
+			t.Errorf("expected events 2 and 3, got %v", ids(backlog))
+		}
+	})
+
+	t.Run("Testing a slow subscriber is dropped", func(t *testing.T) {
+		broker := NewBroker(Options{ClientQueue: 1})
+		subscription, _, _ := broker.Subscribe(0)
+		broker.Publish(event(1, models.EventBookCreated))
+		broker.Publish(event(2, models.EventBookCreated))
+		<-subscription.Events
+		if _, open := <-subscription.Events; open || broker.Subscribers() != 0 {
+			t.Errorf("expected the subscription to be closed, %d left", broker.Subscribers())
+		}
+		// closing it again is harmless
+		subscription.Close()
+	})
+}
+
+func TestMatches(t *testing.T) {
+	for _, test := range []struct {
+		topics  []string
+		event   string
+		matches bool
+	}{
+		{nil, models.EventBookCreated, true},
+		{[]string{"book"}, models.EventBookDeleted, true},
+		{[]string{models.EventBookCreated, models.EventBookDeleted}, models.EventBookDeleted, true},
+		{[]string{models.EventBookCreated}, models.EventBookUpdated, false},
+		{[]string{"loan"}, models.EventBookUpdated, false},
+	} {
+		if Matches(test.topics, test.event) != test.matches {
+			t.Errorf("%v %s: expected %v", test.topics, test.event, test.matches)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCsvWriter(w io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(book models.Book) error {
+	if !c.headerWritten {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return c.writer.Write(bookToRow(book))
+}
+
+func (c *csvWriter) writeHeader() error {
+	c.headerWritten = true
+	return c.writer.Write(Columns)
+}
+
+// Close writes the header if no book was written, so an empty export is still a valid file
+func (c *csvWriter) Close() error {
+	if !c.headerWritten {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// reads all rows of a csv file, the first row being the header
+func readCsvRows(data []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1 // tolerate ragged rows, missing cells are treated as empty
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
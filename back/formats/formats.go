@@ -0,0 +1,136 @@
+package formats
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+This package converts books from and to the file formats used outside of the API (spreadsheets mostly)
+Writers are streaming, they get one book at a time so a whole catalogue never has to sit in memory
+**/
+
+// Columns are the default column names used when exporting, and the ones recognised when importing without a mapping
+var Columns = []string{"book_id", "title", "author", "num_pages", "pub_date", "isbn"}
+
+// ExportFormats lists the formats NewBookWriter supports
+var ExportFormats = []string{"csv", "xlsx", "json", "ndjson", "marc", "marcxml"}
+
+// IsExportFormat reports whether NewBookWriter supports the format
+func IsExportFormat(format string) bool {
+	for _, supported := range ExportFormats {
+		if strings.EqualFold(supported, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// BookWriter writes books one by one to an underlying writer, Close must be called to flush the output
+type BookWriter interface {
+	Write(book models.Book) error
+	Close() error
+}
+
+// NewBookWriter returns a BookWriter for the requested format, one of ExportFormats
+func NewBookWriter(format string, w io.Writer) (BookWriter, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return newCsvWriter(w), nil
+	case "xlsx":
+		return newXlsxWriter(w)
+	case "json":
+		return newJsonWriter(w), nil
+	case "ndjson":
+		return newNdjsonWriter(w), nil
+	case "marc":
+		return &marcWriter{w: w}, nil
+	case "marcxml":
+		return &marcXmlBookWriter{writer: NewMarcXmlWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// ContentType returns the MIME type to use when serving the given format
+func ContentType(format string) string {
+	switch strings.ToLower(format) {
+	case "csv":
+		return "text/csv"
+	case "xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "ndjson":
+		return "application/x-ndjson"
+	case "marc":
+		return "application/marc"
+	case "marcxml":
+		return "application/marcxml+xml"
+	default:
+		return "application/json"
+	}
+}
+
+// FileExtension returns the extension export files get for the format
+func FileExtension(format string) string {
+	if strings.ToLower(format) == "marc" {
+		return "mrc"
+	}
+	if strings.ToLower(format) == "marcxml" {
+		return "xml"
+	}
+	return strings.ToLower(format)
+}
+
+// FormatFromContentType guesses the import format from a Content-Type header, returns an empty string if unknown
+func FormatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return "csv"
+	case strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"):
+		return "xlsx"
+	case strings.HasPrefix(contentType, "application/marc"):
+		return "marc"
+	case strings.HasPrefix(contentType, "application/marcxml+xml"):
+		return "marcxml"
+	default:
+		return ""
+	}
+}
+
+// FormatFromFilename guesses the import format from a file extension, returns an empty string if unknown
+func FormatFromFilename(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".csv"):
+		return "csv"
+	case strings.HasSuffix(lower, ".xlsx"):
+		return "xlsx"
+	case strings.HasSuffix(lower, ".mrc"), strings.HasSuffix(lower, ".marc"):
+		return "marc"
+	case strings.HasSuffix(lower, ".xml"):
+		return "marcxml"
+	default:
+		return ""
+	}
+}
+
+// turns a book into a spreadsheet row, in the same order as Columns
+func bookToRow(book models.Book) []string {
+	pages := ""
+	if book.Num_Pages != nil {
+		pages = fmt.Sprint(*book.Num_Pages)
+	}
+	return []string{fmt.Sprint(book.Book_Id), book.Title, book.Author, pages, dateOnly(book.Pub_Date), book.Isbn}
+}
+
+// the sqlite driver hands DATE columns back as full timestamps, spreadsheets get the YYYY-MM-DD form the import expects
+func dateOnly(date string) string {
+	if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+		return parsed.Format("2006-01-02")
+	}
+	return date
+}
@@ -0,0 +1,166 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+var pages = 328
+
+var testBooks = []models.Book{
+	{Book_Id: 1, Title: "1984", Author: "George Orwell", Num_Pages: &pages, Pub_Date: "1949-06-08", Isbn: "9780451524935"},
+	{Book_Id: 2, Title: "Pride & Prejudice, <annotated>", Author: "Jane Austen", Pub_Date: "1813-01-28"},
+}
+
+func writeBooks(t *testing.T, format string) []byte {
+	var buffer bytes.Buffer
+	writer, err := NewBookWriter(format, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, book := range testBooks {
+		if err := writer.Write(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{"csv", "xlsx"} {
+		t.Run("Round trip through "+format, func(t *testing.T) {
+			data := writeBooks(t, format)
+			rows, err := ReadBooks(format, data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(testBooks) {
+				t.Fatalf("Expected %d rows, got %d", len(testBooks), len(rows))
+			}
+			for i, row := range rows {
+				if len(row.Errors) != 0 {
+					t.Errorf("Expected no errors on row %d, got %v", row.Row, row.Errors)
+				}
+				expected := testBooks[i]
+				if row.Book.Title != expected.Title || row.Book.Author != expected.Author || row.Book.Pub_Date != expected.Pub_Date || row.Book.Isbn != expected.Isbn {
+					t.Errorf("Expected %v, got %v", expected, row.Book)
+				}
+				if (row.Book.Num_Pages == nil) != (expected.Num_Pages == nil) {
+					t.Errorf("Expected num_pages %v, got %v", expected.Num_Pages, row.Book.Num_Pages)
+				}
+				if row.Book.Book_Id != 0 {
+					t.Errorf("Expected imported book_id to be ignored, got %d", row.Book.Book_Id)
+				}
+			}
+		})
+	}
+}
+
+func TestJsonWriters(t *testing.T) {
+	t.Run("Json export is a valid array", func(t *testing.T) {
+		var books []models.Book
+		if err := json.Unmarshal(writeBooks(t, "json"), &books); err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != len(testBooks) {
+			t.Errorf("Expected %d books, got %d", len(testBooks), len(books))
+		}
+	})
+
+	t.Run("Empty json export is an empty array", func(t *testing.T) {
+		var buffer bytes.Buffer
+		writer, _ := NewBookWriter("json", &buffer)
+		writer.Close()
+		if strings.TrimSpace(buffer.String()) != "[]" {
+			t.Errorf("Expected [], got %s", buffer.String())
+		}
+	})
+
+	t.Run("Ndjson export has one book per line", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(string(writeBooks(t, "ndjson"))), "\n")
+		if len(lines) != len(testBooks) {
+			t.Errorf("Expected %d lines, got %d", len(testBooks), len(lines))
+		}
+	})
+}
+
+func TestReadBooks(t *testing.T) {
+	t.Run("Mapping custom column names", func(t *testing.T) {
+		data := []byte("Book Title,Writer,Released,Pages\nDune,Frank Herbert,1965-08-01,412\n")
+		mapping, err := ParseMapping("title=Book Title, author=Writer,pub_date=Released,num_pages=Pages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := ReadBooks("csv", data, mapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Book.Author != "Frank Herbert" || *rows[0].Book.Num_Pages != 412 {
+			t.Errorf("Unexpected rows %v", rows)
+		}
+	})
+
+	t.Run("Invalid rows are reported with their line", func(t *testing.T) {
+		data := []byte("title,author,pub_date,num_pages\nDune,,1965-08-01,\nEmma,Jane Austen,1815/12/23,many\nOk,Someone,2000-01-01,\n")
+		rows, err := ReadBooks("csv", data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := NewImportReport(rows, true)
+		if report.Failed != 2 || len(report.Books) != 1 {
+			t.Fatalf("Expected 2 failed and 1 valid row, got %+v", report)
+		}
+		if report.Errors[0].Row != 2 || report.Errors[1].Row != 3 {
+			t.Errorf("Expected errors on rows 2 and 3, got %+v", report.Errors)
+		}
+		if len(report.Errors[1].Errors) != 2 {
+			t.Errorf("Expected 2 errors on row 3, got %v", report.Errors[1].Errors)
+		}
+	})
+
+	t.Run("Missing required column", func(t *testing.T) {
+		_, err := ReadBooks("csv", []byte("title,pub_date\nDune,1965-08-01\n"), nil)
+		if err == nil {
+			t.Error("Expected an error for the missing author column")
+		}
+	})
+
+	t.Run("Mapping to a column that does not exist", func(t *testing.T) {
+		_, err := ReadBooks("csv", []byte("title,author,pub_date\n"), map[string]string{"author": "Writer"})
+		if err == nil {
+			t.Error("Expected an error for the unknown column")
+		}
+	})
+
+	t.Run("Invalid mapping", func(t *testing.T) {
+		if _, err := ParseMapping("publisher=Publisher"); err == nil {
+			t.Error("Expected an error for an unknown field")
+		}
+		if _, err := ParseMapping("title"); err == nil {
+			t.Error("Expected an error for a pair without column")
+		}
+	})
+
+	t.Run("Broken xlsx", func(t *testing.T) {
+		if _, err := ReadBooks("xlsx", []byte("not a zip"), nil); err == nil {
+			t.Error("Expected an error for a file that is not a workbook")
+		}
+	})
+}
+
+func TestExcelSerialToDate(t *testing.T) {
+	date, ok := excelSerialToDate("17692")
+	if !ok || date != "1948-06-08" {
+		t.Errorf("Expected 1948-06-08, got %s", date)
+	}
+	if _, ok := excelSerialToDate("1984-06-08"); ok {
+		t.Error("Expected a date string not to be treated as a serial number")
+	}
+}
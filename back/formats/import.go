@@ -0,0 +1,181 @@
+package formats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+)
+
+// ImportRow is a book read from an imported file along with the problems found on its row
+type ImportRow struct {
+	Row      int // line of the row in the file, the header being line 1, or position of the record for MARC files
+	Book     models.Book
+	Errors   []string
+	Unmapped []string // MARC tags of the record that have no book counterpart
+}
+
+// ParseMapping parses a column mapping of the form "title=Book Title,author=Writer"
+// keys are book fields (see Columns), values are column headers of the imported file
+func ParseMapping(spec string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, found := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.TrimSpace(column)
+		if !found || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected field=column", pair)
+		}
+		if !isColumn(field) {
+			return nil, fmt.Errorf("unknown book field %q in mapping", field)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+func isColumn(field string) bool {
+	for _, column := range Columns {
+		if column == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadBooks reads a csv, xlsx, MARC or MARCXML file and turns every row or record into a book
+// for spreadsheets, fields without an entry in mapping are looked up by their own name in the header, ignoring case
+// book_id is never imported, imported books are always new books
+func ReadBooks(format string, data []byte, mapping map[string]string) ([]ImportRow, error) {
+	var rows [][]string
+	var err error
+	format = strings.ToLower(format)
+	switch format {
+	case "marc", "marcxml":
+		if len(mapping) > 0 {
+			return nil, fmt.Errorf("column mappings only apply to csv and xlsx files")
+		}
+		return readMarcBooks(format, data)
+	case "csv":
+		rows, err = readCsvRows(data)
+	case "xlsx":
+		rows, err = readXlsxRows(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("file is empty, a header row is required")
+	}
+
+	positions, err := columnPositions(rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make([]ImportRow, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		if isBlankRow(row) {
+			continue
+		}
+		importRow := ImportRow{Row: i + 2}
+		cell := func(field string) string {
+			position, ok := positions[field]
+			if !ok || position >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[position])
+		}
+
+		importRow.Book.Title = cell("title")
+		importRow.Book.Author = cell("author")
+		importRow.Book.Pub_Date = cell("pub_date")
+		importRow.Book.Isbn = utils.NormalizeIsbn(cell("isbn"))
+		if format == "xlsx" && !utils.ValidateDate(importRow.Book.Pub_Date) {
+			// date formatted cells come out of spreadsheets as serial numbers
+			if date, ok := excelSerialToDate(importRow.Book.Pub_Date); ok {
+				importRow.Book.Pub_Date = date
+			}
+		}
+		if pages := cell("num_pages"); pages != "" {
+			numPages, err := strconv.Atoi(pages)
+			if err != nil {
+				importRow.Errors = append(importRow.Errors, fmt.Sprintf("num_pages %q is not a whole number", pages))
+			} else {
+				importRow.Book.Num_Pages = &numPages
+			}
+		}
+		importRow.Errors = append(importRow.Errors, utils.ValidateBook(importRow.Book)...)
+		imported = append(imported, importRow)
+	}
+	return imported, nil
+}
+
+// finds which column holds which book field, required fields must be present
+func columnPositions(header []string, mapping map[string]string) (map[string]int, error) {
+	byName := make(map[string]int, len(header))
+	for i, name := range header {
+		byName[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	positions := make(map[string]int)
+	for _, field := range Columns {
+		column := field
+		if mapped, ok := mapping[field]; ok {
+			column = mapped
+		}
+		if position, ok := byName[strings.ToLower(column)]; ok {
+			positions[field] = position
+		} else if _, mapped := mapping[field]; mapped {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the header", column, field)
+		}
+	}
+
+	var missing []string
+	for _, field := range []string{"title", "author", "pub_date"} {
+		if _, ok := positions[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no column found for: %s", strings.Join(missing, ", "))
+	}
+	return positions, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// NewImportReport summarises the rows of an import, the books of the report are the rows that passed validation
+// callers fill in their ids once they are stored
+func NewImportReport(rows []ImportRow, dryRun bool) models.ImportReport {
+	report := models.ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Errors: make([]models.ImportError, 0),
+		Books:  make([]models.Book, 0, len(rows)),
+	}
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			report.Errors = append(report.Errors, models.ImportError{Row: row.Row, Errors: row.Errors})
+			continue
+		}
+		report.Books = append(report.Books, row.Book)
+	}
+	report.Failed = len(report.Errors)
+	report.Unmapped = countUnmapped(rows)
+	return report
+}
@@ -0,0 +1,61 @@
+package formats
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+// writes a json array, element by element
+type jsonWriter struct {
+	w       io.Writer
+	written int
+}
+
+func newJsonWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (j *jsonWriter) Write(book models.Book) error {
+	separator := ","
+	if j.written == 0 {
+		separator = "["
+	}
+	encoded, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	j.written++
+	_, err = j.w.Write(encoded)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "]\n"
+	if j.written == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+// writes one json object per line
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func newNdjsonWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n *ndjsonWriter) Write(book models.Book) error {
+	return n.encoder.Encode(book)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,253 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/**
+MARC 21 records and their ISO 2709 binary transmission format
+A record is a 24 byte leader, a directory of 12 byte entries (tag, length, offset) and the fields themselves
+Control fields (00X) hold a plain value, data fields have two indicators and a list of coded subfields
+**/
+
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+	marcLeaderLength      = 24
+	marcDirectoryEntry    = 12
+	// biggest record ISO 2709 can describe, the record length only has 5 digits
+	marcMaxRecordLength = 99999
+)
+
+// MarcRecord is a single bibliographic record
+type MarcRecord struct {
+	Leader        string
+	ControlFields []MarcControlField
+	DataFields    []MarcDataField
+}
+
+// MarcControlField is a 00X field, it has no indicators nor subfields
+type MarcControlField struct {
+	Tag   string
+	Value string
+}
+
+// MarcDataField is a field made of two indicators and subfields
+type MarcDataField struct {
+	Tag        string
+	Indicator1 byte
+	Indicator2 byte
+	Subfields  []MarcSubfield
+}
+
+// MarcSubfield is a coded piece of a data field, e.g. $a
+type MarcSubfield struct {
+	Code  byte
+	Value string
+}
+
+// ControlField returns the value of the first control field with the tag
+func (record *MarcRecord) ControlField(tag string) (string, bool) {
+	for _, field := range record.ControlFields {
+		if field.Tag == tag {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// DataFieldsWithTag returns every data field with the tag, in record order
+func (record *MarcRecord) DataFieldsWithTag(tag string) []MarcDataField {
+	var fields []MarcDataField
+	for _, field := range record.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the value of the first subfield with the code
+func (field MarcDataField) Subfield(code byte) (string, bool) {
+	for _, subfield := range field.Subfields {
+		if subfield.Code == code {
+			return subfield.Value, true
+		}
+	}
+	return "", false
+}
+
+func isControlTag(tag string) bool {
+	return len(tag) == 3 && tag[0] == '0' && tag[1] == '0'
+}
+
+// MarcReader reads ISO 2709 records one after the other
+type MarcReader struct {
+	reader *bufio.Reader
+}
+
+func NewMarcReader(r io.Reader) *MarcReader {
+	return &MarcReader{reader: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF once there are no more
+func (m *MarcReader) Read() (*MarcRecord, error) {
+	// some files end with line breaks or padding after the last record
+	for {
+		next, err := m.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if next[0] != '\n' && next[0] != '\r' && next[0] != ' ' && next[0] != 0 {
+			break
+		}
+		m.reader.ReadByte()
+	}
+
+	lengthDigits := make([]byte, 5)
+	if _, err := io.ReadFull(m.reader, lengthDigits); err != nil {
+		return nil, fmt.Errorf("truncated MARC record: %w", err)
+	}
+	length, ok := marcNumber(lengthDigits)
+	if !ok || length < marcLeaderLength+1 {
+		return nil, fmt.Errorf("invalid MARC record length %q", lengthDigits)
+	}
+	data := make([]byte, length)
+	copy(data, lengthDigits)
+	if _, err := io.ReadFull(m.reader, data[5:]); err != nil {
+		return nil, fmt.Errorf("truncated MARC record: %w", err)
+	}
+	return ParseMarcRecord(data)
+}
+
+// ParseMarcRecord decodes a single ISO 2709 record
+func ParseMarcRecord(data []byte) (*MarcRecord, error) {
+	if len(data) < marcLeaderLength+1 {
+		return nil, errors.New("MARC record is shorter than its leader")
+	}
+	if data[len(data)-1] != marcRecordTerminator {
+		return nil, errors.New("MARC record does not end with a record terminator")
+	}
+	leader := string(data[:marcLeaderLength])
+	baseAddress, ok := marcNumber(data[12:17])
+	if !ok || baseAddress <= marcLeaderLength || baseAddress > len(data) {
+		return nil, fmt.Errorf("invalid MARC base address %q", leader[12:17])
+	}
+
+	directory := data[marcLeaderLength : baseAddress-1]
+	if data[baseAddress-1] != marcFieldTerminator || len(directory)%marcDirectoryEntry != 0 {
+		return nil, errors.New("invalid MARC directory")
+	}
+
+	record := &MarcRecord{Leader: leader}
+	fields := data[baseAddress:]
+	for i := 0; i < len(directory); i += marcDirectoryEntry {
+		entry := directory[i : i+marcDirectoryEntry]
+		tag := string(entry[:3])
+		length, lengthOk := marcNumber(entry[3:7])
+		start, startOk := marcNumber(entry[7:12])
+		if !lengthOk || !startOk || start+length > len(fields) || length < 1 {
+			return nil, fmt.Errorf("invalid directory entry for field %s", tag)
+		}
+		content := fields[start : start+length]
+		if content[len(content)-1] != marcFieldTerminator {
+			return nil, fmt.Errorf("field %s is not terminated", tag)
+		}
+		content = content[:len(content)-1]
+
+		if isControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, MarcControlField{Tag: tag, Value: string(content)})
+			continue
+		}
+		if len(content) < 2 {
+			return nil, fmt.Errorf("field %s is missing its indicators", tag)
+		}
+		field := MarcDataField{Tag: tag, Indicator1: content[0], Indicator2: content[1]}
+		for _, subfield := range bytes.Split(content[2:], []byte{marcSubfieldDelimiter}) {
+			if len(subfield) == 0 {
+				continue // what comes before the first delimiter
+			}
+			field.Subfields = append(field.Subfields, MarcSubfield{Code: subfield[0], Value: string(subfield[1:])})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+	return record, nil
+}
+
+// reads the digits of a number of the leader or of the directory, a sign or a space is refused
+func marcNumber(digits []byte) (int, bool) {
+	number := 0
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		number = number*10 + int(digit-'0')
+	}
+	return number, true
+}
+
+// MarshalBinary encodes the record to ISO 2709, the length and base address of the leader are computed
+// control fields are written before data fields, both in the order they have in the record
+func (record *MarcRecord) MarshalBinary() ([]byte, error) {
+	var directory, fields bytes.Buffer
+	addField := func(tag string, content []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("invalid MARC tag %q", tag)
+		}
+		content = append(content, marcFieldTerminator)
+		if len(content) > 9999 {
+			return fmt.Errorf("field %s is too long for ISO 2709", tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(content), fields.Len())
+		fields.Write(content)
+		return nil
+	}
+
+	for _, field := range record.ControlFields {
+		if err := addField(field.Tag, []byte(field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range record.DataFields {
+		content := []byte{indicatorOrBlank(field.Indicator1), indicatorOrBlank(field.Indicator2)}
+		for _, subfield := range field.Subfields {
+			content = append(content, marcSubfieldDelimiter, subfield.Code)
+			content = append(content, subfield.Value...)
+		}
+		if err := addField(field.Tag, content); err != nil {
+			return nil, err
+		}
+	}
+
+	leader := []byte(record.Leader)
+	if len(leader) != marcLeaderLength {
+		leader = []byte(defaultMarcLeader)
+	}
+	baseAddress := marcLeaderLength + directory.Len() + 1
+	length := baseAddress + fields.Len() + 1
+	if length > marcMaxRecordLength {
+		return nil, errors.New("record is too long for ISO 2709")
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+
+	output := make([]byte, 0, length)
+	output = append(output, leader...)
+	output = append(output, directory.Bytes()...)
+	output = append(output, marcFieldTerminator)
+	output = append(output, fields.Bytes()...)
+	output = append(output, marcRecordTerminator)
+	return output, nil
+}
+
+func indicatorOrBlank(indicator byte) byte {
+	if indicator == 0 {
+		return ' '
+	}
+	return indicator
+}
@@ -0,0 +1,262 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+)
+
+/**
+Mapping between MARC 21 bibliographic records and books
+	020 $a          -> isbn
+	100 $a          -> author, "Surname, Forename" headings are turned back into "Forename Surname"
+	245 $a $b       -> title, with the subtitle appended after a colon
+	264 $c / 260 $c -> pub_date, 008 is used when neither has a date
+	300 $a          -> num_pages
+Every other field of an imported record is reported as unmapped
+**/
+
+// leader of the records written on export: new, language material, monograph, unicode, ISBD punctuation omitted
+const defaultMarcLeader = "00000nam a2200000 i 4500"
+
+var mappedMarcTags = map[string]bool{"008": true, "020": true, "100": true, "245": true, "260": true, "264": true, "300": true}
+
+var (
+	isoDateRegex = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	yearRegex    = regexp.MustCompile(`\d{4}`)
+	pagesRegex   = regexp.MustCompile(`(\d+)\s*(?:p\b|p\.|pp\.?|pages?\b)`)
+)
+
+// BookFromMarc maps a record to a book, it also returns the tags of the fields that have no book counterpart
+func BookFromMarc(record *MarcRecord) (models.Book, []string) {
+	var book models.Book
+
+	for _, field := range record.DataFieldsWithTag("020") {
+		value, _ := field.Subfield('a')
+		// $a often carries a qualifier after the number: "9780451524935 (pbk.)"
+		if parts := strings.Fields(value); len(parts) > 0 {
+			book.Isbn = utils.NormalizeIsbn(parts[0])
+			break
+		}
+	}
+
+	if fields := record.DataFieldsWithTag("100"); len(fields) > 0 {
+		if name, ok := fields[0].Subfield('a'); ok {
+			name = trimIsbdPunctuation(name)
+			// first indicator 1 is a surname heading, "Orwell, George"
+			if surname, forename, found := strings.Cut(name, ", "); found && fields[0].Indicator1 == '1' {
+				name = forename + " " + surname
+			}
+			book.Author = name
+		}
+	}
+
+	if fields := record.DataFieldsWithTag("245"); len(fields) > 0 {
+		title, _ := fields[0].Subfield('a')
+		title = trimIsbdPunctuation(title)
+		if subtitle, ok := fields[0].Subfield('b'); ok {
+			title = title + ": " + trimIsbdPunctuation(subtitle)
+		}
+		book.Title = title
+	}
+
+	book.Pub_Date = marcPublicationDate(record)
+
+	for _, field := range record.DataFieldsWithTag("300") {
+		if extent, ok := field.Subfield('a'); ok {
+			if match := pagesRegex.FindStringSubmatch(extent); match != nil {
+				pages, err := strconv.Atoi(match[1])
+				if err == nil {
+					book.Num_Pages = &pages
+				}
+			}
+			break
+		}
+	}
+
+	var unmapped []string
+	for _, field := range record.ControlFields {
+		if !mappedMarcTags[field.Tag] {
+			unmapped = append(unmapped, field.Tag)
+		}
+	}
+	for _, field := range record.DataFields {
+		if !mappedMarcTags[field.Tag] {
+			unmapped = append(unmapped, field.Tag)
+		}
+	}
+	return book, unmapped
+}
+
+// publication date from 264 (RDA, second indicator 1 is publication), then 260 (AACR2), then the 008 date 1
+// a full YYYY-MM-DD is kept as is, a lone year becomes the first of January of that year
+func marcPublicationDate(record *MarcRecord) string {
+	var candidates []string
+	for _, field := range record.DataFieldsWithTag("264") {
+		if value, ok := field.Subfield('c'); ok && field.Indicator2 == '1' {
+			candidates = append(candidates, value)
+		}
+	}
+	for _, tag := range []string{"264", "260"} {
+		for _, field := range record.DataFieldsWithTag(tag) {
+			if value, ok := field.Subfield('c'); ok {
+				candidates = append(candidates, value)
+			}
+		}
+	}
+	if fixed, ok := record.ControlField("008"); ok && len(fixed) >= 11 {
+		candidates = append(candidates, fixed[7:11])
+	}
+
+	for _, candidate := range candidates {
+		if date := isoDateRegex.FindString(candidate); date != "" && utils.ValidateDate(date) {
+			return date
+		}
+		if year := yearRegex.FindString(candidate); year != "" {
+			return year + "-01-01"
+		}
+	}
+	return ""
+}
+
+// removes the ISBD punctuation cataloguers leave at the end of subfields, "Nineteen eighty-four /"
+func trimIsbdPunctuation(value string) string {
+	return strings.TrimRight(strings.TrimSpace(value), " /:;,.=")
+}
+
+// MarcFromBook builds the record of a book, the book id is used as the control number
+func MarcFromBook(book models.Book) *MarcRecord {
+	date := dateOnly(book.Pub_Date)
+	year := "    "
+	if len(date) >= 4 {
+		year = date[:4]
+	}
+	record := &MarcRecord{
+		Leader: defaultMarcLeader,
+		ControlFields: []MarcControlField{
+			{Tag: "001", Value: strconv.Itoa(book.Book_Id)},
+			// fixed length data: | fill for the unknown entry date, single known date, undetermined language
+			{Tag: "008", Value: fmt.Sprintf("||||||s%s    xx %17s%s d", year, "", "und")},
+		},
+	}
+
+	if book.Isbn != "" {
+		record.DataFields = append(record.DataFields, MarcDataField{
+			Tag: "020", Indicator1: ' ', Indicator2: ' ',
+			Subfields: []MarcSubfield{{Code: 'a', Value: book.Isbn}},
+		})
+	}
+
+	author := MarcDataField{Tag: "100", Indicator1: '0', Indicator2: ' ', Subfields: []MarcSubfield{{Code: 'a', Value: book.Author}}}
+	if split := strings.LastIndex(book.Author, " "); split > 0 {
+		author.Indicator1 = '1'
+		author.Subfields[0].Value = book.Author[split+1:] + ", " + book.Author[:split]
+	}
+	record.DataFields = append(record.DataFields, author)
+
+	record.DataFields = append(record.DataFields, MarcDataField{
+		Tag: "245", Indicator1: '1', Indicator2: '0',
+		Subfields: []MarcSubfield{{Code: 'a', Value: book.Title}},
+	})
+	record.DataFields = append(record.DataFields, MarcDataField{
+		Tag: "264", Indicator1: ' ', Indicator2: '1',
+		Subfields: []MarcSubfield{{Code: 'c', Value: date}},
+	})
+	if book.Num_Pages != nil {
+		record.DataFields = append(record.DataFields, MarcDataField{
+			Tag: "300", Indicator1: ' ', Indicator2: ' ',
+			Subfields: []MarcSubfield{{Code: 'a', Value: fmt.Sprintf("%d pages", *book.Num_Pages)}},
+		})
+	}
+	return record
+}
+
+// writes books as ISO 2709 records
+type marcWriter struct {
+	w io.Writer
+}
+
+func (m *marcWriter) Write(book models.Book) error {
+	data, err := MarcFromBook(book).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("book %d: %w", book.Book_Id, err)
+	}
+	_, err = m.w.Write(data)
+	return err
+}
+
+func (m *marcWriter) Close() error {
+	return nil
+}
+
+// writes books as a MARCXML collection
+type marcXmlBookWriter struct {
+	writer *MarcXmlWriter
+}
+
+func (m *marcXmlBookWriter) Write(book models.Book) error {
+	return m.writer.WriteRecord(MarcFromBook(book))
+}
+
+func (m *marcXmlBookWriter) Close() error {
+	return m.writer.Close()
+}
+
+// reads every record of a MARC or MARCXML file, rows are numbered after the position of the record in the file
+func readMarcBooks(format string, data []byte) ([]ImportRow, error) {
+	var records []*MarcRecord
+	if format == "marcxml" {
+		parsed, err := ReadMarcXml(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		records = parsed
+	} else {
+		reader := NewMarcReader(bytes.NewReader(data))
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+			}
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("file does not contain any MARC record")
+	}
+
+	rows := make([]ImportRow, 0, len(records))
+	for i, record := range records {
+		book, unmapped := BookFromMarc(record)
+		rows = append(rows, ImportRow{
+			Row:      i + 1,
+			Book:     book,
+			Errors:   utils.ValidateBook(book),
+			Unmapped: unmapped,
+		})
+	}
+	return rows, nil
+}
+
+// counts how many times each unmapped tag was seen over the rows
+func countUnmapped(rows []ImportRow) map[string]int {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		for _, tag := range row.Unmapped {
+			counts[tag]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	return counts
+}
@@ -0,0 +1,199 @@
+package formats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testdata/sample.mrc and testdata/sample.xml hold the same three records, built independently of this package
+
+func readSampleRecords(t *testing.T) ([]byte, []*MarcRecord) {
+	data, err := os.ReadFile("testdata/sample.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*MarcRecord
+	reader := NewMarcReader(bytes.NewReader(data))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 sample records, got %d", len(records))
+	}
+	return data, records
+}
+
+func TestMarcRoundTrip(t *testing.T) {
+	data, records := readSampleRecords(t)
+
+	t.Run("Binary records are written back byte for byte", func(t *testing.T) {
+		var written []byte
+		for _, record := range records {
+			encoded, err := record.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			written = append(written, encoded...)
+		}
+		if !bytes.Equal(written, data) {
+			t.Errorf("Expected the written records to match testdata/sample.mrc")
+		}
+	})
+
+	t.Run("MARCXML sample holds the same records", func(t *testing.T) {
+		file, err := os.Open("testdata/sample.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		xmlRecords, err := ReadMarcXml(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(xmlRecords, records) {
+			t.Errorf("Expected MARCXML records to equal the binary ones\n%+v\n%+v", xmlRecords, records)
+		}
+	})
+
+	t.Run("MARCXML records survive a round trip", func(t *testing.T) {
+		var buffer bytes.Buffer
+		writer := NewMarcXmlWriter(&buffer)
+		for _, record := range records {
+			if err := writer.WriteRecord(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadMarcXml(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, records) {
+			t.Errorf("Expected records to survive the round trip\n%+v\n%+v", read, records)
+		}
+	})
+
+	for _, format := range []string{"marc", "marcxml"} {
+		t.Run("Books survive a round trip through "+format, func(t *testing.T) {
+			rows, err := ReadBooks(format, writeBooks(t, format), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(testBooks) {
+				t.Fatalf("Expected %d rows, got %d", len(testBooks), len(rows))
+			}
+			for i, row := range rows {
+				expected := testBooks[i]
+				expected.Book_Id = 0
+				if !reflect.DeepEqual(row.Book, expected) {
+					t.Errorf("Expected %+v, got %+v", expected, row.Book)
+				}
+				if len(row.Errors) != 0 {
+					t.Errorf("Expected no errors, got %v", row.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestBookFromMarc(t *testing.T) {
+	_, records := readSampleRecords(t)
+
+	t.Run("RDA record with ISBN qualifier and inverted name", func(t *testing.T) {
+		book, unmapped := BookFromMarc(records[0])
+		if book.Title != "Nineteen eighty-four" || book.Author != "George Orwell" || book.Isbn != "9780451524935" {
+			t.Errorf("Unexpected book %+v", book)
+		}
+		if book.Pub_Date != "1950-01-01" || book.Num_Pages == nil || *book.Num_Pages != 328 {
+			t.Errorf("Unexpected date or pages %+v", book)
+		}
+		if !reflect.DeepEqual(unmapped, []string{"001", "040", "050", "650"}) {
+			t.Errorf("Unexpected unmapped fields %v", unmapped)
+		}
+	})
+
+	t.Run("AACR2 record with subtitle and 260", func(t *testing.T) {
+		book, _ := BookFromMarc(records[1])
+		if book.Title != "Pride and prejudice: a novel" || book.Author != "Jane Austen" || book.Isbn != "0141439513" {
+			t.Errorf("Unexpected book %+v", book)
+		}
+		if book.Pub_Date != "1813-01-01" || book.Num_Pages != nil {
+			t.Errorf("Expected 1813 and no page count for 3 volumes, got %+v", book)
+		}
+	})
+
+	t.Run("Import report of the sample file", func(t *testing.T) {
+		data, _ := readSampleRecords(t)
+		rows, err := ReadBooks("marc", data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := NewImportReport(rows, true)
+		// Beowulf has no 100 field, so no author
+		if report.Failed != 1 || report.Errors[0].Row != 3 {
+			t.Errorf("Expected the third record to fail, got %+v", report.Errors)
+		}
+		if report.Unmapped["001"] != 3 || report.Unmapped["650"] != 1 || report.Unmapped["130"] != 1 {
+			t.Errorf("Unexpected unmapped report %v", report.Unmapped)
+		}
+	})
+
+	t.Run("Column mappings are refused for MARC", func(t *testing.T) {
+		if _, err := ReadBooks("marc", []byte{}, map[string]string{"title": "x"}); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+func TestMarcErrors(t *testing.T) {
+	data, _ := readSampleRecords(t)
+
+	t.Run("Truncated record", func(t *testing.T) {
+		_, err := NewMarcReader(bytes.NewReader(data[:100])).Read()
+		if err == nil || err == io.EOF {
+			t.Errorf("Expected a truncation error, got %v", err)
+		}
+	})
+
+	t.Run("Record without terminator", func(t *testing.T) {
+		first := make([]byte, 0)
+		first = append(first, data...)
+		length := 439 // length of the first sample record
+		first[length-1] = 'x'
+		if _, err := ParseMarcRecord(first[:length]); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("Directory entry with a sign", func(t *testing.T) {
+		// 245 starting at -0001, 2 bytes long, once passed the bounds check and panicked
+		record := []byte("00041nam  2200037   4500" + "2450002-0001" + "\x1e" + "ab\x1e" + "\x1d")
+		if _, err := ParseMarcRecord(record); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("Leader with a sign", func(t *testing.T) {
+		if _, err := NewMarcReader(bytes.NewReader([]byte("+0045nam  2200037   4500"))).Read(); err == nil || err == io.EOF {
+			t.Errorf("Expected an invalid length, got %v", err)
+		}
+	})
+
+	t.Run("Not MARCXML", func(t *testing.T) {
+		if _, err := ReadMarcXml(bytes.NewReader([]byte("<html><body/></html>"))); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
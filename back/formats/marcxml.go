@@ -0,0 +1,175 @@
+package formats
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/**
+MARCXML (http://www.loc.gov/standards/marcxml/), the same records as ISO 2709 written as XML
+Files hold either a single <record> or a <collection> of them
+**/
+
+const marcXmlNamespace = "http://www.loc.gov/MARC21/slim"
+
+type marcXmlRecord struct {
+	XMLName       xml.Name              `xml:"record"`
+	Leader        string                `xml:"leader"`
+	ControlFields []marcXmlControlField `xml:"controlfield"`
+	DataFields    []marcXmlDataField    `xml:"datafield"`
+}
+
+type marcXmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcXmlDataField struct {
+	Tag       string            `xml:"tag,attr"`
+	Ind1      string            `xml:"ind1,attr"`
+	Ind2      string            `xml:"ind2,attr"`
+	Subfields []marcXmlSubfield `xml:"subfield"`
+}
+
+type marcXmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (x marcXmlRecord) toRecord() (*MarcRecord, error) {
+	record := &MarcRecord{Leader: x.Leader}
+	for _, field := range x.ControlFields {
+		record.ControlFields = append(record.ControlFields, MarcControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range x.DataFields {
+		dataField := MarcDataField{Tag: field.Tag, Indicator1: firstByte(field.Ind1), Indicator2: firstByte(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			if len(subfield.Code) != 1 {
+				return nil, fmt.Errorf("field %s has an invalid subfield code %q", field.Tag, subfield.Code)
+			}
+			dataField.Subfields = append(dataField.Subfields, MarcSubfield{Code: subfield.Code[0], Value: subfield.Value})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+	return record, nil
+}
+
+func fromRecord(record *MarcRecord) marcXmlRecord {
+	x := marcXmlRecord{Leader: record.Leader}
+	for _, field := range record.ControlFields {
+		x.ControlFields = append(x.ControlFields, marcXmlControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range record.DataFields {
+		dataField := marcXmlDataField{
+			Tag:  field.Tag,
+			Ind1: string(indicatorOrBlank(field.Indicator1)),
+			Ind2: string(indicatorOrBlank(field.Indicator2)),
+		}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, marcXmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		x.DataFields = append(x.DataFields, dataField)
+	}
+	return x
+}
+
+func firstByte(indicator string) byte {
+	if indicator == "" {
+		return ' '
+	}
+	return indicator[0]
+}
+
+// ReadMarcXml decodes every record of a MARCXML document, be it a collection or a lone record
+func ReadMarcXml(r io.Reader) ([]*MarcRecord, error) {
+	decoder := xml.NewDecoder(r)
+	var records []*MarcRecord
+	foundRoot := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid MARCXML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "collection":
+			foundRoot = true
+		case "record":
+			foundRoot = true
+			var x marcXmlRecord
+			if err := decoder.DecodeElement(&x, &start); err != nil {
+				return nil, fmt.Errorf("invalid MARCXML record: %w", err)
+			}
+			record, err := x.toRecord()
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		default:
+			if !foundRoot {
+				return nil, fmt.Errorf("invalid MARCXML: unexpected root element <%s>", start.Name.Local)
+			}
+		}
+	}
+	if !foundRoot {
+		return nil, errors.New("invalid MARCXML: no collection or record element")
+	}
+	return records, nil
+}
+
+// MarcXmlWriter writes records inside a <collection>, Close must be called to end the document
+type MarcXmlWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+func NewMarcXmlWriter(w io.Writer) *MarcXmlWriter {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return &MarcXmlWriter{w: w, encoder: encoder}
+}
+
+func (m *MarcXmlWriter) start() error {
+	m.started = true
+	if _, err := io.WriteString(m.w, xml.Header); err != nil {
+		return err
+	}
+	return m.encoder.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: marcXmlNamespace}},
+	})
+}
+
+func (m *MarcXmlWriter) WriteRecord(record *MarcRecord) error {
+	if !m.started {
+		if err := m.start(); err != nil {
+			return err
+		}
+	}
+	return m.encoder.Encode(fromRecord(record))
+}
+
+func (m *MarcXmlWriter) Close() error {
+	if !m.started {
+		if err := m.start(); err != nil {
+			return err
+		}
+	}
+	if err := m.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "collection"}}); err != nil {
+		return err
+	}
+	if err := m.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "\n")
+	return err
+}
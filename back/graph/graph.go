@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is the body of a GraphQL request, as sent by GraphiQL and most clients
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// ErrMutationNotAllowed is returned for a mutation sent where only queries are run (GET requests)
+var ErrMutationNotAllowed = errors.New("Mutations can only be sent with POST")
+
+/*
+Execute parses, validates and checks the limits of the request, then runs it against the DB
+rejected is true when the request failed before being executed, the result then only has errors
+*/
+func Execute(ctx context.Context, schema graphql.Schema, db *sql.DB, request Request, limits Limits, allowMutations bool) (result *graphql.Result, rejected bool) {
+	reject := func(errs ...error) (*graphql.Result, bool) {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(errs...)}, true
+	}
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return reject(err)
+	}
+	validation := graphql.ValidateDocument(&schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}, true
+	}
+	if err := CheckLimits(document, request.OperationName, request.Variables, limits); err != nil {
+		return reject(err)
+	}
+	if !allowMutations && hasMutation(document, request.OperationName) {
+		return reject(ErrMutationNotAllowed)
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       withLoaders(ctx, newLoaders(db)),
+	}), false
+}
+
+// whether the operation that would be run is a mutation
+func hasMutation(document *ast.Document, operationName string) bool {
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || operation.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			return true
+		}
+	}
+	return false
+}
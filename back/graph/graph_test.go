@@ -0,0 +1,299 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/graphql-go/graphql"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+func setupMockDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory DB
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS Books (
+    book_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    author TEXT NOT NULL,
+    num_pages INTEGER,
+    pub_date DATE NOT NULL
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	pages := 328
+	_, err = database.AddBooks(db, []models.Book{
+		{Title: "1984", Author: "George Orwell", Num_Pages: &pages, Pub_Date: "1949-06-08", Isbn: "9780451524935"},
+		{Title: "Animal Farm", Author: "George Orwell", Pub_Date: "1945-08-17"},
+		{Title: "Pride and Prejudice", Author: "Jane Austen", Pub_Date: "1813-01-28"},
+		{Title: "Emma", Author: "Jane Austen", Pub_Date: "1815-12-23"},
+		{Title: "Frankenstein", Author: "Mary Shelley", Pub_Date: "1818-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestSchema(t *testing.T) graphql.Schema {
+	schema, err := NewSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// runs the request and decodes its data into target
+func run(t *testing.T, db *sql.DB, request Request, target any) *graphql.Result {
+	t.Helper()
+	result, rejected := Execute(context.Background(), newTestSchema(t), db, request, DefaultLimits, true)
+	if rejected || len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+	data, _ := json.Marshal(result.Data)
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+type testBook struct {
+	Id       int     `json:"id"`
+	Title    string  `json:"title"`
+	NumPages *int    `json:"numPages"`
+	PubDate  string  `json:"pubDate"`
+	Isbn     *string `json:"isbn"`
+	Author   struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+func TestQueries(t *testing.T) {
+	db := setupMockDB(t)
+
+	t.Run("Testing books with a filter, an order and a page", func(t *testing.T) {
+		var data struct {
+			Books struct {
+				TotalCount  int        `json:"totalCount"`
+				HasNextPage bool       `json:"hasNextPage"`
+				Items       []testBook `json:"items"`
+			} `json:"books"`
+		}
+		run(t, db, Request{
+			Query: `query($first: Int) {
+				books(filter: {author: "orwell"}, orderBy: TITLE, first: $first) {
+					totalCount hasNextPage items { id title numPages pubDate isbn author { name } }
+				}
+			}`,
+			Variables: map[string]interface{}{"first": 1},
+		}, &data)
+		if data.Books.TotalCount != 2 || !data.Books.HasNextPage || len(data.Books.Items) != 1 {
+			t.Fatalf("unexpected page %+v", data.Books)
+		}
+		book := data.Books.Items[0]
+		if book.Title != "1984" || book.PubDate != "1949-06-08" || book.NumPages == nil || *book.NumPages != 328 ||
+			book.Isbn == nil || *book.Isbn != "9780451524935" || book.Author.Name != "George Orwell" {
+			t.Errorf("unexpected book %+v", book)
+		}
+	})
+
+	t.Run("Testing a single book and an author", func(t *testing.T) {
+		var data struct {
+			Book    *testBook `json:"book"`
+			Missing *testBook `json:"missing"`
+			Author  struct {
+				BookCount int        `json:"bookCount"`
+				Books     []testBook `json:"books"`
+			} `json:"author"`
+			Nobody *struct{} `json:"nobody"`
+		}
+		run(t, db, Request{Query: `{
+			book(id: 5) { title isbn }
+			missing: book(id: 1000) { title }
+			author(name: "Jane Austen") { bookCount books(first: 1) { title } }
+			nobody: author(name: "Nobody") { name }
+		}`}, &data)
+		if data.Book == nil || data.Book.Title != "Frankenstein" || data.Book.Isbn != nil {
+			t.Errorf("unexpected book %+v", data.Book)
+		}
+		if data.Missing != nil || data.Nobody != nil {
+			t.Errorf("expected null for what does not exist, got %+v %+v", data.Missing, data.Nobody)
+		}
+		if data.Author.BookCount != 2 || len(data.Author.Books) != 1 || data.Author.Books[0].Title != "Emma" {
+			t.Errorf("unexpected author %+v", data.Author)
+		}
+	})
+
+	t.Run("Testing invalid arguments", func(t *testing.T) {
+		for _, query := range []string{
+			`{ books(first: 1000) { totalCount } }`,
+			`{ books(offset: -1) { totalCount } }`,
+			`{ books(filter: {from: "1949"}) { totalCount } }`,
+		} {
+			result, rejected := Execute(context.Background(), newTestSchema(t), db, Request{Query: query}, Limits{}, false)
+			if rejected || len(result.Errors) == 0 {
+				t.Errorf("%s: expected an execution error, got %+v", query, result)
+			}
+		}
+	})
+}
+
+func TestMutations(t *testing.T) {
+	db := setupMockDB(t)
+
+	var added struct {
+		AddBook testBook `json:"addBook"`
+	}
+	run(t, db, Request{
+		Query: `mutation($input: BookInput!) { addBook(input: $input) { id title isbn author { name bookCount } } }`,
+		Variables: map[string]interface{}{"input": map[string]interface{}{
+			"title": "The Last Man", "author": "Mary Shelley", "pubDate": "1826-01-01", "isbn": "0-306-40615-2",
+		}},
+	}, &added)
+	if added.AddBook.Id == 0 || added.AddBook.Isbn == nil || *added.AddBook.Isbn != "0306406152" {
+		t.Fatalf("unexpected added book %+v", added.AddBook)
+	}
+
+	var updated struct {
+		UpdateBook testBook `json:"updateBook"`
+	}
+	run(t, db, Request{
+		Query:     `mutation($id: Int!) { updateBook(id: $id, input: {title: "The Last Man", author: "Mary Shelley", pubDate: "1826-02-01", numPages: 479}) { pubDate numPages } }`,
+		Variables: map[string]interface{}{"id": added.AddBook.Id},
+	}, &updated)
+	if updated.UpdateBook.PubDate != "1826-02-01" || *updated.UpdateBook.NumPages != 479 {
+		t.Errorf("unexpected updated book %+v", updated.UpdateBook)
+	}
+	book, err := database.GetBook(db, added.AddBook.Id)
+	if err != nil || book.Pub_Date[:10] != "1826-02-01" || book.Isbn != "0306406152" {
+		t.Errorf("the update should have replaced the book but its isbn, got %+v %v", book, err)
+	}
+	run(t, db, Request{
+		Query:     `mutation($id: Int!) { updateBook(id: $id, input: {title: "The Last Man", author: "Mary Shelley", pubDate: "1826-02-01", isbn: ""}) { id } }`,
+		Variables: map[string]interface{}{"id": added.AddBook.Id},
+	}, &updated)
+	if book, err := database.GetBook(db, added.AddBook.Id); err != nil || book.Isbn != "" {
+		t.Errorf("an empty isbn should have removed it, got %+v %v", book, err)
+	}
+
+	var deleted struct {
+		DeleteBook bool `json:"deleteBook"`
+	}
+	run(t, db, Request{Query: fmt.Sprintf(`mutation { deleteBook(id: %d) }`, added.AddBook.Id)}, &deleted)
+	if _, err := database.GetBook(db, added.AddBook.Id); !deleted.DeleteBook || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the book should have been deleted, got %v", err)
+	}
+
+	for query, message := range map[string]string{
+		`mutation { deleteBook(id: 1000) }`: "Book not found",
+		`mutation { updateBook(id: 1000, input: {title: "a", author: "b", pubDate: "2000-01-01"}) { id } }`: "Book not found",
+		`mutation { addBook(input: {title: "a", author: "b", pubDate: "2000"}) { id } }`:                    "date",
+	} {
+		result, rejected := Execute(context.Background(), newTestSchema(t), db, Request{Query: query}, DefaultLimits, true)
+		if rejected || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, message) {
+			t.Errorf("%s: expected an error about %q, got %+v", query, message, result.Errors)
+		}
+	}
+
+	t.Log("Testing that mutations are refused when not allowed")
+	result, rejected := Execute(context.Background(), newTestSchema(t), db, Request{Query: `mutation { deleteBook(id: 1) }`}, DefaultLimits, false)
+	if !rejected || len(result.Errors) != 1 || result.Errors[0].Message != ErrMutationNotAllowed.Error() {
+		t.Errorf("expected the mutation to be refused, got %+v", result)
+	}
+	if _, err := database.GetBook(db, 1); err != nil {
+		t.Errorf("the book should still exist, got %v", err)
+	}
+}
+
+// runs the query with loaders the test can look at
+func runWithLoaders(t *testing.T, db *sql.DB, query string) *loaders {
+	t.Helper()
+	l := newLoaders(db)
+	result := graphql.Do(graphql.Params{Schema: newTestSchema(t), RequestString: query, Context: withLoaders(context.Background(), l)})
+	if len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+	return l
+}
+
+func TestBatching(t *testing.T) {
+	db := setupMockDB(t)
+
+	t.Log("Testing that the books of every author are loaded with a single query")
+	l := runWithLoaders(t, db, `{ authors { items { name bookCount books { title author { name } } } } }`)
+	if l.booksByAuthor.batches != 1 || len(l.booksByAuthor.cache) != 3 {
+		t.Errorf("expected a single batch for the 3 authors, got %d batches", l.booksByAuthor.batches)
+	}
+
+	t.Log("Testing that the books of each book's author are loaded with a single query")
+	l = runWithLoaders(t, db, `{ books { items { author { bookCount books { title } } } } }`)
+	if l.booksByAuthor.batches != 1 {
+		t.Errorf("expected a single batch, got %d", l.booksByAuthor.batches)
+	}
+
+	t.Log("Testing that aliased books are loaded with a single query")
+	l = runWithLoaders(t, db, `{ a: book(id: 1) { title } b: book(id: 2) { title } c: book(id: 1) { author { name } } }`)
+	if l.bookById.batches != 1 || len(l.bookById.cache) != 2 {
+		t.Errorf("expected a single batch for 2 books, got %d batches", l.bookById.batches)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	db := setupMockDB(t)
+	limits := Limits{MaxDepth: 4, MaxComplexity: 200}
+
+	for _, test := range []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		limit     string
+	}{
+		{"too deep", `{ books { items { author { books { author { name } } } } } }`, nil, "depth"},
+		{"too deep through fragments", `{ books { ...items } } fragment items on BookPage { items { author { books { author { name } } } } }`, nil, "depth"},
+		{"default page size", `{ books { items { id title } } }`, nil, ""},
+		{"big page", `{ books(first: 100) { items { id title } } }`, nil, "complexity"},
+		{"big page in a variable", `query($n: Int) { books(first: $n) { items { id title } } }`, map[string]interface{}{"n": 100}, "complexity"},
+		{"small page in a variable", `query($n: Int) { books(first: $n) { items { id title } } }`, map[string]interface{}{"n": 2}, ""},
+		{"nested pages", `{ authors(first: 20) { items { books(first: 20) { title } } } }`, nil, "complexity"},
+		{"introspection", `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, nil, ""},
+	} {
+		result, rejected := Execute(context.Background(), newTestSchema(t), db, Request{Query: test.query, Variables: test.variables}, limits, false)
+		var limitErr *LimitError
+		if test.limit == "" {
+			if rejected {
+				t.Errorf("%s: unexpected errors %+v", test.name, result.Errors)
+			}
+			continue
+		}
+		if !rejected || len(result.Errors) != 1 {
+			t.Errorf("%s: expected the query to be rejected, got %+v", test.name, result)
+			continue
+		}
+		if !errors.As(result.Errors[0].OriginalError(), &limitErr) || limitErr.Limit != test.limit {
+			t.Errorf("%s: expected a %s error, got %+v", test.name, test.limit, result.Errors[0])
+		}
+	}
+
+	t.Log("Testing that deep queries do not overflow the complexity")
+	query := "{ books(first: 100) { items " + strings.Repeat("{ author { books(first: 100) ", 20) + "{ title }" + strings.Repeat(" }", 42)
+	result, rejected := Execute(context.Background(), newTestSchema(t), db, Request{Query: query}, Limits{MaxComplexity: 1000}, false)
+	if !rejected || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("expected the query to be rejected, got %+v", result.Errors)
+	}
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+/**
+Depth and complexity limits, checked on the parsed query before it is executed
+The depth is the number of nested selections, fragments do not add to it
+The complexity is the number of fields the query can return: every field costs 1, and what is selected
+under a paginated field (books, authors) is counted once per item of the page it asks for
+Introspection fields (__schema, __type...) are not counted, GraphiQL needs them to read the schema
+**/
+
+// Limits bounds the cost of a query, 0 disables a limit
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+var DefaultLimits = Limits{MaxDepth: 8, MaxComplexity: 5000}
+
+// complexities saturate there, deep queries would overflow otherwise
+const costCeiling = 1 << 40
+
+// fields whose selection is repeated for every item of the page they return
+var paginatedFields = map[string]bool{"books": true, "authors": true}
+
+// LimitError is returned when a query goes over a limit
+type LimitError struct {
+	Limit string
+	Value int
+	Max   int
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("Query %s is %d, the maximum is %d", err.Limit, err.Value, err.Max)
+}
+
+// computes the cost of an operation of the document
+type costWalker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// fragments being walked, to stop on cycles
+	visiting map[string]bool
+}
+
+// CheckLimits measures the operation that will be executed and fails if it goes over the limits
+func CheckLimits(document *ast.Document, operationName string, variables map[string]interface{}, limits Limits) error {
+	walker := costWalker{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		visiting:  make(map[string]bool),
+	}
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			walker.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operations = append(operations, definition)
+			}
+		}
+	}
+	// validation has already made sure there is a single operation to run
+	if len(operations) == 0 {
+		return nil
+	}
+
+	depth, complexity := walker.selectionSet(operations[0].SelectionSet)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &LimitError{Limit: "depth", Value: depth, Max: limits.MaxDepth}
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return &LimitError{Limit: "complexity", Value: complexity, Max: limits.MaxComplexity}
+	}
+	return nil
+}
+
+// depth and complexity of a selection set
+func (walker *costWalker) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, complexity := 0, 0
+	for _, selection := range set.Selections {
+		var depth, cost int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			childDepth, childCost := walker.selectionSet(selection.SelectionSet)
+			depth = childDepth + 1
+			cost = min(1+walker.multiplier(selection)*childCost, costCeiling)
+		case *ast.InlineFragment:
+			depth, cost = walker.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, found := walker.fragments[name]
+			if !found || walker.visiting[name] {
+				continue
+			}
+			walker.visiting[name] = true
+			depth, cost = walker.selectionSet(fragment.SelectionSet)
+			delete(walker.visiting, name)
+		}
+		maxDepth = max(maxDepth, depth)
+		complexity = min(complexity+cost, costCeiling)
+	}
+	return maxDepth, complexity
+}
+
+// number of times the selection of a field is resolved
+func (walker *costWalker) multiplier(field *ast.Field) int {
+	if !paginatedFields[field.Name.Value] {
+		return 1
+	}
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if first, err := strconv.Atoi(value.Value); err == nil {
+				return clampPage(first)
+			}
+		case *ast.Variable:
+			if first, ok := walker.variables[value.Name.Value].(float64); ok {
+				return clampPage(int(first))
+			}
+			if first, ok := walker.variables[value.Name.Value].(int); ok {
+				return clampPage(first)
+			}
+			// the default value of the variable, assume the biggest page
+			return maxPageSize
+		}
+	}
+	return defaultPageSize
+}
+
+// pages bigger than maxPageSize are refused by the resolvers, clamping keeps the products from overflowing
+func clampPage(first int) int {
+	return min(max(first, 1), maxPageSize)
+}
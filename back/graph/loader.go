@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+Dataloaders, to avoid running a query per parent object (N+1) when a list is resolved
+Resolvers queue their key and return a thunk, the executor resolves every field of a level of the query
+before calling the thunks of that level, so the first thunk called loads every queued key with a single query
+Loaders live for a single request, their results are cached for its duration
+**/
+
+// loader batches and caches the loading of values by key
+type loader[K comparable, V any] struct {
+	mutex   sync.Mutex
+	fetch   func(keys []K) (map[K]V, error)
+	pending []K
+	queued  map[K]bool
+	cache   map[K]V
+	// error of the last batch, returned to every key it contained
+	errors map[K]error
+	// number of queries run, checked by the tests
+	batches int
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:  fetch,
+		queued: make(map[K]bool),
+		cache:  make(map[K]V),
+		errors: make(map[K]error),
+	}
+}
+
+// Load queues the key and returns a thunk giving its value, found is false when the fetch did not return the key
+func (l *loader[K, V]) Load(key K) func() (V, bool, error) {
+	l.mutex.Lock()
+	_, cached := l.cache[key]
+	if !cached && !l.queued[key] && l.errors[key] == nil {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mutex.Unlock()
+
+	return func() (V, bool, error) {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		if l.queued[key] {
+			l.dispatch()
+		}
+		if err := l.errors[key]; err != nil {
+			var zero V
+			return zero, false, err
+		}
+		value, found := l.cache[key]
+		return value, found, nil
+	}
+}
+
+// loads every pending key, the mutex is held by the caller
+func (l *loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	for _, key := range keys {
+		delete(l.queued, key)
+	}
+	l.batches++
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errors[key] = err
+			continue
+		}
+		if value, found := values[key]; found {
+			l.cache[key] = value
+		}
+	}
+}
+
+// loaders of a request
+type loaders struct {
+	db            *sql.DB
+	bookById      *loader[int, models.Book]
+	booksByAuthor *loader[string, []models.Book]
+}
+
+func newLoaders(db *sql.DB) *loaders {
+	return &loaders{
+		db: db,
+		bookById: newLoader(func(ids []int) (map[int]models.Book, error) {
+			books, err := database.GetBooksByIds(db, ids)
+			if err != nil {
+				return nil, err
+			}
+			byId := make(map[int]models.Book, len(books))
+			for _, book := range books {
+				byId[book.Book_Id] = book
+			}
+			return byId, nil
+		}),
+		booksByAuthor: newLoader(func(authors []string) (map[string][]models.Book, error) {
+			books, err := database.GetBooksByAuthors(db, authors)
+			if err != nil {
+				return nil, err
+			}
+			byAuthor := make(map[string][]models.Book, len(authors))
+			for _, book := range books {
+				byAuthor[book.Author] = append(byAuthor[book.Author], book)
+			}
+			return byAuthor, nil
+		}),
+	}
+}
+
+// forgets what was cached, called after a mutation so the fields selected on its result see the change
+func (l *loaders) clear() {
+	fresh := newLoaders(l.db)
+	l.bookById = fresh.bookById
+	l.booksByAuthor = fresh.booksByAuthor
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,431 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/graphql-go/graphql"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+)
+
+/**
+GraphQL schema of the catalogue, books and their authors
+Authors are not stored on their own, an author is the name found on books, with the books that carry it
+The mutations mirror the POST, PUT and DELETE /books endpoints and validate books the same way
+**/
+
+const (
+	// page size when first is not given
+	defaultPageSize = 25
+	// biggest page a query can ask for
+	maxPageSize = 100
+)
+
+var bookOrderEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "BookOrder",
+	Description: "Order of a list of books",
+	Values: graphql.EnumValueConfigMap{
+		"ID":     {Value: database.OrderById, Description: "Insertion order"},
+		"NEWEST": {Value: database.OrderNewest, Description: "Most recently added first"},
+		"TITLE":  {Value: database.OrderTitle, Description: "Alphabetical"},
+	},
+})
+
+var bookFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "BookFilter",
+	Description: "Same filters as GET /books, every field is optional",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":  {Type: graphql.String, Description: "Title contains, case insensitive"},
+		"author": {Type: graphql.String, Description: "Author contains, case insensitive"},
+		"search": {Type: graphql.String, Description: "Title or author contains, case insensitive"},
+		"year":   {Type: graphql.String, Description: "Published that year (YYYY)"},
+		"from":   {Type: graphql.String, Description: "Published on or after (YYYY-MM-DD)"},
+		"to":     {Type: graphql.String, Description: "Published on or before (YYYY-MM-DD)"},
+	},
+})
+
+var bookInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "BookInput",
+	Description: "A book to add, or the new values of a book to update",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":    {Type: graphql.NewNonNull(graphql.String)},
+		"author":   {Type: graphql.NewNonNull(graphql.String)},
+		"numPages": {Type: graphql.Int},
+		"pubDate":  {Type: graphql.NewNonNull(graphql.String), Description: "YYYY-MM-DD"},
+		"isbn":     {Type: graphql.String, Description: "ISBN-10 or ISBN-13, an update without one keeps the ISBN of the book"},
+	},
+})
+
+var bookType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Book",
+	Fields: graphql.Fields{
+		"id": {
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Book).Book_Id, nil
+			},
+		},
+		"title": {
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Book).Title, nil
+			},
+		},
+		"author": {
+			Type: graphql.NewNonNull(authorType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return models.Facet{Value: p.Source.(models.Book).Author}, nil
+			},
+		},
+		"numPages": {
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if pages := p.Source.(models.Book).Num_Pages; pages != nil {
+					return *pages, nil
+				}
+				return nil, nil
+			},
+		},
+		"pubDate": {
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "YYYY-MM-DD",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				// dates come back from the DB as YYYY-MM-DDT00:00:00Z
+				date, _, _ := strings.Cut(p.Source.(models.Book).Pub_Date, "T")
+				return date, nil
+			},
+		},
+		"isbn": {
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if isbn := p.Source.(models.Book).Isbn; isbn != "" {
+					return isbn, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+// the source of an author is a facet, its count is 0 when it was not read along with the name
+var authorType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Author",
+	Fields: graphql.Fields{
+		"name": {
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Facet).Value, nil
+			},
+		},
+		"bookCount": {
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				author := p.Source.(models.Facet)
+				if author.Count > 0 {
+					return author.Count, nil
+				}
+				books := loadersFrom(p.Context).booksByAuthor.Load(author.Value)
+				return func() (interface{}, error) {
+					books, _, err := books()
+					return len(books), err
+				}, nil
+			},
+		},
+	},
+})
+
+// books refers back to the Book type, it is added once both types exist
+func init() {
+	authorType.AddFieldConfig("books", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+		Description: "Books of the author, by title",
+		Args:        pageArgs(),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, offset, err := pageFromArgs(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			books := loadersFrom(p.Context).booksByAuthor.Load(p.Source.(models.Facet).Value)
+			return func() (interface{}, error) {
+				books, _, err := books()
+				if err != nil {
+					return nil, err
+				}
+				return books[min(offset, len(books)):min(offset+first, len(books))], nil
+			}, nil
+		},
+	})
+}
+
+// a page of a list, the source of the BookPage and AuthorPage types
+type page struct {
+	total  int
+	offset int
+	items  any
+	length int
+}
+
+func pageType(name string, item graphql.Type) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"totalCount": {
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Number of items in the whole list",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(page).total, nil
+				},
+			},
+			"hasNextPage": {
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					source := p.Source.(page)
+					return source.offset+source.length < source.total, nil
+				},
+			},
+			"items": {
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(item))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(page).items, nil
+				},
+			},
+		},
+	})
+}
+
+var bookPageType = pageType("BookPage", bookType)
+var authorPageType = pageType("AuthorPage", authorType)
+
+func pageArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"first":  {Type: graphql.Int, DefaultValue: defaultPageSize, Description: fmt.Sprintf("Page size, at most %d", maxPageSize)},
+		"offset": {Type: graphql.Int, DefaultValue: 0, Description: "Number of items to skip"},
+	}
+}
+
+func pageFromArgs(args map[string]interface{}) (int, int, error) {
+	first, _ := args["first"].(int)
+	offset, _ := args["offset"].(int)
+	if first < 0 || first > maxPageSize {
+		return 0, 0, fmt.Errorf("first should be between 0 and %d", maxPageSize)
+	}
+	if offset < 0 {
+		return 0, 0, errors.New("offset can not be negative")
+	}
+	return first, offset, nil
+}
+
+func filterFromArgs(args map[string]interface{}) (database.BookFilter, error) {
+	values, _ := args["filter"].(map[string]interface{})
+	value := func(key string) string {
+		text, _ := values[key].(string)
+		return text
+	}
+	filter := database.BookFilter{
+		Title:    value("title"),
+		Author:   value("author"),
+		Search:   value("search"),
+		Year:     value("year"),
+		FromDate: value("from"),
+		ToDate:   value("to"),
+	}
+	if filter.FromDate != "" && !utils.ValidateDate(filter.FromDate) {
+		return filter, errors.New("Invalid 'from' date format. Should be YYYY-MM-DD")
+	}
+	if filter.ToDate != "" && !utils.ValidateDate(filter.ToDate) {
+		return filter, errors.New("Invalid 'to' date format. Should be YYYY-MM-DD")
+	}
+	return filter, nil
+}
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"book": {
+			Type: bookType,
+			Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				book := loadersFrom(p.Context).bookById.Load(p.Args["id"].(int))
+				return func() (interface{}, error) {
+					book, found, err := book()
+					if err != nil || !found {
+						return nil, err
+					}
+					return book, nil
+				}, nil
+			},
+		},
+		"books": {
+			Type: graphql.NewNonNull(bookPageType),
+			Args: func() graphql.FieldConfigArgument {
+				args := pageArgs()
+				args["filter"] = &graphql.ArgumentConfig{Type: bookFilterInput}
+				args["orderBy"] = &graphql.ArgumentConfig{Type: bookOrderEnum, DefaultValue: database.OrderById}
+				return args
+			}(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				first, offset, err := pageFromArgs(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				filter, err := filterFromArgs(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				order, _ := p.Args["orderBy"].(database.BookOrder)
+				db := loadersFrom(p.Context).db
+				total, err := database.CountBooks(db, filter)
+				if err != nil {
+					return nil, err
+				}
+				books, err := database.ListBooks(db, filter, order, first, offset)
+				if err != nil {
+					return nil, err
+				}
+				return page{total: total, offset: offset, items: books, length: len(books)}, nil
+			},
+		},
+		"author": {
+			Type: authorType,
+			Args: graphql.FieldConfigArgument{"name": {Type: graphql.NewNonNull(graphql.String), Description: "Exact name, as found on the books"}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				name := p.Args["name"].(string)
+				books := loadersFrom(p.Context).booksByAuthor.Load(name)
+				return func() (interface{}, error) {
+					books, found, err := books()
+					if err != nil || !found {
+						return nil, err
+					}
+					return models.Facet{Value: name, Count: len(books)}, nil
+				}, nil
+			},
+		},
+		"authors": {
+			Type:        graphql.NewNonNull(authorPageType),
+			Description: "Authors, by name",
+			Args:        pageArgs(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				first, offset, err := pageFromArgs(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				authors, err := database.GetAuthors(loadersFrom(p.Context).db)
+				if err != nil {
+					return nil, err
+				}
+				items := authors[min(offset, len(authors)):min(offset+first, len(authors))]
+				return page{total: len(authors), offset: offset, items: items, length: len(items)}, nil
+			},
+		},
+	},
+})
+
+// who makes a mutation, for the audit log, the endpoint takes no token so the changes are anonymous
+func changeFrom(ctx context.Context) database.Change {
+	return database.Change{Actor: "anonymous", RequestId: middleware.GetReqID(ctx)}
+}
+
+var mutationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Mutation",
+	Fields: graphql.Fields{
+		"addBook": {
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Same as POST /books",
+			Args:        graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(bookInput)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				book, err := bookFromInput(p.Args["input"])
+				if err != nil {
+					return nil, err
+				}
+				l := loadersFrom(p.Context)
+				book.Book_Id, err = database.AddBookAudited(l.db, book, changeFrom(p.Context))
+				if err != nil {
+					return nil, err
+				}
+				l.clear()
+				return book, nil
+			},
+		},
+		"updateBook": {
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Same as PUT /books/{id}, every field of the book is replaced but a missing isbn",
+			Args: graphql.FieldConfigArgument{
+				"id":    {Type: graphql.NewNonNull(graphql.Int)},
+				"input": {Type: graphql.NewNonNull(bookInput)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				book, err := bookFromInput(p.Args["input"])
+				if err != nil {
+					return nil, err
+				}
+				book.Book_Id = p.Args["id"].(int)
+				l := loadersFrom(p.Context)
+				if _, ok := p.Args["input"].(map[string]interface{})["isbn"]; !ok {
+					stored, err := database.GetBook(l.db, book.Book_Id)
+					if err == sql.ErrNoRows {
+						return nil, errors.New("Book not found")
+					} else if err != nil {
+						return nil, err
+					}
+					book.Isbn = stored.Isbn
+				}
+				if err := database.UpdateBookAudited(l.db, book, changeFrom(p.Context)); err != nil {
+					if err == sql.ErrNoRows {
+						return nil, errors.New("Book not found")
+					}
+					return nil, err
+				}
+				l.clear()
+				return book, nil
+			},
+		},
+		"deleteBook": {
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "Same as DELETE /books/{id}",
+			Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				l := loadersFrom(p.Context)
+				if err := database.DeleteBookAudited(l.db, p.Args["id"].(int), changeFrom(p.Context)); err != nil {
+					if err == sql.ErrNoRows {
+						return nil, errors.New("Book not found")
+					}
+					return nil, err
+				}
+				l.clear()
+				return true, nil
+			},
+		},
+	},
+})
+
+// reads and validates a BookInput like the REST endpoints do
+func bookFromInput(input interface{}) (models.Book, error) {
+	values, _ := input.(map[string]interface{})
+	var book models.Book
+	book.Title, _ = values["title"].(string)
+	book.Author, _ = values["author"].(string)
+	book.Pub_Date, _ = values["pubDate"].(string)
+	book.Isbn, _ = values["isbn"].(string)
+	if pages, ok := values["numPages"].(int); ok {
+		book.Num_Pages = &pages
+	}
+	if problems := utils.ValidateBook(book); len(problems) > 0 {
+		return book, errors.New(strings.Join(problems, ", "))
+	}
+	book.Isbn = utils.NormalizeIsbn(book.Isbn)
+	return book, nil
+}
+
+// NewSchema builds the schema served on /graphql
+func NewSchema() (graphql.Schema, error) {
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType,
+		Mutation: mutationType,
+	})
+}
@@ -1,118 +1,168 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
 	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	"github.com/mimminou/BookIT-ByFood/back/rpc"
 	"github.com/mimminou/BookIT-ByFood/back/server"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"github.com/mimminou/BookIT-ByFood/back/webhooks"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-// config struct for config.json
-type server_config struct {
-	Port uint16 `json:"port"`
-}
-
-type db_config struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
-}
-
-type config struct {
-	Server server_config `json:"server"`
-	Db     db_config     `json:"database"`
-}
+var errNoDb = errors.New("DB does not exist yet, run 'bookit db setup' to set it up first")
 
-// Print small help message that demonstrates usage
-func showHelp() {
-	fmt.Println("Usage:")
-	fmt.Println("-h : Prints this help message and exits")
-	fmt.Println("-s : Setup DB and exits, needs to run once before running the server first time")
+func checkDB(name, path string) error {
+	if _, err := os.Stat(path + name); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errNoDb
+		}
+		return err
+	}
+	return nil
 }
 
-// reads json config from file, returns pointer to config struct
-func readConfig(filename string) (*config, error) {
-	var config config
-	bytes, err := os.ReadFile(filename)
+// connects to the existing DB and brings it up to date with the schema this build expects
+func openDb(config *config) (*sql.DB, error) {
+	if err := checkDB(config.Db.Name, config.Db.Path); err != nil {
+		return nil, err
+	}
+	db, err := database.ConnectDb(config.Db.Name, config.Db.Path, config.Db.Options)
 	if err != nil {
-		log.Fatal("Error reading config.json: ", err)
 		return nil, err
 	}
-	err = json.Unmarshal(bytes, &config)
+	if err := database.Migrate(db); err != nil {
+		database.Close(db)
+		return nil, fmt.Errorf("migrating: %w", err)
+	}
+	return db, nil
+}
+
+// loads the rules of the URL cleaner, with the client of its network operations
+func loadUrlRules(config *config) (*urlrules.Engine, error) {
+	rules, err := urlrules.Load(config.UrlRules.Path)
 	if err != nil {
-		log.Fatal("Error reading config.json: ", err)
 		return nil, err
 	}
-	return &config, nil
+	rules.SetFetcher(urlfetch.New(config.UrlFetch))
+	return rules, nil
 }
 
-// Handles command line args
-func handleArgs() {
-	if len(os.Args) == 1 {
-		// no args provided, run server without setup
+// reloads the URL rules when the file changes, and on SIGHUP
+func watchRules(rules *urlrules.Engine, config url_rules_config) {
+	if config.Path == "" {
 		return
 	}
-	if len(os.Args) > 2 {
-		fmt.Println("Error: Too many arguments, please only provide one arguement")
-		showHelp()
-		os.Exit(3)
-	}
-
-	switch os.Args[1] {
-	case "-s":
-
-		db := SetupDatabase()
-		if db != nil {
-			fmt.Println("Error setting up database: ", db)
-			os.Exit(5)
+	logReload := func(err error) {
+		if err != nil {
+			log.Println("Error reloading URL rules, keeping the previous ones: ", err)
+			return
 		}
-	case "-h":
-		showHelp()
-		os.Exit(0)
-	default:
-		fmt.Println("Error: Invalid argument")
-		showHelp()
-		os.Exit(4)
+		log.Println("Reloaded URL rules from", config.Path)
+	}
+	if config.ReloadSeconds > 0 {
+		go rules.Watch(context.Background(), time.Duration(config.ReloadSeconds)*time.Second, logReload)
 	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logReload(rules.Reload())
+		}
+	}()
 }
 
-func checkDB(name, path string) {
-	if _, err := os.Stat(path + name); err == nil {
-		return
-	} else {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Fatal("Error : Db does not exist yet, please run the server with '-s' flag to setup the DB first")
-		} else {
-			log.Fatal("Error : ", err)
-		}
+// serve command, runs the HTTP server, and the gRPC one when it has a port, returns the exit code
+func runServe(config *config) int {
+	db, err := openDb(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening database: ", err)
+		return 1
 	}
-}
+	defer database.Close(db)
 
-func main() {
-	// Attempt to read the config.json file
-	config, err := readConfig("config.json")
+	rules, err := loadUrlRules(config)
 	if err != nil {
-		if err == os.ErrNotExist {
-			fmt.Println("Error reading config.json: File does not exist")
-			os.Exit(1)
-		}
-		fmt.Println("Error reading config.json:", err)
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, "Error loading URL rules: ", err)
+		return 1
 	}
+	watchRules(rules, config.UrlRules)
 
-	handleArgs()
+	files, err := storage.Open(config.Storage)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening the storage: ", err)
+		return 1
+	}
+	catalogue, err := enrich.Open(config.Enrichment)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening the enrichment provider: ", err)
+		return 1
+	}
 
-	checkDB(config.Db.Name, config.Db.Path)
+	go backup.Schedule(context.Background(), db, config.Backup, func(info backup.Info, err error) {
+		if err != nil {
+			log.Println("Error backing up database: ", err)
+			return
+		}
+		log.Println("Backed up database to", info.Name)
+	})
+	go services.SchedulePurge(context.Background(), db, files, config.Trash, func(purged int, err error) {
+		if err != nil {
+			log.Println("Error purging the trash: ", err)
+			return
+		}
+		if purged > 0 {
+			log.Println("Purged", purged, "books from the trash")
+		}
+	})
 
-	// connect to DB, then pass DB instance to server
-	db, err := database.ConnectDb(config.Db.Name, config.Db.Path)
+	// the clients that reconnect after a restart resume from the changes kept in the audit log
+	feed := events.NewBroker(config.Events)
+	recent, err := database.RecentEvents(db, feed.Options().BufferSize)
 	if err != nil {
-		fmt.Println("Error connecting to database: ", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error loading the events: ", err)
+		return 1
 	}
-	defer db.Close()
+	feed.Load(recent)
+	database.OnBookChange(db, feed.Publish)
+
+	go webhooks.New(db, config.Webhooks).Run(context.Background(), func(sent int, err error) {
+		if err != nil {
+			log.Println("Error delivering webhooks: ", err)
+		}
+	})
 
-	server.Serve(config.Server.Port, db)
+	if config.Server.GrpcPort != 0 {
+		go rpc.Serve(config.Server.GrpcPort, db, rules)
+	}
+	server.Serve(db, server.Options{
+		Port:       config.Server.Port,
+		Rules:      rules,
+		UrlBatch:   config.UrlBatch,
+		ShortLinks: config.ShortLinks,
+		Backups:    config.Backup,
+		Feed:       feed,
+		Files:      files,
+		Covers:     config.Covers,
+		Epubs:      config.Epubs,
+		Catalogue:  catalogue,
+	})
+	return 0
+}
+
+func main() {
+	os.Exit(newCli().Execute(legacyArgs(os.Args[1:])))
 }
@@ -1,5 +1,12 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
 //Here are the structs that define the models of the DB, needed for unmarshalling/Marhsalling Json
 
 // Book is the schema for a book object
@@ -16,17 +23,380 @@ type Book struct {
 	Num_Pages *int `json:"num_pages,omitempty"`
 	// @Property pub_date int true "Publication date"
 	Pub_Date string `json:"pub_date"`
+	// @Property isbn string false "ISBN-10 or ISBN-13"
+	Isbn string `json:"isbn,omitempty"`
+}
+
+// @Description	Deleted book, in the trash until it is restored or purged
+type TrashedBook struct {
+	Book
+	// @Property deleted_at string true "Deletion time, RFC 3339"
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// @Description	Cover image of a book, served at url, and scaled down at the URLs of its sizes
+type Cover struct {
+	// @Property		book_id int true "Book ID"
+	Book_Id int `json:"book_id"`
+	// @Property		content_type string true "image/jpeg, image/png or image/webp"
+	ContentType string `json:"content_type"`
+	// @Property		width int true "Width in pixels"
+	Width int `json:"width"`
+	// @Property		height int true "Height in pixels"
+	Height int `json:"height"`
+	// @Property		thumbnail_type string true "Type of the thumbnails, image/jpeg, or image/png for the covers with transparency"
+	ThumbnailType string `json:"thumbnail_type"`
+	// @Property		etag string true "Version of the cover, changed by every upload"
+	Etag string `json:"etag"`
+	// @Property		updated_at string true "Time of the upload, RFC 3339"
+	UpdatedAt time.Time `json:"updated_at"`
+	// @Property		url string true "URL of the cover, with its version so that it can be cached for good"
+	Url string `json:"url"`
+	// @Property		sizes object true "URLs of the thumbnails, by size (small, medium, large)"
+	Sizes map[string]string `json:"sizes"`
+}
+
+// @Description	EPUB file of a book, downloaded at url
+type Epub struct {
+	// @Property		book_id int true "Book ID"
+	Book_Id int `json:"book_id"`
+	// @Property		filename string true "Name the file is downloaded as"
+	Filename string `json:"filename"`
+	// @Property		size int true "Size in bytes"
+	Size int64 `json:"size"`
+	// @Property		sha256 string true "SHA-256 of the file, hex encoded"
+	Sha256 string `json:"sha256"`
+	// @Property		language string false "Language of the book, as its package document says, e.g. en-GB"
+	Language string `json:"language,omitempty"`
+	// @Property		identifiers array false "Identifiers of the book, ISBN, UUID, DOI..."
+	Identifiers []string `json:"identifiers,omitempty"`
+	// @Property		etag string true "Version of the file, changed by every upload"
+	Etag string `json:"etag"`
+	// @Property		uploaded_at string true "Time of the upload, RFC 3339"
+	UploadedAt time.Time `json:"uploaded_at"`
+	// @Property		url string true "URL of the file"
+	Url string `json:"url"`
+}
+
+// @Description	Result of an EPUB upload, the book as it was created or updated out of the metadata of the file
+type EpubUpload struct {
+	// @Property		created bool true "Whether the book was created, rather than updated"
+	Created bool `json:"created"`
+	// @Property		book object true "Book"
+	Book Book `json:"book"`
+	// @Property		epub object true "EPUB file"
+	Epub Epub `json:"epub"`
+	// @Property		cover object false "Cover taken from the file, when it has one"
+	Cover *Cover `json:"cover,omitempty"`
+	// @Property		warnings array false "What was left out, e.g. a cover that can't be read"
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// @Description	What the catalogue would change in a book, saved once confirmed with the digest
+type Enrichment struct {
+	// @Property		book_id int false "Book ID, absent for a new book"
+	Book_Id int `json:"book_id,omitempty"`
+	// @Property		isbn string true "ISBN looked up"
+	Isbn string `json:"isbn"`
+	// @Property		source string true "Catalogue of the record, openlibrary or googlebooks"
+	Source string `json:"source"`
+	// @Property		changes object true "Changes by field (title, author, num_pages, pub_date, cover), the value of the book and the one of the catalogue"
+	Changes map[string]FieldChange `json:"changes"`
+	// @Property		book object true "The book with every change made"
+	Book Book `json:"book"`
+	// @Property		digest string true "Digest of the book and of the record, sent back to confirm the changes"
+	Digest string `json:"digest"`
+}
+
+// @Description	Book to enrich, and the changes confirmed, without a digest the changes are only previewed
+type EnrichRequest struct {
+	Book
+	// @Property		digest string false "Digest of the preview, confirms the changes"
+	Digest string `json:"digest"`
+	// @Property		fields array false "Fields whose change is confirmed, all of them when empty"
+	Fields []string `json:"fields"`
+}
+
+// @Description	Changes of the catalogue saved in a book
+type EnrichResult struct {
+	// @Property		created bool true "Whether the book was created"
+	Created bool `json:"created"`
+	// @Property		book object true "The book as saved"
+	Book Book `json:"book"`
+	// @Property		applied array true "Fields changed"
+	Applied []string `json:"applied"`
+	// @Property		cover object false "Cover downloaded from the catalogue"
+	Cover *Cover `json:"cover,omitempty"`
+	// @Property		warnings array false "What was left out, e.g. a cover that could not be downloaded"
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// operations of the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditRevert  = "revert"
+)
+
+// @Description	Change made to a book, entries of the audit log are never changed or removed
+type AuditEntry struct {
+	// @Property		audit_id int true "Entry ID, in the order the changes were made"
+	Audit_Id int `json:"audit_id"`
+	// @Property		book_id int true "Changed book"
+	Book_Id int `json:"book_id"`
+	// @Property		operation string true "create, update, delete, restore or revert"
+	Operation string `json:"operation"`
+	// @Property		actor string true "Name of the user who made the change, anonymous without a token"
+	Actor string `json:"actor"`
+	// @Property		request_id string false "ID of the request that made the change, its X-Request-Id header"
+	RequestId string `json:"request_id,omitempty"`
+	// @Property		at string true "Time of the change, RFC 3339"
+	At time.Time `json:"at"`
+	// @Property		before object false "Book before the change, null when it didn't exist or was in the trash"
+	Before *Book `json:"before"`
+	// @Property		after object false "Book after the change, null when it was deleted"
+	After *Book `json:"after"`
+	// @Property		diff object true "Changed fields, by JSON key"
+	Diff map[string]FieldChange `json:"diff"`
+}
+
+// @Description	Value of a field before and after a change
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// events sent to the webhooks, a revert is an update
+const (
+	EventBookCreated  = "book.created"
+	EventBookUpdated  = "book.updated"
+	EventBookDeleted  = "book.deleted"
+	EventBookRestored = "book.restored"
+)
+
+// Events lists the events a webhook can subscribe to
+var Events = []string{EventBookCreated, EventBookUpdated, EventBookDeleted, EventBookRestored}
+
+// @Description	Change of a book, the body of a webhook delivery
+type BookEvent struct {
+	// @Property		event string true "book.created, book.updated, book.deleted or book.restored"
+	Event string `json:"event"`
+	// @Property		audit_id int true "Entry of the audit log of the change, unique to the event"
+	Audit_Id int `json:"audit_id"`
+	// @Property		book_id int true "Changed book"
+	Book_Id int `json:"book_id"`
+	// @Property		actor string true "Name of the user who made the change, anonymous without a token"
+	Actor string `json:"actor"`
+	// @Property		at string true "Time of the change, RFC 3339"
+	At time.Time `json:"at"`
+	// @Property		book object true "Book after the change, before it for book.deleted"
+	Book *Book `json:"book"`
+	// @Property		diff object true "Changed fields, by JSON key"
+	Diff map[string]FieldChange `json:"diff"`
+}
+
+// @Description	Subscription of a URL to book events, each event is POSTed to it signed with the secret
+type Webhook struct {
+	// @Property		webhook_id int true "Webhook ID"
+	Webhook_Id int `json:"webhook_id"`
+	// @Property		url string true "Receiver of the events, http or https"
+	Url string `json:"url"`
+	// @Property		events array true "Events sent to the receiver"
+	Events []string `json:"events"`
+	// @Property		active bool true "No event is sent to an inactive webhook"
+	Active bool `json:"active"`
+	// @Property		secret string false "Key of the signatures, only shown when it is set"
+	Secret string `json:"secret,omitempty"`
+	// @Property		created_at string true "Creation time, RFC 3339"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// @Description	New webhook
+type WebhookRequest struct {
+	// @Property		url string true "Receiver of the events, http or https"
+	Url string `json:"url"`
+	// @Property		events array true "Events to send, from book.created, book.updated, book.deleted and book.restored"
+	Events []string `json:"events"`
+	// @Property		secret string false "Key of the signatures, at least 16 characters, generated when empty"
+	Secret string `json:"secret,omitempty"`
+}
+
+// @Description	Changes to a webhook, the fields left out are kept
+type WebhookUpdate struct {
+	// @Property		url string false "New receiver"
+	Url *string `json:"url,omitempty"`
+	// @Property		events array false "New events"
+	Events []string `json:"events,omitempty"`
+	// @Property		active bool false "Stop or start sending events"
+	Active *bool `json:"active,omitempty"`
+	// @Property		rotate_secret bool false "Replace the secret with a generated one, shown in the response"
+	RotateSecret bool `json:"rotate_secret,omitempty"`
+}
+
+// states of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// @Description	Delivery of an event to a webhook, with the outcome of its last attempt
+type WebhookDelivery struct {
+	// @Property		delivery_id int true "Delivery ID, sent in the X-Bookit-Delivery header"
+	Delivery_Id int `json:"delivery_id"`
+	// @Property		webhook_id int true "Webhook ID"
+	Webhook_Id int `json:"webhook_id"`
+	// @Property		event string true "Event sent"
+	Event string `json:"event"`
+	// @Property		status string true "pending until the receiver answers 2xx (delivered) or the attempts run out (failed)"
+	Status string `json:"status"`
+	// @Property		attempts int true "Number of attempts made"
+	Attempts int `json:"attempts"`
+	// @Property		next_attempt_at string false "Time of the next attempt of a pending delivery, RFC 3339"
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// @Property		last_attempt_at string false "Time of the last attempt, RFC 3339"
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	// @Property		response_status int false "HTTP status of the last answer of the receiver"
+	ResponseStatus int `json:"response_status,omitempty"`
+	// @Property		error string false "Why the last attempt failed"
+	Error string `json:"error,omitempty"`
+	// @Property		redelivery_of int false "Delivery this one sends again"
+	RedeliveryOf int `json:"redelivery_of,omitempty"`
+	// @Property		created_at string true "Creation time, RFC 3339"
+	CreatedAt time.Time `json:"created_at"`
+	// @Property		payload object true "Body sent, a BookEvent"
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+}
+
+// roles a user can have, an admin can also run the maintenance operations
+const (
+	RoleAdmin = "admin"
+	RoleStaff = "staff"
+)
+
+// @Description User of the API
+type User struct {
+	// @Property user_id int true "User ID"
+	User_Id int `json:"user_id"`
+	// @Property name string true "Unique name"
+	Name string `json:"name"`
+	// @Property role string true "admin or staff"
+	Role string `json:"role"`
+	// @Property created_at string true "Creation time, RFC 3339"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// @Description	A value books are grouped by, e.g. an author, and how many books share it
+type Facet struct {
+	// @Property		value string true "Grouped value"
+	Value string `json:"value"`
+	// @Property		count int true "Number of books"
+	Count int `json:"count"`
 }
 
 // @Description	Process URL
 type RequestStruct struct {
 	// @Property		url string true "URL to process"
 	Url string `json:"url"`
-	// @Property		operation string true "Operation to perform"
-	// @Enum			canonical, redirection, all
+	// @Property		operation string true "Operation to perform, a rule set of the URL rules, see GET /url/operations"
 	Operation string `json:"operation"`
 }
 
 type ResponseStruct struct {
 	ProcessedUrl string `json:"processed_url"`
+	// requests made by the resolve and html-canonical operations, in order
+	Chain []urlfetch.Hop `json:"chain,omitempty"`
+	// canonical URLs the page declares, for html-canonical
+	Canonical *urlfetch.CanonicalReport `json:"canonical,omitempty"`
+}
+
+// @Description	Result of one item of a URL batch, in the order of the request
+type BatchResult struct {
+	// @Property		index int true "Position of the item in the request, from 0"
+	Index int `json:"index"`
+	// @Property		url string false "URL of the item"
+	Url string `json:"url,omitempty"`
+	// @Property		operation string false "Operation of the item"
+	Operation string `json:"operation,omitempty"`
+	// @Property		processed_url string false "Processed URL, when the item succeeded"
+	ProcessedUrl string `json:"processed_url,omitempty"`
+	// @Property		error string false "Why the item failed"
+	Error string `json:"error,omitempty"`
+}
+
+// @Description	Import report
+type ImportReport struct {
+	// @Property		dry_run bool true "True when nothing was written to the DB"
+	DryRun bool `json:"dry_run"`
+	// @Property		total_rows int true "Number of rows read from the file"
+	Total int `json:"total_rows"`
+	// @Property		imported int true "Number of books written to the DB"
+	Imported int `json:"imported"`
+	// @Property		failed int true "Number of rows rejected"
+	Failed int `json:"failed"`
+	// @Property		errors array true "Problems found for each rejected row"
+	Errors []ImportError `json:"errors"`
+	// @Property		books array true "Books imported, or that would be imported on a dry run"
+	Books []Book `json:"books"`
+	// @Property		unmapped_fields object false "MARC tags that have no book counterpart, with the number of records they were found in"
+	Unmapped map[string]int `json:"unmapped_fields,omitempty"`
+}
+
+// @Description	Problems found on a single imported row
+type ImportError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// @Description	Short link to a page, GET /l/{slug} redirects to its url
+type ShortLink struct {
+	// @Property		slug string true "Slug of the link, the last segment of its short URL"
+	Slug string `json:"slug"`
+	// @Property		url string true "Destination, the requested URL once processed by the URL cleaner"
+	Url string `json:"url"`
+	// @Property		short_url string false "URL that redirects to the destination"
+	ShortUrl string `json:"short_url,omitempty"`
+	// @Property		permanent bool false "Redirects with 301 instead of 302"
+	Permanent bool `json:"permanent"`
+	// @Property		disabled bool false "A disabled link answers 410"
+	Disabled bool `json:"disabled"`
+	// @Property		expires_at string false "Time the link stops redirecting at, RFC 3339"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// @Property		clicks int false "Redirects made by the link"
+	Clicks int `json:"clicks"`
+	// @Property		last_clicked_at string false "Time of the last redirect, RFC 3339"
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+	// @Property		created_at string true "Creation time, RFC 3339"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Expired reports whether the link has expired at the time
+func (link ShortLink) Expired(at time.Time) bool {
+	return link.ExpiresAt != nil && !at.Before(*link.ExpiresAt)
+}
+
+// @Description	New short link
+type ShortLinkRequest struct {
+	// @Property		url string true "URL to shorten"
+	Url string `json:"url"`
+	// @Property		slug string false "Custom slug, 3 to 64 letters, digits, - or _, generated when empty"
+	Slug string `json:"slug,omitempty"`
+	// @Property		permanent bool false "Redirect with 301 instead of 302"
+	Permanent bool `json:"permanent,omitempty"`
+	// @Property		expires_at string false "Time the link stops redirecting at, RFC 3339"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// @Description	Changes to a short link, the fields left out are kept
+type ShortLinkUpdate struct {
+	// @Property		permanent bool false "Redirect with 301 instead of 302"
+	Permanent *bool `json:"permanent,omitempty"`
+	// @Property		disabled bool false "Stop or start redirecting"
+	Disabled *bool `json:"disabled,omitempty"`
+	// @Property		expires_at string false "New expiry time, RFC 3339"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// @Property		no_expiry bool false "Remove the expiry time"
+	NoExpiry bool `json:"no_expiry,omitempty"`
 }
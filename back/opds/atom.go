@@ -0,0 +1,224 @@
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+OPDS 1.2 (https://specs.opds.io/opds-1.2), Atom feeds with Dublin Core metadata on the entries
+and OpenSearch elements for the pagination
+**/
+
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	dublinCoreNamespace = "http://purl.org/dc/terms/"
+	opdsNamespace       = "http://opds-spec.org/2010/catalog"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+
+	// feeds need an author unless every entry has one, navigation entries do not
+	catalogAuthor = "BookIT"
+)
+
+type atomFeed struct {
+	XMLName         xml.Name     `xml:"feed"`
+	Xmlns           string       `xml:"xmlns,attr"`
+	XmlnsDc         string       `xml:"xmlns:dc,attr"`
+	XmlnsOpds       string       `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string       `xml:"xmlns:opensearch,attr"`
+	Id              string       `xml:"id"`
+	Title           string       `xml:"title"`
+	Updated         string       `xml:"updated"`
+	Author          atomAuthor   `xml:"author"`
+	TotalResults    *int         `xml:"opensearch:totalResults"`
+	ItemsPerPage    *int         `xml:"opensearch:itemsPerPage"`
+	StartIndex      *int         `xml:"opensearch:startIndex"`
+	Links           []atomLink   `xml:"link"`
+	Entries         []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	XMLName xml.Name `xml:"entry"`
+	// namespaces are only set on standalone entries, entries of a feed inherit those of the feed
+	Xmlns      string       `xml:"xmlns,attr,omitempty"`
+	XmlnsDc    string       `xml:"xmlns:dc,attr,omitempty"`
+	Title      string       `xml:"title"`
+	Id         string       `xml:"id"`
+	Updated    string       `xml:"updated"`
+	Authors    []atomAuthor `xml:"author"`
+	Identifier string       `xml:"dc:identifier,omitempty"`
+	Issued     string       `xml:"dc:issued,omitempty"`
+	Extent     string       `xml:"dc:extent,omitempty"`
+	Content    *atomContent `xml:"content"`
+	Links      []atomLink   `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (catalog Catalog) writeAtomFeed(w io.Writer, feed *Feed) error {
+	updated := atomTime(feed.Updated)
+	output := atomFeed{
+		Xmlns:           atomNamespace,
+		XmlnsDc:         dublinCoreNamespace,
+		XmlnsOpds:       opdsNamespace,
+		XmlnsOpenSearch: openSearchNamespace,
+		Id:              feedId(feed.Path),
+		Title:           feed.Title,
+		Updated:         updated,
+		Author:          atomAuthor{Name: catalogAuthor},
+		Links: []atomLink{
+			{Rel: "self", Href: catalog.pageHref(feed, feed.Page.Number), Type: catalog.FeedContentType(feed.Kind)},
+			{Rel: "start", Href: catalog.Root(), Type: AtomNavigationType, Title: catalogAuthor},
+			{Rel: "search", Href: catalog.BaseUrl + "/opds/opensearch.xml", Type: OpenSearchType},
+		},
+	}
+	if feed.Up != "" {
+		output.Links = append(output.Links, atomLink{Rel: "up", Href: catalog.href(feed.Up, nil), Type: AtomNavigationType})
+	}
+
+	if feed.Page.Size > 0 {
+		startIndex := feed.Page.Offset() + 1
+		output.TotalResults = &feed.Page.Total
+		output.ItemsPerPage = &feed.Page.Size
+		output.StartIndex = &startIndex
+		for _, link := range paginationLinks(feed.Page) {
+			output.Links = append(output.Links, atomLink{Rel: link.rel, Href: catalog.pageHref(feed, link.page), Type: catalog.FeedContentType(feed.Kind)})
+		}
+	}
+
+	for _, entry := range feed.Navigation {
+		rel := "subsection"
+		if entry.New {
+			rel = relSortNew
+		}
+		content := entry.Title
+		if entry.Count > 0 {
+			content = booksCount(entry.Count)
+		}
+		output.Entries = append(output.Entries, &atomEntry{
+			Title:   entry.Title,
+			Id:      feedId(entry.Href),
+			Updated: updated,
+			Content: &atomContent{Type: "text", Value: content},
+			Links:   []atomLink{{Rel: rel, Href: catalog.href(entry.Href, nil), Type: catalog.FeedContentType(entry.Kind)}},
+		})
+	}
+	for _, book := range feed.Publications {
+		output.Entries = append(output.Entries, catalog.atomBookEntry(book, updated))
+	}
+
+	return writeXml(w, output)
+}
+
+func (catalog Catalog) writeAtomEntry(w io.Writer, book models.Book, updated time.Time) error {
+	entry := catalog.atomBookEntry(book, atomTime(updated))
+	entry.Xmlns = atomNamespace
+	entry.XmlnsDc = dublinCoreNamespace
+	return writeXml(w, entry)
+}
+
+func (catalog Catalog) atomBookEntry(book models.Book, updated string) *atomEntry {
+	entry := &atomEntry{
+		Title:   book.Title,
+		Id:      bookId(book),
+		Updated: updated,
+		Authors: []atomAuthor{{Name: book.Author}},
+		Issued:  publicationDate(book),
+		Links: []atomLink{
+			{Rel: "alternate", Href: catalog.bookHref(book), Type: AtomEntryType},
+			{Rel: relAcquisition, Href: catalog.acquisitionHref(book), Type: bookRecordType},
+		},
+	}
+	if book.Isbn != "" {
+		entry.Identifier = "urn:isbn:" + book.Isbn
+	}
+	if book.Num_Pages != nil {
+		entry.Extent = fmt.Sprintf("%d pages", *book.Num_Pages)
+	}
+	return entry
+}
+
+// WriteOpenSearch writes the OpenSearch description of the search feed, it is only used by OPDS 1.2
+func WriteOpenSearch(w io.Writer, baseUrl string) error {
+	description := struct {
+		XMLName        xml.Name `xml:"OpenSearchDescription"`
+		Xmlns          string   `xml:"xmlns,attr"`
+		ShortName      string   `xml:"ShortName"`
+		Description    string   `xml:"Description"`
+		InputEncoding  string   `xml:"InputEncoding"`
+		OutputEncoding string   `xml:"OutputEncoding"`
+		Url            struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Url"`
+	}{
+		Xmlns:          openSearchNamespace,
+		ShortName:      catalogAuthor,
+		Description:    "Search the books by title or author",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+	}
+	description.Url.Type = AtomAcquisitionType
+	description.Url.Template = baseUrl + "/opds/search?q={searchTerms}&page={startPage?}"
+	return writeXml(w, description)
+}
+
+func writeXml(w io.Writer, value any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type paginationLink struct {
+	rel  string
+	page int
+}
+
+// first, previous, next and last links of a page, the ones that would point to the page itself are left out
+func paginationLinks(page Page) []paginationLink {
+	last := page.LastPage()
+	var links []paginationLink
+	if page.Number > 1 {
+		links = append(links, paginationLink{"first", 1}, paginationLink{"previous", page.Number - 1})
+	}
+	if page.Number < last {
+		links = append(links, paginationLink{"next", page.Number + 1}, paginationLink{"last", last})
+	}
+	return links
+}
+
+func booksCount(count int) string {
+	if count == 1 {
+		return "1 book"
+	}
+	return fmt.Sprintf("%d books", count)
+}
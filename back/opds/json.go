@@ -0,0 +1,126 @@
+package opds
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+OPDS 2.0 (https://drafts.opds.io/opds-2.0), JSON feeds built on the Readium Web Publication Manifest
+**/
+
+type jsonFeed struct {
+	Metadata   jsonFeedMetadata `json:"metadata"`
+	Links      []jsonLink       `json:"links"`
+	Navigation []jsonLink       `json:"navigation,omitempty"`
+	// a pointer so that an empty acquisition feed still has its publications, a navigation feed has none
+	Publications *[]jsonPublication `json:"publications,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified"`
+	NumberOfItems *int   `json:"numberOfItems,omitempty"`
+	ItemsPerPage  *int   `json:"itemsPerPage,omitempty"`
+	CurrentPage   *int   `json:"currentPage,omitempty"`
+}
+
+type jsonLink struct {
+	Rel        string              `json:"rel,omitempty"`
+	Href       string              `json:"href"`
+	Type       string              `json:"type,omitempty"`
+	Title      string              `json:"title,omitempty"`
+	Templated  bool                `json:"templated,omitempty"`
+	Properties *jsonLinkProperties `json:"properties,omitempty"`
+}
+
+type jsonLinkProperties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+}
+
+type jsonPublicationMetadata struct {
+	Type          string `json:"@type"`
+	Identifier    string `json:"identifier"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	Published     string `json:"published,omitempty"`
+	NumberOfPages int    `json:"numberOfPages,omitempty"`
+}
+
+func (catalog Catalog) writeJsonFeed(w io.Writer, feed *Feed) error {
+	output := jsonFeed{
+		Metadata: jsonFeedMetadata{Title: feed.Title, Modified: feed.Updated.UTC().Format(time.RFC3339)},
+		Links: []jsonLink{
+			{Rel: "self", Href: catalog.pageHref(feed, feed.Page.Number), Type: JsonFeedType},
+			{Rel: "start", Href: catalog.Root(), Type: JsonFeedType, Title: catalogAuthor},
+			{Rel: "search", Href: catalog.Root() + "/search{?query}", Type: JsonFeedType, Templated: true},
+		},
+	}
+	if feed.Up != "" {
+		output.Links = append(output.Links, jsonLink{Rel: "up", Href: catalog.href(feed.Up, nil), Type: JsonFeedType})
+	}
+
+	if feed.Page.Size > 0 {
+		output.Metadata.NumberOfItems = &feed.Page.Total
+		output.Metadata.ItemsPerPage = &feed.Page.Size
+		output.Metadata.CurrentPage = &feed.Page.Number
+		for _, link := range paginationLinks(feed.Page) {
+			output.Links = append(output.Links, jsonLink{Rel: link.rel, Href: catalog.pageHref(feed, link.page), Type: JsonFeedType})
+		}
+	}
+
+	for _, entry := range feed.Navigation {
+		link := jsonLink{Href: catalog.href(entry.Href, nil), Type: JsonFeedType, Title: entry.Title}
+		if entry.New {
+			link.Rel = relSortNew
+		}
+		if entry.Count > 0 {
+			link.Properties = &jsonLinkProperties{NumberOfItems: entry.Count}
+		}
+		output.Navigation = append(output.Navigation, link)
+	}
+	if feed.Kind == Acquisition {
+		publications := make([]jsonPublication, 0, len(feed.Publications))
+		for _, book := range feed.Publications {
+			publications = append(publications, catalog.jsonBookPublication(book))
+		}
+		output.Publications = &publications
+	}
+
+	return json.NewEncoder(w).Encode(output)
+}
+
+func (catalog Catalog) writeJsonPublication(w io.Writer, book models.Book) error {
+	return json.NewEncoder(w).Encode(catalog.jsonBookPublication(book))
+}
+
+func (catalog Catalog) jsonBookPublication(book models.Book) jsonPublication {
+	publication := jsonPublication{
+		Metadata: jsonPublicationMetadata{
+			Type:       "http://schema.org/Book",
+			Identifier: bookId(book),
+			Title:      book.Title,
+			Author:     book.Author,
+			Published:  publicationDate(book),
+		},
+		Links: []jsonLink{
+			{Rel: "self", Href: catalog.bookHref(book), Type: JsonPublicationType},
+			{Rel: relAcquisition, Href: catalog.acquisitionHref(book), Type: bookRecordType},
+		},
+	}
+	if book.Isbn != "" {
+		publication.Metadata.Identifier = "urn:isbn:" + book.Isbn
+	}
+	if book.Num_Pages != nil && *book.Num_Pages > 0 {
+		publication.Metadata.NumberOfPages = *book.Num_Pages
+	}
+	return publication
+}
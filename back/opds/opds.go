@@ -0,0 +1,194 @@
+package opds
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+/**
+OPDS catalogues (https://opds.io) let e-reader apps browse the books
+Feeds are described once with Feed and rendered either as OPDS 1.2 (Atom, served under /opds)
+or as OPDS 2.0 (JSON, served under /opds/v2)
+Navigation feeds list links to other feeds, acquisition feeds list books
+**/
+
+const (
+	AtomNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AtomAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	AtomEntryType       = "application/atom+xml;type=entry;profile=opds-catalog"
+	OpenSearchType      = "application/opensearchdescription+xml"
+	JsonFeedType        = "application/opds+json"
+	JsonPublicationType = "application/opds-publication+json"
+
+	// books have no downloadable file, their acquisition link points to the JSON record of the REST API
+	bookRecordType = "application/json"
+
+	relAcquisition = "http://opds-spec.org/acquisition"
+	relSortNew     = "http://opds-spec.org/sort/new"
+)
+
+// Format is the version of OPDS a catalogue is rendered in
+type Format int
+
+const (
+	Atom Format = iota
+	Json
+)
+
+// FeedKind tells whether a feed lists other feeds or books
+type FeedKind int
+
+const (
+	Navigation FeedKind = iota
+	Acquisition
+)
+
+// Feed describes a single page of a feed, independently of its format
+// Path and the Href of navigation entries are relative to the root of the catalogue, e.g. /authors
+type Feed struct {
+	Path    string
+	Title   string
+	Kind    FeedKind
+	Updated time.Time
+	// extra query parameters kept on the pagination links, e.g. the search terms
+	Query url.Values
+	// Path of the parent feed, empty for the root
+	Up           string
+	Navigation   []NavigationEntry
+	Publications []models.Book
+	Page         Page
+}
+
+// NavigationEntry is a link to another feed of the catalogue
+type NavigationEntry struct {
+	Title string
+	Href  string
+	// kind of the linked feed
+	Kind FeedKind
+	// number of books behind the link, not shown when 0
+	Count int
+	// marks the link to the newest books so apps can highlight it
+	New bool
+}
+
+// Page is the position of a feed in a paginated list, Size 0 means the feed is not paginated
+type Page struct {
+	Number int
+	Size   int
+	Total  int
+}
+
+// LastPage is the number of the last page, there is always at least one even when the list is empty
+func (page Page) LastPage() int {
+	if page.Size == 0 || page.Total == 0 {
+		return 1
+	}
+	return (page.Total + page.Size - 1) / page.Size
+}
+
+// Offset is the number of items before the page
+func (page Page) Offset() int {
+	return (page.Number - 1) * page.Size
+}
+
+// Catalog renders feeds in one format, every link is made absolute with BaseUrl
+type Catalog struct {
+	// scheme and host the catalogue is served from, e.g. http://localhost:8046
+	BaseUrl string
+	Format  Format
+}
+
+// Root is the absolute URL of the start feed
+func (catalog Catalog) Root() string {
+	if catalog.Format == Json {
+		return catalog.BaseUrl + "/opds/v2"
+	}
+	return catalog.BaseUrl + "/opds"
+}
+
+// FeedContentType is the media type of a feed
+func (catalog Catalog) FeedContentType(kind FeedKind) string {
+	if catalog.Format == Json {
+		return JsonFeedType
+	}
+	if kind == Acquisition {
+		return AtomAcquisitionType
+	}
+	return AtomNavigationType
+}
+
+// BookContentType is the media type of a single publication
+func (catalog Catalog) BookContentType() string {
+	if catalog.Format == Json {
+		return JsonPublicationType
+	}
+	return AtomEntryType
+}
+
+// WriteFeed renders the feed
+func (catalog Catalog) WriteFeed(w io.Writer, feed *Feed) error {
+	if catalog.Format == Json {
+		return catalog.writeJsonFeed(w, feed)
+	}
+	return catalog.writeAtomFeed(w, feed)
+}
+
+// WriteBook renders the complete entry of a single book
+func (catalog Catalog) WriteBook(w io.Writer, book models.Book, updated time.Time) error {
+	if catalog.Format == Json {
+		return catalog.writeJsonPublication(w, book)
+	}
+	return catalog.writeAtomEntry(w, book, updated)
+}
+
+// absolute URL of a path of the catalogue, with its query, / is the root itself
+func (catalog Catalog) href(path string, query url.Values) string {
+	href := catalog.Root() + strings.TrimSuffix(path, "/")
+	if encoded := query.Encode(); encoded != "" {
+		href += "?" + encoded
+	}
+	return href
+}
+
+// absolute URL of a page of the feed, the first page has no page parameter
+func (catalog Catalog) pageHref(feed *Feed, number int) string {
+	query := url.Values{}
+	for key, values := range feed.Query {
+		query[key] = values
+	}
+	if number > 1 {
+		query.Set("page", strconv.Itoa(number))
+	}
+	return catalog.href(feed.Path, query)
+}
+
+func (catalog Catalog) bookHref(book models.Book) string {
+	return catalog.href(fmt.Sprintf("/books/%d", book.Book_Id), nil)
+}
+
+func (catalog Catalog) acquisitionHref(book models.Book) string {
+	return fmt.Sprintf("%s/books/%d", catalog.BaseUrl, book.Book_Id)
+}
+
+// identifiers are URNs so they do not change with the address the catalogue is served from
+func feedId(path string) string {
+	return "urn:bookit:opds" + path
+}
+
+func bookId(book models.Book) string {
+	return fmt.Sprintf("urn:bookit:book:%d", book.Book_Id)
+}
+
+// dates come back from the DB as YYYY-MM-DDT00:00:00Z, only the date is published
+func publicationDate(book models.Book) string {
+	if len(book.Pub_Date) > 10 {
+		return book.Pub_Date[:10]
+	}
+	return book.Pub_Date
+}
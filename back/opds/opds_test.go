@@ -0,0 +1,360 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var pages = 328
+
+var testBooks = []models.Book{
+	{Book_Id: 1, Title: "1984", Author: "George Orwell", Num_Pages: &pages, Pub_Date: "1949-06-08T00:00:00Z", Isbn: "9780451524935"},
+	{Book_Id: 2, Title: "Frankenstein", Author: "Mary Shelley", Pub_Date: "1818-01-01"},
+}
+
+var testUpdated = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// feeds covering every shape the server produces
+func testFeeds() map[string]*Feed {
+	return map[string]*Feed{
+		"navigation": {
+			Title: "BookIT catalogue", Kind: Navigation, Updated: testUpdated,
+			Navigation: []NavigationEntry{
+				{Title: "All books", Href: "/all", Kind: Acquisition, Count: 2},
+				{Title: "New arrivals", Href: "/new", Kind: Acquisition, New: true},
+				{Title: "By author", Href: "/authors", Kind: Navigation},
+			},
+		},
+		"paginated navigation": {
+			Path: "/authors", Title: "Books by author", Kind: Navigation, Updated: testUpdated, Up: "/",
+			Navigation: []NavigationEntry{{Title: "George Orwell", Href: "/authors/George%20Orwell", Kind: Acquisition, Count: 1}},
+			Page:       Page{Number: 1, Size: 1, Total: 2},
+		},
+		"acquisition": {
+			Path: "/search", Title: "Search results", Kind: Acquisition, Updated: testUpdated, Up: "/",
+			Query:        map[string][]string{"q": {"or"}},
+			Publications: testBooks,
+			Page:         Page{Number: 2, Size: 2, Total: 6},
+		},
+		"empty acquisition": {
+			Path: "/all", Title: "All books", Kind: Acquisition, Updated: testUpdated, Up: "/",
+			Page: Page{Number: 1, Size: 25, Total: 0},
+		},
+	}
+}
+
+// the uri-template check of the validator parses the template as a URL first, which splits form-style query
+// expansions like {?query} in two, so templates are checked against RFC 6570 expressions instead
+var uriTemplateExpression = regexp.MustCompile(`\{[+#./;?&=,!@|]?[A-Za-z0-9_.%]+(?::[1-9][0-9]{0,3}|\*)?(?:,[A-Za-z0-9_.%]+(?::[1-9][0-9]{0,3}|\*)?)*\}`)
+
+func isUriTemplate(value any) bool {
+	template, ok := value.(string)
+	if !ok {
+		return true
+	}
+	literal := uriTemplateExpression.ReplaceAllString(template, "")
+	if strings.ContainsAny(literal, "{}") {
+		return false
+	}
+	_, err := url.Parse(literal)
+	return err == nil
+}
+
+func TestJsonFeedsMatchSchema(t *testing.T) {
+	jsonschema.Formats["uri-template"] = isUriTemplate
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	feedSchema, err := compiler.Compile("testdata/opds2-feed.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicationSchema, err := compiler.Compile("testdata/opds2-feed.schema.json#/definitions/publication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := Catalog{BaseUrl: "http://localhost:8046", Format: Json}
+
+	for name, feed := range testFeeds() {
+		t.Run(name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := catalog.WriteFeed(&buffer, feed); err != nil {
+				t.Fatal(err)
+			}
+			var document any
+			if err := json.Unmarshal(buffer.Bytes(), &document); err != nil {
+				t.Fatal(err)
+			}
+			if err := feedSchema.Validate(document); err != nil {
+				t.Errorf("%#v\n%s", err, buffer.String())
+			}
+		})
+	}
+
+	for _, book := range testBooks {
+		t.Run("publication "+book.Title, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := catalog.WriteBook(&buffer, book, testUpdated); err != nil {
+				t.Fatal(err)
+			}
+			var document any
+			if err := json.Unmarshal(buffer.Bytes(), &document); err != nil {
+				t.Fatal(err)
+			}
+			if err := publicationSchema.Validate(document); err != nil {
+				t.Errorf("%#v\n%s", err, buffer.String())
+			}
+		})
+	}
+}
+
+func TestJsonFeedContent(t *testing.T) {
+	var buffer bytes.Buffer
+	catalog := Catalog{BaseUrl: "http://localhost:8046", Format: Json}
+	if err := catalog.WriteFeed(&buffer, testFeeds()["acquisition"]); err != nil {
+		t.Fatal(err)
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(buffer.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+
+	links := make(map[string]jsonLink)
+	for _, link := range feed.Links {
+		links[link.Rel] = link
+	}
+	expected := map[string]string{
+		"self":     "http://localhost:8046/opds/v2/search?page=2&q=or",
+		"up":       "http://localhost:8046/opds/v2",
+		"first":    "http://localhost:8046/opds/v2/search?q=or",
+		"previous": "http://localhost:8046/opds/v2/search?q=or",
+		"next":     "http://localhost:8046/opds/v2/search?page=3&q=or",
+		"last":     "http://localhost:8046/opds/v2/search?page=3&q=or",
+		"search":   "http://localhost:8046/opds/v2/search{?query}",
+	}
+	for rel, href := range expected {
+		if links[rel].Href != href {
+			t.Errorf("Expected %s link %s, got %s", rel, href, links[rel].Href)
+		}
+	}
+	if !links["search"].Templated {
+		t.Error("Expected the search link to be templated")
+	}
+
+	publication := (*feed.Publications)[0]
+	if publication.Metadata.Identifier != "urn:isbn:9780451524935" || publication.Metadata.Published != "1949-06-08" || publication.Metadata.NumberOfPages != 328 {
+		t.Errorf("Unexpected metadata %+v", publication.Metadata)
+	}
+	if (*feed.Publications)[1].Metadata.Identifier != "urn:bookit:book:2" {
+		t.Errorf("Expected books without ISBN to be identified by id, got %+v", (*feed.Publications)[1].Metadata)
+	}
+}
+
+// generic XML tree, used to check the Atom documents the way a validator would
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (node xmlNode) attr(name string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Local == name && attr.Name.Space == "" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (node xmlNode) children(space, local string) []xmlNode {
+	var children []xmlNode
+	for _, child := range node.Children {
+		if child.XMLName.Space == space && child.XMLName.Local == local {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+/*
+*
+No RelaxNG validator is available for Go, so the patterns of the OPDS 1.2 schema (opds.rnc) and of the
+Atom schema it extends (RFC 4287) that apply to what the server writes are checked here
+*
+*/
+func validateAtomFeed(t *testing.T, root xmlNode, kind FeedKind) {
+	t.Helper()
+	if root.XMLName.Space != atomNamespace || root.XMLName.Local != "feed" {
+		t.Fatalf("Expected an Atom feed, got %v", root.XMLName)
+	}
+	validateAtomCommon(t, "feed", root)
+
+	selfLinks := 0
+	for _, link := range root.children(atomNamespace, "link") {
+		if link.attr("rel") == "self" {
+			selfLinks++
+		}
+	}
+	if selfLinks != 1 {
+		t.Errorf("Expected a single self link, got %d", selfLinks)
+	}
+
+	feedHasAuthor := len(root.children(atomNamespace, "author")) > 0
+	for _, entry := range root.children(atomNamespace, "entry") {
+		validateAtomEntry(t, entry, kind, feedHasAuthor)
+	}
+}
+
+func validateAtomEntry(t *testing.T, entry xmlNode, kind FeedKind, feedHasAuthor bool) {
+	t.Helper()
+	validateAtomCommon(t, "entry", entry)
+	if !feedHasAuthor && len(entry.children(atomNamespace, "author")) == 0 {
+		t.Errorf("Entry %q has no author and neither has the feed", entry.children(atomNamespace, "title")[0].Text)
+	}
+
+	hasAlternate, hasAcquisition, hasCatalogLink := false, false, false
+	for _, link := range entry.children(atomNamespace, "link") {
+		rel := link.attr("rel")
+		hasAlternate = hasAlternate || rel == "alternate"
+		hasAcquisition = hasAcquisition || strings.HasPrefix(rel, relAcquisition)
+		hasCatalogLink = hasCatalogLink || strings.HasPrefix(link.attr("type"), "application/atom+xml;profile=opds-catalog")
+	}
+	if !hasAlternate && len(entry.children(atomNamespace, "content")) == 0 {
+		t.Error("Entries need either a content or an alternate link")
+	}
+	if kind == Acquisition && !hasAcquisition {
+		t.Error("Entries of an acquisition feed need an acquisition link")
+	}
+	if kind == Navigation && !hasCatalogLink {
+		t.Error("Entries of a navigation feed need a link to a catalog feed")
+	}
+	if kind == Acquisition && len(entry.children(dublinCoreNamespace, "issued")) != 1 {
+		t.Error("Expected the publication date of the book as dc:issued")
+	}
+	for _, issued := range entry.children(dublinCoreNamespace, "issued") {
+		if _, err := time.Parse("2006-01-02", issued.Text); err != nil {
+			t.Errorf("Invalid dc:issued %q", issued.Text)
+		}
+	}
+}
+
+// atom:id, atom:title and atom:updated exactly once, links with a href and a rel
+func validateAtomCommon(t *testing.T, element string, node xmlNode) {
+	t.Helper()
+	for _, required := range []string{"id", "title", "updated"} {
+		if count := len(node.children(atomNamespace, required)); count != 1 {
+			t.Errorf("Expected one atom:%s in %s, got %d", required, element, count)
+		}
+	}
+	if updated := node.children(atomNamespace, "updated"); len(updated) == 1 {
+		if _, err := time.Parse(time.RFC3339, updated[0].Text); err != nil {
+			t.Errorf("Invalid atom:updated %q", updated[0].Text)
+		}
+	}
+	for _, link := range node.children(atomNamespace, "link") {
+		if link.attr("href") == "" || link.attr("rel") == "" {
+			t.Errorf("Links need a href and a rel, got %v", link.Attrs)
+		}
+	}
+}
+
+func TestAtomFeedsMatchSchema(t *testing.T) {
+	catalog := Catalog{BaseUrl: "http://localhost:8046", Format: Atom}
+
+	for name, feed := range testFeeds() {
+		t.Run(name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := catalog.WriteFeed(&buffer, feed); err != nil {
+				t.Fatal(err)
+			}
+			var root xmlNode
+			if err := xml.Unmarshal(buffer.Bytes(), &root); err != nil {
+				t.Fatal(err)
+			}
+			validateAtomFeed(t, root, feed.Kind)
+
+			if feed.Page.Size > 0 {
+				total := root.children(openSearchNamespace, "totalResults")
+				if len(total) != 1 || strings.TrimSpace(total[0].Text) == "" {
+					t.Errorf("Expected opensearch:totalResults in a paginated feed\n%s", buffer.String())
+				}
+			}
+		})
+	}
+
+	for _, book := range testBooks {
+		t.Run("entry "+book.Title, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := catalog.WriteBook(&buffer, book, testUpdated); err != nil {
+				t.Fatal(err)
+			}
+			var root xmlNode
+			if err := xml.Unmarshal(buffer.Bytes(), &root); err != nil {
+				t.Fatal(err)
+			}
+			if root.XMLName.Space != atomNamespace || root.XMLName.Local != "entry" {
+				t.Fatalf("Expected an Atom entry, got %v", root.XMLName)
+			}
+			validateAtomEntry(t, root, Acquisition, false)
+		})
+	}
+}
+
+func TestAtomFeedContent(t *testing.T) {
+	var buffer bytes.Buffer
+	catalog := Catalog{BaseUrl: "http://localhost:8046", Format: Atom}
+	if err := catalog.WriteFeed(&buffer, testFeeds()["navigation"]); err != nil {
+		t.Fatal(err)
+	}
+	var root xmlNode
+	if err := xml.Unmarshal(buffer.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := root.children(atomNamespace, "entry")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	link := entries[1].children(atomNamespace, "link")[0]
+	if link.attr("rel") != relSortNew || link.attr("href") != "http://localhost:8046/opds/new" || link.attr("type") != AtomAcquisitionType {
+		t.Errorf("Unexpected new arrivals link %v", link.Attrs)
+	}
+	if content := entries[0].children(atomNamespace, "content")[0].Text; content != "2 books" {
+		t.Errorf("Expected the count of books as content, got %q", content)
+	}
+	for _, link := range root.children(atomNamespace, "link") {
+		if link.attr("rel") == "up" || link.attr("rel") == "next" {
+			t.Errorf("The unpaginated root feed should not have a %s link", link.attr("rel"))
+		}
+	}
+}
+
+func TestOpenSearch(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteOpenSearch(&buffer, "http://localhost:8046"); err != nil {
+		t.Fatal(err)
+	}
+	var root xmlNode
+	if err := xml.Unmarshal(buffer.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.XMLName.Space != openSearchNamespace || root.XMLName.Local != "OpenSearchDescription" {
+		t.Fatalf("Unexpected root %v", root.XMLName)
+	}
+	if len(root.children(openSearchNamespace, "ShortName")) != 1 {
+		t.Error("Expected a ShortName")
+	}
+	urls := root.children(openSearchNamespace, "Url")
+	if len(urls) != 1 || !strings.Contains(urls[0].attr("template"), "{searchTerms}") || urls[0].attr("type") != AtomAcquisitionType {
+		t.Errorf("Unexpected Url %v", urls)
+	}
+}
@@ -0,0 +1,317 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: bookit/v1/bookit.proto
+
+// gRPC API of the library, the same operations as the /books and /url REST endpoints
+// The Go code next to this file is generated with `buf generate`, see the gRPC section of the README
+
+package bookitv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// BookServiceName is the fully-qualified name of the BookService service.
+	BookServiceName = "bookit.v1.BookService"
+	// UrlServiceName is the fully-qualified name of the UrlService service.
+	UrlServiceName = "bookit.v1.UrlService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// BookServiceListBooksProcedure is the fully-qualified name of the BookService's ListBooks RPC.
+	BookServiceListBooksProcedure = "/bookit.v1.BookService/ListBooks"
+	// BookServiceGetBookProcedure is the fully-qualified name of the BookService's GetBook RPC.
+	BookServiceGetBookProcedure = "/bookit.v1.BookService/GetBook"
+	// BookServiceAddBookProcedure is the fully-qualified name of the BookService's AddBook RPC.
+	BookServiceAddBookProcedure = "/bookit.v1.BookService/AddBook"
+	// BookServiceUpdateBookProcedure is the fully-qualified name of the BookService's UpdateBook RPC.
+	BookServiceUpdateBookProcedure = "/bookit.v1.BookService/UpdateBook"
+	// BookServiceDeleteBookProcedure is the fully-qualified name of the BookService's DeleteBook RPC.
+	BookServiceDeleteBookProcedure = "/bookit.v1.BookService/DeleteBook"
+	// UrlServiceProcessUrlProcedure is the fully-qualified name of the UrlService's ProcessUrl RPC.
+	UrlServiceProcessUrlProcedure = "/bookit.v1.UrlService/ProcessUrl"
+)
+
+// These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
+var (
+	bookServiceServiceDescriptor          = v1.File_bookit_v1_bookit_proto.Services().ByName("BookService")
+	bookServiceListBooksMethodDescriptor  = bookServiceServiceDescriptor.Methods().ByName("ListBooks")
+	bookServiceGetBookMethodDescriptor    = bookServiceServiceDescriptor.Methods().ByName("GetBook")
+	bookServiceAddBookMethodDescriptor    = bookServiceServiceDescriptor.Methods().ByName("AddBook")
+	bookServiceUpdateBookMethodDescriptor = bookServiceServiceDescriptor.Methods().ByName("UpdateBook")
+	bookServiceDeleteBookMethodDescriptor = bookServiceServiceDescriptor.Methods().ByName("DeleteBook")
+	urlServiceServiceDescriptor           = v1.File_bookit_v1_bookit_proto.Services().ByName("UrlService")
+	urlServiceProcessUrlMethodDescriptor  = urlServiceServiceDescriptor.Methods().ByName("ProcessUrl")
+)
+
+// BookServiceClient is a client for the bookit.v1.BookService service.
+type BookServiceClient interface {
+	// Books matching the filter, by id, a page at a time
+	ListBooks(context.Context, *connect.Request[v1.ListBooksRequest]) (*connect.Response[v1.ListBooksResponse], error)
+	// NOT_FOUND when there is no book with the id
+	GetBook(context.Context, *connect.Request[v1.GetBookRequest]) (*connect.Response[v1.Book], error)
+	// INVALID_ARGUMENT when the book is not valid, book_id is ignored
+	AddBook(context.Context, *connect.Request[v1.AddBookRequest]) (*connect.Response[v1.Book], error)
+	// Replaces every field of the book, NOT_FOUND when there is no book with the id
+	UpdateBook(context.Context, *connect.Request[v1.UpdateBookRequest]) (*connect.Response[v1.Book], error)
+	// NOT_FOUND when there is no book with the id
+	DeleteBook(context.Context, *connect.Request[v1.DeleteBookRequest]) (*connect.Response[v1.DeleteBookResponse], error)
+}
+
+// NewBookServiceClient constructs a client for the bookit.v1.BookService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewBookServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) BookServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &bookServiceClient{
+		listBooks: connect.NewClient[v1.ListBooksRequest, v1.ListBooksResponse](
+			httpClient,
+			baseURL+BookServiceListBooksProcedure,
+			connect.WithSchema(bookServiceListBooksMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getBook: connect.NewClient[v1.GetBookRequest, v1.Book](
+			httpClient,
+			baseURL+BookServiceGetBookProcedure,
+			connect.WithSchema(bookServiceGetBookMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		addBook: connect.NewClient[v1.AddBookRequest, v1.Book](
+			httpClient,
+			baseURL+BookServiceAddBookProcedure,
+			connect.WithSchema(bookServiceAddBookMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		updateBook: connect.NewClient[v1.UpdateBookRequest, v1.Book](
+			httpClient,
+			baseURL+BookServiceUpdateBookProcedure,
+			connect.WithSchema(bookServiceUpdateBookMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		deleteBook: connect.NewClient[v1.DeleteBookRequest, v1.DeleteBookResponse](
+			httpClient,
+			baseURL+BookServiceDeleteBookProcedure,
+			connect.WithSchema(bookServiceDeleteBookMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// bookServiceClient implements BookServiceClient.
+type bookServiceClient struct {
+	listBooks  *connect.Client[v1.ListBooksRequest, v1.ListBooksResponse]
+	getBook    *connect.Client[v1.GetBookRequest, v1.Book]
+	addBook    *connect.Client[v1.AddBookRequest, v1.Book]
+	updateBook *connect.Client[v1.UpdateBookRequest, v1.Book]
+	deleteBook *connect.Client[v1.DeleteBookRequest, v1.DeleteBookResponse]
+}
+
+// ListBooks calls bookit.v1.BookService.ListBooks.
+func (c *bookServiceClient) ListBooks(ctx context.Context, req *connect.Request[v1.ListBooksRequest]) (*connect.Response[v1.ListBooksResponse], error) {
+	return c.listBooks.CallUnary(ctx, req)
+}
+
+// GetBook calls bookit.v1.BookService.GetBook.
+func (c *bookServiceClient) GetBook(ctx context.Context, req *connect.Request[v1.GetBookRequest]) (*connect.Response[v1.Book], error) {
+	return c.getBook.CallUnary(ctx, req)
+}
+
+// AddBook calls bookit.v1.BookService.AddBook.
+func (c *bookServiceClient) AddBook(ctx context.Context, req *connect.Request[v1.AddBookRequest]) (*connect.Response[v1.Book], error) {
+	return c.addBook.CallUnary(ctx, req)
+}
+
+// UpdateBook calls bookit.v1.BookService.UpdateBook.
+func (c *bookServiceClient) UpdateBook(ctx context.Context, req *connect.Request[v1.UpdateBookRequest]) (*connect.Response[v1.Book], error) {
+	return c.updateBook.CallUnary(ctx, req)
+}
+
+// DeleteBook calls bookit.v1.BookService.DeleteBook.
+func (c *bookServiceClient) DeleteBook(ctx context.Context, req *connect.Request[v1.DeleteBookRequest]) (*connect.Response[v1.DeleteBookResponse], error) {
+	return c.deleteBook.CallUnary(ctx, req)
+}
+
+// BookServiceHandler is an implementation of the bookit.v1.BookService service.
+type BookServiceHandler interface {
+	// Books matching the filter, by id, a page at a time
+	ListBooks(context.Context, *connect.Request[v1.ListBooksRequest]) (*connect.Response[v1.ListBooksResponse], error)
+	// NOT_FOUND when there is no book with the id
+	GetBook(context.Context, *connect.Request[v1.GetBookRequest]) (*connect.Response[v1.Book], error)
+	// INVALID_ARGUMENT when the book is not valid, book_id is ignored
+	AddBook(context.Context, *connect.Request[v1.AddBookRequest]) (*connect.Response[v1.Book], error)
+	// Replaces every field of the book, NOT_FOUND when there is no book with the id
+	UpdateBook(context.Context, *connect.Request[v1.UpdateBookRequest]) (*connect.Response[v1.Book], error)
+	// NOT_FOUND when there is no book with the id
+	DeleteBook(context.Context, *connect.Request[v1.DeleteBookRequest]) (*connect.Response[v1.DeleteBookResponse], error)
+}
+
+// NewBookServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewBookServiceHandler(svc BookServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	bookServiceListBooksHandler := connect.NewUnaryHandler(
+		BookServiceListBooksProcedure,
+		svc.ListBooks,
+		connect.WithSchema(bookServiceListBooksMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	bookServiceGetBookHandler := connect.NewUnaryHandler(
+		BookServiceGetBookProcedure,
+		svc.GetBook,
+		connect.WithSchema(bookServiceGetBookMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	bookServiceAddBookHandler := connect.NewUnaryHandler(
+		BookServiceAddBookProcedure,
+		svc.AddBook,
+		connect.WithSchema(bookServiceAddBookMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	bookServiceUpdateBookHandler := connect.NewUnaryHandler(
+		BookServiceUpdateBookProcedure,
+		svc.UpdateBook,
+		connect.WithSchema(bookServiceUpdateBookMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	bookServiceDeleteBookHandler := connect.NewUnaryHandler(
+		BookServiceDeleteBookProcedure,
+		svc.DeleteBook,
+		connect.WithSchema(bookServiceDeleteBookMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/bookit.v1.BookService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case BookServiceListBooksProcedure:
+			bookServiceListBooksHandler.ServeHTTP(w, r)
+		case BookServiceGetBookProcedure:
+			bookServiceGetBookHandler.ServeHTTP(w, r)
+		case BookServiceAddBookProcedure:
+			bookServiceAddBookHandler.ServeHTTP(w, r)
+		case BookServiceUpdateBookProcedure:
+			bookServiceUpdateBookHandler.ServeHTTP(w, r)
+		case BookServiceDeleteBookProcedure:
+			bookServiceDeleteBookHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedBookServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedBookServiceHandler struct{}
+
+func (UnimplementedBookServiceHandler) ListBooks(context.Context, *connect.Request[v1.ListBooksRequest]) (*connect.Response[v1.ListBooksResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.BookService.ListBooks is not implemented"))
+}
+
+func (UnimplementedBookServiceHandler) GetBook(context.Context, *connect.Request[v1.GetBookRequest]) (*connect.Response[v1.Book], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.BookService.GetBook is not implemented"))
+}
+
+func (UnimplementedBookServiceHandler) AddBook(context.Context, *connect.Request[v1.AddBookRequest]) (*connect.Response[v1.Book], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.BookService.AddBook is not implemented"))
+}
+
+func (UnimplementedBookServiceHandler) UpdateBook(context.Context, *connect.Request[v1.UpdateBookRequest]) (*connect.Response[v1.Book], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.BookService.UpdateBook is not implemented"))
+}
+
+func (UnimplementedBookServiceHandler) DeleteBook(context.Context, *connect.Request[v1.DeleteBookRequest]) (*connect.Response[v1.DeleteBookResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.BookService.DeleteBook is not implemented"))
+}
+
+// UrlServiceClient is a client for the bookit.v1.UrlService service.
+type UrlServiceClient interface {
+	// Same operations as POST /url, INVALID_ARGUMENT when the url or the operation is not valid
+	ProcessUrl(context.Context, *connect.Request[v1.ProcessUrlRequest]) (*connect.Response[v1.ProcessUrlResponse], error)
+}
+
+// NewUrlServiceClient constructs a client for the bookit.v1.UrlService service. By default, it uses
+// the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewUrlServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) UrlServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &urlServiceClient{
+		processUrl: connect.NewClient[v1.ProcessUrlRequest, v1.ProcessUrlResponse](
+			httpClient,
+			baseURL+UrlServiceProcessUrlProcedure,
+			connect.WithSchema(urlServiceProcessUrlMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// urlServiceClient implements UrlServiceClient.
+type urlServiceClient struct {
+	processUrl *connect.Client[v1.ProcessUrlRequest, v1.ProcessUrlResponse]
+}
+
+// ProcessUrl calls bookit.v1.UrlService.ProcessUrl.
+func (c *urlServiceClient) ProcessUrl(ctx context.Context, req *connect.Request[v1.ProcessUrlRequest]) (*connect.Response[v1.ProcessUrlResponse], error) {
+	return c.processUrl.CallUnary(ctx, req)
+}
+
+// UrlServiceHandler is an implementation of the bookit.v1.UrlService service.
+type UrlServiceHandler interface {
+	// Same operations as POST /url, INVALID_ARGUMENT when the url or the operation is not valid
+	ProcessUrl(context.Context, *connect.Request[v1.ProcessUrlRequest]) (*connect.Response[v1.ProcessUrlResponse], error)
+}
+
+// NewUrlServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewUrlServiceHandler(svc UrlServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	urlServiceProcessUrlHandler := connect.NewUnaryHandler(
+		UrlServiceProcessUrlProcedure,
+		svc.ProcessUrl,
+		connect.WithSchema(urlServiceProcessUrlMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/bookit.v1.UrlService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case UrlServiceProcessUrlProcedure:
+			urlServiceProcessUrlHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedUrlServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedUrlServiceHandler struct{}
+
+func (UnimplementedUrlServiceHandler) ProcessUrl(context.Context, *connect.Request[v1.ProcessUrlRequest]) (*connect.Response[v1.ProcessUrlResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bookit.v1.UrlService.ProcessUrl is not implemented"))
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+
+	"connectrpc.com/connect"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+/**
+Identity of the callers, like the REST endpoints: a call carries the token of a user (bookit user add) as "Bearer <token>"
+in its "authorization" metadata with gRPC, or its Authorization header with Connect
+A call without a token goes through anonymously but an invalid token is refused with UNAUTHENTICATED
+**/
+
+type userKey struct{}
+
+// the context with the user of the authorization value, unchanged when there is no token
+func identify(ctx context.Context, db *sql.DB, authorization string) (context.Context, error) {
+	token, found := utils.BearerToken(authorization)
+	if !found {
+		return ctx, nil
+	}
+	user, err := database.GetUserByToken(db, utils.HashToken(token))
+	if err == sql.ErrNoRows {
+		return ctx, status.Error(codes.Unauthenticated, "Invalid API token")
+	}
+	if err != nil {
+		return ctx, status.Error(codes.Internal, err.Error())
+	}
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+// userFrom returns the user identify found
+func userFrom(ctx context.Context) (models.User, bool) {
+	user, found := ctx.Value(userKey{}).(models.User)
+	return user, found
+}
+
+// identifies the callers of the gRPC server
+func identifyInterceptor(db *sql.DB) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var authorization string
+		if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+		ctx, err := identify(ctx, db, authorization)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// identifies the callers of the Connect handlers
+func identifyConnect(db *sql.DB) connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			ctx, err := identify(ctx, db, request.Header().Get("Authorization"))
+			if err != nil {
+				return nil, connectError(err)
+			}
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	bookitv1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// page size when the request does not set one
+	defaultPageSize = 25
+	// biggest page a request can ask for
+	maxPageSize = 100
+)
+
+// BookServer implements the BookService on top of the DB, validating books like the /books endpoints
+type BookServer struct {
+	bookitv1.UnimplementedBookServiceServer
+	Db *sql.DB
+}
+
+// who makes a change, for the audit log, the user of the token or anonymous without one
+// a request of the Connect mapping carries the ID of its HTTP request, gRPC requests have none
+func changeFrom(ctx context.Context) database.Change {
+	change := database.Change{Actor: "anonymous", RequestId: middleware.GetReqID(ctx)}
+	if user, found := userFrom(ctx); found {
+		change.Actor = user.Name
+	}
+	return change
+}
+
+func (server *BookServer) ListBooks(ctx context.Context, request *bookitv1.ListBooksRequest) (*bookitv1.ListBooksResponse, error) {
+	filter := database.BookFilter{Title: request.Title, Author: request.Author, FromDate: request.From, ToDate: request.To}
+	if filter.FromDate != "" && !utils.ValidateDate(filter.FromDate) {
+		return nil, status.Error(codes.InvalidArgument, "Invalid 'from' date format. Should be YYYY-MM-DD")
+	}
+	if filter.ToDate != "" && !utils.ValidateDate(filter.ToDate) {
+		return nil, status.Error(codes.InvalidArgument, "Invalid 'to' date format. Should be YYYY-MM-DD")
+	}
+	pageSize := int(request.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size should be between 1 and %d", maxPageSize)
+	}
+	// the token is the offset of the page
+	offset := 0
+	if request.PageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(request.PageToken)
+		if err != nil || offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page_token")
+		}
+	}
+
+	total, err := database.CountBooks(server.Db, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	books, err := database.ListBooks(server.Db, filter, database.OrderById, pageSize, offset)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := &bookitv1.ListBooksResponse{TotalSize: int32(total)}
+	for _, book := range books {
+		response.Books = append(response.Books, toProto(book))
+	}
+	if offset+len(books) < total {
+		response.NextPageToken = strconv.Itoa(offset + len(books))
+	}
+	return response, nil
+}
+
+func (server *BookServer) GetBook(ctx context.Context, request *bookitv1.GetBookRequest) (*bookitv1.Book, error) {
+	book, err := database.GetBook(server.Db, int(request.BookId))
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return toProto(book), nil
+}
+
+func (server *BookServer) AddBook(ctx context.Context, request *bookitv1.AddBookRequest) (*bookitv1.Book, error) {
+	book, err := fromProto(request.Book)
+	if err != nil {
+		return nil, err
+	}
+	id, err := database.AddBookAudited(server.Db, book, changeFrom(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	book.Book_Id = id
+	return toProto(book), nil
+}
+
+func (server *BookServer) UpdateBook(ctx context.Context, request *bookitv1.UpdateBookRequest) (*bookitv1.Book, error) {
+	book, err := fromProto(request.Book)
+	if err != nil {
+		return nil, err
+	}
+	book.Book_Id = int(request.Book.BookId)
+	if err := database.UpdateBookAudited(server.Db, book, changeFrom(ctx)); err != nil {
+		return nil, dbError(err)
+	}
+	return toProto(book), nil
+}
+
+func (server *BookServer) DeleteBook(ctx context.Context, request *bookitv1.DeleteBookRequest) (*bookitv1.DeleteBookResponse, error) {
+	if err := database.DeleteBookAudited(server.Db, int(request.BookId), changeFrom(ctx)); err != nil {
+		return nil, dbError(err)
+	}
+	return &bookitv1.DeleteBookResponse{}, nil
+}
+
+// NOT_FOUND for a missing book, INTERNAL otherwise
+func dbError(err error) error {
+	if err == sql.ErrNoRows {
+		return status.Error(codes.NotFound, "Book not found")
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toProto(book models.Book) *bookitv1.Book {
+	// dates come back from the DB as YYYY-MM-DDT00:00:00Z
+	date, _, _ := strings.Cut(book.Pub_Date, "T")
+	message := &bookitv1.Book{
+		BookId:  int64(book.Book_Id),
+		Title:   book.Title,
+		Author:  book.Author,
+		PubDate: date,
+		Isbn:    book.Isbn,
+	}
+	if book.Num_Pages != nil {
+		pages := int32(*book.Num_Pages)
+		message.NumPages = &pages
+	}
+	return message
+}
+
+// reads and validates a book like the REST endpoints do
+func fromProto(message *bookitv1.Book) (models.Book, error) {
+	if message == nil {
+		return models.Book{}, status.Error(codes.InvalidArgument, "Missing book")
+	}
+	book := models.Book{
+		Title:    message.Title,
+		Author:   message.Author,
+		Pub_Date: message.PubDate,
+		Isbn:     message.Isbn,
+	}
+	if message.NumPages != nil {
+		pages := int(*message.NumPages)
+		book.Num_Pages = &pages
+	}
+	if problems := utils.ValidateBook(book); len(problems) > 0 {
+		return book, status.Error(codes.InvalidArgument, strings.Join(problems, ", "))
+	}
+	book.Isbn = utils.NormalizeIsbn(book.Isbn)
+	return book, nil
+}
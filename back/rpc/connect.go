@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"connectrpc.com/connect"
+	bookitv1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	"github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1/bookitv1connect"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"google.golang.org/grpc/status"
+)
+
+/**
+The same services over plain HTTP with the Connect protocol, for clients that can't speak HTTP/2 gRPC
+Each method is a POST to /rpc/bookit.v1.BookService/GetBook and so on, with a JSON or binary protobuf body
+The handlers call the gRPC implementation, so both transports always behave the same
+**/
+
+// ConnectHandler serves the BookService and UrlService with the Connect protocol, paths start with the service name
+func ConnectHandler(db *sql.DB, rules *urlrules.Engine) http.Handler {
+	mux := http.NewServeMux()
+	interceptors := connect.WithInterceptors(identifyConnect(db))
+	mux.Handle(bookitv1connect.NewBookServiceHandler(&connectBooks{server: &BookServer{Db: db}}, interceptors))
+	mux.Handle(bookitv1connect.NewUrlServiceHandler(&connectUrls{server: &UrlServer{Rules: rules}}, interceptors))
+	return mux
+}
+
+// calls a gRPC method with the message of a Connect request
+func unary[Req, Res any](ctx context.Context, request *connect.Request[Req], method func(context.Context, *Req) (*Res, error)) (*connect.Response[Res], error) {
+	response, err := method(ctx, request.Msg)
+	if err != nil {
+		return nil, connectError(err)
+	}
+	return connect.NewResponse(response), nil
+}
+
+// the Connect error of a gRPC one, gRPC and Connect share their codes
+func connectError(err error) error {
+	if st, ok := status.FromError(err); ok {
+		return connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	}
+	return err
+}
+
+type connectBooks struct {
+	server *BookServer
+}
+
+func (books *connectBooks) ListBooks(ctx context.Context, request *connect.Request[bookitv1.ListBooksRequest]) (*connect.Response[bookitv1.ListBooksResponse], error) {
+	return unary(ctx, request, books.server.ListBooks)
+}
+
+func (books *connectBooks) GetBook(ctx context.Context, request *connect.Request[bookitv1.GetBookRequest]) (*connect.Response[bookitv1.Book], error) {
+	return unary(ctx, request, books.server.GetBook)
+}
+
+func (books *connectBooks) AddBook(ctx context.Context, request *connect.Request[bookitv1.AddBookRequest]) (*connect.Response[bookitv1.Book], error) {
+	return unary(ctx, request, books.server.AddBook)
+}
+
+func (books *connectBooks) UpdateBook(ctx context.Context, request *connect.Request[bookitv1.UpdateBookRequest]) (*connect.Response[bookitv1.Book], error) {
+	return unary(ctx, request, books.server.UpdateBook)
+}
+
+func (books *connectBooks) DeleteBook(ctx context.Context, request *connect.Request[bookitv1.DeleteBookRequest]) (*connect.Response[bookitv1.DeleteBookResponse], error) {
+	return unary(ctx, request, books.server.DeleteBook)
+}
+
+type connectUrls struct {
+	server *UrlServer
+}
+
+func (urls *connectUrls) ProcessUrl(ctx context.Context, request *connect.Request[bookitv1.ProcessUrlRequest]) (*connect.Response[bookitv1.ProcessUrlResponse], error) {
+	return unary(ctx, request, urls.server.ProcessUrl)
+}
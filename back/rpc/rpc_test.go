@@ -0,0 +1,316 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	bookitv1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupMockDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory DB
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS Books (
+    book_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    author TEXT NOT NULL,
+    num_pages INTEGER,
+    pub_date DATE NOT NULL
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	pages := 328
+	_, err = database.AddBooks(db, []models.Book{
+		{Title: "1984", Author: "George Orwell", Num_Pages: &pages, Pub_Date: "1949-06-08", Isbn: "9780451524935"},
+		{Title: "Animal Farm", Author: "George Orwell", Pub_Date: "1945-08-17"},
+		{Title: "Pride and Prejudice", Author: "Jane Austen", Pub_Date: "1813-01-28"},
+		{Title: "Frankenstein", Author: "Mary Shelley", Pub_Date: "1818-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// starts the server on an in-memory listener and returns a connection to it
+func dialServer(t *testing.T, db *sql.DB) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(db, urlrules.Default())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Errorf("expected %v, got %v", code, err)
+	}
+}
+
+func TestBookService(t *testing.T) {
+	client := bookitv1.NewBookServiceClient(dialServer(t, setupMockDB(t)))
+	ctx := context.Background()
+
+	t.Run("Testing a list of books a page at a time", func(t *testing.T) {
+		var titles []string
+		request := &bookitv1.ListBooksRequest{Author: "orwell", PageSize: 1}
+		for pages := 0; pages < 5; pages++ {
+			response, err := client.ListBooks(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.TotalSize != 2 {
+				t.Errorf("expected 2 books in total, got %d", response.TotalSize)
+			}
+			for _, book := range response.Books {
+				titles = append(titles, book.Title)
+			}
+			if response.NextPageToken == "" {
+				break
+			}
+			request.PageToken = response.NextPageToken
+		}
+		if strings.Join(titles, ",") != "1984,Animal Farm" {
+			t.Errorf("unexpected books %v", titles)
+		}
+
+		_, err := client.ListBooks(ctx, &bookitv1.ListBooksRequest{PageSize: 1000})
+		expectCode(t, err, codes.InvalidArgument)
+		_, err = client.ListBooks(ctx, &bookitv1.ListBooksRequest{PageToken: "abc"})
+		expectCode(t, err, codes.InvalidArgument)
+		_, err = client.ListBooks(ctx, &bookitv1.ListBooksRequest{From: "1949"})
+		expectCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("Testing adding, reading, updating and deleting a book", func(t *testing.T) {
+		pages := int32(479)
+		added, err := client.AddBook(ctx, &bookitv1.AddBookRequest{Book: &bookitv1.Book{
+			Title: "The Last Man", Author: "Mary Shelley", PubDate: "1826-01-01", NumPages: &pages, Isbn: "0-306-40615-2",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added.BookId == 0 || added.Isbn != "0306406152" {
+			t.Errorf("unexpected added book %v", added)
+		}
+
+		book, err := client.GetBook(ctx, &bookitv1.GetBookRequest{BookId: added.BookId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if book.PubDate != "1826-01-01" || book.NumPages == nil || *book.NumPages != 479 {
+			t.Errorf("unexpected book %v", book)
+		}
+
+		updated, err := client.UpdateBook(ctx, &bookitv1.UpdateBookRequest{Book: &bookitv1.Book{
+			BookId: added.BookId, Title: "The Last Man", Author: "Mary Shelley", PubDate: "1826-02-01",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.PubDate != "1826-02-01" || updated.NumPages != nil {
+			t.Errorf("unexpected updated book %v", updated)
+		}
+
+		if _, err := client.DeleteBook(ctx, &bookitv1.DeleteBookRequest{BookId: added.BookId}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.GetBook(ctx, &bookitv1.GetBookRequest{BookId: added.BookId})
+		expectCode(t, err, codes.NotFound)
+	})
+
+	t.Run("Testing error codes", func(t *testing.T) {
+		_, err := client.AddBook(ctx, &bookitv1.AddBookRequest{})
+		expectCode(t, err, codes.InvalidArgument)
+		_, err = client.AddBook(ctx, &bookitv1.AddBookRequest{Book: &bookitv1.Book{Title: "a", Author: "b", PubDate: "2000"}})
+		expectCode(t, err, codes.InvalidArgument)
+		_, err = client.UpdateBook(ctx, &bookitv1.UpdateBookRequest{Book: &bookitv1.Book{BookId: 1000, Title: "a", Author: "b", PubDate: "2000-01-01"}})
+		expectCode(t, err, codes.NotFound)
+		_, err = client.DeleteBook(ctx, &bookitv1.DeleteBookRequest{BookId: 1000})
+		expectCode(t, err, codes.NotFound)
+	})
+}
+
+func TestUrlService(t *testing.T) {
+	client := bookitv1.NewUrlServiceClient(dialServer(t, setupMockDB(t)))
+	ctx := context.Background()
+
+	response, err := client.ProcessUrl(ctx, &bookitv1.ProcessUrlRequest{Url: "https://BYFOOD.com/food-EXPeriences?query=abc/", Operation: "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ProcessedUrl != "https://www.byfood.com/food-EXPeriences" {
+		t.Errorf("unexpected url %s", response.ProcessedUrl)
+	}
+	_, err = client.ProcessUrl(ctx, &bookitv1.ProcessUrlRequest{Url: "ftp://byfood.com", Operation: "all"})
+	expectCode(t, err, codes.InvalidArgument)
+	_, err = client.ProcessUrl(ctx, &bookitv1.ProcessUrlRequest{Url: "https://byfood.com", Operation: "nothing"})
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn := dialServer(t, setupMockDB(t))
+	ctx := context.Background()
+
+	health := healthpb.NewHealthClient(conn)
+	for _, service := range []string{"", "bookit.v1.BookService", "bookit.v1.UrlService"} {
+		response, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || response.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expected %q to be serving, got %v %v", service, response, err)
+		}
+	}
+	_, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "nothing"})
+	expectCode(t, err, codes.NotFound)
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := map[string]bool{}
+	for _, service := range response.GetListServicesResponse().Service {
+		services[service.Name] = true
+	}
+	for _, name := range []string{"bookit.v1.BookService", "bookit.v1.UrlService", "grpc.health.v1.Health"} {
+		if !services[name] {
+			t.Errorf("expected %s to be listed, got %v", name, services)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	handler := ConnectHandler(setupMockDB(t), urlrules.Default())
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("/bookit.v1.BookService/GetBook", `{"bookId": 4}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"title":"Frankenstein"`) {
+		t.Errorf("unexpected response %v %s", rr.Code, rr.Body.String())
+	}
+	rr = post("/bookit.v1.BookService/GetBook", `{"bookId": 1000}`)
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), `"code":"not_found"`) {
+		t.Errorf("unexpected response %v %s", rr.Code, rr.Body.String())
+	}
+	rr = post("/bookit.v1.UrlService/ProcessUrl", `{"url": "https://byfood.com/a/", "operation": "canonical"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"processedUrl":"https://byfood.com/a"`) {
+		t.Errorf("unexpected response %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestActor(t *testing.T) {
+	db := setupMockDB(t)
+	if _, err := database.AddUser(db, models.User{Name: "rpc-staff", Role: models.RoleStaff, CreatedAt: time.Now()}, utils.HashToken("rpc-staff-token")); err != nil {
+		t.Fatal(err)
+	}
+	// the actor of the last change of the book
+	actor := func(id int64) string {
+		entries, err := database.GetAuditLog(db, database.AuditFilter{BookId: int(id)}, 1, 0)
+		if err != nil || len(entries) == 0 {
+			t.Fatalf("expected an audit entry, got %v %v", entries, err)
+		}
+		return entries[0].Actor
+	}
+	book := &bookitv1.Book{Title: "The Last Man", Author: "Mary Shelley", PubDate: "1826-01-01"}
+
+	t.Run("Testing the token of a gRPC call", func(t *testing.T) {
+		client := bookitv1.NewBookServiceClient(dialServer(t, db))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer rpc-staff-token")
+		added, err := client.AddBook(ctx, &bookitv1.AddBookRequest{Book: book})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := actor(added.BookId); name != "rpc-staff" {
+			t.Errorf("expected the change to be made by rpc-staff, got %s", name)
+		}
+		added, err = client.AddBook(context.Background(), &bookitv1.AddBookRequest{Book: book})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := actor(added.BookId); name != "anonymous" {
+			t.Errorf("expected an anonymous change, got %s", name)
+		}
+		ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+		_, err = client.AddBook(ctx, &bookitv1.AddBookRequest{Book: book})
+		expectCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("Testing the token of a Connect call", func(t *testing.T) {
+		handler := ConnectHandler(db, urlrules.Default())
+		post := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/bookit.v1.BookService/AddBook", strings.NewReader(`{"book": {"title": "Mathilda", "author": "Mary Shelley", "pubDate": "1959-01-01"}}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+		rr := post("rpc-staff-token")
+		var added struct {
+			BookId string `json:"bookId"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &added); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("unexpected response %v %s", rr.Code, rr.Body.String())
+		}
+		id, _ := strconv.ParseInt(added.BookId, 10, 64)
+		if name := actor(id); name != "rpc-staff" {
+			t.Errorf("expected the change to be made by rpc-staff, got %s", name)
+		}
+		if rr := post("nope"); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), `"code":"unauthenticated"`) {
+			t.Errorf("unexpected response %v %s", rr.Code, rr.Body.String())
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+
+	bookitv1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+/**
+gRPC server of the library, the BookService and UrlService share the DB interface and the validation of the REST endpoints
+The standard health service reports every service as serving, and reflection lets grpcurl and similar tools
+list the services without the .proto file
+**/
+
+// NewServer registers the services of the library, health checks and reflection on a new gRPC server
+func NewServer(db *sql.DB, rules *urlrules.Engine) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(identifyInterceptor(db)))
+	bookitv1.RegisterBookServiceServer(server, &BookServer{Db: db})
+	bookitv1.RegisterUrlServiceServer(server, &UrlServer{Rules: rules})
+
+	healthServer := health.NewServer()
+	for name := range server.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	// the empty name is the health of the whole server
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+// Serve runs the gRPC server on the port, it returns when the server stops
+func Serve(port uint16, db *sql.DB, rules *urlrules.Engine) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Serving gRPC on port", port)
+	if err := NewServer(db, rules).Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
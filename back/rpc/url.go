@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	bookitv1 "github.com/mimminou/BookIT-ByFood/back/proto/bookit/v1"
+	"github.com/mimminou/BookIT-ByFood/back/urlcleaner"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UrlServer implements the UrlService with the operations of POST /url
+type UrlServer struct {
+	bookitv1.UnimplementedUrlServiceServer
+	Rules *urlrules.Engine
+}
+
+func (server *UrlServer) ProcessUrl(ctx context.Context, request *bookitv1.ProcessUrlRequest) (*bookitv1.ProcessUrlResponse, error) {
+	response, err := urlcleaner.Process(ctx, server.Rules, models.RequestStruct{Url: request.Url, Operation: request.Operation})
+	switch urlcleaner.FailureOf(err) {
+	case urlcleaner.Unreachable:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case urlcleaner.InvalidInput:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &bookitv1.ProcessUrlResponse{ProcessedUrl: response.ProcessedUrl}, nil
+}
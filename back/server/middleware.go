@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
 	"log"
 	"net/http"
 	"os"
@@ -20,6 +21,15 @@ func Cors(next http.Handler) http.Handler {
 	})
 }
 
+// RequestId gives the request an ID, the one of its X-Request-Id header when it has one, and sends it back in the same header
+// the changes made by the request are recorded in the audit log with it
+func RequestId(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
+
 // Logging Middlware, writes requests to console
 // write to in.log
 func Logging(next http.Handler) http.Handler {
@@ -78,3 +88,8 @@ func (resp *myResponseWriter) WriteHeader(code int) {
 	resp.statusCode = code
 	resp.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the writer underneath, to flush the streams of GET /events
+func (resp *myResponseWriter) Unwrap() http.ResponseWriter {
+	return resp.ResponseWriter
+}
@@ -5,30 +5,80 @@ import (
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
 	"github.com/mimminou/BookIT-ByFood/back/controllers"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	"github.com/mimminou/BookIT-ByFood/back/epub"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	"github.com/mimminou/BookIT-ByFood/back/services"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
 	"log"
 	"net/http"
 )
 
+// Options of the server, what its controllers are made of besides the DB
+type Options struct {
+	Port uint16
+	// rules of the URL cleaner
+	Rules *urlrules.Engine
+	// limits of POST /url/batch
+	UrlBatch   services.BatchLimits
+	ShortLinks services.ShortLinkOptions
+	Backups    backup.Options
+	// live stream of the changes of GET /events
+	Feed *events.Broker
+	// where the files of the books are kept
+	Files  storage.Storage
+	Covers covers.Options
+	Epubs  epub.Options
+	// catalogue the books are filled out of
+	Catalogue enrich.Provider
+}
+
 // serve
-func Serve(port uint16, db *sql.DB) {
+func Serve(db *sql.DB, options Options) {
 	serverMux := chi.NewRouter()
 
 	serverMux.Use(middleware.StripSlashes)
+	serverMux.Use(RequestId)
 	serverMux.Use(middleware.Logger)
 	serverMux.Use(Cors)
 
 	//Mount Books Controller
-	serverMux.Mount("/books", controllers.BookController(db))
+	serverMux.Mount("/books", controllers.BookController(db, controllers.BookOptions{Files: options.Files, Covers: options.Covers, Epubs: options.Epubs, Catalogue: options.Catalogue}))
+
+	//Mount OPDS Controller
+	serverMux.Mount("/opds", controllers.OpdsController(db))
+
+	//Mount GraphQL Controller
+	serverMux.Mount("/graphql", controllers.GraphqlController(db))
 
-	//Mount Docs Controller
+	//Mount the HTTP mapping of the gRPC services
+	serverMux.Mount("/rpc", controllers.RpcController(db, options.Rules))
+
+	//Mount Docs Controller, and GraphiQL next to it
 	serverMux.Mount("/docs", controllers.DocsController())
+	serverMux.Get("/graphiql", services.ServeGraphiql)
 
 	//Mount UrlCleaner Controller
-	serverMux.Mount("/url", controllers.UrlCleanerController())
+	serverMux.Mount("/url", controllers.UrlCleanerController(options.Rules, options.UrlBatch))
+
+	//Mount the short links, and their redirects
+	serverMux.Mount("/links", controllers.ShortLinkController(db, options.Rules, options.ShortLinks))
+	serverMux.Mount("/l", controllers.ShortLinkRedirectController(db))
+
+	//Mount the maintenance operations of the admins
+	serverMux.Mount("/admin", controllers.AdminController(db, options.Backups, options.Files))
+	serverMux.Mount("/audit", controllers.AuditController(db))
+	serverMux.Mount("/webhooks", controllers.WebhookController(db))
+
+	//Mount the live stream of the changes
+	serverMux.Mount("/events", controllers.EventsController(options.Feed))
 
-	fmt.Println("Serving on port", port)
-	err := http.ListenAndServe(fmt.Sprintf(":%d", port), serverMux)
+	fmt.Println("Serving on port", options.Port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", options.Port), serverMux)
 	if err != nil {
 		log.Fatal(err)
 	}
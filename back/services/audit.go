@@ -0,0 +1,230 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// actor of the changes made without a token
+const anonymous = "anonymous"
+
+var auditOperations = []string{AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditRevert}
+
+// default and maximum number of entries of a page of GET /audit, and of the other logs
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// changeFrom is who makes the change of the request, for the audit log
+func changeFrom(r *http.Request) database.Change {
+	change := database.Change{Actor: anonymous, RequestId: middleware.GetReqID(r.Context())}
+	if user, found := UserFrom(r.Context()); found {
+		change.Actor = user.Name
+	}
+	return change
+}
+
+// AuditHandler serves the audit log of the books, and reverts them to the versions it recorded
+type AuditHandler struct {
+	Db *sql.DB
+}
+
+// @Description	Version of the book to revert to
+type RevertRequest struct {
+	// @Property		audit_id int true "Entry of the history of the book, the book is put back as that change left it"
+	Audit_Id int `json:"audit_id"`
+}
+
+// History of a book
+
+// @Summary		History of a book
+// @Description	Lists the changes made to a book, the most recent first, with the book before and after each one and the fields that changed
+// @Tags			books
+// @Produce		json
+// @Param			id		path	int	true	"Book ID"
+// @Param			limit	query	int	false	"Number of entries, 100 by default, 1000 at most"
+// @Param			offset	query	int	false	"Number of entries to skip"
+// @Success		200 {array}	AuditEntry
+// @Failure		400 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/history [get]
+func (handler *AuditHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid book ID"})
+		w.Write(jsonResponse)
+		return
+	}
+	handler.serveEntries(w, r, database.AuditFilter{BookId: id})
+}
+
+// Audit log
+
+// @Summary		Audit log
+// @Description	Lists the changes made to the books, the most recent first, for admins
+// @Tags			admin
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			book_id		query	int		false	"Changes of this book"
+// @Param			actor			query	string	false	"Changes made by this user, anonymous for the changes made without a token"
+// @Param			operation		query	string	false	"create, update, delete, restore or revert"
+// @Param			from			query	string	false	"Changes made at or after this time, RFC 3339 or YYYY-MM-DD"
+// @Param			to				query	string	false	"Changes made at or before this time, RFC 3339 or YYYY-MM-DD (the whole day)"
+// @Param			limit			query	int		false	"Number of entries, 100 by default, 1000 at most"
+// @Param			offset			query	int		false	"Number of entries to skip"
+// @Success		200 {array}	AuditEntry
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/audit [get]
+func (handler *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.AuditFilter{Actor: query.Get("actor"), Operation: query.Get("operation")}
+	var problems []error
+	if value := query.Get("book_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			problems = append(problems, errors.New("book_id must be a book ID"))
+		}
+		filter.BookId = id
+	}
+	if filter.Operation != "" && !slices.Contains(auditOperations, filter.Operation) {
+		problems = append(problems, errors.New("operation must be one of create, update, delete, restore or revert"))
+	}
+	if value := query.Get("from"); value != "" {
+		since, _, err := parseAuditTime(value)
+		if err != nil {
+			problems = append(problems, errors.New("from must be an RFC 3339 time or a YYYY-MM-DD date"))
+		}
+		filter.Since = since
+	}
+	if value := query.Get("to"); value != "" {
+		until, isDate, err := parseAuditTime(value)
+		if err != nil {
+			problems = append(problems, errors.New("to must be an RFC 3339 time or a YYYY-MM-DD date"))
+		}
+		// inclusive, up to the end of the day for a date, times are kept to the second
+		if isDate {
+			filter.Until = until.AddDate(0, 0, 1)
+		} else {
+			filter.Until = until.Add(time.Second)
+		}
+	}
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: errors.Join(problems...).Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	handler.serveEntries(w, r, filter)
+}
+
+// an RFC 3339 time, or a date in UTC
+func parseAuditTime(value string) (time.Time, bool, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, false, nil
+	}
+	at, err := time.Parse(time.DateOnly, value)
+	return at, true, err
+}
+
+// answers a page of the entries matching the filter, the page is given by the limit and offset query parameters
+func (handler *AuditHandler) serveEntries(w http.ResponseWriter, r *http.Request, filter database.AuditFilter) {
+	limit, offset, err := pageOf(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	entries, err := database.GetAuditLog(handler.Db, filter, limit, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(entries)
+	w.Write(jsonResponse)
+}
+
+// the page given by the limit and offset query parameters, for the logs
+func pageOf(r *http.Request) (limit, offset int, err error) {
+	limit = defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			return 0, 0, errors.New("limit must be from 1 to " + strconv.Itoa(maxAuditLimit))
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// Revert a book
+
+// @Summary		Revert a book
+// @Description	Puts the book back as a change of its history left it, out of the trash if it was deleted since. The revert is itself recorded in the history
+// @Tags			books
+// @Accept			json
+// @Produce		json
+// @Param			id				path	int				true	"Book ID"
+// @Param			RevertRequest	body	RevertRequest	true	"Version to revert to"
+// @Success		200 {object}	Book
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage	"The entry is not in the history of the book, or the book was purged"
+// @Failure		409 {object}	ErrMessage	"The change deleted the book, there is no version to revert to"
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/revert [post]
+func (handler *AuditHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid book ID"})
+		w.Write(jsonResponse)
+		return
+	}
+	var request RevertRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Audit_Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Expected {\"audit_id\": int}, an entry of the history of the book"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	book, err := database.RevertBook(handler.Db, id, request.Audit_Id, changeFrom(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case err == sql.ErrNoRows:
+			status = http.StatusNotFound
+		case errors.Is(err, database.ErrNoVersion):
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(book)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestAudit(t *testing.T) {
+	for name, role := range map[string]string{"audit-admin": RoleAdmin, "audit-staff": RoleStaff} {
+		if _, err := database.AddUser(db, User{Name: name, Role: role, CreatedAt: time.Now()}, utils.HashToken(name+"-token")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	books := &DBRequestHandler{Db: db}
+	handler := &AuditHandler{Db: db}
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Route("/books", func(router chi.Router) {
+		router.Use(IdentifyUser(db))
+		router.Post("/", books.Add)
+		router.Put("/{id}", books.Update)
+		router.Get("/{id}/history", handler.History)
+		router.Post("/{id}/revert", handler.Revert)
+	})
+	router.With(RequireRole(db, RoleAdmin)).Get("/audit", handler.List)
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(middleware.RequestIDHeader, "request-"+method)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var book Book
+	rr := serve("POST", "/books/", "audit-staff-token", `{"title": "Walden", "author": "Henry David Thoreau", "pub_date": "1854-08-09"}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &book); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("expected a new book, got %v %s", rr.Code, rr.Body.String())
+	}
+	// the other tests expect the books of the mock DB only
+	t.Cleanup(func() { db.Exec("DELETE FROM Books WHERE book_id = ?", book.Book_Id) })
+	path := "/books/" + strconv.Itoa(book.Book_Id)
+
+	t.Run("Testing the actor and the request of the changes", func(t *testing.T) {
+		if rr := serve("PUT", path, "", `{"title": "Walden; or, Life in the Woods", "author": "Henry David Thoreau", "pub_date": "1854-08-09"}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected the update, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("PUT", path, "nope", `{"title": "x", "author": "y", "pub_date": "2000-01-01"}`); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %v for an invalid token, got %v", http.StatusUnauthorized, rr.Code)
+		}
+
+		rr := serve("GET", path+"/history", "", "")
+		var entries []AuditEntry
+		if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil || len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %v %s", rr.Code, rr.Body.String())
+		}
+		if entries[0].Operation != AuditUpdate || entries[0].Actor != anonymous || entries[0].RequestId != "request-PUT" {
+			t.Errorf("expected an anonymous update, got %+v", entries[0])
+		}
+		if entries[1].Operation != AuditCreate || entries[1].Actor != "audit-staff" || entries[1].RequestId != "request-POST" {
+			t.Errorf("expected a create by audit-staff, got %+v", entries[1])
+		}
+		t.Log(rr.Body.String())
+	})
+
+	t.Run("Testing GET /audit", func(t *testing.T) {
+		if rr := serve("GET", "/audit", "audit-staff-token", ""); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %v, got %v", http.StatusForbidden, rr.Code)
+		}
+		today := time.Now().UTC().Format(time.DateOnly)
+		rr := serve("GET", "/audit?actor=audit-staff&operation=create&from="+today+"&to="+today, "audit-admin-token", "")
+		var entries []AuditEntry
+		if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Book_Id != book.Book_Id {
+			t.Errorf("expected the create of audit-staff, got %v %s", rr.Code, rr.Body.String())
+		}
+		for _, query := range []string{"operation=rename", "from=yesterday", "book_id=-1", "limit=0", "offset=-1"} {
+			if rr := serve("GET", "/audit?"+query, "audit-admin-token", ""); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %v, got %v", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Testing POST /books/{id}/revert", func(t *testing.T) {
+		entries, _ := database.GetAuditLog(db, database.AuditFilter{BookId: book.Book_Id, Operation: AuditCreate}, 1, 0)
+		rr := serve("POST", path+"/revert", "audit-admin-token", `{"audit_id": `+strconv.Itoa(entries[0].Audit_Id)+`}`)
+		var reverted Book
+		if json.Unmarshal(rr.Body.Bytes(), &reverted); rr.Code != http.StatusOK || reverted.Title != "Walden" {
+			t.Errorf("expected the first title back, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("POST", path+"/revert", "", `{"audit_id": 999999}`); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v for an unknown entry, got %v", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve("POST", path+"/revert", "", `{}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v without an entry, got %v", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
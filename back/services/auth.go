@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+/**
+Authentication of the API users, a request carries the token of a user (bookit user add) as "Authorization: Bearer <token>"
+**/
+
+type userKey struct{}
+
+// RequireRole only lets through the requests of users with one of the roles, the user is then available to the handlers with UserFrom
+func RequireRole(db *sql.DB, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, found := bearerToken(r); !found {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bookit"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				jsonResponse, _ := json.Marshal(ErrMessage{Msg: "An API token is required"})
+				w.Write(jsonResponse)
+				return
+			}
+			user, ok := authenticate(db, w, r)
+			if !ok {
+				return
+			}
+			if !slices.Contains(roles, user.Role) {
+				w.WriteHeader(http.StatusForbidden)
+				jsonResponse, _ := json.Marshal(ErrMessage{Msg: "This needs the " + strings.Join(roles, " or ") + " role"})
+				w.Write(jsonResponse)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+		})
+	}
+}
+
+// IdentifyUser makes the user of the token available to the handlers with UserFrom, for the endpoints open to everyone
+// that still record who used them, a request without a token goes through anonymously but an invalid token is refused
+func IdentifyUser(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, found := bearerToken(r); !found {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, ok := authenticate(db, w, r)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return utils.BearerToken(r.Header.Get("Authorization"))
+}
+
+// looks the user of the token up, answers the request when it can't be
+func authenticate(db *sql.DB, w http.ResponseWriter, r *http.Request) (User, bool) {
+	token, _ := bearerToken(r)
+	user, err := database.GetUserByToken(db, utils.HashToken(token))
+	if err == sql.ErrNoRows {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bookit", error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid API token"})
+		w.Write(jsonResponse)
+		return user, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return user, false
+	}
+	return user, true
+}
+
+// UserFrom returns the user RequireRole or IdentifyUser let through
+func UserFrom(ctx context.Context) (User, bool) {
+	user, found := ctx.Value(userKey{}).(User)
+	return user, found
+}
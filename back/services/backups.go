@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
+	"net/http"
+	"path/filepath"
+)
+
+// BackupHandler makes and serves the backups of the DB, for admins
+type BackupHandler struct {
+	Db      *sql.DB
+	Options backup.Options
+}
+
+// Create a backup
+
+// @Summary		Create a backup
+// @Description	Writes a consistent copy of the DB to the backup directory, compressed and checksummed like the scheduled backups, then removes the backups over the retention
+// @Tags			admin
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Success		201 {object}	backup.Info
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/admin/backups [post]
+func (handler *BackupHandler) Create(w http.ResponseWriter, r *http.Request) {
+	info, err := backup.Create(handler.Db, handler.Options)
+	if err != nil && info.Name == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	// the backup is made even when the old ones could not be pruned
+	w.WriteHeader(http.StatusCreated)
+	jsonResponse, _ := json.Marshal(info)
+	w.Write(jsonResponse)
+}
+
+// List the backups
+
+// @Summary		List the backups
+// @Description	Lists the backups of the backup directory, the newest first
+// @Tags			admin
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Success		200 {array}	backup.Info
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/admin/backups [get]
+func (handler *BackupHandler) List(w http.ResponseWriter, r *http.Request) {
+	backups, err := backup.List(handler.Options.Dir)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(backups)
+	w.Write(jsonResponse)
+}
+
+// Download a backup
+
+// @Summary		Download a backup
+// @Description	Sends the file of a backup, its checksum is in the listing
+// @Tags			admin
+// @Produce		application/octet-stream
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			name	path	string	true	"File name of the backup"
+// @Success		200
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Router			/admin/backups/{name} [get]
+func (handler *BackupHandler) Download(w http.ResponseWriter, r *http.Request) {
+	path, err := backup.Find(handler.Options.Dir, chi.URLParam(r, "name"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, backup.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+	http.ServeFile(w, r, path)
+}
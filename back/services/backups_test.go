@@ -0,0 +1,74 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/backup"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBackups(t *testing.T) {
+	for name, role := range map[string]string{"backup-admin": RoleAdmin, "backup-staff": RoleStaff} {
+		if _, err := database.AddUser(db, User{Name: name, Role: role, CreatedAt: time.Now()}, utils.HashToken(name+"-token")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := &BackupHandler{Db: db, Options: backup.Options{Dir: t.TempDir(), Keep: 2, Compression: "gzip"}}
+	router := chi.NewRouter()
+	router.Use(RequireRole(db, RoleAdmin))
+	router.Post("/admin/backups", handler.Create)
+	router.Get("/admin/backups", handler.List)
+	router.Get("/admin/backups/{name}", handler.Download)
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Testing the authentication", func(t *testing.T) {
+		for token, status := range map[string]int{"": http.StatusUnauthorized, "nope": http.StatusUnauthorized, "backup-staff-token": http.StatusForbidden} {
+			if rr := serve("GET", "/admin/backups", token); rr.Code != status {
+				t.Errorf("%q: expected status code %v, got %v %s", token, status, rr.Code, rr.Body.String())
+			}
+		}
+		if rr := serve("GET", "/admin/backups", ""); rr.Header().Get("WWW-Authenticate") == "" {
+			t.Error("expected a WWW-Authenticate header")
+		}
+	})
+
+	t.Run("Testing POST /admin/backups then GET /admin/backups", func(t *testing.T) {
+		rr := serve("POST", "/admin/backups", "backup-admin-token")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %v, got %v %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var created backup.Info
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		t.Log(created)
+
+		rr = serve("GET", "/admin/backups", "backup-admin-token")
+		var backups []backup.Info
+		json.Unmarshal(rr.Body.Bytes(), &backups)
+		if rr.Code != http.StatusOK || len(backups) != 1 || backups[0] != created {
+			t.Errorf("expected %+v, got %v %s", created, rr.Code, rr.Body.String())
+		}
+
+		rr = serve("GET", "/admin/backups/"+created.Name, "backup-admin-token")
+		if rr.Code != http.StatusOK || int64(rr.Body.Len()) != created.Size {
+			t.Errorf("expected %d bytes, got %v %d", created.Size, rr.Code, rr.Body.Len())
+		}
+		if rr := serve("GET", "/admin/backups/..%2Fbackups.go", "backup-admin-token"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+}
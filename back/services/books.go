@@ -3,6 +3,7 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"github.com/mimminou/BookIT-ByFood/back/database"
 	"github.com/mimminou/BookIT-ByFood/back/models"
 	"github.com/mimminou/BookIT-ByFood/back/utils"
@@ -29,11 +30,16 @@ type ErrMessage struct {
 // Get all books
 
 // @Summary		Get all books
-// @Description	Get all books in the DB
+// @Description	Get all books in the DB, optionally filtered
 // @Tags			books
 // @Accept			json
 // @Produce		json
+// @Param			title	query	string	false	"Title contains"
+// @Param			author	query	string	false	"Author contains"
+// @Param			from	query	string	false	"Published on or after (YYYY-MM-DD)"
+// @Param			to		query	string	false	"Published on or before (YYYY-MM-DD)"
 // @Success		200	{array}	models.Book
+// @Failure		400	{object}	ErrMessage
 // @Failure		500
 // @Failure		500	{object}	ErrMessage
 // @Failure		404	{object}	ErrMessage
@@ -45,7 +51,14 @@ func (handler *DBRequestHandler) GetAll(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	books, err := database.GetBooks(handler.Db)
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	books, err := database.GetBooksFiltered(handler.Db, filter)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
@@ -62,6 +75,24 @@ func (handler *DBRequestHandler) GetAll(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(books)
 }
 
+// reads the filters supported by GetAll from the query string
+func parseBookFilter(r *http.Request) (database.BookFilter, error) {
+	query := r.URL.Query()
+	filter := database.BookFilter{
+		Title:    query.Get("title"),
+		Author:   query.Get("author"),
+		FromDate: query.Get("from"),
+		ToDate:   query.Get("to"),
+	}
+	if filter.FromDate != "" && !utils.ValidateDate(filter.FromDate) {
+		return filter, errors.New("Invalid 'from' date format. Should be YYYY-MM-DD")
+	}
+	if filter.ToDate != "" && !utils.ValidateDate(filter.ToDate) {
+		return filter, errors.New("Invalid 'to' date format. Should be YYYY-MM-DD")
+	}
+	return filter, nil
+}
+
 // Get a single Book
 
 // @Summary		Get a single Book
@@ -154,7 +185,15 @@ func (handler *DBRequestHandler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := database.AddBook(handler.Db, book)
+	if book.Isbn != "" && !utils.ValidateIsbn(book.Isbn) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid ISBN, should be a valid ISBN-10 or ISBN-13"})
+		w.Write(jsonResponse)
+		return
+	}
+	book.Isbn = utils.NormalizeIsbn(book.Isbn)
+
+	id, err := database.AddBookAudited(handler.Db, book, changeFrom(r))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
@@ -170,7 +209,7 @@ func (handler *DBRequestHandler) Add(w http.ResponseWriter, r *http.Request) {
 // delete an existing book
 
 //	 @Summary		Delete a book
-//		@Description	Delete a book by ID
+//		@Description	Moves a book to the trash, where it can be restored from until it is purged, see /books/trash
 //		@Tags			books
 //		@Accept			json
 //		@Produce		json
@@ -195,7 +234,7 @@ func (handler *DBRequestHandler) Delete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	delErr := database.DeleteBook(handler.Db, id)
+	delErr := database.DeleteBookAudited(handler.Db, id, changeFrom(r))
 	if delErr != nil {
 		if delErr == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -214,8 +253,14 @@ func (handler *DBRequestHandler) Delete(w http.ResponseWriter, r *http.Request)
 
 // update existing book
 
+// the body of PUT /books/{id}, an isbn left out keeps the one of the book
+type bookUpdate struct {
+	models.Book
+	Isbn *string `json:"isbn"`
+}
+
 // @Summary 		Update a book
-// @Description	Update a book by ID
+// @Description	Update a book by ID, the ISBN is kept when the body has none and removed when it is empty
 // @Tags			books
 // @Accept			json
 // @Produce		json
@@ -244,8 +289,8 @@ func (handler *DBRequestHandler) Update(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var book models.Book
-	decodeErr := json.NewDecoder(r.Body).Decode(&book)
+	var update bookUpdate
+	decodeErr := json.NewDecoder(r.Body).Decode(&update)
 
 	if decodeErr != nil {
 		log.Println(decodeErr)
@@ -254,7 +299,11 @@ func (handler *DBRequestHandler) Update(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	book := update.Book
 	book.Book_Id = id
+	if update.Isbn != nil {
+		book.Isbn = *update.Isbn
+	}
 
 	if utils.ValidateDate(book.Pub_Date) == false {
 		w.WriteHeader(http.StatusBadRequest)
@@ -263,7 +312,23 @@ func (handler *DBRequestHandler) Update(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	UpdateErr := database.UpdateBook(handler.Db, book)
+	if book.Isbn != "" && !utils.ValidateIsbn(book.Isbn) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid ISBN, should be a valid ISBN-10 or ISBN-13"})
+		w.Write(jsonResponse)
+		return
+	}
+	book.Isbn = utils.NormalizeIsbn(book.Isbn)
+
+	var UpdateErr error
+	if update.Isbn == nil {
+		var stored models.Book
+		stored, UpdateErr = database.GetBook(handler.Db, id)
+		book.Isbn = stored.Isbn
+	}
+	if UpdateErr == nil {
+		UpdateErr = database.UpdateBookAudited(handler.Db, book, changeFrom(r))
+	}
 	if UpdateErr != nil {
 		if UpdateErr == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -284,6 +349,6 @@ func (handler *DBRequestHandler) Update(w http.ResponseWriter, r *http.Request)
 func (handler *DBRequestHandler) SendOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.WriteHeader(http.StatusOK)
 }
@@ -5,11 +5,13 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
 	"github.com/mimminou/BookIT-ByFood/back/models"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -54,19 +56,22 @@ func setupMockDB() (*sql.DB, error) {
 
 	//apply schema
 	db.Exec(schema)
+	if err := database.Migrate(db); err != nil {
+		return nil, err
+	}
 
 	//creates some mock books
 	books := []models.Book{
-		{0, "To Kill a Mockingbird", "Harper Lee", nil, "1998-08-30T00:00:00Z"},
-		{1, "1984", "George Orwell", nil, "1949-06-08"},
-		{2, "The Great Gatsby", "F. Scott Fitzgerald", nil, "1925-04-10"},
-		{3, "Pride and Prejudice", "Jane Austen", nil, "1813-01-28"},
-		{4, "The Catcher in the Rye", "J.D. Salinger", nil, "1951-07-16"},
-		{5, "The Hobbit", "J.R.R. Tolkien", nil, "1937-09-21"},
-		{6, "To the Lighthouse", "Virginia Woolf", nil, "1927-05-05"},
-		{7, "Moby-Dick", "Herman Melville", nil, "1851-10-18"},
-		{8, "Frankenstein", "Mary Shelley", nil, "1818-01-01"},
-		{9, "The Picture of Dorian Gray", "Oscar Wilde", nil, "1890-07-20"},
+		{Book_Id: 0, Title: "To Kill a Mockingbird", Author: "Harper Lee", Num_Pages: nil, Pub_Date: "1998-08-30T00:00:00Z"},
+		{Book_Id: 1, Title: "1984", Author: "George Orwell", Num_Pages: nil, Pub_Date: "1949-06-08"},
+		{Book_Id: 2, Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Num_Pages: nil, Pub_Date: "1925-04-10"},
+		{Book_Id: 3, Title: "Pride and Prejudice", Author: "Jane Austen", Num_Pages: nil, Pub_Date: "1813-01-28"},
+		{Book_Id: 4, Title: "The Catcher in the Rye", Author: "J.D. Salinger", Num_Pages: nil, Pub_Date: "1951-07-16"},
+		{Book_Id: 5, Title: "The Hobbit", Author: "J.R.R. Tolkien", Num_Pages: nil, Pub_Date: "1937-09-21"},
+		{Book_Id: 6, Title: "To the Lighthouse", Author: "Virginia Woolf", Num_Pages: nil, Pub_Date: "1927-05-05"},
+		{Book_Id: 7, Title: "Moby-Dick", Author: "Herman Melville", Num_Pages: nil, Pub_Date: "1851-10-18"},
+		{Book_Id: 8, Title: "Frankenstein", Author: "Mary Shelley", Num_Pages: nil, Pub_Date: "1818-01-01"},
+		{Book_Id: 9, Title: "The Picture of Dorian Gray", Author: "Oscar Wilde", Num_Pages: nil, Pub_Date: "1890-07-20"},
 	}
 
 	for i, book := range books {
@@ -360,6 +365,34 @@ func TestUpdate(t *testing.T) {
 		}
 	})
 
+	t.Run("Testing Update a Book without its ISBN", func(t *testing.T) {
+		id, err := database.AddBook(db, models.Book{Title: "Mrs Dalloway", Author: "Virginia Woolf", Pub_Date: "1925-05-14", Isbn: "9780156907392"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+		path := "/books/" + strconv.Itoa(id)
+
+		body := `{"title": "Mrs Dalloway", "author": "Virginia Woolf", "num_pages": 194, "pub_date": "1925-05-14"}`
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Update(rr, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		var updated models.Book
+		json.Unmarshal(rr.Body.Bytes(), &updated)
+		if rr.Code != http.StatusOK || updated.Isbn != "9780156907392" {
+			t.Errorf("expected the ISBN in the response, got %v %s", rr.Code, rr.Body.String())
+		}
+		if book, err := database.GetBook(db, id); err != nil || book.Isbn != "9780156907392" || *book.Num_Pages != 194 {
+			t.Errorf("expected the book to keep its ISBN, got %+v %v", book, err)
+		}
+
+		body = `{"title": "Mrs Dalloway", "author": "Virginia Woolf", "num_pages": 194, "pub_date": "1925-05-14", "isbn": ""}`
+		rr = httptest.NewRecorder()
+		dbRequestHandler.Update(rr, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		if book, err := database.GetBook(db, id); rr.Code != http.StatusOK || err != nil || book.Isbn != "" {
+			t.Errorf("expected an empty ISBN to remove it, got %v %+v %v", rr.Code, book, err)
+		}
+	})
+
 	t.Run("Testing Update a book with wrong date format", func(t *testing.T) {
 		t.Log("Testing PUT /books/120")
 		//create body and request
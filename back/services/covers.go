@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoverHandler uploads and serves the covers of the books, the images are kept in the storage
+type CoverHandler struct {
+	Db      *sql.DB
+	Storage storage.Storage
+	Options covers.Options
+}
+
+// the images of a cover are stored under its etag, an upload never overwrites the files being served
+func coverKey(bookId int, etag, name string) string {
+	return fmt.Sprintf("covers/%d/%s/%s", bookId, etag, name)
+}
+
+// name of the original image, next to the names of the sizes
+const originalCover = "original"
+
+// withUrls fills the URLs of the cover and of its thumbnails, versioned by its etag
+func withUrls(cover Cover) Cover {
+	base := "/books/" + strconv.Itoa(cover.Book_Id) + "/cover"
+	version := "?v=" + cover.Etag
+	cover.Url = base + version
+	cover.Sizes = map[string]string{}
+	for _, size := range covers.Sizes {
+		cover.Sizes[size.Name] = base + "/" + size.Name + version
+	}
+	return cover
+}
+
+// Upload a cover
+
+// @Summary		Upload the cover of a book
+// @Description	Sets the cover of a book, the body is the image, or a multipart form with the image in its file field. JPEG, PNG and WebP are accepted, recognised by their content rather than their Content-Type. The metadata of the image (EXIF, XMP) is removed, a JPEG is turned upright as its EXIF orientation says, and thumbnails are made in the sizes small (160 pixels wide), medium (320) and large (640). The cover replaces the one the book had
+// @Tags			books
+// @Accept			image/jpeg,image/png,image/webp,multipart/form-data
+// @Produce		json
+// @Param			id		path		int		true	"Book ID"
+// @Param			cover	body		string	true	"Image"
+// @Success		200 {object}	Cover
+// @Failure		400 {object}	ErrMessage	"The image can't be read"
+// @Failure		404 {object}	ErrMessage
+// @Failure		413 {object}	ErrMessage	"The image is over the size or pixel limits"
+// @Failure		415 {object}	ErrMessage	"The image is not a JPEG, PNG or WebP"
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/cover [put]
+func (handler *CoverHandler) Put(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	options := handler.Options.WithDefaults()
+	// room for the headers of a multipart form
+	r.Body = http.MaxBytesReader(w, r.Body, options.MaxBytes+64<<10)
+	defer r.Body.Close()
+
+	var upload io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			coverError(w, err, options)
+			return
+		}
+		defer file.Close()
+		upload = file
+	}
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		coverError(w, err, options)
+		return
+	}
+	if _, err := database.GetBook(handler.Db, id); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	processed, err := covers.Process(data, options)
+	if err != nil {
+		coverError(w, err, options)
+		return
+	}
+	cover, err := handler.save(r.Context(), id, processed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// deleted while the cover was processed
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(cover)
+	w.Write(jsonResponse)
+}
+
+// save stores the images of a processed cover and makes it the cover of the book, in place of the one it had
+// sql.ErrNoRows when the book doesn't exist or is in the trash, the cover is returned with its URLs
+func (handler *CoverHandler) save(ctx context.Context, id int, processed covers.Cover) (Cover, error) {
+	etag, err := newEtag()
+	if err != nil {
+		return Cover{}, err
+	}
+	cover := Cover{
+		Book_Id:       id,
+		ContentType:   processed.Original.ContentType,
+		Width:         processed.Original.Width,
+		Height:        processed.Original.Height,
+		ThumbnailType: processed.Thumbnails[covers.Sizes[0].Name].ContentType,
+		Etag:          etag,
+		UpdatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	images := map[string]covers.Image{originalCover: processed.Original}
+	for name, thumbnail := range processed.Thumbnails {
+		images[name] = thumbnail
+	}
+	for name, image := range images {
+		if err := handler.Storage.Put(ctx, coverKey(id, cover.Etag, name), bytes.NewReader(image.Data), int64(len(image.Data)), image.ContentType); err != nil {
+			handler.remove(cover)
+			return Cover{}, fmt.Errorf("Storing the cover failed: %w", err)
+		}
+	}
+
+	previous, err := database.SetCover(handler.Db, cover)
+	if err != nil {
+		handler.remove(cover)
+		return Cover{}, err
+	}
+	if previous != nil {
+		handler.remove(*previous)
+	}
+	return withUrls(cover), nil
+}
+
+// a new version for every upload, even of the same file, so that the files of two uploads are never the same
+func newEtag() (string, error) {
+	version := make([]byte, 8)
+	if _, err := rand.Read(version); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(version), nil
+}
+
+// answers the error of an upload, a body over the limit answers 413 however it was found
+func coverError(w http.ResponseWriter, err error, options covers.Options) {
+	var tooLarge *http.MaxBytesError
+	status := http.StatusBadRequest
+	msg := err.Error()
+	switch {
+	case errors.As(err, &tooLarge), errors.Is(err, covers.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+		msg = fmt.Sprintf("The cover is larger than %d bytes", options.MaxBytes)
+	case errors.Is(err, covers.ErrTooManyPixels):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, covers.ErrUnsupported):
+		status = http.StatusUnsupportedMediaType
+	}
+	w.WriteHeader(status)
+	jsonResponse, _ := json.Marshal(ErrMessage{Msg: msg})
+	w.Write(jsonResponse)
+}
+
+// removes the images of a cover, a failure leaves files nothing points to, which is only logged
+func (handler *CoverHandler) remove(cover Cover) {
+	names := []string{originalCover}
+	for _, size := range covers.Sizes {
+		names = append(names, size.Name)
+	}
+	for _, name := range names {
+		// the request may be gone, the files are removed all the same
+		if err := handler.Storage.Delete(context.Background(), coverKey(cover.Book_Id, cover.Etag, name)); err != nil {
+			log.Println("Error removing a cover: ", err)
+		}
+	}
+}
+
+// Get a cover
+
+// @Summary		Get the cover of a book
+// @Description	Serves the cover of a book, or one of its thumbnails. The response has an ETag and answers 304 to a matching If-None-Match. With v, the etag of the cover as in the URLs given by the upload, the image can be cached for good, without it the cache has to check it is still current
+// @Tags			books
+// @Produce		image/jpeg,image/png,image/webp
+// @Param			id		path	int		true	"Book ID"
+// @Param			size	path	string	false	"Thumbnail size, the full cover without it"	Enums(small, medium, large)
+// @Param			v		query	string	false	"Etag of the cover"
+// @Success		200
+// @Success		304
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/cover [get]
+// @Router			/books/{id}/cover/{size} [get]
+func (handler *CoverHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	cover, err := database.GetCover(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Cover not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	name, contentType := originalCover, cover.ContentType
+	if size := chi.URLParam(r, "size"); size != "" {
+		if _, err := covers.SizeOf(size); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		name, contentType = size, cover.ThumbnailType
+	}
+
+	etag := `"` + cover.Etag + "-" + name + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", cover.UpdatedAt.Format(http.TimeFormat))
+	if r.URL.Query().Get("v") == cover.Etag {
+		// the URL changes with the cover
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	if matchesEtag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	image, err := handler.Storage.Get(r.Context(), coverKey(id, cover.Etag, name))
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Reading the cover failed: " + err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	defer image.Close()
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, image)
+}
+
+// matchesEtag reports whether an If-None-Match header matches the etag, weakly as RFC 9110 has it
+func matchesEtag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete a cover
+
+// @Summary		Delete the cover of a book
+// @Description	Removes the cover of a book and its thumbnails
+// @Tags			books
+// @Produce		json
+// @Param			id	path	int	true	"Book ID"
+// @Success		204
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/cover [delete]
+func (handler *CoverHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	cover, err := database.DeleteCover(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Cover not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	handler.remove(cover)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the book ID of the path, answers 400 when it isn't one
+func bookId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid book ID"})
+		w.Write(jsonResponse)
+		return 0, false
+	}
+	return id, true
+}
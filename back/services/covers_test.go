@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCovers(t *testing.T) {
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &CoverHandler{Db: db, Storage: files, Options: covers.Options{MaxBytes: 1 << 20}}
+	router := chi.NewRouter()
+	router.Put("/books/{id}/cover", handler.Put)
+	router.Get("/books/{id}/cover", handler.Get)
+	router.Get("/books/{id}/cover/{size}", handler.Get)
+	router.Delete("/books/{id}/cover", handler.Delete)
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	id, err := database.AddBook(db, Book{Title: "Mrs Dalloway", Author: "Virginia Woolf", Pub_Date: "1925-05-14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM Covers WHERE book_id = ?", id)
+		db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+	})
+	path := "/books/" + strconv.Itoa(id) + "/cover"
+	picture := image.NewNRGBA(image.Rect(0, 0, 400, 600))
+	for index := range picture.Pix {
+		picture.Pix[index] = 200
+	}
+	var pngCover, jpegCover bytes.Buffer
+	png.Encode(&pngCover, picture)
+	jpeg.Encode(&jpegCover, picture, nil)
+
+	var cover Cover
+	t.Run("Testing PUT /books/{id}/cover", func(t *testing.T) {
+		rr := serve(httptest.NewRequest("PUT", path, bytes.NewReader(pngCover.Bytes())))
+		if err := json.Unmarshal(rr.Body.Bytes(), &cover); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("expected the cover, got %v %s", rr.Code, rr.Body.String())
+		}
+		if cover.ContentType != "image/png" || cover.Width != 400 || cover.Height != 600 || cover.Url != path+"?v="+cover.Etag || len(cover.Sizes) != len(covers.Sizes) {
+			t.Errorf("expected a 400x600 PNG cover, got %+v", cover)
+		}
+		t.Log(rr.Body.String())
+	})
+
+	t.Run("Testing GET /books/{id}/cover and its caching", func(t *testing.T) {
+		rr := serve(httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("Cache-Control") != "public, no-cache" {
+			t.Fatalf("expected the PNG to be revalidated, got %v %v", rr.Code, rr.Header())
+		}
+		if _, err := png.Decode(rr.Body); err != nil {
+			t.Errorf("expected a PNG, got %v", err)
+		}
+		etag := rr.Header().Get("ETag")
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("If-None-Match", `"other", `+etag)
+		if rr := serve(request); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("expected status code %v, got %v", http.StatusNotModified, rr.Code)
+		}
+		if rr := serve(httptest.NewRequest("GET", cover.Sizes["small"], nil)); rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+			t.Errorf("expected the versioned thumbnail to be cached for good, got %v %v", rr.Code, rr.Header())
+		} else if thumbnail, err := png.DecodeConfig(rr.Body); err != nil || thumbnail.Width != 160 || thumbnail.Height != 240 {
+			t.Errorf("expected a 160x240 thumbnail, got %+v %v", thumbnail, err)
+		}
+		if rr := serve(httptest.NewRequest("GET", path+"/huge", nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Testing the uploads that are refused", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			path   string
+			body   []byte
+			status int
+		}{
+			"gif":          {path, []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), http.StatusUnsupportedMediaType},
+			"text":         {path, []byte("not an image"), http.StatusUnsupportedMediaType},
+			"truncated":    {path, pngCover.Bytes()[:100], http.StatusBadRequest},
+			"too large":    {path, make([]byte, 2<<20), http.StatusRequestEntityTooLarge},
+			"unknown book": {"/books/999999/cover", pngCover.Bytes(), http.StatusNotFound},
+		} {
+			if rr := serve(httptest.NewRequest("PUT", test.path, bytes.NewReader(test.body))); rr.Code != test.status {
+				t.Errorf("%s: expected status code %v, got %v %s", name, test.status, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("Testing a multipart upload replaces the cover", func(t *testing.T) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "cover.jpg")
+		part.Write(jpegCover.Bytes())
+		form.Close()
+		request := httptest.NewRequest("PUT", path, &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		rr := serve(request)
+		var replaced Cover
+		if json.Unmarshal(rr.Body.Bytes(), &replaced); rr.Code != http.StatusOK || replaced.ContentType != "image/jpeg" || replaced.Etag == cover.Etag {
+			t.Fatalf("expected a new JPEG cover, got %v %s", rr.Code, rr.Body.String())
+		}
+		if _, err := files.Get(context.Background(), coverKey(id, cover.Etag, originalCover)); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected the files of the replaced cover to be removed, got %v", err)
+		}
+		if rr := serve(httptest.NewRequest("GET", path+"/medium", nil)); rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("expected a JPEG thumbnail, got %v %v", rr.Code, rr.Header())
+		}
+		cover = replaced
+	})
+
+	t.Run("Testing DELETE /books/{id}/cover", func(t *testing.T) {
+		if rr := serve(httptest.NewRequest("DELETE", path, nil)); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %v, got %v", http.StatusNoContent, rr.Code)
+		}
+		if rr := serve(httptest.NewRequest("GET", path, nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+		if _, err := files.Get(context.Background(), coverKey(id, cover.Etag, "small")); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected the files of the cover to be removed, got %v", err)
+		}
+		if rr := serve(httptest.NewRequest("DELETE", path, nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+}
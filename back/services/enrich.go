@@ -0,0 +1,282 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// EnrichHandler fills the books out of the catalogue of the provider, the changes are previewed, then confirmed
+type EnrichHandler struct {
+	Db       *sql.DB
+	Provider enrich.Provider
+	// saves the cover downloaded from the catalogue
+	Covers *CoverHandler
+}
+
+// fields the catalogue can change, in the order they are applied
+var enrichFields = []string{"title", "author", "num_pages", "pub_date", "cover"}
+
+// Enrich a new book
+
+// @Summary		Fill a new book out of the catalogue
+// @Description	Looks up the ISBN of the book in the catalogue of the provider (Open Library or Google Books) and answers the changes the record makes to the fields given: title, author, num_pages, pub_date and cover. Nothing is saved until the changes are confirmed: the same request with the digest of the preview, and the fields to take, all of them when empty, creates the book. The records are cached
+// @Tags			books
+// @Accept			json
+// @Produce		json
+// @Param			book	body		EnrichRequest	true	"Book, with at least its isbn"
+// @Success		200 {object}	Enrichment		"Preview, without a digest"
+// @Success		201 {object}	EnrichResult	"The book was created"
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage	"The catalogue has no record of the ISBN"
+// @Failure		409 {object}	ErrMessage	"The record changed since the preview"
+// @Failure		422 {object}	ErrMessage	"The book would lack a field"
+// @Failure		502 {object}	ErrMessage	"The catalogue could not be queried"
+// @Router			/books/enrich [post]
+func (handler *EnrichHandler) Add(w http.ResponseWriter, r *http.Request) {
+	handler.enrich(w, r, 0)
+}
+
+// Enrich a book
+
+// @Summary		Fill a book out of the catalogue
+// @Description	Looks up the ISBN of the book in the catalogue and answers the changes its record makes, a cover is only proposed to a book without one. Nothing is saved until the changes are confirmed with the digest of the preview, the fields to take are given in fields, all of them when empty
+// @Tags			books
+// @Accept			json
+// @Produce		json
+// @Param			id		path		int				true	"Book ID"
+// @Param			confirm	body		EnrichRequest	false	"Digest and fields, the book fields are ignored"
+// @Success		200 {object}	Enrichment		"Preview without a digest, an EnrichResult once confirmed"
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage	"The book doesn't exist, or the catalogue has no record of its ISBN"
+// @Failure		409 {object}	ErrMessage	"The book or the record changed since the preview"
+// @Failure		422 {object}	ErrMessage	"The book has no ISBN"
+// @Failure		502 {object}	ErrMessage	"The catalogue could not be queried"
+// @Router			/books/{id}/enrich [post]
+func (handler *EnrichHandler) Enrich(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	handler.enrich(w, r, id)
+}
+
+// enrich previews or confirms the changes of the catalogue, id is 0 for a new book, given in the body
+func (handler *EnrichHandler) enrich(w http.ResponseWriter, r *http.Request, id int) {
+	var request EnrichRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	book := request.Book
+	book.Book_Id = 0
+	hasCover := false
+	if id != 0 {
+		var err error
+		if book, err = database.GetBook(handler.Db, id); err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusNotFound)
+				jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+				w.Write(jsonResponse)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		// dates come back from the DB as YYYY-MM-DDT00:00:00Z
+		book.Pub_Date, _, _ = strings.Cut(book.Pub_Date, "T")
+		if _, err := database.GetCover(handler.Db, id); err == nil {
+			hasCover = true
+		} else if err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		if book.Isbn == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The book has no ISBN to look up"})
+			w.Write(jsonResponse)
+			return
+		}
+	} else if book.Isbn == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The isbn of the book is needed to look it up"})
+		w.Write(jsonResponse)
+		return
+	}
+	if !utils.ValidateIsbn(book.Isbn) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid ISBN, should be a valid ISBN-10 or ISBN-13"})
+		w.Write(jsonResponse)
+		return
+	}
+	book.Isbn = utils.NormalizeIsbn(book.Isbn)
+
+	record, err := handler.Provider.Lookup(r.Context(), book.Isbn)
+	if err != nil {
+		if errors.Is(err, enrich.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "No record of ISBN " + book.Isbn + " in " + handler.Provider.Name()})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	changes, enriched := proposeChanges(book, record, hasCover)
+	digest := enrichDigest(book, record)
+
+	if request.Digest == "" {
+		jsonResponse, _ := json.Marshal(Enrichment{Book_Id: id, Isbn: book.Isbn, Source: record.Source, Changes: changes, Book: enriched, Digest: digest})
+		w.Write(jsonResponse)
+		return
+	}
+	if request.Digest != digest {
+		w.WriteHeader(http.StatusConflict)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The book or its record changed since the preview, preview the changes again"})
+		w.Write(jsonResponse)
+		return
+	}
+	fields := request.Fields
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(changes))
+		for field := range changes {
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range fields {
+		if _, ok := changes[field]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The catalogue proposes no change of " + field})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+
+	result := EnrichResult{Created: id == 0, Applied: []string{}}
+	saved := book
+	for _, field := range enrichFields {
+		if !slices.Contains(fields, field) {
+			continue
+		}
+		switch field {
+		case "title":
+			saved.Title = enriched.Title
+		case "author":
+			saved.Author = enriched.Author
+		case "num_pages":
+			saved.Num_Pages = enriched.Num_Pages
+		case "pub_date":
+			saved.Pub_Date = enriched.Pub_Date
+		}
+		result.Applied = append(result.Applied, field)
+	}
+	if result.Created {
+		if emptyFields := utils.CheckEmptyFields(saved); len(emptyFields) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The following fields are empty: " + strings.Join(emptyFields, ", ")})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+	if problems := utils.ValidateBook(saved); len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: strings.Join(problems, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+	if result.Created {
+		saved.Book_Id, err = database.AddBookAudited(handler.Db, saved, changeFrom(r))
+	} else if saved != book {
+		err = database.UpdateBookAudited(handler.Db, saved, changeFrom(r))
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	result.Book = saved
+
+	if slices.Contains(fields, "cover") {
+		// the book is saved already, a cover that can't be used doesn't fail the change
+		options := handler.Covers.Options.WithDefaults()
+		if data, err := handler.Provider.Cover(r.Context(), record, options.MaxBytes); err != nil {
+			result.Warnings = append(result.Warnings, "cover left out: "+err.Error())
+		} else if processed, err := covers.Process(data, options); err != nil {
+			result.Warnings = append(result.Warnings, "cover left out: "+err.Error())
+		} else if cover, err := handler.Covers.save(r.Context(), saved.Book_Id, processed); err != nil {
+			result.Warnings = append(result.Warnings, "cover left out: "+err.Error())
+		} else {
+			result.Cover = &cover
+		}
+	}
+	if result.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	jsonResponse, _ := json.Marshal(result)
+	w.Write(jsonResponse)
+}
+
+// the changes the record makes to the book, and the book with all of them made
+// a field the record doesn't know is left as it is, the cover is only proposed to a book without one
+func proposeChanges(book Book, record enrich.Record, hasCover bool) (map[string]FieldChange, Book) {
+	changes := map[string]FieldChange{}
+	enriched := book
+	if record.Title != "" && record.Title != book.Title {
+		changes["title"] = FieldChange{From: book.Title, To: record.Title}
+		enriched.Title = record.Title
+	}
+	if author := strings.Join(record.Authors, ", "); author != "" && author != book.Author {
+		changes["author"] = FieldChange{From: book.Author, To: author}
+		enriched.Author = author
+	}
+	if pages := record.NumPages; pages > 0 && (book.Num_Pages == nil || *book.Num_Pages != pages) {
+		changes["num_pages"] = FieldChange{From: book.Num_Pages, To: pages}
+		enriched.Num_Pages = &pages
+	}
+	if record.PublishDate != "" && record.PublishDate != book.Pub_Date {
+		changes["pub_date"] = FieldChange{From: book.Pub_Date, To: record.PublishDate}
+		enriched.Pub_Date = record.PublishDate
+	}
+	if record.CoverUrl != "" && !hasCover {
+		changes["cover"] = FieldChange{From: nil, To: record.CoverUrl}
+	}
+	return changes, enriched
+}
+
+// the digest of what a preview was made of, a confirmation is refused when the book or the record changed since
+func enrichDigest(book Book, record enrich.Record) string {
+	data, _ := json.Marshal(struct {
+		Book   Book
+		Record enrich.Record
+	}{book, record})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
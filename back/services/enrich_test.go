@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/enrich"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// a catalogue that knows the records given, and fails on 0000000000
+type fakeCatalogue struct {
+	records map[string]enrich.Record
+	cover   []byte
+}
+
+func (catalogue *fakeCatalogue) Name() string {
+	return "fake"
+}
+
+func (catalogue *fakeCatalogue) Lookup(ctx context.Context, isbn string) (enrich.Record, error) {
+	if isbn == "0000000000" {
+		return enrich.Record{}, enrich.ErrUnavailable
+	}
+	record, ok := catalogue.records[isbn]
+	if !ok {
+		return enrich.Record{}, enrich.ErrNotFound
+	}
+	return record, nil
+}
+
+func (catalogue *fakeCatalogue) Cover(ctx context.Context, record enrich.Record, maxBytes int64) ([]byte, error) {
+	if record.CoverUrl == "" {
+		return nil, enrich.ErrNotFound
+	}
+	return catalogue.cover, nil
+}
+
+func TestEnrich(t *testing.T) {
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cover bytes.Buffer
+	png.Encode(&cover, image.NewGray(image.Rect(0, 0, 200, 300)))
+	catalogue := &fakeCatalogue{cover: cover.Bytes(), records: map[string]enrich.Record{
+		"9780156907392": {Isbn: "9780156907392", Title: "Mrs Dalloway", Authors: []string{"Virginia Woolf"}, NumPages: 194, PublishDate: "1925-05-14",
+			CoverUrl: "https://covers.example.com/L.jpg", Source: "fake"},
+	}}
+	handler := &EnrichHandler{Db: db, Provider: catalogue, Covers: &CoverHandler{Db: db, Storage: files, Options: covers.Options{}}}
+	router := chi.NewRouter()
+	router.Post("/books/enrich", handler.Add)
+	router.Post("/books/{id}/enrich", handler.Enrich)
+	serve := func(path string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(data)))
+		return rr
+	}
+	var ids []int
+	t.Cleanup(func() {
+		for _, id := range ids {
+			db.Exec("DELETE FROM Covers WHERE book_id = ?", id)
+			db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+		}
+	})
+
+	var preview Enrichment
+	t.Run("Testing POST /books/enrich previews the changes", func(t *testing.T) {
+		rr := serve("/books/enrich", EnrichRequest{Book: Book{Isbn: "978-0-15-690739-2"}})
+		if err := json.Unmarshal(rr.Body.Bytes(), &preview); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("expected a preview, got %v %s", rr.Code, rr.Body.String())
+		}
+		fields := make([]string, 0, len(preview.Changes))
+		for field := range preview.Changes {
+			fields = append(fields, field)
+		}
+		if len(fields) != 5 || preview.Changes["title"].To != "Mrs Dalloway" || preview.Changes["num_pages"].To != float64(194) || preview.Digest == "" {
+			t.Errorf("expected a change of every field, got %+v", preview)
+		}
+		if preview.Book.Title != "Mrs Dalloway" || preview.Book.Pub_Date != "1925-05-14" || preview.Isbn != "9780156907392" {
+			t.Errorf("expected the book with the changes made, got %+v", preview.Book)
+		}
+		if _, err := database.GetBookByIsbn(db, "9780156907392"); err == nil {
+			t.Errorf("expected the preview to save nothing")
+		}
+	})
+
+	var result EnrichResult
+	t.Run("Testing the digest of the preview creates the book", func(t *testing.T) {
+		rr := serve("/books/enrich", EnrichRequest{Book: Book{Isbn: "978-0-15-690739-2"}, Digest: preview.Digest})
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusCreated {
+			t.Fatalf("expected the book to be created, got %v %s", rr.Code, rr.Body.String())
+		}
+		ids = append(ids, result.Book.Book_Id)
+		stored, err := database.GetBook(db, result.Book.Book_Id)
+		if err != nil || stored.Title != "Mrs Dalloway" || stored.Author != "Virginia Woolf" || stored.Num_Pages == nil || *stored.Num_Pages != 194 {
+			t.Errorf("expected the book of the catalogue, got %+v %v", stored, err)
+		}
+		if !result.Created || !reflect.DeepEqual(result.Applied, []string{"title", "author", "num_pages", "pub_date", "cover"}) {
+			t.Errorf("expected every change to be applied, got %+v", result)
+		}
+		if result.Cover == nil || result.Cover.Width != 200 {
+			t.Errorf("expected the cover of the catalogue, got %+v %v", result.Cover, result.Warnings)
+		}
+	})
+
+	path := "/books/" + strconv.Itoa(result.Book.Book_Id) + "/enrich"
+	t.Run("Testing POST /books/{id}/enrich with the fields confirmed", func(t *testing.T) {
+		record := catalogue.records["9780156907392"]
+		record.Title, record.NumPages = "Mrs Dalloway: A Novel", 216
+		catalogue.records["9780156907392"] = record
+
+		rr := serve(path, nil)
+		var preview Enrichment
+		if err := json.Unmarshal(rr.Body.Bytes(), &preview); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("expected a preview, got %v %s", rr.Code, rr.Body.String())
+		}
+		// the book has a cover already, none is proposed
+		if len(preview.Changes) != 2 || preview.Changes["title"].From != "Mrs Dalloway" || preview.Book_Id != result.Book.Book_Id {
+			t.Fatalf("expected the title and the number of pages to change, got %+v", preview.Changes)
+		}
+
+		rr = serve(path, EnrichRequest{Digest: preview.Digest, Fields: []string{"title"}})
+		var saved EnrichResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &saved); err != nil || rr.Code != http.StatusOK || !reflect.DeepEqual(saved.Applied, []string{"title"}) {
+			t.Fatalf("expected the title to be saved, got %v %s", rr.Code, rr.Body.String())
+		}
+		if stored, err := database.GetBook(db, result.Book.Book_Id); err != nil || stored.Title != "Mrs Dalloway: A Novel" || *stored.Num_Pages != 194 {
+			t.Errorf("expected the title alone to change, got %+v %v", stored, err)
+		}
+		// the book changed since the preview
+		if rr := serve(path, EnrichRequest{Digest: preview.Digest}); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %v, got %v %s", http.StatusConflict, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Testing the requests that are refused", func(t *testing.T) {
+		id, err := database.AddBook(db, Book{Title: "The Years", Author: "Virginia Woolf", Pub_Date: "1937-03-15"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		rr := serve(path, nil)
+		var preview Enrichment
+		json.Unmarshal(rr.Body.Bytes(), &preview)
+		for _, test := range []struct {
+			path     string
+			body     any
+			expected int
+		}{
+			{"/books/enrich", nil, http.StatusBadRequest},
+			{"/books/enrich", EnrichRequest{Book: Book{Isbn: "9780156907393"}}, http.StatusBadRequest},
+			{"/books/enrich", EnrichRequest{Book: Book{Isbn: "9780141182605"}}, http.StatusNotFound},
+			{"/books/enrich", EnrichRequest{Book: Book{Isbn: "0000000000"}}, http.StatusBadGateway},
+			{"/books/999999/enrich", nil, http.StatusNotFound},
+			{"/books/" + strconv.Itoa(id) + "/enrich", nil, http.StatusUnprocessableEntity},
+			{path, EnrichRequest{Digest: preview.Digest, Fields: []string{"isbn"}}, http.StatusBadRequest},
+		} {
+			if rr := serve(test.path, test.body); rr.Code != test.expected {
+				t.Errorf("%s %+v: expected status code %v, got %v %s", test.path, test.body, test.expected, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("Testing a new book still lacking a field is not created", func(t *testing.T) {
+		catalogue.records["9780141182605"] = enrich.Record{Isbn: "9780141182605", Title: "To the Lighthouse", Source: "fake"}
+		request := EnrichRequest{Book: Book{Isbn: "9780141182605"}}
+		var preview Enrichment
+		json.Unmarshal(serve("/books/enrich", request).Body.Bytes(), &preview)
+		request.Digest = preview.Digest
+		if rr := serve("/books/enrich", request); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "author") {
+			t.Errorf("expected status code %v, got %v %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+		}
+	})
+}
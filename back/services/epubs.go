@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/epub"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EpubHandler uploads and serves the EPUB files of the books, a book is created or updated out of the metadata of its file
+type EpubHandler struct {
+	Db      *sql.DB
+	Storage storage.Storage
+	Options epub.Options
+	// saves the cover found in the file
+	Covers *CoverHandler
+}
+
+// the files are stored under their etag, an upload never overwrites the file being served
+func epubKey(etag string) string {
+	return "epubs/" + etag + ".epub"
+}
+
+func epubWithUrl(file Epub) Epub {
+	file.Url = "/books/" + strconv.Itoa(file.Book_Id) + "/epub"
+	return file
+}
+
+// Upload an EPUB as a new book
+
+// @Summary		Add a book out of an EPUB file
+// @Description	Reads the metadata of an EPUB (title, creators, language, identifiers, publication date and cover) and stores the file. The book with the ISBN of the file is updated when there is one, otherwise a book is created. The creators whose role is author make the author, a year or a month alone is published on the first day. The query parameters take precedence over the metadata, e.g. to give a publication date the file doesn't have. The cover of the file replaces the cover of the book, a cover that can't be used is reported in warnings. The body is the file, or a multipart form with the file in its file field
+// @Tags			books
+// @Accept			application/epub+zip,multipart/form-data
+// @Produce		json
+// @Param			epub		body		string	true	"EPUB file"
+// @Param			title		query		string	false	"Title, instead of the one of the file"
+// @Param			author		query		string	false	"Author, instead of the creators of the file"
+// @Param			pub_date	query		string	false	"Publication date, YYYY-MM-DD, instead of the one of the file"
+// @Param			isbn		query		string	false	"ISBN, instead of the one of the file"
+// @Success		200 {object}	EpubUpload	"The book with the ISBN was updated"
+// @Success		201 {object}	EpubUpload	"A book was created"
+// @Failure		400 {object}	ErrMessage	"The archive is malformed, or a query parameter is invalid"
+// @Failure		413 {object}	ErrMessage	"The file is over the size limits"
+// @Failure		415 {object}	ErrMessage	"The file is not an EPUB"
+// @Failure		422 {object}	ErrMessage	"The metadata lacks a field the book needs, it can be given in the query parameters"
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/epub [post]
+func (handler *EpubHandler) Add(w http.ResponseWriter, r *http.Request) {
+	handler.upload(w, r, 0)
+}
+
+// Upload the EPUB of a book
+
+// @Summary		Set the EPUB file of a book
+// @Description	Stores the EPUB of a book and updates the book out of its metadata, as POST /books/epub does. The fields the file doesn't have keep their value
+// @Tags			books
+// @Accept			application/epub+zip,multipart/form-data
+// @Produce		json
+// @Param			id			path		int		true	"Book ID"
+// @Param			epub		body		string	true	"EPUB file"
+// @Param			title		query		string	false	"Title, instead of the one of the file"
+// @Param			author		query		string	false	"Author, instead of the creators of the file"
+// @Param			pub_date	query		string	false	"Publication date, YYYY-MM-DD, instead of the one of the file"
+// @Param			isbn		query		string	false	"ISBN, instead of the one of the file"
+// @Success		200 {object}	EpubUpload
+// @Failure		400 {object}	ErrMessage	"The archive is malformed, or a query parameter is invalid"
+// @Failure		404 {object}	ErrMessage
+// @Failure		413 {object}	ErrMessage	"The file is over the size limits"
+// @Failure		415 {object}	ErrMessage	"The file is not an EPUB"
+// @Failure		422 {object}	ErrMessage	"The book would lack a field"
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/epub [put]
+func (handler *EpubHandler) Put(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	handler.upload(w, r, id)
+}
+
+// upload reads the file and writes the book, id is 0 to find the book by its ISBN, or create it
+func (handler *EpubHandler) upload(w http.ResponseWriter, r *http.Request, id int) {
+	options := handler.Options.WithDefaults()
+	// room for the headers of a multipart form
+	r.Body = http.MaxBytesReader(w, r.Body, options.MaxBytes+64<<10)
+	defer r.Body.Close()
+
+	var upload io.Reader = r.Body
+	filename := ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			epubError(w, err, options)
+			return
+		}
+		defer file.Close()
+		upload = file
+		filename = header.Filename
+	}
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		epubError(w, err, options)
+		return
+	}
+	metadata, err := epub.Parse(data, options)
+	if err != nil {
+		epubError(w, err, options)
+		return
+	}
+
+	query := r.URL.Query()
+	isbn := metadata.Isbn
+	if query.Has("isbn") {
+		if isbn = utils.NormalizeIsbn(query.Get("isbn")); isbn != "" && !utils.ValidateIsbn(isbn) {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid ISBN, should be a valid ISBN-10 or ISBN-13"})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+	var book Book
+	created := id == 0
+	if id != 0 {
+		if book, err = database.GetBook(handler.Db, id); err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusNotFound)
+				jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+				w.Write(jsonResponse)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+	} else if isbn != "" {
+		// the book with the ISBN of the file is updated rather than added again
+		if existing, err := database.GetBookByIsbn(handler.Db, isbn); err == nil {
+			book, created = existing, false
+		} else if err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+
+	// dates come back from the DB as YYYY-MM-DDT00:00:00Z
+	book.Pub_Date, _, _ = strings.Cut(book.Pub_Date, "T")
+	// what the file has replaces what the book had, the query parameters replace both
+	if metadata.Title != "" {
+		book.Title = metadata.Title
+	}
+	if len(metadata.Authors) > 0 {
+		book.Author = strings.Join(metadata.Authors, ", ")
+	}
+	if metadata.Date != "" {
+		book.Pub_Date = metadata.Date
+	}
+	if isbn != "" || query.Has("isbn") {
+		book.Isbn = isbn
+	}
+	for field, value := range map[string]*string{"title": &book.Title, "author": &book.Author, "pub_date": &book.Pub_Date} {
+		if query.Has(field) {
+			*value = strings.TrimSpace(query.Get(field))
+		}
+	}
+	if emptyFields := utils.CheckEmptyFields(book); len(emptyFields) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "The EPUB doesn't give the following fields, set them with the query parameters of the same name: " + strings.Join(emptyFields, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+	if problems := utils.ValidateBook(book); len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: strings.Join(problems, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+
+	etag, err := newEtag()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	sum := sha256.Sum256(data)
+	file := Epub{
+		Filename:   epubFilename(filename, book.Title),
+		Size:       int64(len(data)),
+		Sha256:     hex.EncodeToString(sum[:]),
+		Language:   metadata.Language,
+		Etag:       etag,
+		UploadedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	for _, identifier := range metadata.Identifiers {
+		file.Identifiers = append(file.Identifiers, identifier.Value)
+	}
+	// the file is stored first, then the book and the row of its file are written in one transaction
+	if err := handler.Storage.Put(r.Context(), epubKey(etag), bytes.NewReader(data), file.Size, epub.MediaType); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Storing the EPUB failed: " + err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	id, previous, err := database.SaveBookEpub(handler.Db, book, file, changeFrom(r))
+	if err != nil {
+		handler.remove(file)
+		if err == sql.ErrNoRows {
+			// deleted while the file was read
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	book.Book_Id, file.Book_Id = id, id
+	if previous != nil {
+		handler.remove(*previous)
+	}
+
+	result := EpubUpload{Created: created, Book: book, Epub: epubWithUrl(file), Warnings: metadata.Warnings}
+	if metadata.Cover != nil {
+		// the book is saved already, a cover that can't be used doesn't fail the upload
+		if processed, err := covers.Process(metadata.Cover, handler.Covers.Options); err != nil {
+			result.Warnings = append(result.Warnings, "cover left out: "+err.Error())
+		} else if cover, err := handler.Covers.save(r.Context(), book.Book_Id, processed); err != nil {
+			result.Warnings = append(result.Warnings, "cover left out: "+err.Error())
+		} else {
+			result.Cover = &cover
+		}
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	jsonResponse, _ := json.Marshal(result)
+	w.Write(jsonResponse)
+}
+
+// the name the file is downloaded as, the name it was uploaded with, or the title of the book
+func epubFilename(uploaded, title string) string {
+	name := path.Base(strings.ReplaceAll(uploaded, `\`, "/"))
+	if name == "." || name == "/" || !strings.HasSuffix(strings.ToLower(name), ".epub") {
+		name = strings.Trim(strings.Map(func(char rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, char) || char < ' ' {
+				return -1
+			}
+			return char
+		}, title), " .") + ".epub"
+	}
+	return name
+}
+
+// answers the error of an upload, a body over the limit answers 413 however it was found
+func epubError(w http.ResponseWriter, err error, options epub.Options) {
+	var tooLarge *http.MaxBytesError
+	status := http.StatusBadRequest
+	msg := err.Error()
+	switch {
+	case errors.As(err, &tooLarge):
+		status = http.StatusRequestEntityTooLarge
+		msg = fmt.Sprintf("The EPUB is larger than %d bytes", options.MaxBytes)
+	case errors.Is(err, epub.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, epub.ErrNotEpub):
+		status = http.StatusUnsupportedMediaType
+	}
+	w.WriteHeader(status)
+	jsonResponse, _ := json.Marshal(ErrMessage{Msg: msg})
+	w.Write(jsonResponse)
+}
+
+// removes a file, a failure leaves a file nothing points to, which is only logged
+func (handler *EpubHandler) remove(file Epub) {
+	// the request may be gone, the file is removed all the same
+	if err := handler.Storage.Delete(context.Background(), epubKey(file.Etag)); err != nil {
+		log.Println("Error removing an EPUB: ", err)
+	}
+}
+
+// Download an EPUB
+
+// @Summary		Download the EPUB file of a book
+// @Description	Serves the EPUB of a book as an attachment, with its SHA-256 as ETag, 304 to a matching If-None-Match
+// @Tags			books
+// @Produce		application/epub+zip
+// @Param			id	path	int	true	"Book ID"
+// @Success		200
+// @Success		304
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/epub [get]
+func (handler *EpubHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	file, err := database.GetEpub(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "EPUB not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	etag := `"` + file.Sha256 + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", file.UploadedAt.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "public, no-cache")
+	if matchesEtag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, err := handler.Storage.Get(r.Context(), epubKey(file.Etag))
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Reading the EPUB failed: " + err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", epub.MediaType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, content)
+}
+
+// Delete an EPUB
+
+// @Summary		Delete the EPUB file of a book
+// @Description	Removes the EPUB of a book, the book and its cover are kept
+// @Tags			books
+// @Produce		json
+// @Param			id	path	int	true	"Book ID"
+// @Success		204
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/epub [delete]
+func (handler *EpubHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := bookId(w, r)
+	if !ok {
+		return
+	}
+	file, err := database.DeleteEpub(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "EPUB not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	handler.remove(file)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/epub"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// an EPUB 3 with the metadata given, and a cover when it isn't nil
+func epubFile(t *testing.T, metadata string, cover []byte) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	manifest := ""
+	entries := map[string][]byte{
+		"META-INF/container.xml": []byte(`<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`),
+	}
+	if cover != nil {
+		manifest = `<item id="cover" href="cover.png" media-type="image/png" properties="cover-image"/>`
+		entries["cover.png"] = cover
+	}
+	entries["content.opf"] = []byte(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0"><metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		metadata + `</metadata><manifest>` + manifest + `</manifest></package>`)
+	mimetype, _ := writer.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	mimetype.Write([]byte(epub.MediaType))
+	for name, data := range entries {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(data)
+	}
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestEpubs(t *testing.T) {
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverHandler := &CoverHandler{Db: db, Storage: files, Options: covers.Options{}}
+	handler := &EpubHandler{Db: db, Storage: files, Options: epub.Options{MaxBytes: 1 << 20}, Covers: coverHandler}
+	router := chi.NewRouter()
+	router.Post("/books/epub", handler.Add)
+	router.Put("/books/{id}/epub", handler.Put)
+	router.Get("/books/{id}/epub", handler.Get)
+	router.Delete("/books/{id}/epub", handler.Delete)
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+	var ids []int
+	t.Cleanup(func() {
+		for _, id := range ids {
+			db.Exec("DELETE FROM Epubs WHERE book_id = ?", id)
+			db.Exec("DELETE FROM Covers WHERE book_id = ?", id)
+			db.Exec("DELETE FROM Books WHERE book_id = ?", id)
+		}
+	})
+	var cover bytes.Buffer
+	png.Encode(&cover, image.NewGray(image.Rect(0, 0, 200, 300)))
+	waves := epubFile(t, `<dc:title>The Waves</dc:title><dc:creator>Virginia Woolf</dc:creator><dc:language>en</dc:language>
+		<dc:identifier>urn:isbn:0156949601</dc:identifier><dc:date>1931-10-08</dc:date>`, cover.Bytes())
+
+	var upload EpubUpload
+	t.Run("Testing POST /books/epub creates the book", func(t *testing.T) {
+		rr := serve(httptest.NewRequest("POST", "/books/epub", bytes.NewReader(waves)))
+		if err := json.Unmarshal(rr.Body.Bytes(), &upload); err != nil || rr.Code != http.StatusCreated {
+			t.Fatalf("expected the book to be created, got %v %s", rr.Code, rr.Body.String())
+		}
+		ids = append(ids, upload.Book.Book_Id)
+		expected := Book{Book_Id: upload.Book.Book_Id, Title: "The Waves", Author: "Virginia Woolf", Pub_Date: "1931-10-08", Isbn: "0156949601"}
+		if stored, err := database.GetBook(db, upload.Book.Book_Id); err != nil || stored.Title != expected.Title || stored.Isbn != expected.Isbn || upload.Book != expected {
+			t.Errorf("expected %+v, got %+v %v", expected, stored, err)
+		}
+		if !upload.Created || upload.Epub.Language != "en" || upload.Epub.Filename != "The Waves.epub" || upload.Epub.Size != int64(len(waves)) {
+			t.Errorf("expected the file of the book, got %+v", upload.Epub)
+		}
+		if upload.Cover == nil || upload.Cover.Width != 200 {
+			t.Errorf("expected the cover of the file, got %+v %v", upload.Cover, upload.Warnings)
+		}
+		t.Log(rr.Body.String())
+	})
+
+	t.Run("Testing GET /books/{id}/epub", func(t *testing.T) {
+		path := "/books/" + strconv.Itoa(upload.Book.Book_Id) + "/epub"
+		rr := serve(httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != epub.MediaType || !bytes.Equal(rr.Body.Bytes(), waves) {
+			t.Fatalf("expected the file, got %v %v", rr.Code, rr.Header())
+		}
+		sum := sha256.Sum256(waves)
+		if etag := rr.Header().Get("ETag"); etag != `"`+hex.EncodeToString(sum[:])+`"` || rr.Header().Get("Content-Disposition") != `attachment; filename="The Waves.epub"` {
+			t.Errorf("expected the SHA-256 as ETag and an attachment, got %v", rr.Header())
+		}
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+		if rr := serve(request); rr.Code != http.StatusNotModified {
+			t.Errorf("expected status code %v, got %v", http.StatusNotModified, rr.Code)
+		}
+	})
+
+	t.Run("Testing an upload with a known ISBN updates the book", func(t *testing.T) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", `C:\Books\waves.epub`)
+		part.Write(epubFile(t, `<dc:title>The Waves, annotated</dc:title><dc:creator>Virginia Woolf</dc:creator><dc:identifier>978-0-15-694960-2</dc:identifier>`, nil))
+		form.Close()
+		// the ISBN of the query takes precedence over the one of the file
+		request := httptest.NewRequest("POST", "/books/epub?isbn=0-15-694960-1", &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		rr := serve(request)
+		var updated EpubUpload
+		if json.Unmarshal(rr.Body.Bytes(), &updated); rr.Code != http.StatusOK || updated.Created || updated.Book.Book_Id != upload.Book.Book_Id {
+			t.Fatalf("expected book %d to be updated, got %v %s", upload.Book.Book_Id, rr.Code, rr.Body.String())
+		}
+		if updated.Book.Title != "The Waves, annotated" || updated.Book.Pub_Date != "1931-10-08" || updated.Epub.Filename != "waves.epub" {
+			t.Errorf("expected the new title, the date of the book and the uploaded name, got %+v %+v", updated.Book, updated.Epub)
+		}
+		if _, err := files.Get(context.Background(), epubKey(upload.Epub.Etag)); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected the replaced file to be removed, got %v", err)
+		}
+		if entries, _ := database.GetAuditLog(db, database.AuditFilter{BookId: upload.Book.Book_Id}, 10, 0); len(entries) != 2 {
+			t.Errorf("expected the creation and the update in the audit log, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("Testing the uploads that are refused", func(t *testing.T) {
+		untitled := epubFile(t, `<dc:creator>Anonymous</dc:creator>`, nil)
+		for name, test := range map[string]struct {
+			path   string
+			body   []byte
+			status int
+		}{
+			"not an epub":   {"/books/epub", []byte("%PDF-1.7"), http.StatusUnsupportedMediaType},
+			"truncated":     {"/books/epub", waves[:300], http.StatusBadRequest},
+			"too large":     {"/books/epub", make([]byte, 2<<20), http.StatusRequestEntityTooLarge},
+			"no title":      {"/books/epub", untitled, http.StatusUnprocessableEntity},
+			"invalid date":  {"/books/epub?title=Untitled&pub_date=someday", untitled, http.StatusBadRequest},
+			"invalid isbn":  {"/books/epub?isbn=123", waves, http.StatusBadRequest},
+			"unknown book":  {"/books/999999/epub", waves, http.StatusNotFound},
+			"invalid cover": {"/books/epub", epubFile(t, `<dc:title>Flush</dc:title><dc:creator>Virginia Woolf</dc:creator><dc:date>1933</dc:date>`, []byte("not a cover")), http.StatusCreated},
+		} {
+			method := "POST"
+			if strings.HasSuffix(test.path, "/999999/epub") {
+				method = "PUT"
+			}
+			rr := serve(httptest.NewRequest(method, test.path, bytes.NewReader(test.body)))
+			if rr.Code != test.status {
+				t.Errorf("%s: expected status code %v, got %v %s", name, test.status, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusCreated {
+				var created EpubUpload
+				json.Unmarshal(rr.Body.Bytes(), &created)
+				ids = append(ids, created.Book.Book_Id)
+				if created.Cover != nil || len(created.Warnings) != 1 || created.Book.Pub_Date != "1933-01-01" {
+					t.Errorf("%s: expected the book without its cover, got %s", name, rr.Body.String())
+				}
+			}
+		}
+	})
+
+	t.Run("Testing DELETE /books/{id}/epub", func(t *testing.T) {
+		path := "/books/" + strconv.Itoa(upload.Book.Book_Id) + "/epub"
+		if rr := serve(httptest.NewRequest("DELETE", path, nil)); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %v, got %v", http.StatusNoContent, rr.Code)
+		}
+		if rr := serve(httptest.NewRequest("GET", path, nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+		if _, err := database.GetBook(db, upload.Book.Book_Id); err != nil {
+			t.Errorf("expected the book to be kept, got %v", err)
+		}
+		if rr := serve(httptest.NewRequest("DELETE", path, nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+}
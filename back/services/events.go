@@ -0,0 +1,127 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventsHandler streams the changes of the books as server-sent events
+type EventsHandler struct {
+	Broker *events.Broker
+}
+
+// topics of GET /events, the events and their kinds
+var eventTopics = append([]string{"book"}, Events...)
+
+// @Description	Sent as the reset event when the events missed by a client are no longer all kept, it should reload what it shows
+type EventsReset struct {
+	// @Property		last_event_id int true "ID of the last event kept, the stream goes on from there"
+	LastEventId int `json:"last_event_id"`
+}
+
+// Stream of the changes
+
+// @Summary		Stream of the changes
+// @Description	Streams the changes of the books as server-sent events (text/event-stream), each one a BookEvent with its audit_id as the event ID and its event name (book.created, book.updated, book.deleted or book.restored) as the event type. A client that reconnects with the Last-Event-ID header (browsers send it) gets the events it missed, or a reset event when they are no longer all kept, it should then reload the books. A ": heartbeat" comment is sent on an idle stream
+// @Tags			books
+// @Produce		text/event-stream
+// @Param			topics			query	string	false	"Comma separated events or kinds of events to stream, e.g. book.created,book.deleted or book, all of them by default"
+// @Param			last_event_id	query	int		false	"ID of the last event received, for the first connection, the Last-Event-ID header takes precedence"
+// @Param			Last-Event-ID	header	int		false	"ID of the last event received, sent by the browsers when they reconnect"
+// @Success		200 {object}	BookEvent
+// @Failure		400 {object}	ErrMessage
+// @Router			/events [get]
+func (handler *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	var topics []string
+	if value := r.URL.Query().Get("topics"); value != "" {
+		for _, topic := range strings.Split(value, ",") {
+			topic = strings.TrimSpace(topic)
+			if !slices.Contains(eventTopics, topic) {
+				w.WriteHeader(http.StatusBadRequest)
+				jsonResponse, _ := json.Marshal(ErrMessage{Msg: "unknown topic " + strconv.Quote(topic) + ", expected one of " + strings.Join(eventTopics, ", ")})
+				w.Write(jsonResponse)
+				return
+			}
+			topics = append(topics, topic)
+		}
+	}
+	lastId := 0
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		// an ID that isn't one of ours resumes nothing, the client only gets the next events
+		lastId, _ = strconv.Atoi(value)
+	} else if value := r.URL.Query().Get("last_event_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "last_event_id must be the ID of an event"})
+			w.Write(jsonResponse)
+			return
+		}
+		lastId = id
+	}
+
+	// reaches the Flush of the writer under the ones of the middlewares, through their Unwrap
+	controller := http.NewResponseController(w)
+	// the stream outlives any write timeout of the server
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers the responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		// a writer that can't flush, the client only sees the stream end
+		return
+	}
+
+	subscription, backlog, reset := handler.Broker.Subscribe(lastId)
+	defer subscription.Close()
+	if reset {
+		lastId := handler.Broker.LastId()
+		data, _ := json.Marshal(EventsReset{LastEventId: lastId})
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: %s\n\n", lastId, data)
+	}
+	for _, event := range backlog {
+		writeEvent(w, topics, event)
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(time.Duration(handler.Broker.Options().HeartbeatSeconds) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, open := <-subscription.Events:
+			if !open {
+				// too slow, it resumes from the log once it reconnects
+				return
+			}
+			writeEvent(w, topics, event)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writes the event in the format of the server-sent events, unless it isn't one of the topics
+func writeEvent(w http.ResponseWriter, topics []string, event BookEvent) {
+	if !events.Matches(topics, event.Event) {
+		return
+	}
+	// JSON has no line break, the data fits on one line
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Audit_Id, event.Event, data)
+}
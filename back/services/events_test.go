@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/events"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// one event read from a stream, comments skipped unless they are all there is
+type sentEvent struct {
+	id, name, data, comment string
+}
+
+func readEvent(t *testing.T, stream *bufio.Reader) sentEvent {
+	var event sentEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch {
+		case line == "":
+			if event != (sentEvent{}) {
+				return event
+			}
+		case strings.HasPrefix(line, ":"):
+			event.comment = strings.TrimPrefix(line, ": ")
+		case field == "id":
+			event.id = value
+		case field == "event":
+			event.name = value
+		case field == "data":
+			event.data = value
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	broker := events.NewBroker(events.Options{BufferSize: 100, HeartbeatSeconds: 1})
+	database.OnBookChange(db, broker.Publish)
+	books := &DBRequestHandler{Db: db}
+	handler := &EventsHandler{Broker: broker}
+	router := chi.NewRouter()
+	// the stream is flushed through the writers of the middlewares
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logger)
+	router.Post("/books", books.Add)
+	router.Put("/books/{id}", books.Update)
+	router.Get("/events", handler.Stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	connect := func(query, lastId string) *bufio.Reader {
+		request, _ := http.NewRequest("GET", server.URL+"/events"+query, nil)
+		if lastId != "" {
+			request.Header.Set("Last-Event-ID", lastId)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected a stream, got %v %s", response.StatusCode, response.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(response.Body)
+	}
+
+	stream := connect("", "")
+	created := connect("?topics=book.created", "")
+	var book Book
+	response, err := http.Post(server.URL+"/books", "application/json", strings.NewReader(`{"title": "Middlemarch", "author": "George Eliot", "pub_date": "1871-12-01"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(response.Body).Decode(&book)
+	response.Body.Close()
+	t.Cleanup(func() { db.Exec("DELETE FROM Books WHERE book_id = ?", book.Book_Id) })
+	var firstId string
+
+	t.Run("Testing a change is streamed", func(t *testing.T) {
+		event := readEvent(t, stream)
+		var data BookEvent
+		if err := json.Unmarshal([]byte(event.data), &data); err != nil || event.name != EventBookCreated || data.Book_Id != book.Book_Id ||
+			event.id != strconv.Itoa(data.Audit_Id) {
+			t.Fatalf("expected the creation of the book, got %+v", event)
+		}
+		firstId = event.id
+		t.Log(event)
+	})
+
+	t.Run("Testing the topics and the heartbeats", func(t *testing.T) {
+		request, _ := http.NewRequest("PUT", server.URL+"/books/"+strconv.Itoa(book.Book_Id), strings.NewReader(`{"title": "Middlemarch, A Study of Provincial Life", "author": "George Eliot", "pub_date": "1871-12-01"}`))
+		if response, err := http.DefaultClient.Do(request); err != nil || response.StatusCode != http.StatusOK {
+			t.Fatalf("expected the update, got %v %v", response, err)
+		}
+		if event := readEvent(t, created); event.name != EventBookCreated {
+			t.Errorf("expected the creation, got %+v", event)
+		}
+		// the update is left out
+		if event := readEvent(t, created); event.comment != "heartbeat" {
+			t.Errorf("expected a heartbeat, got %+v", event)
+		}
+		if event := readEvent(t, stream); event.name != EventBookUpdated {
+			t.Errorf("expected the update, got %+v", event)
+		}
+	})
+
+	t.Run("Testing the resume with Last-Event-ID", func(t *testing.T) {
+		if event := readEvent(t, connect("", firstId)); event.name != EventBookUpdated {
+			t.Errorf("expected the missed update, got %+v", event)
+		}
+		if event := readEvent(t, connect("?last_event_id="+firstId, "")); event.name != EventBookUpdated {
+			t.Errorf("expected the missed update, got %+v", event)
+		}
+	})
+
+	t.Run("Testing the invalid queries", func(t *testing.T) {
+		for _, query := range []string{"?topics=loan.created", "?last_event_id=abc"} {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/events"+query, nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %v, got %v", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	// the streams end with the server
+	deadline := time.Now().Add(time.Second)
+	server.CloseClientConnections()
+	for broker.Subscribers() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if broker.Subscribers() != 0 {
+		t.Errorf("expected the subscriptions to be closed, %d left", broker.Subscribers())
+	}
+}
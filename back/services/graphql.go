@@ -0,0 +1,132 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/mimminou/BookIT-ByFood/back/graph"
+)
+
+// biggest GraphQL request body accepted
+const maxGraphqlRequestSize = 1 << 20
+
+// GraphqlRequestHandler runs GraphQL requests against the DB
+type GraphqlRequestHandler struct {
+	Db     *sql.DB
+	Schema graphql.Schema
+	Limits graph.Limits
+}
+
+// Run a query sent in the URL
+
+// @Summary		GraphQL query
+// @Description	Runs a GraphQL query passed in the query string, mutations are refused. Malformed queries, queries that fail validation and queries over the depth or complexity limits are answered with 400
+// @Tags			graphql
+// @Produce		json
+// @Param			query			query	string	true	"GraphQL query"
+// @Param			variables		query	string	false	"Variables, as a JSON object"
+// @Param			operationName	query	string	false	"Operation to run when the query has several"
+// @Success		200
+// @Failure		400
+// @Router			/graphql [get]
+func (handler *GraphqlRequestHandler) Get(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := graph.Request{Query: query.Get("query"), OperationName: query.Get("operationName")}
+	if variables := query.Get("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+			graphqlError(w, "Invalid variables, should be a JSON object")
+			return
+		}
+	}
+	handler.execute(w, r, request, false)
+}
+
+// Run a query or a mutation sent in the body
+
+// @Summary		GraphQL query or mutation
+// @Description	Runs a GraphQL query or mutation. Malformed queries, queries that fail validation and queries over the depth or complexity limits are answered with 400
+// @Tags			graphql
+// @Accept			json
+// @Produce		json
+// @Param			request	body	graph.Request	true	"GraphQL request"
+// @Success		200
+// @Failure		400
+// @Router			/graphql [post]
+func (handler *GraphqlRequestHandler) Post(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxGraphqlRequestSize)
+	var request graph.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		graphqlError(w, "Invalid request, should be a JSON object with a query")
+		return
+	}
+	handler.execute(w, r, request, true)
+}
+
+func (handler *GraphqlRequestHandler) SendOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (handler *GraphqlRequestHandler) execute(w http.ResponseWriter, r *http.Request, request graph.Request, allowMutations bool) {
+	if request.Query == "" {
+		graphqlError(w, "Missing query")
+		return
+	}
+	result, rejected := graph.Execute(r.Context(), handler.Schema, handler.Db, request, handler.Limits, allowMutations)
+	w.Header().Set("Content-Type", "application/json")
+	if rejected {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// errors are written the way GraphQL clients expect them, in an errors list
+func graphqlError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(graphql.Result{Errors: gqlerrors.FormatErrors(errors.New(msg))})
+}
+
+// GraphiQL, loaded from a CDN, pointed at /graphql
+const graphiqlPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>BookIT GraphiQL</title>
+	<link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css">
+	<style>body { margin: 0; height: 100vh; } #graphiql { height: 100vh; }</style>
+</head>
+<body>
+	<div id="graphiql">Loading...</div>
+	<script crossorigin src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+	<script crossorigin src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+	<script crossorigin src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+	<script>
+		const fetcher = GraphiQL.createFetcher({ url: new URL("/graphql", window.location.href).href });
+		ReactDOM.createRoot(document.getElementById("graphiql")).render(React.createElement(GraphiQL, { fetcher }));
+	</script>
+</body>
+</html>
+`
+
+// Serves the GraphiQL playground
+
+// @Summary		GraphiQL playground
+// @Description	In-browser editor to write and run queries against /graphql
+// @Tags			graphql
+// @Produce		html
+// @Success		200
+// @Router			/graphiql [get]
+func ServeGraphiql(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(graphiqlPage))
+}
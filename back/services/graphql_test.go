@@ -0,0 +1,77 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/graph"
+)
+
+func TestGraphql(t *testing.T) {
+	schema, err := graph.NewSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &GraphqlRequestHandler{Db: db, Schema: schema, Limits: graph.DefaultLimits}
+	type response struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	send := func(method, body string) (int, response) {
+		var req *http.Request
+		if method == "GET" {
+			req = httptest.NewRequest("GET", "/graphql?"+body, nil)
+		} else {
+			req = httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		}
+		rr := httptest.NewRecorder()
+		if method == "GET" {
+			handler.Get(rr, req)
+		} else {
+			handler.Post(rr, req)
+		}
+		var decoded response
+		if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("invalid response %s", rr.Body.String())
+		}
+		return rr.Code, decoded
+	}
+
+	t.Run("Testing a query sent with GET", func(t *testing.T) {
+		query := url.Values{"query": {`query($name: String!) { author(name: $name) { name bookCount } }`}, "variables": {`{"name": "Mary Shelley"}`}}
+		code, body := send("GET", query.Encode())
+		if code != http.StatusOK || len(body.Errors) > 0 || !strings.Contains(string(body.Data["author"]), "Mary Shelley") {
+			t.Errorf("unexpected response %v %+v", code, body)
+		}
+	})
+
+	t.Run("Testing a query sent with POST", func(t *testing.T) {
+		code, body := send("POST", `{"query": "{ books(filter: {search: \"frankenstein\"}) { totalCount } }"}`)
+		if code != http.StatusOK || len(body.Errors) > 0 || string(body.Data["books"]) == `{"totalCount":0}` {
+			t.Errorf("unexpected response %v %+v", code, body)
+		}
+	})
+
+	t.Run("Testing rejected requests", func(t *testing.T) {
+		for _, test := range []struct{ method, body string }{
+			{"POST", `not json`},
+			{"POST", `{"query": ""}`},
+			{"POST", `{"query": "{ books {"}`},
+			{"POST", `{"query": "{ nothing }"}`},
+			{"GET", url.Values{"query": {`mutation { deleteBook(id: 1) }`}}.Encode()},
+			{"GET", url.Values{"query": {`{ books { totalCount } }`}, "variables": {`[]`}}.Encode()},
+			{"GET", url.Values{"query": {`{ books { items { author { books { author { books { author { books { title } } } } } } } } }`}}.Encode()},
+		} {
+			code, body := send(test.method, test.body)
+			if code != http.StatusBadRequest || len(body.Errors) == 0 {
+				t.Errorf("%s %s: expected a 400 with errors, got %v %+v", test.method, test.body, code, body)
+			}
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/formats"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// biggest file accepted by the import endpoint
+const maxImportSize = 10 << 20
+
+// Export the catalogue
+
+// @Summary		Export books
+// @Description	Streams the catalogue as csv, xlsx, json, ndjson, MARC 21 (ISO 2709) or MARCXML, accepts the same filters as GET /books
+// @Tags			books
+// @Produce		text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/json,application/x-ndjson,application/marc,application/marcxml+xml
+// @Param			format	query	string	false	"Export format"	Enums(csv, xlsx, json, ndjson, marc, marcxml)	default(json)
+// @Param			title	query	string	false	"Title contains"
+// @Param			author	query	string	false	"Author contains"
+// @Param			from	query	string	false	"Published on or after (YYYY-MM-DD)"
+// @Param			to		query	string	false	"Published on or before (YYYY-MM-DD)"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Failure		405
+// @Router			/books/export [get]
+func (handler *DBRequestHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+	}
+	if !formats.IsExportFormat(format) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid format, should be one of: " + strings.Join(formats.ExportFormats, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.Header().Set("Content-Type", formats.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="books.`+formats.FileExtension(format)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer, err := formats.NewBookWriter(format, w)
+	if err != nil {
+		log.Println("Error exporting books:", err)
+		return
+	}
+	// the status is already sent at this point, an error can only be logged and the output cut short
+	if err := database.StreamBooks(handler.Db, filter, writer.Write); err != nil {
+		log.Println("Error exporting books:", err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Println("Error exporting books:", err)
+	}
+}
+
+// Import books from a spreadsheet
+
+// @Summary		Import books
+// @Description	Imports books from a csv, xlsx, MARC 21 (ISO 2709) or MARCXML file, sent either as the raw body or as the "file" field of a multipart form.
+// @Description	Every row or record is validated like POST /books, valid ones are imported in a single transaction and invalid ones are reported.
+// @Description	For MARC files, the tags of the fields that have no book counterpart are reported in unmapped_fields.
+// @Tags			books
+// @Accept			text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/marc,application/marcxml+xml,multipart/form-data
+// @Produce		json
+// @Param			format	query	string	false	"Import format, guessed from the Content-Type or the file name when missing"	Enums(csv, xlsx, marc, marcxml)
+// @Param			mapping	query	string	false	"Column mapping for csv and xlsx, e.g. title=Book Title,author=Writer"
+// @Param			dry_run	query	bool	false	"Validate and preview without writing to the DB"
+// @Success		200	{object}	models.ImportReport
+// @Success		201	{object}	models.ImportReport
+// @Failure		400	{object}	ErrMessage
+// @Failure		405
+// @Failure		500	{object}	ErrMessage
+// @Router			/books/import [post]
+func (handler *DBRequestHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	defer r.Body.Close()
+
+	query := r.URL.Query()
+	format := strings.ToLower(query.Get("format"))
+	mappingSpec := query.Get("mapping")
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid dry_run value, should be true or false"})
+			w.Write(jsonResponse)
+			return
+		}
+		dryRun = parsed
+	}
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		file, fileHeader, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Missing 'file' field in form"})
+			w.Write(jsonResponse)
+			return
+		}
+		defer file.Close()
+		if format == "" {
+			format = formats.FormatFromFilename(fileHeader.Filename)
+		}
+		if mappingSpec == "" {
+			mappingSpec = r.FormValue("mapping")
+		}
+		data, err = io.ReadAll(file)
+	} else {
+		if format == "" {
+			format = formats.FormatFromContentType(r.Header.Get("Content-Type"))
+		}
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	if format == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Could not guess the import format, please set the 'format' query parameter"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	mapping, err := formats.ParseMapping(mappingSpec)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	rows, err := formats.ReadBooks(format, data, mapping)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	report := formats.NewImportReport(rows, dryRun)
+	if dryRun || len(report.Books) == 0 {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	ids, err := database.AddBooksAudited(handler.Db, report.Books, changeFrom(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	for i, id := range ids {
+		report.Books[i].Book_Id = id
+	}
+	report.Imported = len(ids)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	dbRequestHandler := &DBRequestHandler{Db: db}
+
+	t.Run("Testing csv export with a filter", func(t *testing.T) {
+		t.Log("Testing GET /books/export?format=csv&author=orwell")
+		req := httptest.NewRequest("GET", "/books/export?format=csv&author=orwell", nil)
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Export(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+			t.Errorf("returned wrong content type: got %v want %v", contentType, "text/csv")
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) < 2 {
+			t.Fatalf("expected a header and at least one book, got %v", records)
+		}
+		for _, record := range records[1:] {
+			if record[2] != "George Orwell" || record[4] != "1949-06-08" {
+				t.Errorf("expected only books by George Orwell with a YYYY-MM-DD date, got %v", record)
+			}
+		}
+	})
+
+	t.Run("Testing ndjson export", func(t *testing.T) {
+		t.Log("Testing GET /books/export?format=ndjson")
+		req := httptest.NewRequest("GET", "/books/export?format=ndjson", nil)
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Export(rr, req)
+
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		var book models.Book
+		if err := json.Unmarshal([]byte(lines[0]), &book); err != nil {
+			t.Fatal(err)
+		}
+		if book.Book_Id == 0 {
+			t.Errorf("expected a book on the first line, got %s", lines[0])
+		}
+	})
+
+	t.Run("Testing export with an unknown format", func(t *testing.T) {
+		t.Log("Testing GET /books/export?format=pdf")
+		req := httptest.NewRequest("GET", "/books/export?format=pdf", nil)
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Export(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Testing export with an invalid date filter", func(t *testing.T) {
+		t.Log("Testing GET /books/export?from=yesterday")
+		req := httptest.NewRequest("GET", "/books/export?from=yesterday", nil)
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Export(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	dbRequestHandler := &DBRequestHandler{Db: db}
+	spreadsheet := "Name,Writer,pub_date\nDune,Frank Herbert,1965-08-01\nBroken,,not a date\n"
+
+	t.Run("Testing import dry run", func(t *testing.T) {
+		t.Log("Testing POST /books/import?dry_run=true")
+		req := httptest.NewRequest("POST", "/books/import?dry_run=true&mapping=title=Name,author=Writer", strings.NewReader(spreadsheet))
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Import(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v, body %s", status, http.StatusOK, rr.Body.String())
+		}
+		var report models.ImportReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if !report.DryRun || report.Imported != 0 || report.Failed != 1 || len(report.Books) != 1 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("Testing import with a multipart upload", func(t *testing.T) {
+		t.Log("Testing POST /books/import")
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("mapping", "title=Name,author=Writer")
+		file, _ := form.CreateFormFile("file", "books.csv")
+		file.Write([]byte(spreadsheet))
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/books/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Import(rr, req)
+
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("returned wrong status code: got %v want %v, body %s", status, http.StatusCreated, rr.Body.String())
+		}
+		var report models.ImportReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Imported != 1 || report.Books[0].Book_Id == 0 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("Testing import without a format", func(t *testing.T) {
+		t.Log("Testing POST /books/import without format")
+		req := httptest.NewRequest("POST", "/books/import", strings.NewReader(spreadsheet))
+		rr := httptest.NewRecorder()
+		dbRequestHandler.Import(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/opds"
+)
+
+// number of entries in a page of an OPDS feed
+const opdsPageSize = 25
+
+var yearRegex = regexp.MustCompile(`^\d{4}$`)
+
+// OpdsRequestHandler serves the OPDS catalogue in one format, Atom (OPDS 1.2) or JSON (OPDS 2.0)
+type OpdsRequestHandler struct {
+	Db     *sql.DB
+	Format opds.Format
+}
+
+// catalogue whose links point back to the host the request was sent to
+func (handler *OpdsRequestHandler) catalog(r *http.Request) opds.Catalog {
+	return opds.Catalog{BaseUrl: requestBaseUrl(r), Format: handler.Format}
+}
+
+// scheme and host of the request, proxies are trusted to set X-Forwarded-Proto
+func requestBaseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded == "http" || forwarded == "https" {
+		scheme = forwarded
+	}
+	return scheme + "://" + r.Host
+}
+
+// Start feed of the catalogue
+
+// @Summary		OPDS start feed
+// @Description	Navigation feed linking to every book, the new arrivals, and the books by author and by year. /opds is OPDS 1.2 (Atom), /opds/v2 is OPDS 2.0 (JSON)
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Success		200
+// @Router			/opds [get]
+// @Router			/opds/v2 [get]
+func (handler *OpdsRequestHandler) Root(w http.ResponseWriter, r *http.Request) {
+	feed := &opds.Feed{
+		Path:    "",
+		Title:   "BookIT catalogue",
+		Kind:    opds.Navigation,
+		Updated: time.Now(),
+		Navigation: []opds.NavigationEntry{
+			{Title: "All books", Href: "/all", Kind: opds.Acquisition},
+			{Title: "New arrivals", Href: "/new", Kind: opds.Acquisition, New: true},
+			{Title: "By author", Href: "/authors", Kind: opds.Navigation},
+			{Title: "By year", Href: "/years", Kind: opds.Navigation},
+		},
+	}
+	total, err := database.CountBooks(handler.Db, database.BookFilter{})
+	if err != nil {
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	feed.Navigation[0].Count = total
+	handler.writeFeed(w, r, feed)
+}
+
+// Every book, by title
+
+// @Summary		OPDS feed of every book
+// @Description	Acquisition feed of every book sorted by title
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			page	query	int	false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Router			/opds/all [get]
+// @Router			/opds/v2/all [get]
+func (handler *OpdsRequestHandler) All(w http.ResponseWriter, r *http.Request) {
+	feed := &opds.Feed{Path: "/all", Title: "All books", Up: "/"}
+	handler.acquisitionFeed(w, r, feed, database.BookFilter{}, database.OrderTitle)
+}
+
+// Most recently added books
+
+// @Summary		OPDS feed of the new arrivals
+// @Description	Acquisition feed of the books, most recently added first
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			page	query	int	false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Router			/opds/new [get]
+// @Router			/opds/v2/new [get]
+func (handler *OpdsRequestHandler) NewArrivals(w http.ResponseWriter, r *http.Request) {
+	feed := &opds.Feed{Path: "/new", Title: "New arrivals", Up: "/"}
+	handler.acquisitionFeed(w, r, feed, database.BookFilter{}, database.OrderNewest)
+}
+
+// Search books by title or author
+
+// @Summary		OPDS search
+// @Description	Acquisition feed of the books whose title or author contains the search terms, OPDS 1.2 clients send them as q, OPDS 2.0 clients as query
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			q		query	string	false	"Search terms (OPDS 1.2)"
+// @Param			query	query	string	false	"Search terms (OPDS 2.0)"
+// @Param			page	query	int		false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Router			/opds/search [get]
+// @Router			/opds/v2/search [get]
+func (handler *OpdsRequestHandler) Search(w http.ResponseWriter, r *http.Request) {
+	parameter := "q"
+	if handler.Format == opds.Json {
+		parameter = "query"
+	}
+	terms := strings.TrimSpace(r.URL.Query().Get(parameter))
+	if terms == "" {
+		opdsError(w, http.StatusBadRequest, "Missing '"+parameter+"' search terms")
+		return
+	}
+	feed := &opds.Feed{
+		Path:  "/search",
+		Title: "Search results for \"" + terms + "\"",
+		Up:    "/",
+		Query: url.Values{parameter: {terms}},
+	}
+	handler.acquisitionFeed(w, r, feed, database.BookFilter{Search: terms}, database.OrderTitle)
+}
+
+// Authors of the catalogue
+
+// @Summary		OPDS feed of the authors
+// @Description	Navigation feed with an entry per author, linking to the books they wrote
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			page	query	int	false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Router			/opds/authors [get]
+// @Router			/opds/v2/authors [get]
+func (handler *OpdsRequestHandler) Authors(w http.ResponseWriter, r *http.Request) {
+	authors, err := database.GetAuthors(handler.Db)
+	if err != nil {
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	feed := &opds.Feed{Path: "/authors", Title: "Books by author", Up: "/"}
+	handler.navigationFeed(w, r, feed, authors, func(author models.Facet) opds.NavigationEntry {
+		return opds.NavigationEntry{Title: author.Value, Href: "/authors/" + url.PathEscape(author.Value), Kind: opds.Acquisition, Count: author.Count}
+	})
+}
+
+// Books of an author
+
+// @Summary		OPDS feed of the books of an author
+// @Description	Acquisition feed of the books of an author, sorted by title
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			author	path	string	true	"Author, as listed in the authors feed"
+// @Param			page	query	int		false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Failure		404	{object}	ErrMessage
+// @Router			/opds/authors/{author} [get]
+// @Router			/opds/v2/authors/{author} [get]
+func (handler *OpdsRequestHandler) Author(w http.ResponseWriter, r *http.Request) {
+	author := chi.URLParam(r, "author")
+	// chi hands over the escaped value when the path holds escaped slashes
+	if r.URL.RawPath != "" {
+		if unescaped, err := url.PathUnescape(author); err == nil {
+			author = unescaped
+		}
+	}
+	feed := &opds.Feed{Path: "/authors/" + url.PathEscape(author), Title: "Books by " + author, Up: "/authors"}
+	handler.acquisitionFeed(w, r, feed, database.BookFilter{ExactAuthor: author}, database.OrderTitle)
+}
+
+// Publication years of the catalogue
+
+// @Summary		OPDS feed of the publication years
+// @Description	Navigation feed with an entry per publication year, most recent first
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			page	query	int	false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Router			/opds/years [get]
+// @Router			/opds/v2/years [get]
+func (handler *OpdsRequestHandler) Years(w http.ResponseWriter, r *http.Request) {
+	years, err := database.GetPublicationYears(handler.Db)
+	if err != nil {
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	feed := &opds.Feed{Path: "/years", Title: "Books by year", Up: "/"}
+	handler.navigationFeed(w, r, feed, years, func(year models.Facet) opds.NavigationEntry {
+		return opds.NavigationEntry{Title: year.Value, Href: "/years/" + year.Value, Kind: opds.Acquisition, Count: year.Count}
+	})
+}
+
+// Books published in a year
+
+// @Summary		OPDS feed of the books published in a year
+// @Description	Acquisition feed of the books published in a year, sorted by title
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds+json
+// @Param			year	path	string	true	"Year (YYYY)"
+// @Param			page	query	int		false	"Page number, starting at 1"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Failure		404	{object}	ErrMessage
+// @Router			/opds/years/{year} [get]
+// @Router			/opds/v2/years/{year} [get]
+func (handler *OpdsRequestHandler) Year(w http.ResponseWriter, r *http.Request) {
+	year := chi.URLParam(r, "year")
+	if !yearRegex.MatchString(year) {
+		opdsError(w, http.StatusBadRequest, "Invalid year, should be YYYY")
+		return
+	}
+	feed := &opds.Feed{Path: "/years/" + year, Title: "Books published in " + year, Up: "/years"}
+	handler.acquisitionFeed(w, r, feed, database.BookFilter{Year: year}, database.OrderTitle)
+}
+
+// Single book
+
+// @Summary		OPDS entry of a book
+// @Description	Complete OPDS 1.2 entry or OPDS 2.0 publication of a book
+// @Tags			opds
+// @Produce		application/atom+xml,application/opds-publication+json
+// @Param			id	path	int	true	"Book ID"
+// @Success		200
+// @Failure		400	{object}	ErrMessage
+// @Failure		404	{object}	ErrMessage
+// @Router			/opds/books/{id} [get]
+// @Router			/opds/v2/books/{id} [get]
+func (handler *OpdsRequestHandler) Book(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		opdsError(w, http.StatusBadRequest, "Invalid book id")
+		return
+	}
+	book, err := database.GetBook(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			opdsError(w, http.StatusNotFound, "Book not found")
+			return
+		}
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	catalog := handler.catalog(r)
+	w.Header().Set("Content-Type", catalog.BookContentType())
+	w.WriteHeader(http.StatusOK)
+	catalog.WriteBook(w, book, time.Now())
+}
+
+// OpenSearch description of the search feed
+
+// @Summary		OpenSearch description
+// @Description	Describes the OPDS 1.2 search feed to e-reader apps
+// @Tags			opds
+// @Produce		application/opensearchdescription+xml
+// @Success		200
+// @Router			/opds/opensearch.xml [get]
+func (handler *OpdsRequestHandler) OpenSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", opds.OpenSearchType)
+	w.WriteHeader(http.StatusOK)
+	opds.WriteOpenSearch(w, requestBaseUrl(r))
+}
+
+// fills the feed with a page of the books matching the filter and writes it
+func (handler *OpdsRequestHandler) acquisitionFeed(w http.ResponseWriter, r *http.Request, feed *opds.Feed, filter database.BookFilter, order database.BookOrder) {
+	pageNumber, err := parsePageNumber(r)
+	if err != nil {
+		opdsError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	total, err := database.CountBooks(handler.Db, filter)
+	if err != nil {
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// an unknown author or a year without books is a missing feed, an empty catalogue is not
+	if total == 0 && (filter.ExactAuthor != "" || filter.Year != "") {
+		opdsError(w, http.StatusNotFound, "No books found")
+		return
+	}
+
+	feed.Kind = opds.Acquisition
+	feed.Updated = time.Now()
+	feed.Page = opds.Page{Number: pageNumber, Size: opdsPageSize, Total: total}
+	if pageNumber > feed.Page.LastPage() {
+		opdsError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+	feed.Publications, err = database.ListBooks(handler.Db, filter, order, feed.Page.Size, feed.Page.Offset())
+	if err != nil {
+		opdsError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	handler.writeFeed(w, r, feed)
+}
+
+// fills the feed with a page of navigation entries, one per facet, and writes it
+func (handler *OpdsRequestHandler) navigationFeed(w http.ResponseWriter, r *http.Request, feed *opds.Feed, facets []models.Facet, entry func(models.Facet) opds.NavigationEntry) {
+	pageNumber, err := parsePageNumber(r)
+	if err != nil {
+		opdsError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	feed.Kind = opds.Navigation
+	feed.Updated = time.Now()
+	feed.Page = opds.Page{Number: pageNumber, Size: opdsPageSize, Total: len(facets)}
+	if pageNumber > feed.Page.LastPage() {
+		opdsError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+	end := min(feed.Page.Offset()+feed.Page.Size, len(facets))
+	for _, facet := range facets[feed.Page.Offset():end] {
+		feed.Navigation = append(feed.Navigation, entry(facet))
+	}
+	handler.writeFeed(w, r, feed)
+}
+
+func (handler *OpdsRequestHandler) writeFeed(w http.ResponseWriter, r *http.Request, feed *opds.Feed) {
+	catalog := handler.catalog(r)
+	w.Header().Set("Content-Type", catalog.FeedContentType(feed.Kind))
+	w.WriteHeader(http.StatusOK)
+	catalog.WriteFeed(w, feed)
+}
+
+// the page query parameter, 1 when missing or empty
+func parsePageNumber(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("page")
+	if value == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 0, errors.New("Invalid page, should be a number starting at 1")
+	}
+	return page, nil
+}
+
+// errors are sent as json like the rest of the API, feeds readers show the status anyway
+func opdsError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	jsonResponse, _ := json.Marshal(ErrMessage{Msg: msg})
+	w.Write(jsonResponse)
+}
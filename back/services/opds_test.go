@@ -0,0 +1,185 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/opds"
+)
+
+// same routes as controllers.OpdsController, the controllers package can't be imported from here
+func opdsRouter() http.Handler {
+	router := chi.NewRouter()
+	register := func(mux chi.Router, handler *OpdsRequestHandler) {
+		mux.Get("/", handler.Root)
+		mux.Get("/all", handler.All)
+		mux.Get("/new", handler.NewArrivals)
+		mux.Get("/search", handler.Search)
+		mux.Get("/authors", handler.Authors)
+		mux.Get("/authors/{author}", handler.Author)
+		mux.Get("/years", handler.Years)
+		mux.Get("/years/{year}", handler.Year)
+		mux.Get("/books/{id}", handler.Book)
+	}
+	router.Route("/opds", func(mux chi.Router) {
+		atomHandler := &OpdsRequestHandler{Db: db, Format: opds.Atom}
+		register(mux, atomHandler)
+		mux.Get("/opensearch.xml", atomHandler.OpenSearch)
+		mux.Route("/v2", func(v2Mux chi.Router) {
+			register(v2Mux, &OpdsRequestHandler{Db: db, Format: opds.Json})
+		})
+	})
+	return router
+}
+
+type testAtomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+type testJsonFeed struct {
+	Metadata struct {
+		NumberOfItems int `json:"numberOfItems"`
+	} `json:"metadata"`
+	Navigation []struct {
+		Href  string `json:"href"`
+		Title string `json:"title"`
+	} `json:"navigation"`
+	Publications []struct {
+		Metadata struct {
+			Title  string `json:"title"`
+			Author string `json:"author"`
+		} `json:"metadata"`
+	} `json:"publications"`
+}
+
+func TestOpds(t *testing.T) {
+	router := opdsRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "library.example"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Testing the Atom start feed", func(t *testing.T) {
+		t.Log("Testing GET /opds")
+		rr := get("/opds")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != opds.AtomNavigationType {
+			t.Errorf("returned wrong content type: got %v", contentType)
+		}
+		var feed testAtomFeed
+		if err := xml.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		if len(feed.Entries) != 4 || feed.Entries[2].Links[0].Href != "http://library.example/opds/authors" {
+			t.Errorf("unexpected navigation entries %+v", feed.Entries)
+		}
+	})
+
+	t.Run("Testing the JSON authors feed and an author's books", func(t *testing.T) {
+		t.Log("Testing GET /opds/v2/authors")
+		rr := get("/opds/v2/authors")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != opds.JsonFeedType {
+			t.Errorf("returned wrong content type: got %v", contentType)
+		}
+		var feed testJsonFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		href := ""
+		for _, entry := range feed.Navigation {
+			if entry.Title == "Mary Shelley" {
+				href = entry.Href
+			}
+		}
+		if href != "http://library.example/opds/v2/authors/Mary%20Shelley" {
+			t.Fatalf("expected a link to the books of Mary Shelley, got %+v", feed.Navigation)
+		}
+
+		rr = get(strings.TrimPrefix(href, "http://library.example"))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		feed = testJsonFeed{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		if len(feed.Publications) == 0 {
+			t.Fatal("expected the books of Mary Shelley")
+		}
+		for _, publication := range feed.Publications {
+			if publication.Metadata.Author != "Mary Shelley" {
+				t.Errorf("expected only books of Mary Shelley, got %+v", publication.Metadata)
+			}
+		}
+	})
+
+	t.Run("Testing the books of a year", func(t *testing.T) {
+		t.Log("Testing GET /opds/years/1818")
+		rr := get("/opds/years/1818")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != opds.AtomAcquisitionType {
+			t.Errorf("returned wrong content type: got %v", contentType)
+		}
+	})
+
+	t.Run("Testing the search feeds", func(t *testing.T) {
+		t.Log("Testing GET /opds/v2/search?query=shelley")
+		rr := get("/opds/v2/search?query=shelley")
+		var feed testJsonFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != http.StatusOK || feed.Metadata.NumberOfItems == 0 {
+			t.Errorf("expected search results, got %v %s", rr.Code, rr.Body.String())
+		}
+
+		t.Log("Testing GET /opds/search without terms")
+		if rr := get("/opds/search"); rr.Code != http.StatusBadRequest {
+			t.Errorf("returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Testing status codes", func(t *testing.T) {
+		for path, status := range map[string]int{
+			"/opds/all?page=0":         http.StatusBadRequest,
+			"/opds/all?page=abc":       http.StatusBadRequest,
+			"/opds/v2/new?page=1000":   http.StatusNotFound,
+			"/opds/years/18":           http.StatusBadRequest,
+			"/opds/authors/Nobody":     http.StatusNotFound,
+			"/opds/v2/books/1000":      http.StatusNotFound,
+			"/opds/opensearch.xml":     http.StatusOK,
+			"/opds/v2/opensearch.xml":  http.StatusNotFound,
+			"/opds/all?page=1":         http.StatusOK,
+			"/opds/v2/years":           http.StatusOK,
+			"/opds/books/not-a-number": http.StatusBadRequest,
+			"/opds/search?q=x&page=":   http.StatusOK,
+		} {
+			t.Log("Testing GET " + path)
+			if rr := get(path); rr.Code != status {
+				t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, status)
+			}
+		}
+	})
+}
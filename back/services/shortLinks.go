@@ -0,0 +1,305 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ShortLinkOptions configures the short links, a field left empty takes its value from DefaultShortLinkOptions
+type ShortLinkOptions struct {
+	// operation of the URL cleaner a URL goes through before it is stored
+	Operation string `json:"operation"`
+	// length of the generated slugs
+	SlugLength int `json:"slug_length"`
+	// scheme and host the short URLs are built with, the ones of the request when empty
+	BaseUrl string `json:"base_url"`
+}
+
+var DefaultShortLinkOptions = ShortLinkOptions{Operation: "all", SlugLength: 7}
+
+func (options ShortLinkOptions) withDefaults() ShortLinkOptions {
+	if options.Operation == "" {
+		options.Operation = DefaultShortLinkOptions.Operation
+	}
+	if options.SlugLength <= 0 {
+		options.SlugLength = DefaultShortLinkOptions.SlugLength
+	}
+	options.BaseUrl = strings.TrimSuffix(options.BaseUrl, "/")
+	return options
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// custom slugs stay readable in a URL without escaping
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,64}$`)
+
+// generated slugs are random, a few attempts are made when one is already taken
+const slugAttempts = 5
+
+// ShortLinkHandler creates the short links and redirects them
+type ShortLinkHandler struct {
+	Db      *sql.DB
+	Rules   *urlrules.Engine
+	Options ShortLinkOptions
+}
+
+// Create a short link
+
+// @Summary		Create a short link
+// @Description	Processes the URL with the operation of the short links (redirection and canonical by default), then stores it under the slug, generated when none is given
+// @Tags			links
+// @Accept			json
+// @Produce		json
+// @Param			ShortLinkRequest	body	ShortLinkRequest	true	"Link to create"
+// @Success		201 {object}	ShortLink
+// @Failure		400 {object}	ErrMessage
+// @Failure		409 {object}	ErrMessage	"The slug is already taken"
+// @Failure		500 {object}	ErrMessage
+// @Failure		502 {object}	ErrMessage	"The URL could not be fetched by a network operation"
+// @Router			/links/ [post]
+func (handler *ShortLinkHandler) Create(w http.ResponseWriter, r *http.Request) {
+	options := handler.Options.withDefaults()
+	defer r.Body.Close()
+
+	var request ShortLinkRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid request format"})
+		w.Write(jsonResponse)
+		return
+	}
+	if request.Slug != "" && !slugPattern.MatchString(request.Slug) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid slug, should be 3 to 64 letters, digits, - or _"})
+		w.Write(jsonResponse)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "expires_at is in the past"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	result, err := handler.Rules.Run(r.Context(), request.Url, options.Operation)
+	if err != nil {
+		if errors.Is(err, urlfetch.ErrUnreachable) {
+			w.WriteHeader(http.StatusBadGateway)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	link := ShortLink{Slug: request.Slug, Url: result.Url, Permanent: request.Permanent, ExpiresAt: request.ExpiresAt, CreatedAt: now}
+	if link.Slug != "" {
+		err = database.AddShortLink(handler.Db, link)
+	} else {
+		for attempt := 0; attempt < slugAttempts; attempt++ {
+			if link.Slug, err = randomSlug(options.SlugLength); err != nil {
+				break
+			}
+			if err = database.AddShortLink(handler.Db, link); err != database.ErrSlugTaken {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if err == database.ErrSlugTaken {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			log.Println("Error adding short link:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	link.ShortUrl = shortUrl(r, options, link.Slug)
+	w.Header().Set("Location", "/links/"+link.Slug)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// Get a short link
+
+// @Summary		Get a short link
+// @Description	Gets a short link with its click counter
+// @Tags			links
+// @Produce		json
+// @Param			slug	path	string	true	"Slug"
+// @Success		200 {object}	ShortLink
+// @Failure		404 {object}	ErrMessage
+// @Router			/links/{slug} [get]
+func (handler *ShortLinkHandler) Get(w http.ResponseWriter, r *http.Request) {
+	link, ok := handler.fetch(w, chi.URLParam(r, "slug"))
+	if !ok {
+		return
+	}
+	link.ShortUrl = shortUrl(r, handler.Options.withDefaults(), link.Slug)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(link)
+}
+
+// Update a short link
+
+// @Summary		Update a short link
+// @Description	Disables or enables a short link, changes its expiry or its redirect status, the fields left out are kept
+// @Tags			links
+// @Accept			json
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of a staff member or an admin"
+// @Param			slug	path	string	true	"Slug"
+// @Param			ShortLinkUpdate	body	ShortLinkUpdate	true	"Changes"
+// @Success		200 {object}	ShortLink
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/links/{slug} [patch]
+func (handler *ShortLinkHandler) Update(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var update ShortLinkUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid request format"})
+		w.Write(jsonResponse)
+		return
+	}
+	if update.NoExpiry && update.ExpiresAt != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "expires_at and no_expiry can't be set together"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	link, ok := handler.fetch(w, chi.URLParam(r, "slug"))
+	if !ok {
+		return
+	}
+	if update.Permanent != nil {
+		link.Permanent = *update.Permanent
+	}
+	if update.Disabled != nil {
+		link.Disabled = *update.Disabled
+	}
+	if update.ExpiresAt != nil {
+		link.ExpiresAt = update.ExpiresAt
+	}
+	if update.NoExpiry {
+		link.ExpiresAt = nil
+	}
+	if err := database.UpdateShortLink(handler.Db, link); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	link.ShortUrl = shortUrl(r, handler.Options.withDefaults(), link.Slug)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(link)
+}
+
+// Follow a short link
+
+// @Summary		Follow a short link
+// @Description	Redirects to the destination of the link, with 301 for a permanent link and 302 otherwise, and counts the click
+// @Tags			links
+// @Param			slug	path	string	true	"Slug"
+// @Success		301
+// @Success		302
+// @Failure		404 {object}	ErrMessage
+// @Failure		410 {object}	ErrMessage	"The link is disabled or has expired"
+// @Router			/l/{slug} [get]
+func (handler *ShortLinkHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	link, ok := handler.fetch(w, chi.URLParam(r, "slug"))
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if link.Disabled || link.Expired(now) {
+		w.WriteHeader(http.StatusGone)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Link is no longer available"})
+		w.Write(jsonResponse)
+		return
+	}
+	// a lost click is not worth failing the redirect for
+	if err := database.AddShortLinkClick(handler.Db, link.Slug, now); err != nil {
+		log.Println("Error counting a click of", link.Slug, ":", err)
+	}
+	status := http.StatusFound
+	if link.Permanent {
+		status = http.StatusMovedPermanently
+	} else {
+		// so that every click reaches the server, and disabling the link takes effect
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	http.Redirect(w, r, link.Url, status)
+}
+
+// reads the link, writes the error response when it can't
+func (handler *ShortLinkHandler) fetch(w http.ResponseWriter, slug string) (ShortLink, bool) {
+	link, err := database.GetShortLink(handler.Db, slug)
+	if err == nil {
+		return link, true
+	}
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Link not found"})
+		w.Write(jsonResponse)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+	}
+	return link, false
+}
+
+// a slug of random base62 characters
+func randomSlug(length int) (string, error) {
+	slug := make([]byte, length)
+	max := big.NewInt(int64(len(base62)))
+	for i := range slug {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		slug[i] = base62[n.Int64()]
+	}
+	return string(slug), nil
+}
+
+// the URL that redirects to the link
+func shortUrl(r *http.Request, options ShortLinkOptions, slug string) string {
+	if options.BaseUrl != "" {
+		return options.BaseUrl + "/l/" + slug
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/l/%s", scheme, r.Host, slug)
+}
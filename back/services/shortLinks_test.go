@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shortLinkRouter() http.Handler {
+	handler := &ShortLinkHandler{Db: db, Rules: urlrules.Default(), Options: ShortLinkOptions{BaseUrl: "https://byf.ood/"}}
+	router := chi.NewRouter()
+	router.Post("/links", handler.Create)
+	router.Get("/links/{slug}", handler.Get)
+	router.With(RequireRole(db, RoleStaff, RoleAdmin)).Patch("/links/{slug}", handler.Update)
+	router.Get("/l/{slug}", handler.Follow)
+	return router
+}
+
+// the PATCH requests are made as a staff member
+func serveShortLink(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if method == "PATCH" {
+		req.Header.Set("Authorization", "Bearer links-staff-token")
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestShortLinks(t *testing.T) {
+	if _, err := database.AddUser(db, User{Name: "links-staff", Role: RoleStaff, CreatedAt: time.Now()}, utils.HashToken("links-staff-token")); err != nil {
+		t.Fatal(err)
+	}
+	router := shortLinkRouter()
+
+	t.Run("Testing a generated slug and its redirect", func(t *testing.T) {
+		t.Log("Testing POST /links then GET /l/{slug}")
+		rr := serveShortLink(router, "POST", "/links", `{"url":"https://BYFOOD.com/food-EXPeriences/?utm_source=x"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %v, got %v %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var link ShortLink
+		json.Unmarshal(rr.Body.Bytes(), &link)
+		if len(link.Slug) != 7 || strings.Trim(link.Slug, base62) != "" || link.Url != "https://www.byfood.com/food-EXPeriences" ||
+			link.ShortUrl != "https://byf.ood/l/"+link.Slug || rr.Header().Get("Location") != "/links/"+link.Slug {
+			t.Errorf("unexpected link %+v", link)
+		}
+
+		for i := 0; i < 3; i++ {
+			rr = serveShortLink(router, "GET", "/l/"+link.Slug, "")
+			if rr.Code != http.StatusFound || rr.Header().Get("Location") != link.Url || rr.Header().Get("Cache-Control") != "no-store" {
+				t.Fatalf("unexpected redirect %v %v", rr.Code, rr.Header())
+			}
+		}
+		rr = serveShortLink(router, "GET", "/links/"+link.Slug, "")
+		json.Unmarshal(rr.Body.Bytes(), &link)
+		if rr.Code != http.StatusOK || link.Clicks != 3 || link.LastClickedAt == nil {
+			t.Errorf("expected 3 clicks, got %v %+v", rr.Code, link)
+		}
+	})
+
+	t.Run("Testing a custom permanent slug", func(t *testing.T) {
+		t.Log("Testing POST /links with a slug")
+		rr := serveShortLink(router, "POST", "/links", `{"url":"https://byfood.com/tokyo","slug":"tokyo-tour","permanent":true}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %v, got %v %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		rr = serveShortLink(router, "GET", "/l/tokyo-tour", "")
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "https://www.byfood.com/tokyo" {
+			t.Errorf("unexpected redirect %v %v", rr.Code, rr.Header())
+		}
+		rr = serveShortLink(router, "POST", "/links", `{"url":"https://byfood.com/osaka","slug":"tokyo-tour"}`)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %v, got %v", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("Testing disabling and expiry", func(t *testing.T) {
+		t.Log("Testing PATCH /links/{slug}")
+		serveShortLink(router, "POST", "/links", `{"url":"https://byfood.com/kyoto","slug":"kyoto"}`)
+		rr := serveShortLink(router, "PATCH", "/links/kyoto", `{"disabled":true}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %v, got %v %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if rr = serveShortLink(router, "GET", "/l/kyoto", ""); rr.Code != http.StatusGone {
+			t.Errorf("expected status code %v, got %v", http.StatusGone, rr.Code)
+		}
+		serveShortLink(router, "PATCH", "/links/kyoto", `{"disabled":false}`)
+		if rr = serveShortLink(router, "GET", "/l/kyoto", ""); rr.Code != http.StatusFound {
+			t.Errorf("expected status code %v, got %v", http.StatusFound, rr.Code)
+		}
+
+		// expired links are only created in the past through the DB
+		past := time.Now().Add(-time.Hour)
+		database.AddShortLink(db, ShortLink{Slug: "expired", Url: "https://www.byfood.com/", ExpiresAt: &past, CreatedAt: past.Add(-time.Hour)})
+		if rr = serveShortLink(router, "GET", "/l/expired", ""); rr.Code != http.StatusGone {
+			t.Errorf("expected status code %v, got %v", http.StatusGone, rr.Code)
+		}
+		serveShortLink(router, "PATCH", "/links/expired", `{"no_expiry":true}`)
+		if rr = serveShortLink(router, "GET", "/l/expired", ""); rr.Code != http.StatusFound {
+			t.Errorf("expected status code %v, got %v", http.StatusFound, rr.Code)
+		}
+	})
+
+	t.Run("Testing PATCH /links/{slug} needs a staff member or an admin", func(t *testing.T) {
+		for _, token := range []string{"", "nope"} {
+			req := httptest.NewRequest("PATCH", "/links/kyoto", strings.NewReader(`{"disabled":true}`))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("token %q: expected status code %v, got %v %s", token, http.StatusUnauthorized, rr.Code, rr.Body.String())
+			}
+		}
+		if rr := serveShortLink(router, "GET", "/l/kyoto", ""); rr.Code != http.StatusFound {
+			t.Errorf("expected the link to be left alone, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Testing invalid requests", func(t *testing.T) {
+		t.Log("Testing status codes")
+		for _, test := range []struct {
+			method, target, body string
+			expected             int
+		}{
+			{"POST", "/links", `{"url":"https://notbyfood.com/a"}`, http.StatusBadRequest},
+			{"POST", "/links", `{"url":"https://byfood.com/a","slug":"a/b"}`, http.StatusBadRequest},
+			{"POST", "/links", `{"url":"https://byfood.com/a","slug":"ab"}`, http.StatusBadRequest},
+			{"POST", "/links", `{"url":"https://byfood.com/a","expires_at":"2001-01-01T00:00:00Z"}`, http.StatusBadRequest},
+			{"POST", "/links", `{"url":"https://byfood.com/a","clicks":5}`, http.StatusBadRequest},
+			{"PATCH", "/links/unknown", `{"disabled":true}`, http.StatusNotFound},
+			{"PATCH", "/links/kyoto", `{"no_expiry":true,"expires_at":"2101-01-01T00:00:00Z"}`, http.StatusBadRequest},
+			{"GET", "/links/unknown", "", http.StatusNotFound},
+			{"GET", "/l/unknown", "", http.StatusNotFound},
+		} {
+			if rr := serveShortLink(router, test.method, test.target, test.body); rr.Code != test.expected {
+				t.Errorf("%s %s %s: expected status code %v, got %v", test.method, test.target, test.body, test.expected, rr.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TrashOptions configures how long the deleted books stay in the trash, the config section "trash"
+type TrashOptions struct {
+	// books deleted more than this many days ago are purged by the server, the trash is only purged by hand when 0
+	RetentionDays int `json:"retention_days"`
+	// how often the server looks for books to purge
+	PurgeIntervalMinutes int `json:"purge_interval_minutes"`
+}
+
+var DefaultTrashOptions = TrashOptions{RetentionDays: 30, PurgeIntervalMinutes: 60}
+
+// TrashHandler lists, restores and purges the deleted books
+type TrashHandler struct {
+	Db *sql.DB
+	// where the covers and the EPUBs of the purged books are removed from
+	Storage storage.Storage
+}
+
+// @Description	Result of a purge of the trash
+type PurgeReport struct {
+	// @Property		purged int true "Number of books deleted for good"
+	Purged int `json:"purged"`
+}
+
+// List the trash
+
+// @Summary		List the deleted books
+// @Description	Lists the books in the trash, the most recently deleted first, they can be restored until they are purged
+// @Tags			books
+// @Produce		json
+// @Success		200 {array}	models.TrashedBook
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/trash [get]
+func (handler *TrashHandler) List(w http.ResponseWriter, r *http.Request) {
+	books, err := database.GetTrash(handler.Db)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(books)
+	w.Write(jsonResponse)
+}
+
+// Restore a book
+
+// @Summary		Restore a deleted book
+// @Description	Moves a book out of the trash, it is listed and can be edited again
+// @Tags			books
+// @Produce		json
+// @Param			id	path	int	true	"Book ID"
+// @Success		200 {object}	models.Book
+// @Failure		400 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage	"The book is not in the trash"
+// @Failure		500 {object}	ErrMessage
+// @Router			/books/{id}/restore [post]
+func (handler *TrashHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid book ID"})
+		w.Write(jsonResponse)
+		return
+	}
+	if err := database.RestoreBookAudited(handler.Db, id, changeFrom(r)); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Book not found in the trash"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	book, err := database.GetBook(handler.Db, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(book)
+	w.Write(jsonResponse)
+}
+
+// Purge the trash
+
+// @Summary		Purge the trash
+// @Description	Deletes for good the books in the trash, all of them or the ones deleted more than older_than_days days ago, with the files of their covers and EPUBs
+// @Tags			admin
+// @Produce		json
+// @Param			Authorization		header	string	true	"Bearer token of an admin"
+// @Param			older_than_days	query	int		false	"Only purge the books deleted more than this many days ago"
+// @Success		200 {object}	PurgeReport
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/admin/trash [delete]
+func (handler *TrashHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	before := time.Now()
+	if value := r.URL.Query().Get("older_than_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "older_than_days must be a number of days"})
+			w.Write(jsonResponse)
+			return
+		}
+		before = before.AddDate(0, 0, -days)
+	}
+	purged, err := handler.purge(before)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(PurgeReport{Purged: purged})
+	w.Write(jsonResponse)
+}
+
+// purges the books deleted at or before the time, and removes the files of their covers and EPUBs from the storage
+func (handler *TrashHandler) purge(before time.Time) (int, error) {
+	purge, err := database.PurgeBooks(handler.Db, before)
+	if err != nil {
+		return 0, err
+	}
+	coverHandler := &CoverHandler{Db: handler.Db, Storage: handler.Storage}
+	for _, cover := range purge.Covers {
+		coverHandler.remove(cover)
+	}
+	epubHandler := &EpubHandler{Db: handler.Db, Storage: handler.Storage}
+	for _, file := range purge.Epubs {
+		epubHandler.remove(file)
+	}
+	return purge.Books, nil
+}
+
+// SchedulePurge purges the books deleted more than RetentionDays ago every PurgeIntervalMinutes until the context is done
+// report is called after each purge
+func SchedulePurge(ctx context.Context, db *sql.DB, files storage.Storage, options TrashOptions, report func(int, error)) {
+	if options.RetentionDays <= 0 || options.PurgeIntervalMinutes <= 0 {
+		return
+	}
+	handler := &TrashHandler{Db: db, Storage: files}
+	purge := func() {
+		report(handler.purge(time.Now().AddDate(0, 0, -options.RetentionDays)))
+	}
+	// the books past the retention while the server was down don't wait for the first tick
+	purge()
+	ticker := time.NewTicker(time.Duration(options.PurgeIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
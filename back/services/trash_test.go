@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/covers"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/storage"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTrash(t *testing.T) {
+	id, err := database.AddBook(db, Book{Title: "The Castle", Author: "Franz Kafka", Pub_Date: "1926-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteBook(db, id); err != nil {
+		t.Fatal(err)
+	}
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &TrashHandler{Db: db, Storage: files}
+	router := chi.NewRouter()
+	router.Get("/books/trash", handler.List)
+	router.Post("/books/{id}/restore", handler.Restore)
+	router.Delete("/admin/trash", handler.Purge)
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	t.Run("Testing GET /books/trash", func(t *testing.T) {
+		rr := serve("GET", "/books/trash")
+		var books []TrashedBook
+		if err := json.Unmarshal(rr.Body.Bytes(), &books); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("expected the trash, got %v %s", rr.Code, rr.Body.String())
+		}
+		if len(books) == 0 || books[0].Book_Id != id || books[0].DeletedAt.IsZero() {
+			t.Errorf("expected book %d first with its deletion time, got %+v", id, books)
+		}
+		t.Log(rr.Body.String())
+	})
+
+	t.Run("Testing POST /books/{id}/restore", func(t *testing.T) {
+		rr := serve("POST", "/books/"+strconv.Itoa(id)+"/restore")
+		var book Book
+		json.Unmarshal(rr.Body.Bytes(), &book)
+		if rr.Code != http.StatusOK || book.Title != "The Castle" {
+			t.Errorf("expected the restored book, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("POST", "/books/"+strconv.Itoa(id)+"/restore"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v for a book out of the trash, got %v", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve("POST", "/books/abc/restore"); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v, got %v", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("Testing DELETE /admin/trash", func(t *testing.T) {
+		// the book has a cover and an EPUB, their files go with it
+		var picture bytes.Buffer
+		png.Encode(&picture, image.NewGray(image.Rect(0, 0, 200, 300)))
+		processed, err := covers.Process(picture.Bytes(), covers.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cover, err := (&CoverHandler{Db: db, Storage: files}).save(context.Background(), id, processed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := Epub{Book_Id: id, Filename: "the-castle.epub", Etag: "castle", UploadedAt: time.Now()}
+		if err := files.Put(context.Background(), epubKey(file.Etag), bytes.NewReader([]byte("epub")), 4, "application/epub+zip"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.SetEpub(db, file); err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{epubKey(file.Etag), coverKey(id, cover.Etag, originalCover)}
+		for _, size := range covers.Sizes {
+			keys = append(keys, coverKey(id, cover.Etag, size.Name))
+		}
+
+		if err := database.DeleteBook(db, id); err != nil {
+			t.Fatal(err)
+		}
+		if rr := serve("DELETE", "/admin/trash?older_than_days=-1"); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v, got %v", http.StatusBadRequest, rr.Code)
+		}
+		var report PurgeReport
+		rr := serve("DELETE", "/admin/trash?older_than_days=1")
+		if json.Unmarshal(rr.Body.Bytes(), &report); rr.Code != http.StatusOK || report.Purged != 0 {
+			t.Errorf("expected nothing deleted more than a day ago, got %v %s", rr.Code, rr.Body.String())
+		}
+		rr = serve("DELETE", "/admin/trash")
+		if json.Unmarshal(rr.Body.Bytes(), &report); rr.Code != http.StatusOK || report.Purged == 0 {
+			t.Errorf("expected the trash to be purged, got %v %s", rr.Code, rr.Body.String())
+		}
+		books, _ := database.GetTrash(db)
+		if len(books) != 0 {
+			t.Errorf("expected an empty trash, got %+v", books)
+		}
+		for _, key := range keys {
+			if _, err := files.Get(context.Background(), key); err != storage.ErrNotFound {
+				t.Errorf("expected %s to be removed from the storage, got %v", key, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlcleaner"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// BatchLimits bounds POST /url/batch, a field left at 0 takes its value from DefaultBatchLimits
+type BatchLimits struct {
+	// most items a request can hold
+	MaxItems int `json:"max_items"`
+	// biggest request body, in bytes
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// URLs processed at the same time by a request
+	Workers int `json:"workers"`
+}
+
+var DefaultBatchLimits = BatchLimits{MaxItems: 10000, MaxBodyBytes: 10 << 20, Workers: 8}
+
+func (limits BatchLimits) withDefaults() BatchLimits {
+	if limits.MaxItems <= 0 {
+		limits.MaxItems = DefaultBatchLimits.MaxItems
+	}
+	if limits.MaxBodyBytes <= 0 {
+		limits.MaxBodyBytes = DefaultBatchLimits.MaxBodyBytes
+	}
+	if limits.Workers <= 0 {
+		limits.Workers = DefaultBatchLimits.Workers
+	}
+	return limits
+}
+
+// an item waiting for a worker, done receives its result
+type batchJob struct {
+	result BatchResult
+	raw    json.RawMessage
+	done   chan BatchResult
+}
+
+// Process a list of URLs
+
+// @Summary		Process URLs in batch
+// @Description	Processes a JSON array, or NDJSON (one object per line), of {url, operation} items like POST /url.
+// @Description	The response has the format of the request, with one result per item in the order of the request, and is streamed as the items are processed.
+// @Description	An item that fails has an error instead of a processed_url, the others are still processed.
+// @Description	A body that can't be read any further (malformed JSON, too many items, too large) ends the response with a last result holding the error.
+// @Tags			url
+// @Accept			json,application/x-ndjson
+// @Produce		json,application/x-ndjson
+// @Param			items	body	[]RequestStruct	true	"Items to process"
+// @Success		200 {array}	BatchResult
+// @Failure		400 {object}	ErrMessage
+// @Failure		405
+// @Failure		413 {object}	ErrMessage
+// @Router			/url/batch [post]
+func (handler *UrlRequestHandler) ProcessBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limits := handler.Batch.withDefaults()
+
+	if r.ContentLength > limits.MaxBodyBytes {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: fmt.Sprintf("Request body is larger than %d bytes", limits.MaxBodyBytes)})
+		w.Write(jsonResponse)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes)
+	defer r.Body.Close()
+
+	body := bufio.NewReader(r.Body)
+	first, err := firstByte(body)
+	if err != nil || (first != '[' && first != '{') {
+		w.WriteHeader(http.StatusBadRequest)
+		msg := "Invalid request format, should be a JSON array or NDJSON"
+		if err == io.EOF {
+			msg = "Error : Request Body is empty"
+		}
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: msg})
+		w.Write(jsonResponse)
+		return
+	}
+	array := first == '['
+
+	// results are written while the body is still being read
+	http.NewResponseController(w).EnableFullDuplex()
+	if array {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	jobs := make(chan batchJob)
+	// results are written in this order, the buffer bounds how far the reader gets ahead of the writer
+	pending := make(chan chan BatchResult, 4*limits.Workers)
+	for i := 0; i < limits.Workers; i++ {
+		go func() {
+			for job := range jobs {
+				job.done <- handler.processItem(r.Context(), job.result, job.raw)
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		readBatch(json.NewDecoder(body), array, limits, func(job batchJob) {
+			job.done = make(chan BatchResult, 1)
+			pending <- job.done
+			// items that failed to be read already have their result
+			if job.raw == nil {
+				job.done <- job.result
+				return
+			}
+			jobs <- job
+		})
+	}()
+
+	output := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	// sends what is buffered, when there is nothing to write until the reader or the workers catch up
+	flush := func() {
+		output.Flush()
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if array {
+		output.WriteString("[")
+	}
+	for written := 0; ; written++ {
+		var done chan BatchResult
+		var more bool
+		select {
+		case done, more = <-pending:
+		default:
+			flush()
+			done, more = <-pending
+		}
+		if !more {
+			break
+		}
+		var result BatchResult
+		select {
+		case result = <-done:
+		default:
+			flush()
+			result = <-done
+		}
+		if array && written > 0 {
+			output.WriteString(",")
+		}
+		line, _ := json.Marshal(result)
+		output.Write(line)
+		output.WriteString("\n")
+	}
+	if array {
+		output.WriteString("]\n")
+	}
+	if err := output.Flush(); err != nil {
+		log.Println("Error writing URL batch:", err)
+	}
+}
+
+// reads the items one at a time and passes them on to emit
+// an error that stops the reading is passed on as the result of the item it happened at
+func readBatch(decoder *json.Decoder, array bool, limits BatchLimits, emit func(batchJob)) {
+	fail := func(index int, err error) {
+		var tooLarge *http.MaxBytesError
+		msg := "Invalid request format: " + err.Error()
+		if errors.As(err, &tooLarge) {
+			msg = fmt.Sprintf("Request body is larger than %d bytes", limits.MaxBodyBytes)
+		}
+		emit(batchJob{result: BatchResult{Index: index, Error: msg}})
+	}
+
+	if array {
+		// the opening bracket
+		if _, err := decoder.Token(); err != nil {
+			fail(0, err)
+			return
+		}
+	}
+	for index := 0; ; index++ {
+		if array && !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				fail(index, err)
+			}
+			return
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err != io.EOF {
+				fail(index, err)
+			}
+			return
+		}
+		if index >= limits.MaxItems {
+			emit(batchJob{result: BatchResult{Index: index, Error: fmt.Sprintf("Too many items, at most %d are processed", limits.MaxItems)}})
+			return
+		}
+		emit(batchJob{result: BatchResult{Index: index}, raw: raw})
+	}
+}
+
+// runs an item like POST /url would
+func (handler *UrlRequestHandler) processItem(ctx context.Context, result BatchResult, raw json.RawMessage) BatchResult {
+	request, err := urlcleaner.DecodeRequest(bytes.NewReader(raw))
+	if err != nil {
+		result.Error = urlcleaner.ErrInvalidRequest.Error()
+		return result
+	}
+	result.Url, result.Operation = request.Url, request.Operation
+	response, err := urlcleaner.Process(ctx, handler.Rules, request)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ProcessedUrl = response.ProcessedUrl
+	return result
+}
+
+// the first byte of the body that is not white space, left unread
+func firstByte(body *bufio.Reader) (byte, error) {
+	for {
+		next, err := body.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(next[0])) {
+			return next[0], nil
+		}
+		body.ReadByte()
+	}
+}
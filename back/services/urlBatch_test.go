@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postBatch(handler *UrlRequestHandler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/url/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ProcessBatch(rr, req)
+	return rr
+}
+
+func TestUrlBatch(t *testing.T) {
+	handler := &UrlRequestHandler{Rules: urlrules.Default(), Batch: BatchLimits{MaxItems: 300, Workers: 3}}
+
+	t.Run("Testing a JSON array keeps the order of the items", func(t *testing.T) {
+		t.Log("Testing POST /url/batch with a JSON array")
+		var items []RequestStruct
+		for i := 0; i < 250; i++ {
+			items = append(items, RequestStruct{Url: fmt.Sprintf("https://byfood.com/Page-%d/?a=b", i), Operation: "all"})
+		}
+		items[7] = RequestStruct{Url: "https://notbyfood.com/a", Operation: "redirection"}
+		items[8] = RequestStruct{Url: "not a url", Operation: "all"}
+		body, _ := json.Marshal(items)
+
+		rr := postBatch(handler, string(body))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("unexpected response %v %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		var results []BatchResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 250 {
+			t.Fatalf("expected 250 results, got %d", len(results))
+		}
+		for i, result := range results {
+			switch {
+			case result.Index != i:
+				t.Errorf("expected index %d, got %d", i, result.Index)
+			case i == 7:
+				if result.Error != "URL is not from ByFood Domain" {
+					t.Errorf("unexpected result %+v", result)
+				}
+			case i == 8:
+				if result.Error != "Url format invalid" {
+					t.Errorf("unexpected result %+v", result)
+				}
+			case result.ProcessedUrl != fmt.Sprintf("https://www.byfood.com/Page-%d", i) || result.Error != "":
+				t.Errorf("unexpected result %+v", result)
+			}
+		}
+	})
+
+	t.Run("Testing NDJSON", func(t *testing.T) {
+		t.Log("Testing POST /url/batch with NDJSON")
+		rr := postBatch(handler, `{"url": "https://byfood.com/a?utm_source=x&b=1", "operation": "clean"}
+
+{"link": "https://byfood.com/a", "op": "all"}
+{"url": "https://byfood.com/b/", "operation": "canonical"}
+`)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("unexpected response %v %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		expected := []string{
+			`{"index":0,"url":"https://byfood.com/a?utm_source=x\u0026b=1","operation":"clean","processed_url":"https://byfood.com/a?b=1"}`,
+			`{"index":1,"error":"Invalid request format"}`,
+			`{"index":2,"url":"https://byfood.com/b/","operation":"canonical","processed_url":"https://byfood.com/b"}`,
+		}
+		if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("unexpected results\n%s", rr.Body.String())
+		}
+	})
+
+	t.Run("Testing limits and malformed bodies", func(t *testing.T) {
+		t.Log("Testing POST /url/batch limits")
+		small := &UrlRequestHandler{Rules: urlrules.Default(), Batch: BatchLimits{MaxItems: 2, MaxBodyBytes: 200}}
+
+		rr := postBatch(small, `[{"url": "https://byfood.com/a", "operation": "all"}, {}, {}, {}]`)
+		var results []BatchResult
+		json.Unmarshal(rr.Body.Bytes(), &results)
+		if len(results) != 3 || results[2].Index != 2 || results[2].Error != "Too many items, at most 2 are processed" {
+			t.Errorf("unexpected results %s", rr.Body.String())
+		}
+
+		rr = postBatch(small, strings.Repeat(" ", 201)+"[]")
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected %v, got %v", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+
+		// without a Content-Length the limit is only hit while reading
+		req := httptest.NewRequest("POST", "/url/batch", io.MultiReader(strings.NewReader(`{}`+"\n"), strings.NewReader(strings.Repeat(" ", 300)+"{}")))
+		req.ContentLength = -1
+		rr = httptest.NewRecorder()
+		small.ProcessBatch(rr, req)
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if len(lines) != 2 || lines[1] != `{"index":1,"error":"Request body is larger than 200 bytes"}` {
+			t.Errorf("unexpected results %s", rr.Body.String())
+		}
+
+		rr = postBatch(handler, `[{"url": "https://byfood.com/a", "operation": "all"}, {"url": ]`)
+		results = nil
+		json.Unmarshal(rr.Body.Bytes(), &results)
+		if len(results) != 2 || results[0].ProcessedUrl == "" || !strings.HasPrefix(results[1].Error, "Invalid request format: ") {
+			t.Errorf("unexpected results %s", rr.Body.String())
+		}
+
+		for body, msg := range map[string]string{
+			"":           "Error : Request Body is empty",
+			"  \n":       "Error : Request Body is empty",
+			`"https://"`: "Invalid request format, should be a JSON array or NDJSON",
+		} {
+			rr := postBatch(handler, body)
+			var errMessage ErrMessage
+			json.Unmarshal(rr.Body.Bytes(), &errMessage)
+			if rr.Code != http.StatusBadRequest || errMessage.Msg != msg {
+				t.Errorf("%q: unexpected response %v %s", body, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("Testing results are streamed before the body ends", func(t *testing.T) {
+		t.Log("Testing POST /url/batch streaming")
+		server := httptest.NewServer(http.HandlerFunc(handler.ProcessBatch))
+		defer server.Close()
+
+		bodyReader, bodyWriter := io.Pipe()
+		req, _ := http.NewRequest("POST", server.URL, bodyReader)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		responses := make(chan *http.Response)
+		go func() {
+			response, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				close(responses)
+				return
+			}
+			responses <- response
+		}()
+
+		fmt.Fprintln(bodyWriter, `{"url": "https://byfood.com/first/", "operation": "canonical"}`)
+		response, ok := <-responses
+		if !ok {
+			return
+		}
+		defer response.Body.Close()
+		lines := bufio.NewScanner(response.Body)
+		if !lines.Scan() || !strings.Contains(lines.Text(), `"processed_url":"https://byfood.com/first"`) {
+			t.Fatalf("expected the first result before the body ends, got %q", lines.Text())
+		}
+
+		fmt.Fprintln(bodyWriter, `{"url": "https://byfood.com/second/", "operation": "canonical"}`)
+		bodyWriter.Close()
+		if !lines.Scan() || !strings.Contains(lines.Text(), `"index":1`) || lines.Scan() {
+			t.Errorf("unexpected second result %q", lines.Text())
+		}
+	})
+}
@@ -2,24 +2,32 @@ package services
 
 import (
 	"encoding/json"
-	. "github.com/mimminou/BookIT-ByFood/back/models"
-	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"github.com/mimminou/BookIT-ByFood/back/urlcleaner"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
 	"net/http"
 )
 
+// UrlRequestHandler runs the operations of the URL cleaner, the rule sets of its engine
+type UrlRequestHandler struct {
+	Rules *urlrules.Engine
+	// limits of POST /url/batch
+	Batch BatchLimits
+}
+
 // routes requests that have ID based on HTTP
 
 // @Summary		Process URL
-// @Description	Processes URLs depending on the requested operation
+// @Description	Processes URLs depending on the requested operation, the name of a rule set listed by /url/operations
 // @Tags			url
 // @Accept			json
 // @Produce		json
-// @Param			RequestStruct	body	RequestStruct	true	"Request Body"
-// @Success		200 {object}	ResponseStruct
+// @Param			RequestStruct	body	models.RequestStruct	true	"Request Body"
+// @Success		200 {object}	models.ResponseStruct
 // @Failure		400 {object}	ErrMessage
 // @Failure		405
+// @Failure		502 {object}	ErrMessage	"The URL could not be fetched by a network operation"
 // @Router			/url/ [post]
-func ProcessUrl(w http.ResponseWriter, r *http.Request) {
+func (handler *UrlRequestHandler) ProcessUrl(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -35,84 +43,45 @@ func ProcessUrl(w http.ResponseWriter, r *http.Request) {
 
 	if r.ContentLength == 0 {
 		w.WriteHeader(http.StatusBadRequest)
-		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Error : Request Body is empty"})
-		w.Write(jsonResponse)
-		return
-	}
-
-	var request RequestStruct
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-
-	decodeErr := decoder.Decode(&request)
-	if decodeErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid request format"})
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: urlcleaner.ErrEmptyRequest.Error()})
 		w.Write(jsonResponse)
 		return
 	}
 
-	if utils.IsUrl(request.Url) == false {
+	request, err := urlcleaner.DecodeRequest(r.Body)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Url format invalid"})
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
 		w.Write(jsonResponse)
 		return
 	}
 
-	// We are sure it's a URL from this point
-
-	//check operation type and run it, if not valid, return BAD REQUEST
-	switch request.Operation {
-	case "canonical":
-		processedUrl, err := utils.GetCanonicalUrl(request.Url)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
-			w.Write(jsonResponse)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		jsonResponse, _ := json.Marshal(ResponseStruct{ProcessedUrl: processedUrl})
-		w.Write(jsonResponse)
-		return
-	case "redirection":
-		processedUrl, err := utils.GetRedirectionUrl(request.Url)
-		if err != nil {
+	response, err := urlcleaner.Process(r.Context(), handler.Rules, request)
+	if err != nil {
+		// the URL was fine, the host it points to was not
+		if urlcleaner.FailureOf(err) == urlcleaner.Unreachable {
+			w.WriteHeader(http.StatusBadGateway)
+		} else {
 			w.WriteHeader(http.StatusBadRequest)
-			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
-			w.Write(jsonResponse)
-			return
 		}
-		w.WriteHeader(http.StatusOK)
-		jsonResponse, _ := json.Marshal(ResponseStruct{ProcessedUrl: processedUrl})
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
 		w.Write(jsonResponse)
 		return
+	}
+	w.WriteHeader(http.StatusOK)
+	jsonResponse, _ := json.Marshal(response)
+	w.Write(jsonResponse)
+}
 
-	case "all":
-		processedUrl, err := utils.GetCanonicalUrl(request.Url)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
-			w.Write(jsonResponse)
-			return
-		}
-
-		processedUrl, err = utils.GetRedirectionUrl(processedUrl) //reprocess url
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
-			w.Write(jsonResponse)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		jsonResponse, _ := json.Marshal(ResponseStruct{ProcessedUrl: processedUrl})
-		w.Write(jsonResponse)
-		return
+// List the operations
 
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid operation"})
-		w.Write(jsonResponse)
-		return
-	}
+// @Summary		List URL operations
+// @Description	Lists the operations POST /url accepts, the rule sets of the rule file
+// @Tags			url
+// @Produce		json
+// @Success		200 {array}	urlrules.Operation
+// @Router			/url/operations [get]
+func (handler *UrlRequestHandler) Operations(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(handler.Rules.Operations())
 }
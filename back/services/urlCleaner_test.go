@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -26,10 +28,12 @@ type MissingUrlRequest struct {
 	Operation string `json:"operation"`
 }
 
+var urlHandler = &UrlRequestHandler{Rules: urlrules.Default()}
+
 func SetupMockServer() *http.Server {
 	serverMux := chi.NewRouter()
 	serverMux.Use(middleware.Logger)
-	serverMux.HandleFunc("/", ProcessUrl)
+	serverMux.HandleFunc("/", urlHandler.ProcessUrl)
 
 	//Hardcoded port number, only for testing
 	log.Println("Testing mock server on port", 50503)
@@ -63,7 +67,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 
 		resultBody := ResponseStruct{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
@@ -89,7 +93,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "Url format invalid" {
@@ -111,11 +115,33 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
+		resultBody := ResponseStruct{}
+		json.Unmarshal(w.Body.Bytes(), &resultBody)
+		if resultBody.ProcessedUrl != "https://www.byfood.com/FOOD-EXPeriences/" {
+			t.Errorf("Expected %s, got %s", "https://www.byfood.com/FOOD-EXPeriences/", resultBody.ProcessedUrl)
+		}
+	})
+
+	t.Run("Test clean with tracking parameters", func(t *testing.T) {
+		t.Log("Test clean with tracking parameters")
+
+		reqBody := RequestStruct{
+			Url:       "https://BYFOOD.com/food-experiences?utm_source=news&page=2&fbclid=abc&sort=&id=7#reviews",
+			Operation: "clean",
+		}
+
+		jsonBody, _ := json.Marshal(reqBody)
+
+		rr := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(jsonBody))
+		rr.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ResponseStruct{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
-		if resultBody.ProcessedUrl != "https://www.byfood.com/food-experiences/" {
-			t.Errorf("Expected %s, got %s", "https://www.byfood.com/food-experiences/", resultBody.ProcessedUrl)
+		if resultBody.ProcessedUrl != "https://byfood.com/food-experiences?id=7&page=2" {
+			t.Errorf("Expected %s, got %s", "https://byfood.com/food-experiences?id=7&page=2", resultBody.ProcessedUrl)
 		}
 	})
 
@@ -134,7 +160,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "URL is not from ByFood Domain" {
@@ -157,7 +183,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "Invalid operation" {
@@ -180,7 +206,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "Invalid request format" {
@@ -202,7 +228,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "Invalid operation" {
@@ -224,7 +250,7 @@ func TestUrlCleaner(t *testing.T) {
 		rr.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		ProcessUrl(w, rr)
+		urlHandler.ProcessUrl(w, rr)
 		resultBody := ErrMessage{}
 		json.Unmarshal(w.Body.Bytes(), &resultBody)
 		if resultBody.Msg != "Url format invalid" {
@@ -233,3 +259,72 @@ func TestUrlCleaner(t *testing.T) {
 	})
 
 }
+
+func TestUrlNormalization(t *testing.T) {
+	for _, test := range []struct {
+		url, operation, expected, err string
+	}{
+		{"HTTPS://ByFood.COM:443/Food-Experiences/./Tokyo/../Kyoto", "normalize", "https://byfood.com/Food-Experiences/Kyoto", ""},
+		{"http://byfood.com:8080", "normalize", "http://byfood.com:8080/", ""},
+		{"https://user@[2001:DB8::1]:443/%7eA%2f", "normalize", "https://user@[2001:db8::1]/~A%2F", ""},
+		{"https://Bücher.example/Liste?q=%e3%81%82", "normalize", "https://xn--bcher-kva.example/Liste?q=%E3%81%82", ""},
+		{"https://BYFOOD.com/Food-EXPeriences?query=abc/", "redirection", "https://www.byfood.com/Food-EXPeriences?query=abc/", ""},
+		{"HTTP://WWW.ByFood.com:80/a/../Food", "redirection", "https://www.byfood.com/Food", ""},
+		{"https://byfood.com.evil.com/a", "redirection", "", "URL is not from ByFood Domain"},
+		{"https://ByFood.com/Food/./?utm_source=x&b=&a=1#Top", "clean", "https://byfood.com/Food/?a=1", ""},
+		{"https:byfood.com", "normalize", "", "URL host is not valid"},
+	} {
+		jsonBody, _ := json.Marshal(RequestStruct{Url: test.url, Operation: test.operation})
+		rr := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(jsonBody))
+		rr.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		urlHandler.ProcessUrl(w, rr)
+
+		resultBody := struct {
+			ResponseStruct
+			ErrMessage
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &resultBody)
+		if resultBody.ProcessedUrl != test.expected || resultBody.Msg != test.err {
+			t.Errorf("%s %s: expected %q %q, got %q %q", test.operation, test.url, test.expected, test.err, resultBody.ProcessedUrl, resultBody.Msg)
+		}
+	}
+}
+
+func TestUrlResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/s/abc" {
+			w.Header().Set("Location", "/food-experiences?id=7")
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	rules := urlrules.Default()
+	// httptest servers are on 127.0.0.1
+	rules.SetFetcher(urlfetch.New(urlfetch.Options{AllowPrivate: true, HopTimeoutSeconds: 1}))
+	handler := &UrlRequestHandler{Rules: rules}
+	post := func(link string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(RequestStruct{Url: link, Operation: "resolve"})
+		w := httptest.NewRecorder()
+		handler.ProcessUrl(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(jsonBody)))
+		return w
+	}
+
+	w := post(server.URL + "/s/abc")
+	resultBody := ResponseStruct{}
+	json.Unmarshal(w.Body.Bytes(), &resultBody)
+	if w.Code != http.StatusOK || resultBody.ProcessedUrl != server.URL+"/food-experiences?id=7" {
+		t.Errorf("unexpected response %v %s", w.Code, w.Body.String())
+	}
+	if len(resultBody.Chain) != 2 || resultBody.Chain[0].Status != http.StatusFound || resultBody.Chain[1].Status != http.StatusOK {
+		t.Errorf("unexpected chain %+v", resultBody.Chain)
+	}
+
+	// nothing listens there anymore
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if w := post(closed.URL); w.Code != http.StatusBadGateway {
+		t.Errorf("expected %v, got %v %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/mimminou/BookIT-ByFood/back/sitemap"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// biggest sitemap accepted, a little more than the 50MB a single sitemap can hold
+const maxSitemapSize = 64 << 20
+
+// operation of the sitemap audit when none is requested, it checks the domain and the scheme
+const defaultSitemapOperation = "redirection"
+
+// Audit a sitemap
+
+// @Summary		Audit a sitemap
+// @Description	Reads a sitemap or a sitemap index (gzipped or not), sent either as the raw body or as the "file" field of a multipart form, and runs every <loc> through the operation.
+// @Description	The report lists the malformed, off-domain, non-canonical and duplicate entries, and the entries with an invalid lastmod, changefreq or priority.
+// @Description	With output=sitemap the corrected sitemap is returned instead: fixed entries hold their processed URL, the others are left out.
+// @Description	A sitemap over the limits of the protocol (50,000 URLs or 50MB) is split, and the response is a zip of the parts and of the index (sitemap.xml) listing them under base_url.
+// @Tags			url
+// @Accept			xml,application/gzip,multipart/form-data
+// @Produce		json,xml,application/zip
+// @Param			operation	query	string	false	"Operation run on every <loc>, redirection by default"
+// @Param			output		query	string	false	"report (default) or sitemap"	Enums(report, sitemap)
+// @Param			base_url	query	string	false	"URL the parts of a split sitemap are published at, needed to split it"
+// @Success		200 {object}	sitemap.Report
+// @Failure		400 {object}	ErrMessage
+// @Failure		405
+// @Failure		413 {object}	ErrMessage
+// @Router			/url/sitemap [post]
+func (handler *UrlRequestHandler) AuditSitemap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSitemapSize)
+	defer r.Body.Close()
+
+	query := r.URL.Query()
+	operation := query.Get("operation")
+	if operation == "" {
+		operation = defaultSitemapOperation
+	}
+	output := query.Get("output")
+	if output != "" && output != "report" && output != "sitemap" {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid output, should be report or sitemap"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxSitemapSize); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Missing 'file' field in form"})
+			w.Write(jsonResponse)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	parsed, err := sitemap.Parse(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	report, corrected, err := sitemap.Audit(r.Context(), parsed, handler.Rules, operation)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if output != "sitemap" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	// the files are written in memory first, whether there are several of them is only known at the end
+	files := map[string]*bytes.Buffer{}
+	names, err := sitemap.Write(corrected, sitemap.DefaultLimits, query.Get("base_url"), func(name string) (io.WriteCloser, error) {
+		files[name] = &bytes.Buffer{}
+		return nopCloser{files[name]}, nil
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if len(names) == 1 {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(files[names[0]].Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="sitemaps.zip"`)
+	w.WriteHeader(http.StatusOK)
+	archive := zip.NewWriter(w)
+	for _, name := range names {
+		file, err := archive.Create(name)
+		if err == nil {
+			_, err = file.Write(files[name].Bytes())
+		}
+		if err != nil {
+			log.Println("Error writing the sitemaps:", err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Println("Error writing the sitemaps:", err)
+	}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
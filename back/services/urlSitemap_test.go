@@ -0,0 +1,112 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mimminou/BookIT-ByFood/back/sitemap"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://www.byfood.com/a</loc></url>
+  <url><loc>http://byfood.com/a/</loc></url>
+  <url><loc>https://example.com/b</loc></url>
+</urlset>`
+
+func TestUrlSitemap(t *testing.T) {
+	handler := &UrlRequestHandler{Rules: urlrules.Default()}
+	post := func(target, contentType string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.AuditSitemap(rr, req)
+		return rr
+	}
+
+	t.Run("Testing the report of an uploaded sitemap", func(t *testing.T) {
+		t.Log("Testing POST /url/sitemap with a multipart form")
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, _ := form.CreateFormFile("file", "sitemap.xml")
+		file.Write([]byte(testSitemap))
+		form.Close()
+
+		rr := post("/url/sitemap?operation=all", form.FormDataContentType(), &body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %v, got %v %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var report sitemap.Report
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		if report.Operation != "all" || report.Entries != 3 || report.Kept != 1 || report.Counts[sitemap.Duplicate] != 1 || report.Counts[sitemap.OffDomain] != 1 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("Testing the corrected sitemap", func(t *testing.T) {
+		t.Log("Testing POST /url/sitemap?output=sitemap")
+		rr := post("/url/sitemap?output=sitemap", "application/xml", strings.NewReader(testSitemap))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml" {
+			t.Fatalf("unexpected response %v %s", rr.Code, rr.Body.String())
+		}
+		corrected, err := sitemap.Parse(rr.Body)
+		// redirection keeps the trailing slash, both entries stay
+		if err != nil || len(corrected.Entries) != 2 || corrected.Entries[1].Loc != "https://www.byfood.com/a/" {
+			t.Errorf("unexpected sitemap %+v %v", corrected, err)
+		}
+	})
+
+	t.Run("Testing a sitemap over the URL limit is split", func(t *testing.T) {
+		t.Log("Testing POST /url/sitemap?output=sitemap with 50,001 URLs")
+		var body strings.Builder
+		body.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := 0; i <= sitemap.DefaultLimits.MaxUrls; i++ {
+			fmt.Fprintf(&body, "<url><loc>https://www.byfood.com/page-%d</loc></url>", i)
+		}
+		body.WriteString(`</urlset>`)
+
+		if rr := post("/url/sitemap?output=sitemap", "application/xml", strings.NewReader(body.String())); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v without base_url, got %v", http.StatusBadRequest, rr.Code)
+		}
+		rr := post("/url/sitemap?output=sitemap&base_url=https://www.byfood.com/sitemaps/", "application/xml", strings.NewReader(body.String()))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("unexpected response %v %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		if strings.Join(names, ",") != "sitemap-1.xml,sitemap-2.xml,sitemap.xml" {
+			t.Errorf("unexpected files %v", names)
+		}
+	})
+
+	t.Run("Testing invalid requests", func(t *testing.T) {
+		t.Log("Testing status codes")
+		for _, test := range []struct {
+			target, body string
+			expected     int
+		}{
+			{"/url/sitemap", `<rss/>`, http.StatusBadRequest},
+			{"/url/sitemap", `<urlset><url>`, http.StatusBadRequest},
+			{"/url/sitemap?operation=nothing", testSitemap, http.StatusBadRequest},
+			{"/url/sitemap?output=csv", testSitemap, http.StatusBadRequest},
+		} {
+			if rr := post(test.target, "application/xml", strings.NewReader(test.body)); rr.Code != test.expected {
+				t.Errorf("%s: expected status code %v, got %v", test.target, test.expected, rr.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shortest secret accepted for a webhook, a generated one is 32 bytes
+const minSecretLength = 16
+
+var deliveryStatuses = []string{DeliveryPending, DeliveryDelivered, DeliveryFailed}
+
+// WebhookHandler manages the webhooks and their deliveries, the deliveries are sent by the webhooks package
+type WebhookHandler struct {
+	Db *sql.DB
+}
+
+// a random secret for a webhook, hex
+func newSecret() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(random), nil
+}
+
+// the problems of the URL and events of a webhook, the events are deduplicated
+func validateWebhook(hook *Webhook) []string {
+	var problems []string
+	if parsed, err := url.Parse(hook.Url); err != nil || !utils.IsUrl(hook.Url) || parsed.Host == "" {
+		problems = append(problems, "url must be an http or https URL")
+	}
+	if len(hook.Events) == 0 {
+		problems = append(problems, "events must list at least one event")
+	}
+	var events []string
+	for _, event := range hook.Events {
+		if !slices.Contains(Events, event) {
+			problems = append(problems, "unknown event "+strconv.Quote(event)+", expected one of "+strings.Join(Events, ", "))
+		} else if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	hook.Events = events
+	return problems
+}
+
+// Create a webhook
+
+// @Summary		Create a webhook
+// @Description	Subscribes a URL to book events, each event is POSTed to it as a BookEvent with the headers X-Bookit-Event, X-Bookit-Delivery and X-Bookit-Signature, "t=<unix time>,v1=<HMAC-SHA256 of "<unix time>.<body>" with the secret, hex>". The secret is only shown in this response
+// @Tags			webhooks
+// @Accept			json
+// @Produce		json
+// @Param			Authorization	header	string			true	"Bearer token of an admin"
+// @Param			WebhookRequest	body	WebhookRequest	true	"Webhook to create"
+// @Success		201 {object}	Webhook
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/ [post]
+func (handler *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var request WebhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid request format"})
+		w.Write(jsonResponse)
+		return
+	}
+	hook := Webhook{Url: request.Url, Events: request.Events, Secret: request.Secret, Active: true, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	problems := validateWebhook(&hook)
+	if hook.Secret != "" && len(hook.Secret) < minSecretLength {
+		problems = append(problems, "secret must be at least "+strconv.Itoa(minSecretLength)+" characters")
+	}
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: strings.Join(problems, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+
+	var err error
+	if hook.Secret == "" {
+		hook.Secret, err = newSecret()
+	}
+	if err == nil {
+		hook.Webhook_Id, err = database.AddWebhook(handler.Db, hook)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+strconv.Itoa(hook.Webhook_Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// List the webhooks
+
+// @Summary		List the webhooks
+// @Description	Lists the webhooks, without their secrets
+// @Tags			webhooks
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Success		200 {array}	Webhook
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/ [get]
+func (handler *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	hooks, err := database.GetWebhooks(handler.Db)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(hooks)
+	w.Write(jsonResponse)
+}
+
+// Get a webhook
+
+// @Summary		Get a webhook
+// @Description	Gets a webhook, without its secret
+// @Tags			webhooks
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			id				path	int		true	"Webhook ID"
+// @Success		200 {object}	Webhook
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Router			/webhooks/{id} [get]
+func (handler *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	hook, ok := handler.fetch(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(hook)
+}
+
+// Update a webhook
+
+// @Summary		Update a webhook
+// @Description	Changes the URL or the events of a webhook, deactivates or reactivates it, or rotates its secret, the fields left out are kept. The new secret is only shown in this response. The deliveries of an inactive webhook wait until it is active again
+// @Tags			webhooks
+// @Accept			json
+// @Produce		json
+// @Param			Authorization	header	string			true	"Bearer token of an admin"
+// @Param			id				path	int				true	"Webhook ID"
+// @Param			WebhookUpdate	body	WebhookUpdate	true	"Changes"
+// @Success		200 {object}	Webhook
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/{id} [patch]
+func (handler *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var update WebhookUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid request format"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	hook, ok := handler.fetch(w, r)
+	if !ok {
+		return
+	}
+	if update.Url != nil {
+		hook.Url = *update.Url
+	}
+	if update.Events != nil {
+		hook.Events = update.Events
+	}
+	if update.Active != nil {
+		hook.Active = *update.Active
+	}
+	if problems := validateWebhook(&hook); len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: strings.Join(problems, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+	var err error
+	if update.RotateSecret {
+		hook.Secret, err = newSecret()
+	}
+	if err == nil {
+		err = database.UpdateWebhook(handler.Db, hook)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	json.NewEncoder(w).Encode(hook)
+}
+
+// Delete a webhook
+
+// @Summary		Delete a webhook
+// @Description	Deletes a webhook with its deliveries, the ones not sent yet are dropped
+// @Tags			webhooks
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			id				path	int		true	"Webhook ID"
+// @Success		204
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/{id} [delete]
+func (handler *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	if err := database.DeleteWebhook(handler.Db, id); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Webhook not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries of a webhook
+
+// @Summary		Deliveries of a webhook
+// @Description	Lists the deliveries of a webhook, the most recent first, with their payload and the outcome of their last attempt
+// @Tags			webhooks
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			id				path	int		true	"Webhook ID"
+// @Param			status			query	string	false	"pending, delivered or failed"
+// @Param			limit			query	int		false	"Number of deliveries, 100 by default, 1000 at most"
+// @Param			offset			query	int		false	"Number of deliveries to skip"
+// @Success		200 {array}	WebhookDelivery
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/{id}/deliveries [get]
+func (handler *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains(deliveryStatuses, status) {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "status must be one of " + strings.Join(deliveryStatuses, ", ")})
+		w.Write(jsonResponse)
+		return
+	}
+	limit, offset, err := pageOf(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	hook, ok := handler.fetch(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := database.GetDeliveries(handler.Db, hook.Webhook_Id, status, limit, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	jsonResponse, _ := json.Marshal(deliveries)
+	w.Write(jsonResponse)
+}
+
+// Redeliver
+
+// @Summary		Redeliver an event
+// @Description	Queues a new delivery of the payload of a delivery, sent at the next poll of the dispatcher whatever became of the first one
+// @Tags			webhooks
+// @Produce		json
+// @Param			Authorization	header	string	true	"Bearer token of an admin"
+// @Param			id				path	int		true	"Webhook ID"
+// @Param			delivery_id		path	int		true	"Delivery to send again"
+// @Success		202 {object}	WebhookDelivery
+// @Failure		400 {object}	ErrMessage
+// @Failure		401 {object}	ErrMessage
+// @Failure		403 {object}	ErrMessage
+// @Failure		404 {object}	ErrMessage
+// @Failure		500 {object}	ErrMessage
+// @Router			/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (handler *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	deliveryId, err := strconv.Atoi(chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid delivery ID"})
+		w.Write(jsonResponse)
+		return
+	}
+	delivery, err := database.Redeliver(handler.Db, id, deliveryId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Delivery not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// the ID of the path, answers 400 when it isn't one
+func webhookId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Invalid webhook ID"})
+		w.Write(jsonResponse)
+		return 0, false
+	}
+	return id, true
+}
+
+// gets the webhook of the path, answers 400 or 404 when it can't
+func (handler *WebhookHandler) fetch(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return Webhook{}, false
+	}
+	hook, err := database.GetWebhook(handler.Db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			jsonResponse, _ := json.Marshal(ErrMessage{Msg: "Webhook not found"})
+			w.Write(jsonResponse)
+			return Webhook{}, false
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		jsonResponse, _ := json.Marshal(ErrMessage{Msg: err.Error()})
+		w.Write(jsonResponse)
+		return Webhook{}, false
+	}
+	return hook, true
+}
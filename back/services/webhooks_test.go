@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	. "github.com/mimminou/BookIT-ByFood/back/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestWebhooks(t *testing.T) {
+	handler := &WebhookHandler{Db: db}
+	router := chi.NewRouter()
+	router.Post("/webhooks", handler.Create)
+	router.Get("/webhooks", handler.List)
+	router.Get("/webhooks/{id}", handler.Get)
+	router.Patch("/webhooks/{id}", handler.Update)
+	router.Delete("/webhooks/{id}", handler.Delete)
+	router.Get("/webhooks/{id}/deliveries", handler.Deliveries)
+	router.Post("/webhooks/{id}/deliveries/{delivery_id}/redeliver", handler.Redeliver)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	var hook Webhook
+	rr := serve("POST", "/webhooks", `{"url": "https://search.example.com/hooks", "events": ["book.created", "book.updated", "book.created"]}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &hook); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("expected a new webhook, got %v %s", rr.Code, rr.Body.String())
+	}
+	path := "/webhooks/" + strconv.Itoa(hook.Webhook_Id)
+
+	t.Run("Testing POST /webhooks", func(t *testing.T) {
+		if !strings.HasPrefix(hook.Secret, "whsec_") || len(hook.Events) != 2 || !hook.Active {
+			t.Errorf("expected a generated secret and the events once, got %+v", hook)
+		}
+		for _, body := range []string{
+			`{"url": "ftp://example.com", "events": ["book.created"]}`,
+			`{"url": "https://example.com", "events": []}`,
+			`{"url": "https://example.com", "events": ["loan.created"]}`,
+			`{"url": "https://example.com", "events": ["book.created"], "secret": "short"}`,
+			`{"url": "https://example.com", "events": ["book.created"], "extra": true}`,
+		} {
+			if rr := serve("POST", "/webhooks", body); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %v, got %v", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Testing the secret is not shown again", func(t *testing.T) {
+		rr := serve("GET", "/webhooks", "")
+		var hooks []Webhook
+		if err := json.Unmarshal(rr.Body.Bytes(), &hooks); err != nil || len(hooks) != 1 || hooks[0].Secret != "" {
+			t.Errorf("expected the webhook without its secret, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("GET", path, ""); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "secret") {
+			t.Errorf("expected the webhook without its secret, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("GET", "/webhooks/999999", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Testing PATCH /webhooks/{id}", func(t *testing.T) {
+		rr := serve("PATCH", path, `{"events": ["book.deleted"], "rotate_secret": true}`)
+		var updated Webhook
+		if json.Unmarshal(rr.Body.Bytes(), &updated); rr.Code != http.StatusOK || updated.Secret == "" || updated.Secret == hook.Secret ||
+			len(updated.Events) != 1 || updated.Url != hook.Url {
+			t.Errorf("expected a new secret and the new events, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("PATCH", path, `{"url": "not a url"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v, got %v", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("Testing the deliveries and redeliveries", func(t *testing.T) {
+		id, err := database.AddBook(db, Book{Title: "Persuasion", Author: "Jane Austen", Pub_Date: "1817-12-20"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.DeleteBookAudited(db, id, database.Change{Actor: anonymous}); err != nil {
+			t.Fatal(err)
+		}
+		rr := serve("GET", path+"/deliveries?status=pending", "")
+		var deliveries []WebhookDelivery
+		if err := json.Unmarshal(rr.Body.Bytes(), &deliveries); err != nil || len(deliveries) != 1 || deliveries[0].Event != EventBookDeleted {
+			t.Fatalf("expected the deletion to be queued, got %v %s", rr.Code, rr.Body.String())
+		}
+		t.Log(rr.Body.String())
+		if rr := serve("GET", path+"/deliveries?status=lost", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %v, got %v", http.StatusBadRequest, rr.Code)
+		}
+
+		rr = serve("POST", path+"/deliveries/"+strconv.Itoa(deliveries[0].Delivery_Id)+"/redeliver", "")
+		var redelivery WebhookDelivery
+		if json.Unmarshal(rr.Body.Bytes(), &redelivery); rr.Code != http.StatusAccepted || redelivery.RedeliveryOf != deliveries[0].Delivery_Id {
+			t.Errorf("expected a redelivery, got %v %s", rr.Code, rr.Body.String())
+		}
+		if rr := serve("POST", path+"/deliveries/999999/redeliver", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Testing DELETE /webhooks/{id}", func(t *testing.T) {
+		if rr := serve("DELETE", path, ""); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %v, got %v", http.StatusNoContent, rr.Code)
+		}
+		if rr := serve("DELETE", path, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %v, got %v", http.StatusNotFound, rr.Code)
+		}
+		if deliveries, _ := database.GetDeliveries(db, hook.Webhook_Id, "", 100, 0); len(deliveries) != 0 {
+			t.Errorf("expected the deliveries to be deleted, got %+v", deliveries)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+/**
+Layered settings on top of a struct and its json tags
+A setting is named by the json tags of its path, e.g. "url_fetch.max_hops", the same name is used by the files,
+the environment (PREFIX_URL_FETCH_MAX_HOPS) and Set, so a struct needs no other tag
+Fields tagged `secret:"true"` are redacted by Redacted
+**/
+
+// Formats lists the file formats Decode reads, the extension of the file picks one
+var Formats = []string{"json", "yaml", "toml"}
+
+var ErrUnknownFormat = errors.New("unknown settings file format, expected .json, .yaml, .yml or .toml")
+
+// Decode reads a settings file onto the target, the settings missing from the file keep their value
+// unknown settings are an error, so that a typo doesn't go unnoticed
+func Decode(filename string, data []byte, target any) error {
+	var generic any
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	default:
+		return fmt.Errorf("%s: %w", filename, ErrUnknownFormat)
+	}
+	// YAML and TOML go through JSON, which the struct is tagged for
+	if generic != nil {
+		var err error
+		if data, err = json.Marshal(generic); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			return fmt.Errorf("%s: %s must be %s, got %s", filename, typeError.Field, typeName(typeError.Type), typeError.Value)
+		}
+		// "json: unknown field "x"" reads oddly for a YAML or TOML file
+		return fmt.Errorf("%s: %s", filename, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// Keys lists the settings of the target, in the order of the struct
+func Keys(target any) []string {
+	var keys []string
+	walk(reflect.ValueOf(target).Elem(), "", func(key string, _ reflect.Value, _ reflect.StructField) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// EnvName is the environment variable of a setting
+func EnvName(prefix, key string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// ApplyEnv sets the settings found in the environment, lookup is os.LookupEnv outside of tests
+// every invalid value is reported, not only the first one
+func ApplyEnv(target any, prefix string, lookup func(string) (string, bool)) error {
+	var errs []error
+	walk(reflect.ValueOf(target).Elem(), "", func(key string, field reflect.Value, _ reflect.StructField) {
+		name := EnvName(prefix, key)
+		if value, found := lookup(name); found {
+			if err := setValue(field, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Set sets one setting from its text, as "key=value" flags and environment variables give it
+func Set(target any, key, value string) error {
+	var found bool
+	var err error
+	walk(reflect.ValueOf(target).Elem(), "", func(current string, field reflect.Value, _ reflect.StructField) {
+		if current == key {
+			found = true
+			err = setValue(field, value)
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Redacted returns the settings as nested maps, ready to be marshalled, with the secrets that are set replaced
+func Redacted(target any) (map[string]any, error) {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	values = normalize(values).(map[string]any)
+
+	walk(reflect.ValueOf(target).Elem(), "", func(key string, field reflect.Value, structField reflect.StructField) {
+		if structField.Tag.Get("secret") != "true" || field.IsZero() {
+			return
+		}
+		parts := strings.Split(key, ".")
+		section := values
+		for _, part := range parts[:len(parts)-1] {
+			section = section[part].(map[string]any)
+		}
+		section[parts[len(parts)-1]] = "<redacted>"
+	})
+	return values, nil
+}
+
+// json numbers as integers when they are, so that YAML and TOML don't print 1e+07
+func normalize(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, inner := range value {
+			value[key] = normalize(inner)
+		}
+		return value
+	case []any:
+		for index, inner := range value {
+			value[index] = normalize(inner)
+		}
+		return value
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	}
+	return value
+}
+
+// walk calls visit with every setting, the fields of nested structs are settings of their own
+func walk(value reflect.Value, prefix string, visit func(key string, field reflect.Value, structField reflect.StructField)) {
+	for index := 0; index < value.NumField(); index++ {
+		structField := value.Type().Field(index)
+		name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if !structField.IsExported() || name == "-" {
+			continue
+		}
+		field := value.Field(index)
+		// the fields of an embedded struct are promoted, as encoding/json does
+		if name == "" && structField.Anonymous && field.Kind() == reflect.Struct {
+			walk(field, prefix, visit)
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if field.Kind() == reflect.Struct {
+			walk(field, key, visit)
+			continue
+		}
+		visit(key, field, structField)
+	}
+}
+
+// setValue parses the text into the field, lists are comma separated
+func setValue(field reflect.Value, text string) error {
+	text = strings.TrimSpace(text)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected true or false", text)
+		}
+		field.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(text, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected %s", text, typeName(field.Type()))
+		}
+		field.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(text, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected %s", text, typeName(field.Type()))
+		}
+		field.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(text, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected a number", text)
+		}
+		field.SetFloat(value)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("can't be set from text")
+		}
+		var values []string
+		for _, value := range strings.Split(text, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		return fmt.Errorf("can't be set from text")
+	}
+	return nil
+}
+
+// typeName is the type in words, for the errors
+func typeName(kind reflect.Type) string {
+	switch kind.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// e.g. 0 to 65535 for a port
+		return fmt.Sprintf("an integer from 0 to %d", uint64(1)<<kind.Bits()-1)
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "a section"
+	}
+	return kind.String()
+}
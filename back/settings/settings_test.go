@@ -0,0 +1,169 @@
+package settings
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fetchSettings struct {
+	MaxHops int    `json:"max_hops"`
+	Token   string `json:"token" secret:"true"`
+}
+
+type EmbeddedSettings struct {
+	MaxHops int `json:"max_hops"`
+}
+
+type testSettings struct {
+	Port    uint16        `json:"port"`
+	Name    string        `json:"name"`
+	Debug   bool          `json:"debug"`
+	Origins []string      `json:"origins"`
+	Fetch   fetchSettings `json:"url_fetch"`
+	ignored int
+}
+
+func defaults() *testSettings {
+	return &testSettings{Port: 8046, Name: "default", Fetch: fetchSettings{MaxHops: 10}}
+}
+
+func TestDecode(t *testing.T) {
+	expected := testSettings{Port: 9000, Name: "default", Debug: true, Origins: []string{"a", "b"}, Fetch: fetchSettings{MaxHops: 3}}
+	for filename, data := range map[string]string{
+		"config.json": `{"port": 9000, "debug": true, "origins": ["a", "b"], "url_fetch": {"max_hops": 3}}`,
+		"config.yaml": "port: 9000\ndebug: true\norigins: [a, b]\nurl_fetch:\n  max_hops: 3\n",
+		"config.yml":  "port: 9000\ndebug: true\norigins:\n  - a\n  - b\nurl_fetch: {max_hops: 3}\n",
+		"config.toml": "port = 9000\ndebug = true\norigins = ['a', 'b']\n[url_fetch]\nmax_hops = 3\n",
+	} {
+		t.Run("Testing "+filename, func(t *testing.T) {
+			settings := defaults()
+			if err := Decode(filename, []byte(data), settings); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*settings, expected) {
+				t.Errorf("expected %+v, got %+v", expected, *settings)
+			}
+		})
+	}
+
+	t.Run("Testing an empty file", func(t *testing.T) {
+		settings := defaults()
+		if err := Decode("config.yaml", nil, settings); err != nil || !reflect.DeepEqual(settings, defaults()) {
+			t.Errorf("expected the defaults, got %+v %v", *settings, err)
+		}
+	})
+
+	for _, test := range []struct {
+		filename, data, expected string
+	}{
+		{"config.yaml", "prot: 9000\n", `config.yaml: unknown field "prot"`},
+		{"config.toml", "[url_fetch]\nmax_hop = 3\n", `config.toml: unknown field "max_hop"`},
+		{"config.json", `{"port": "http"}`, "config.json: port must be an integer from 0 to 65535, got string"},
+		{"config.yaml", "port: 70000\n", "config.yaml: port must be an integer from 0 to 65535, got number 70000"},
+		{"config.toml", "port = \n", "config.toml: "},
+	} {
+		t.Run("Testing "+test.data, func(t *testing.T) {
+			err := Decode(test.filename, []byte(test.data), defaults())
+			if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+			t.Log(err)
+		})
+	}
+
+	if err := Decode("config.ini", nil, defaults()); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected %v, got %v", ErrUnknownFormat, err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	expected := []string{"port", "name", "debug", "origins", "url_fetch.max_hops", "url_fetch.token"}
+	if keys := Keys(defaults()); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+	// the fields of an embedded struct are keyed like its own, as in JSON
+	embedding := struct {
+		EmbeddedSettings
+		Name string `json:"name"`
+	}{}
+	if keys := Keys(&embedding); !reflect.DeepEqual(keys, []string{"max_hops", "name"}) {
+		t.Errorf("expected the embedded fields, got %v", keys)
+	}
+	if err := Set(&embedding, "max_hops", "3"); err != nil || embedding.MaxHops != 3 {
+		t.Errorf("expected 3, got %d %v", embedding.MaxHops, err)
+	}
+	if name := EnvName("BOOKIT", "url_fetch.max_hops"); name != "BOOKIT_URL_FETCH_MAX_HOPS" {
+		t.Errorf("expected BOOKIT_URL_FETCH_MAX_HOPS, got %s", name)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	environment := map[string]string{
+		"BOOKIT_PORT":               "9000",
+		"BOOKIT_DEBUG":              "true",
+		"BOOKIT_ORIGINS":            "a, b,",
+		"BOOKIT_URL_FETCH_MAX_HOPS": "3",
+		"BOOKIT_UNKNOWN":            "ignored",
+		"OTHER_NAME":                "ignored",
+	}
+	lookup := func(name string) (string, bool) {
+		value, found := environment[name]
+		return value, found
+	}
+	settings := defaults()
+	if err := ApplyEnv(settings, "BOOKIT", lookup); err != nil {
+		t.Fatal(err)
+	}
+	expected := testSettings{Port: 9000, Name: "default", Debug: true, Origins: []string{"a", "b"}, Fetch: fetchSettings{MaxHops: 3}}
+	if !reflect.DeepEqual(*settings, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *settings)
+	}
+
+	environment = map[string]string{"BOOKIT_PORT": "70000", "BOOKIT_DEBUG": "maybe"}
+	err := ApplyEnv(defaults(), "BOOKIT", lookup)
+	for _, message := range []string{`BOOKIT_PORT: invalid value "70000", expected an integer from 0 to 65535`, `BOOKIT_DEBUG: invalid value "maybe", expected true or false`} {
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %q, got %v", message, err)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	settings := defaults()
+	if err := Set(settings, "url_fetch.max_hops", "4"); err != nil || settings.Fetch.MaxHops != 4 {
+		t.Errorf("expected 4, got %d %v", settings.Fetch.MaxHops, err)
+	}
+	if err := Set(settings, "url_fetch", "4"); err == nil {
+		t.Error("expected an error for a section")
+	}
+	if err := Set(settings, "ignored", "4"); err == nil || err.Error() != `unknown setting "ignored"` {
+		t.Errorf("expected an unknown setting, got %v", err)
+	}
+	if err := Set(settings, "port", "-1"); err == nil || !strings.HasPrefix(err.Error(), "port: ") {
+		t.Errorf("expected an invalid port, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	settings := defaults()
+	values, err := Redacted(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an empty secret isn't set, nothing to hide
+	if token := values["url_fetch"].(map[string]any)["token"]; token != "" {
+		t.Errorf("expected an empty token, got %v", token)
+	}
+
+	settings.Fetch.Token = "s3cr3t"
+	values, err = Redacted(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"debug": false, "name": "default", "origins": nil, "port": int64(8046), "url_fetch": map[string]any{"max_hops": int64(10), "token": "<redacted>"}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,173 @@
+package sitemap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+)
+
+// problems an entry can have
+const (
+	// the loc is not an absolute http(s) URL, or is longer than the protocol allows
+	Malformed = "malformed"
+	// the loc is on a domain the operation does not accept
+	OffDomain = "off-domain"
+	// the operation changes the loc, the corrected sitemap holds the processed URL
+	NonCanonical = "non-canonical"
+	// the loc, once processed, is the one of an earlier entry
+	Duplicate = "duplicate"
+	// the operation failed for another reason
+	Rejected = "rejected"
+	// lastmod, changefreq or priority is not valid, it is left out of the corrected sitemap
+	InvalidField = "invalid-field"
+)
+
+// longest loc the protocol allows
+const maxLocLength = 2048
+
+var changefreqs = map[string]bool{"always": true, "hourly": true, "daily": true, "weekly": true, "monthly": true, "yearly": true, "never": true}
+
+// W3C Datetime, from a year alone down to fractions of a second with a time zone
+var w3cDatetime = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2}))?)?)?$`)
+
+// Issue is a problem found on an entry
+type Issue struct {
+	Line    int    `json:"line,omitempty"`
+	Loc     string `json:"loc"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+	// processed URL of a non-canonical entry
+	Fixed string `json:"fixed,omitempty"`
+}
+
+// Report sums up the audit of a sitemap
+type Report struct {
+	Kind      string `json:"kind"`
+	Operation string `json:"operation"`
+	// entries read
+	Entries int `json:"entries"`
+	// entries of the corrected sitemap
+	Kept int `json:"kept"`
+	// issues by problem
+	Counts map[string]int `json:"counts"`
+	Issues []Issue        `json:"issues"`
+}
+
+func (report *Report) add(issue Issue) {
+	report.Counts[issue.Problem]++
+	report.Issues = append(report.Issues, issue)
+}
+
+// Audit runs every loc of the sitemap through the operation and reports the entries that aren't right
+// the corrected sitemap keeps the entries that can be fixed, with their processed URL, and drops the others
+func Audit(ctx context.Context, sitemap Sitemap, rules *urlrules.Engine, operation string) (Report, Sitemap, error) {
+	if !rules.HasOperation(operation) {
+		return Report{}, Sitemap{}, fmt.Errorf("%w: %s", urlrules.ErrInvalidOperation, operation)
+	}
+	report := Report{Kind: sitemap.Kind, Operation: operation, Entries: len(sitemap.Entries), Counts: map[string]int{}, Issues: []Issue{}}
+	corrected := Sitemap{Kind: sitemap.Kind, Entries: make([]Entry, 0, len(sitemap.Entries))}
+	// line of the first entry of each processed URL
+	seen := map[string]int{}
+
+	for _, entry := range sitemap.Entries {
+		if err := ctx.Err(); err != nil {
+			return report, corrected, err
+		}
+		entry.Loc = strings.TrimSpace(entry.Loc)
+		issue := Issue{Line: entry.Line, Loc: entry.Loc}
+
+		if detail := checkLoc(entry.Loc); detail != "" {
+			issue.Problem, issue.Detail = Malformed, detail
+			report.add(issue)
+			continue
+		}
+		result, err := rules.Run(ctx, entry.Loc, operation)
+		if err != nil {
+			issue.Problem, issue.Detail = problemOf(err), err.Error()
+			report.add(issue)
+			continue
+		}
+		if first, found := seen[result.Url]; found {
+			issue.Problem, issue.Detail = Duplicate, fmt.Sprintf("same URL as the entry of line %d", first)
+			report.add(issue)
+			continue
+		}
+		seen[result.Url] = entry.Line
+		if result.Url != entry.Loc {
+			issue.Problem, issue.Fixed = NonCanonical, result.Url
+			report.add(issue)
+			entry.Loc = result.Url
+		}
+
+		for _, field := range checkFields(&entry, sitemap.Kind) {
+			report.add(Issue{Line: entry.Line, Loc: issue.Loc, Problem: InvalidField, Detail: field})
+		}
+		entry.Line = 0
+		corrected.Entries = append(corrected.Entries, entry)
+	}
+	report.Kept = len(corrected.Entries)
+	return report, corrected, nil
+}
+
+// what is wrong with the loc, empty when nothing is
+func checkLoc(loc string) string {
+	if loc == "" {
+		return "loc is empty"
+	}
+	if len(loc) > maxLocLength {
+		return fmt.Sprintf("loc is longer than %d characters", maxLocLength)
+	}
+	parsed, err := url.Parse(loc)
+	if err != nil {
+		return err.Error()
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "loc is not an absolute http or https URL"
+	}
+	return ""
+}
+
+func problemOf(err error) string {
+	switch {
+	case errors.Is(err, urlrules.ErrDomain):
+		return OffDomain
+	case errors.Is(err, urlrules.ErrInvalidUrl), errors.Is(err, urlrules.ErrInvalidHost):
+		return Malformed
+	default:
+		return Rejected
+	}
+}
+
+// clears the optional fields that aren't valid, and describes them
+func checkFields(entry *Entry, kind string) []string {
+	var invalid []string
+	entry.Lastmod = strings.TrimSpace(entry.Lastmod)
+	if entry.Lastmod != "" && !w3cDatetime.MatchString(entry.Lastmod) {
+		invalid = append(invalid, fmt.Sprintf("lastmod %q is not a W3C datetime", entry.Lastmod))
+		entry.Lastmod = ""
+	}
+	entry.Changefreq = strings.TrimSpace(entry.Changefreq)
+	entry.Priority = strings.TrimSpace(entry.Priority)
+	if kind == Index {
+		// an index entry only has a loc and a lastmod
+		entry.Changefreq, entry.Priority = "", ""
+		return invalid
+	}
+	if entry.Changefreq != "" && !changefreqs[entry.Changefreq] {
+		invalid = append(invalid, fmt.Sprintf("changefreq %q is not one of always, hourly, daily, weekly, monthly, yearly, never", entry.Changefreq))
+		entry.Changefreq = ""
+	}
+	if entry.Priority != "" {
+		if priority, err := strconv.ParseFloat(entry.Priority, 64); err != nil || priority < 0 || priority > 1 {
+			invalid = append(invalid, fmt.Sprintf("priority %q is not between 0.0 and 1.0", entry.Priority))
+			entry.Priority = ""
+		}
+	}
+	return invalid
+}
@@ -0,0 +1,100 @@
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/**
+Sitemaps and sitemap indexes of the sitemaps.org protocol (https://www.sitemaps.org/protocol.html)
+A sitemap (<urlset>) lists pages, an index (<sitemapindex>) lists sitemaps, both with a <loc> per entry
+**/
+
+const Namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// kinds of documents, the name of their root element
+const (
+	Urlset = "urlset"
+	Index  = "sitemapindex"
+)
+
+var ErrNotSitemap = errors.New("document is not a sitemap nor a sitemap index")
+
+// Entry is a <url> of a sitemap or a <sitemap> of an index, an index entry has no changefreq nor priority
+type Entry struct {
+	Loc        string `xml:"loc" json:"loc"`
+	Lastmod    string `xml:"lastmod,omitempty" json:"lastmod,omitempty"`
+	Changefreq string `xml:"changefreq,omitempty" json:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty" json:"priority,omitempty"`
+	// line of the document the entry starts at, 0 for an entry that was not read from one
+	Line int `xml:"-" json:"line,omitempty"`
+}
+
+// Sitemap is a sitemap or a sitemap index, Kind tells which
+type Sitemap struct {
+	Kind    string
+	Entries []Entry
+}
+
+// Parse reads a sitemap or a sitemap index, gzipped or not, elements other than the entries are skipped
+func Parse(reader io.Reader) (Sitemap, error) {
+	buffered := bufio.NewReader(reader)
+	// sitemaps are often served as .xml.gz
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(buffered)
+		if err != nil {
+			return Sitemap{}, err
+		}
+		defer unzipped.Close()
+		buffered = bufio.NewReader(unzipped)
+	}
+
+	var sitemap Sitemap
+	decoder := xml.NewDecoder(buffered)
+	entryName := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sitemap, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if sitemap.Kind == "" {
+			switch start.Name.Local {
+			case Urlset:
+				entryName = "url"
+			case Index:
+				entryName = "sitemap"
+			default:
+				return sitemap, fmt.Errorf("%w, its root is <%s>", ErrNotSitemap, start.Name.Local)
+			}
+			sitemap.Kind = start.Name.Local
+			continue
+		}
+		if start.Name.Local != entryName {
+			if err := decoder.Skip(); err != nil {
+				return sitemap, err
+			}
+			continue
+		}
+		line, _ := decoder.InputPos()
+		entry := Entry{Line: line}
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			return sitemap, fmt.Errorf("line %d: %w", line, err)
+		}
+		sitemap.Entries = append(sitemap.Entries, entry)
+	}
+	if sitemap.Kind == "" {
+		return sitemap, ErrNotSitemap
+	}
+	return sitemap, nil
+}
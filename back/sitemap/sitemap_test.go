@@ -0,0 +1,170 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+)
+
+func parseFile(t *testing.T, name string) Sitemap {
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	sitemap, err := Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sitemap
+}
+
+func TestParse(t *testing.T) {
+	sitemap := parseFile(t, "sitemap.xml")
+	if sitemap.Kind != Urlset || len(sitemap.Entries) != 6 {
+		t.Fatalf("unexpected sitemap %+v", sitemap)
+	}
+	if first := sitemap.Entries[0]; first != (Entry{Loc: "https://www.byfood.com/food-experiences", Lastmod: "2024-05-01", Changefreq: "weekly", Priority: "0.8", Line: 4}) {
+		t.Errorf("unexpected entry %+v", first)
+	}
+	// extensions of other namespaces are skipped
+	if second := sitemap.Entries[1]; second.Loc != "http://BYFOOD.com/blog/Tokyo-Ramen" || second.Line != 10 {
+		t.Errorf("unexpected entry %+v", second)
+	}
+
+	index := parseFile(t, "index.xml")
+	if index.Kind != Index || len(index.Entries) != 2 || index.Entries[1].Loc != "https://byfood.com/sitemaps/blog.xml" {
+		t.Errorf("unexpected index %+v", index)
+	}
+
+	data, _ := os.ReadFile("testdata/index.xml")
+	var zipped bytes.Buffer
+	writer := gzip.NewWriter(&zipped)
+	writer.Write(data)
+	writer.Close()
+	if unzipped, err := Parse(&zipped); err != nil || len(unzipped.Entries) != 2 {
+		t.Errorf("unexpected gzipped index %+v %v", unzipped, err)
+	}
+
+	for _, document := range []string{`<rss><channel/></rss>`, ``, `<urlset><url><loc>a</url></urlset>`} {
+		if _, err := Parse(strings.NewReader(document)); err == nil {
+			t.Errorf("%q: expected an error", document)
+		}
+	}
+	if _, err := Parse(strings.NewReader(`<feed/>`)); !errors.Is(err, ErrNotSitemap) {
+		t.Errorf("expected %v, got %v", ErrNotSitemap, err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	report, corrected, err := Audit(context.Background(), parseFile(t, "sitemap.xml"), urlrules.Default(), "redirection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Issue{
+		{Line: 10, Loc: "http://BYFOOD.com/blog/Tokyo-Ramen", Problem: NonCanonical, Fixed: "https://www.byfood.com/blog/Tokyo-Ramen"},
+		{Line: 15, Loc: "https://www.byfood.com/blog/Tokyo-Ramen", Problem: Duplicate, Detail: "same URL as the entry of line 10"},
+		{Line: 18, Loc: "https://blog.example.com/kyoto", Problem: OffDomain, Detail: "URL is not from ByFood Domain"},
+		{Line: 21, Loc: "/relative/page", Problem: Malformed, Detail: "loc is not an absolute http or https URL"},
+		{Line: 24, Loc: "https://www.byfood.com/food-experiences/kyoto?a=1&b=2", Problem: InvalidField, Detail: `lastmod "May 2024" is not a W3C datetime`},
+	}
+	if len(report.Issues) != 7 || report.Entries != 6 || report.Kept != 3 || report.Counts[InvalidField] != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for i, issue := range expected {
+		if report.Issues[i] != issue {
+			t.Errorf("expected %+v, got %+v", issue, report.Issues[i])
+		}
+	}
+
+	if len(corrected.Entries) != 3 || corrected.Entries[1].Loc != "https://www.byfood.com/blog/Tokyo-Ramen" || corrected.Entries[1].Lastmod == "" {
+		t.Errorf("unexpected corrected sitemap %+v", corrected)
+	}
+	if last := corrected.Entries[2]; last != (Entry{Loc: "https://www.byfood.com/food-experiences/kyoto?a=1&b=2"}) {
+		t.Errorf("expected the invalid fields to be dropped, got %+v", last)
+	}
+
+	if _, _, err := Audit(context.Background(), Sitemap{}, urlrules.Default(), "nothing"); !errors.Is(err, urlrules.ErrInvalidOperation) {
+		t.Errorf("expected %v, got %v", urlrules.ErrInvalidOperation, err)
+	}
+}
+
+// collects the files written by Write
+type memoryFiles map[string]*bytes.Buffer
+
+type memoryFile struct{ *bytes.Buffer }
+
+func (memoryFile) Close() error { return nil }
+
+func (files memoryFiles) create(name string) (io.WriteCloser, error) {
+	files[name] = &bytes.Buffer{}
+	return memoryFile{files[name]}, nil
+}
+
+func TestWrite(t *testing.T) {
+	sitemap := Sitemap{Kind: Urlset}
+	for i := 0; i < 25; i++ {
+		sitemap.Entries = append(sitemap.Entries, Entry{Loc: fmt.Sprintf("https://www.byfood.com/page-%d?a=1&b=2", i), Lastmod: "2024-05-01"})
+	}
+
+	files := memoryFiles{}
+	names, err := Write(sitemap, DefaultLimits, "", files.create)
+	if err != nil || len(names) != 1 || names[0] != MainFile {
+		t.Fatalf("unexpected files %v %v", names, err)
+	}
+	written, err := Parse(files[MainFile])
+	if err != nil || written.Kind != Urlset || len(written.Entries) != 25 || written.Entries[3].Loc != "https://www.byfood.com/page-3?a=1&b=2" {
+		t.Errorf("unexpected sitemap %+v %v", written, err)
+	}
+
+	if _, err := Write(sitemap, Limits{MaxUrls: 10}, "", memoryFiles{}.create); err != ErrNoBaseUrl {
+		t.Errorf("expected %v, got %v", ErrNoBaseUrl, err)
+	}
+
+	t.Run("Testing the URL limit", func(t *testing.T) {
+		files := memoryFiles{}
+		names, err := Write(sitemap, Limits{MaxUrls: 10}, "https://www.byfood.com/sitemaps", files.create)
+		if err != nil || strings.Join(names, ",") != "sitemap-1.xml,sitemap-2.xml,sitemap-3.xml,sitemap.xml" {
+			t.Fatalf("unexpected files %v %v", names, err)
+		}
+		index, _ := Parse(files[MainFile])
+		if index.Kind != Index || len(index.Entries) != 3 || index.Entries[2].Loc != "https://www.byfood.com/sitemaps/sitemap-3.xml" {
+			t.Errorf("unexpected index %+v", index)
+		}
+		if last, _ := Parse(files["sitemap-3.xml"]); len(last.Entries) != 5 {
+			t.Errorf("expected 5 entries in the last part, got %d", len(last.Entries))
+		}
+	})
+
+	t.Run("Testing the size limit", func(t *testing.T) {
+		files := memoryFiles{}
+		names, err := Write(sitemap, Limits{MaxBytes: 1024}, "https://www.byfood.com/", files.create)
+		if err != nil || len(names) < 3 {
+			t.Fatalf("unexpected files %v %v", names, err)
+		}
+		total := 0
+		for _, name := range names[:len(names)-1] {
+			if files[name].Len() > 1024 {
+				t.Errorf("%s is %d bytes", name, files[name].Len())
+			}
+			part, _ := Parse(bytes.NewReader(files[name].Bytes()))
+			total += len(part.Entries)
+		}
+		if total != 25 {
+			t.Errorf("expected 25 entries across the parts, got %d", total)
+		}
+	})
+
+	index := Sitemap{Kind: Index, Entries: sitemap.Entries}
+	if _, err := Write(index, Limits{MaxUrls: 10}, "https://www.byfood.com/", memoryFiles{}.create); err != ErrIndexTooLarge {
+		t.Errorf("expected %v, got %v", ErrIndexTooLarge, err)
+	}
+}
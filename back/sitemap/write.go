@@ -0,0 +1,127 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits of a single sitemap file, the protocol allows 50,000 URLs and 50MB uncompressed
+type Limits struct {
+	MaxUrls  int   `json:"max_urls"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+var DefaultLimits = Limits{MaxUrls: 50000, MaxBytes: 50 << 20}
+
+var ErrNoBaseUrl = errors.New("a base URL is needed to split the sitemap into an index")
+var ErrIndexTooLarge = errors.New("sitemap index is over the limits, indexes can't be nested")
+
+// name of the file written for a sitemap that does not need to be split, and of the index otherwise
+const MainFile = "sitemap.xml"
+
+const header = xml.Header
+
+// Write writes the sitemap to the files made by create, MainFile when it fits the limits
+// otherwise it is split into sitemap-1.xml, sitemap-2.xml... and MainFile is an index of them, located at baseUrl
+// returns the names of the files written, MainFile last
+func Write(sitemap Sitemap, limits Limits, baseUrl string, create func(name string) (io.WriteCloser, error)) ([]string, error) {
+	if limits.MaxUrls <= 0 {
+		limits.MaxUrls = DefaultLimits.MaxUrls
+	}
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultLimits.MaxBytes
+	}
+	entryName := "url"
+	if sitemap.Kind == Index {
+		entryName = "sitemap"
+	}
+
+	// entries are encoded first, the files are cut where the next one would not fit
+	encoded := make([][]byte, len(sitemap.Entries))
+	for i, entry := range sitemap.Entries {
+		var element bytes.Buffer
+		if err := xml.NewEncoder(&element).EncodeElement(entry, xml.StartElement{Name: xml.Name{Local: entryName}}); err != nil {
+			return nil, err
+		}
+		element.WriteString("\n")
+		encoded[i] = element.Bytes()
+	}
+	parts := split(encoded, limits, int64(len(header)+len(open(sitemap.Kind))+len(closing(sitemap.Kind))))
+
+	if len(parts) == 1 {
+		return []string{MainFile}, writeFile(create, MainFile, sitemap.Kind, parts[0])
+	}
+	if sitemap.Kind == Index {
+		return nil, ErrIndexTooLarge
+	}
+	if baseUrl == "" {
+		return nil, ErrNoBaseUrl
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+
+	var names []string
+	index := Sitemap{Kind: Index}
+	for i, part := range parts {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		if err := writeFile(create, name, Urlset, part); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+		index.Entries = append(index.Entries, Entry{Loc: baseUrl + name})
+	}
+	indexNames, err := Write(index, limits, "", create)
+	return append(names, indexNames...), err
+}
+
+// groups the encoded entries into files of at most limits, overhead being the size of a file without entries
+// an empty sitemap is one empty file
+func split(encoded [][]byte, limits Limits, overhead int64) [][][]byte {
+	parts := [][][]byte{{}}
+	size := overhead
+	for _, element := range encoded {
+		last := len(parts) - 1
+		if len(parts[last]) > 0 && (len(parts[last]) >= limits.MaxUrls || size+int64(len(element)) > limits.MaxBytes) {
+			parts = append(parts, [][]byte{})
+			last++
+			size = overhead
+		}
+		parts[last] = append(parts[last], element)
+		size += int64(len(element))
+	}
+	return parts
+}
+
+func open(kind string) string {
+	return fmt.Sprintf("<%s xmlns=\"%s\">\n", kind, Namespace)
+}
+
+func closing(kind string) string {
+	return fmt.Sprintf("</%s>\n", kind)
+}
+
+func writeFile(create func(name string) (io.WriteCloser, error), name, kind string, elements [][]byte) error {
+	file, err := create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, header+open(kind))
+	for _, element := range elements {
+		if err != nil {
+			break
+		}
+		_, err = file.Write(element)
+	}
+	if err == nil {
+		_, err = io.WriteString(file, closing(kind))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
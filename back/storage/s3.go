@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+Client of an S3-compatible object store, enough of the API for the files of the books: PutObject, GetObject and DeleteObject
+The requests are signed with AWS Signature Version 4, the bodies are sent unsigned (UNSIGNED-PAYLOAD) so that a file
+is streamed rather than read twice, which AWS S3, MinIO and the like all accept
+**/
+
+// S3Options of the s3 backend, the section "s3" of the storage
+type S3Options struct {
+	// URL of the object store, e.g. https://s3.amazonaws.com or http://localhost:9000 for MinIO
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	// credentials of the requests
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" secret:"true"`
+	// addresses the bucket in the path (endpoint/bucket/key), as MinIO expects, rather than in the host name (bucket.endpoint/key)
+	PathStyle bool `json:"path_style"`
+}
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	amzDateLayout    = "20060102T150405Z"
+)
+
+// S3 keeps the files in a bucket, a key is the key of an object
+type S3 struct {
+	options  S3Options
+	endpoint *url.URL
+	client   *http.Client
+	// the clock of the signatures, replaced by the tests
+	now func() time.Time
+}
+
+// NewS3 makes the client of the bucket, no request is made until a file is
+func NewS3(options S3Options) (*S3, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage.s3.endpoint must be an http or https URL, got %q", options.Endpoint)
+	}
+	if options.Bucket == "" || options.Region == "" || options.AccessKeyId == "" || options.SecretAccessKey == "" {
+		return nil, errors.New("storage.s3 needs a bucket, a region and credentials")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &S3{options: options, endpoint: endpoint, client: &http.Client{Transport: transport}, now: time.Now}, nil
+}
+
+func (s3 *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	request, err := s3.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := s3.do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (s3 *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	request, err := s3.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s3.do(request)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (s3 *S3) Delete(ctx context.Context, key string) error {
+	request, err := s3.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s3.do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// the request of the object of the key, not signed yet
+func (s3 *S3) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	target := *s3.endpoint
+	path := "/" + key
+	if s3.options.PathStyle {
+		path = "/" + s3.options.Bucket + path
+	} else {
+		target.Host = s3.options.Bucket + "." + target.Host
+	}
+	target.Path = strings.TrimSuffix(target.Path, "/") + path
+	// the path is sent as it is signed, url.URL would leave some characters unescaped
+	target.RawPath = uriEncode(target.Path, false)
+	return http.NewRequestWithContext(ctx, method, target.String(), body)
+}
+
+// do signs and sends the request, an answer other than 2xx is an error, 404 ErrNotFound
+func (s3 *S3) do(request *http.Request) (*http.Response, error) {
+	payload := unsignedPayload
+	if request.Body == nil {
+		// the hash of an empty body
+		payload = hex.EncodeToString(sha256.New().Sum(nil))
+	}
+	s3.sign(request, payload, s3.now())
+	response, err := s3.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound && request.Method == http.MethodGet {
+		return nil, ErrNotFound
+	}
+	// the error document of S3, <Error><Code>...</Code><Message>...</Message></Error>
+	var document struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(response.Body, 4096)).Decode(&document)
+	return nil, fmt.Errorf("s3 %s %s: %s %s %s", request.Method, request.URL.Path, response.Status, document.Code, document.Message)
+}
+
+// sign adds the headers of Signature Version 4 to the request, payload is the hex SHA-256 of the body or UNSIGNED-PAYLOAD
+// the host, the content type, the range and the x-amz-* headers are signed
+func (s3 *S3) sign(request *http.Request, payload string, at time.Time) {
+	at = at.UTC()
+	amzDate := at.Format(amzDateLayout)
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payload)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.Path, false),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := date + "/" + s3.options.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signingAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSha256([]byte("AWS4"+s3.options.SecretAccessKey), date)
+	key = hmacSha256(key, s3.options.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	request.Header.Set("Authorization", signingAlgorithm+" Credential="+s3.options.AccessKeyId+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+// the query sorted by name then value, names and values URI encoded
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes every byte but the unreserved characters of RFC 3986, and the slashes of a path unless encodeSlash
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, character := range []byte(value) {
+		switch {
+		case 'A' <= character && character <= 'Z', 'a' <= character && character <= 'z', '0' <= character && character <= '9',
+			character == '-', character == '_', character == '.', character == '~':
+			encoded.WriteByte(character)
+		case character == '/' && !encodeSlash:
+			encoded.WriteByte(character)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", character)
+		}
+	}
+	return encoded.String()
+}
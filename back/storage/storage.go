@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/**
+Storage of the files of the books, e.g. their covers, out of the DB which only keeps what it needs to serve them
+A file is named by a key, a slash separated path such as "covers/12/original", the same on every backend:
+a directory of the local filesystem, or a bucket of an S3-compatible object store (AWS S3, MinIO...)
+**/
+
+// Storage keeps the files by key, safe for concurrent use
+type Storage interface {
+	// Put writes the file of the key, replacing the one there is, size is the length of the body
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the file of the key, ErrNotFound when there is none, the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file of the key, a key without a file is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Options of the storage, the config section "storage"
+type Options struct {
+	// local or s3
+	Backend string `json:"backend"`
+	// directory of the files of the local backend
+	Dir string `json:"dir"`
+	// bucket of the s3 backend
+	S3 S3Options `json:"s3"`
+}
+
+var DefaultOptions = Options{Backend: "local", Dir: "./DB/files/", S3: S3Options{Region: "us-east-1", PathStyle: true}}
+
+// Backends lists the values of Options.Backend
+var Backends = []string{"local", "s3"}
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Open makes the storage of the backend of the options
+func Open(options Options) (Storage, error) {
+	switch options.Backend {
+	case "local":
+		return NewLocal(options.Dir)
+	case "s3":
+		return NewS3(options.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q, expected one of %s", options.Backend, strings.Join(Backends, ", "))
+}
+
+// keys are made by the server, but one that could leave the directory or the bucket is refused all the same
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || slices.Contains(strings.Split(key, "/"), "..") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// Local keeps the files in a directory, a key is a path under it
+type Local struct {
+	dir string
+}
+
+// NewLocal makes the storage of the directory, created if it doesn't exist
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (local *Local) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(local.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file next to its path then renames it, a reader never sees half a file
+func (local *Local) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("%s: wrote %d bytes, expected %d", key, written, size)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (local *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := local.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (local *Local) Delete(ctx context.Context, key string) error {
+	path, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package urlcleaner
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+// OutputFormats lists the formats NewResultWriter supports
+var OutputFormats = []string{"plain", "json", "csv"}
+
+// ResultWriter writes the results of processed URLs one by one, Close must be called to flush the output
+type ResultWriter interface {
+	Write(result models.BatchResult) error
+	Close() error
+}
+
+// NewResultWriter returns a ResultWriter for the format, one of OutputFormats
+// plain writes the processed URLs alone, one per line, and skips the failures
+// json writes a result object per line, like POST /url/batch does for NDJSON
+// csv writes a header, then a row per result
+func NewResultWriter(format string, w io.Writer) (ResultWriter, error) {
+	switch strings.ToLower(format) {
+	case "plain":
+		return &plainWriter{w: bufio.NewWriter(w)}, nil
+	case "json":
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		// URLs are not embedded in HTML here, & stays readable
+		encoder.SetEscapeHTML(false)
+		return &jsonWriter{w: buffered, encoder: encoder}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+type plainWriter struct {
+	w *bufio.Writer
+}
+
+func (writer *plainWriter) Write(result models.BatchResult) error {
+	if result.Error != "" {
+		return nil
+	}
+	_, err := writer.w.WriteString(result.ProcessedUrl + "\n")
+	return err
+}
+
+func (writer *plainWriter) Close() error {
+	return writer.w.Flush()
+}
+
+type jsonWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (writer *jsonWriter) Write(result models.BatchResult) error {
+	return writer.encoder.Encode(result)
+}
+
+func (writer *jsonWriter) Close() error {
+	return writer.w.Flush()
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (writer *csvWriter) Write(result models.BatchResult) error {
+	if !writer.headerWritten {
+		writer.headerWritten = true
+		if err := writer.w.Write([]string{"index", "url", "operation", "processed_url", "error"}); err != nil {
+			return err
+		}
+	}
+	return writer.w.Write([]string{strconv.Itoa(result.Index), result.Url, result.Operation, result.ProcessedUrl, result.Error})
+}
+
+func (writer *csvWriter) Close() error {
+	writer.w.Flush()
+	return writer.w.Error()
+}
@@ -0,0 +1,68 @@
+package urlcleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+)
+
+/**
+What POST /url does, without HTTP: decode a request, run its operation, and tell what kind of failure an error is
+The HTTP handlers, the gRPC service and the url command share it, each reports the failures its own way
+**/
+
+var ErrEmptyRequest = errors.New("Error : Request Body is empty")
+var ErrInvalidRequest = errors.New("Invalid request format")
+
+// Failure is the kind of error Process returns
+type Failure int
+
+const (
+	// no error
+	NoFailure Failure = iota
+	// the request, the URL or the operation is not valid, or the operation refuses the URL
+	InvalidInput
+	// the URL is fine, the host it points to could not be reached by a network operation
+	Unreachable
+)
+
+// FailureOf tells what kind of failure the error is
+func FailureOf(err error) Failure {
+	switch {
+	case err == nil:
+		return NoFailure
+	case errors.Is(err, urlfetch.ErrUnreachable):
+		return Unreachable
+	default:
+		return InvalidInput
+	}
+}
+
+// DecodeRequest reads a JSON request, unknown fields are refused
+func DecodeRequest(reader io.Reader) (models.RequestStruct, error) {
+	var request models.RequestStruct
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&request)
+	if err == io.EOF {
+		return request, ErrEmptyRequest
+	}
+	if err != nil {
+		return request, ErrInvalidRequest
+	}
+	return request, nil
+}
+
+// Process runs the operation of the request on its URL, ctx bounds the network operations
+func Process(ctx context.Context, rules *urlrules.Engine, request models.RequestStruct) (models.ResponseStruct, error) {
+	result, err := rules.Run(ctx, request.Url, request.Operation)
+	if err != nil {
+		return models.ResponseStruct{}, err
+	}
+	return models.ResponseStruct{ProcessedUrl: result.Url, Chain: result.Chain, Canonical: result.Canonical}, nil
+}
@@ -0,0 +1,72 @@
+package urlcleaner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/urlrules"
+)
+
+func TestProcess(t *testing.T) {
+	rules := urlrules.Default()
+	for _, test := range []struct {
+		body, expected string
+		failure        Failure
+	}{
+		{`{"url":"https://BYFOOD.com/Food/?a=b","operation":"all"}`, "https://www.byfood.com/Food", NoFailure},
+		{`{"url":"https://x.com/Food","operation":"all"}`, "", InvalidInput},
+		{`{"url":"https://byfood.com/Food","operation":"nothing"}`, "", InvalidInput},
+		{`{"url":"https://byfood.com/Food","operation":"all","extra":1}`, "", InvalidInput},
+		{`{"url":`, "", InvalidInput},
+		{``, "", InvalidInput},
+	} {
+		request, err := DecodeRequest(strings.NewReader(test.body))
+		var response models.ResponseStruct
+		if err == nil {
+			response, err = Process(context.Background(), rules, request)
+		}
+		if response.ProcessedUrl != test.expected || FailureOf(err) != test.failure {
+			t.Errorf("%s: expected %q %v, got %q %v", test.body, test.expected, test.failure, response.ProcessedUrl, err)
+		}
+	}
+
+	if _, err := DecodeRequest(strings.NewReader(``)); err != ErrEmptyRequest {
+		t.Errorf("expected %v, got %v", ErrEmptyRequest, err)
+	}
+	if failure := FailureOf(fmt.Errorf("%w: timeout", urlfetch.ErrUnreachable)); failure != Unreachable {
+		t.Errorf("expected %v, got %v", Unreachable, failure)
+	}
+}
+
+func TestResultWriters(t *testing.T) {
+	results := []models.BatchResult{
+		{Index: 0, Url: "https://byfood.com/a?b=1&c=2", Operation: "clean", ProcessedUrl: "https://byfood.com/a?b=1&c=2"},
+		{Index: 1, Url: "not, a url", Operation: "clean", Error: "Url format invalid"},
+	}
+	for format, expected := range map[string]string{
+		"plain": "https://byfood.com/a?b=1&c=2\n",
+		"json": `{"index":0,"url":"https://byfood.com/a?b=1&c=2","operation":"clean","processed_url":"https://byfood.com/a?b=1&c=2"}` + "\n" +
+			`{"index":1,"url":"not, a url","operation":"clean","error":"Url format invalid"}` + "\n",
+		"csv": "index,url,operation,processed_url,error\n0,https://byfood.com/a?b=1&c=2,clean,https://byfood.com/a?b=1&c=2,\n1,\"not, a url\",clean,,Url format invalid\n",
+	} {
+		var output strings.Builder
+		writer, err := NewResultWriter(format, &output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			writer.Write(result)
+		}
+		writer.Close()
+		if output.String() != expected {
+			t.Errorf("%s: expected %q, got %q", format, expected, output.String())
+		}
+	}
+	if _, err := NewResultWriter("xml", &strings.Builder{}); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,178 @@
+package urlfetch
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// CanonicalReport lists the canonical URLs a page declares, resolved against the page
+type CanonicalReport struct {
+	// URL the page was read from, after the redirects
+	Page string `json:"page"`
+	// <link rel="canonical" href="..."> of the HTML
+	Link string `json:"link,omitempty"`
+	// Link: <...>; rel="canonical" HTTP header
+	Header string `json:"header,omitempty"`
+	// <meta property="og:url" content="..."> of the HTML
+	OgUrl string `json:"og_url,omitempty"`
+	// what the canonical operation makes of the URL, set by the caller
+	Computed string `json:"computed,omitempty"`
+	// the declarations, and the computed URL, that don't point to the same URL
+	Disagreements []string `json:"disagreements,omitempty"`
+}
+
+// Declared is the canonical URL of the page, the HTML link first, then the header, then og:url
+func (report CanonicalReport) Declared() string {
+	for _, declared := range []string{report.Link, report.Header, report.OgUrl} {
+		if declared != "" {
+			return declared
+		}
+	}
+	return ""
+}
+
+// ParseCanonical reads the canonical declarations of the page, the HTML ones only when it is HTML
+func ParseCanonical(page Page) CanonicalReport {
+	report := CanonicalReport{Page: page.Url}
+	pageUrl, err := url.Parse(page.Url)
+	if err != nil {
+		return report
+	}
+	report.Header = resolveReference(pageUrl, linkHeaderCanonical(page.Header.Values("Link")))
+
+	contentType := page.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(page.Body)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return report
+	}
+	base, link, ogUrl := htmlCanonical(page.Body)
+	if base != "" {
+		if baseUrl, err := pageUrl.Parse(base); err == nil {
+			pageUrl = baseUrl
+		}
+	}
+	report.Link = resolveReference(pageUrl, link)
+	report.OgUrl = resolveReference(pageUrl, ogUrl)
+	return report
+}
+
+// the href of <base>, <link rel="canonical"> and og:url of the head, the first of each
+func htmlCanonical(body []byte) (base, link, ogUrl string) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttributes := tokenizer.TagName()
+			if string(name) == "body" {
+				// declarations are only honoured in the head
+				return
+			}
+			if !hasAttributes {
+				continue
+			}
+			attributes := map[string]string{}
+			for more := true; more; {
+				var key, value []byte
+				key, value, more = tokenizer.TagAttr()
+				if _, found := attributes[string(key)]; !found {
+					attributes[string(key)] = strings.TrimSpace(string(value))
+				}
+			}
+			switch string(name) {
+			case "base":
+				if base == "" {
+					base = attributes["href"]
+				}
+			case "link":
+				if link == "" && hasToken(attributes["rel"], "canonical") {
+					link = attributes["href"]
+				}
+			case "meta":
+				if ogUrl == "" && (strings.EqualFold(attributes["property"], "og:url") || strings.EqualFold(attributes["name"], "og:url")) {
+					ogUrl = attributes["content"]
+				}
+			}
+		}
+	}
+}
+
+// the target of the first rel="canonical" link of Link headers (RFC 8288)
+func linkHeaderCanonical(values []string) string {
+	for _, value := range values {
+		for value != "" {
+			start := strings.IndexByte(value, '<')
+			end := strings.IndexByte(value, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := value[start+1 : end]
+			params, rest := splitLinkParams(value[end+1:])
+			for _, param := range params {
+				name, paramValue, _ := strings.Cut(param, "=")
+				if strings.EqualFold(strings.TrimSpace(name), "rel") && hasToken(strings.Trim(strings.TrimSpace(paramValue), `"`), "canonical") {
+					return strings.TrimSpace(target)
+				}
+			}
+			value = rest
+		}
+	}
+	return ""
+}
+
+// the ;-separated parameters of a link, up to the comma that starts the next link, quotes are honoured
+func splitLinkParams(value string) (params []string, rest string) {
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			quoted = !quoted
+		case ';', ',':
+			if quoted {
+				continue
+			}
+			if param := strings.TrimSpace(value[start:i]); param != "" {
+				params = append(params, param)
+			}
+			start = i + 1
+			if value[i] == ',' {
+				return params, value[i+1:]
+			}
+		}
+	}
+	if param := strings.TrimSpace(value[start:]); param != "" {
+		params = append(params, param)
+	}
+	return params, ""
+}
+
+// whether the space-separated list holds the token, case insensitive
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// reference resolved against base, empty when it is empty or not a URL
+func resolveReference(base *url.URL, reference string) string {
+	if reference == "" {
+		return ""
+	}
+	resolved, err := base.Parse(reference)
+	if err != nil {
+		return ""
+	}
+	return resolved.String()
+}
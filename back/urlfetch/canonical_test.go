@@ -0,0 +1,113 @@
+package urlfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serves the HTML fixtures of testdata, /moved redirects to the canonical fixture
+func fixtureServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/canonical.html", http.StatusMovedPermanently)
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/atom+xml")
+			w.Header().Add("Link", `</feeds/all.xml>; rel="alternate"`)
+			w.Header().Add("Link", `<https://example.com/a,b>; title="x;y", </feed>; rel="self canonical"`)
+			w.Write([]byte(`<feed><link rel="canonical" href="/not-html"/></feed>`))
+		default:
+			body, err := os.ReadFile("testdata" + r.URL.Path)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(body)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseCanonical(t *testing.T) {
+	server := fixtureServer(t)
+	client := New(testOptions)
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		path     string
+		expected CanonicalReport
+	}{
+		{"/moved", CanonicalReport{
+			Page:  server.URL + "/canonical.html",
+			Link:  server.URL + "/experiences/tokyo-food-tour",
+			OgUrl: "https://www.byfood.com/experiences/tokyo-food-tour?ref=og",
+		}},
+		{"/og-only.html", CanonicalReport{Page: server.URL + "/og-only.html", OgUrl: "http://www.byfood.com/blog/kyoto"}},
+		{"/none.html", CanonicalReport{Page: server.URL + "/none.html"}},
+		{"/feed.xml", CanonicalReport{Page: server.URL + "/feed.xml", Header: server.URL + "/feed"}},
+	} {
+		page, _, err := client.Fetch(ctx, server.URL+test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := ParseCanonical(page); report.Page != test.expected.Page || report.Link != test.expected.Link ||
+			report.Header != test.expected.Header || report.OgUrl != test.expected.OgUrl {
+			t.Errorf("%s: expected %+v, got %+v", test.path, test.expected, report)
+		}
+	}
+
+	page, chain, err := client.Fetch(ctx, server.URL+"/moved")
+	if err != nil || len(chain) != 2 || chain[0].Status != 301 || page.Status != 200 || page.Truncated {
+		t.Errorf("unexpected fetch %v %v %v", chain, page.Status, err)
+	}
+	report := ParseCanonical(page)
+	if report.Declared() != report.Link {
+		t.Errorf("expected the HTML link to be the declared canonical, got %s", report.Declared())
+	}
+}
+
+func TestFetchLimits(t *testing.T) {
+	server := fixtureServer(t)
+	options := testOptions
+	options.MaxBodyBytes = 400
+	page, _, err := New(options).Fetch(context.Background(), server.URL+"/canonical.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Truncated || len(page.Body) != 400 {
+		t.Errorf("expected the body to be cut at 400 bytes, got %d", len(page.Body))
+	}
+	// the head is read up to where the body was cut
+	if report := ParseCanonical(page); report.Link == "" || report.OgUrl != "" {
+		t.Errorf("unexpected report of a truncated page %+v", report)
+	}
+
+	if _, _, err := New(Options{}).Fetch(context.Background(), server.URL+"/canonical.html"); err == nil || !strings.Contains(err.Error(), ErrBlockedAddress.Error()) {
+		t.Errorf("expected %v, got %v", ErrBlockedAddress, err)
+	}
+}
+
+func TestLinkHeaderCanonical(t *testing.T) {
+	for _, test := range []struct {
+		values   []string
+		expected string
+	}{
+		{[]string{`<https://byfood.com/a>; rel="canonical"`}, "https://byfood.com/a"},
+		{[]string{`<https://byfood.com/a>; rel=canonical`}, "https://byfood.com/a"},
+		{[]string{`<https://byfood.com/p>; rel="prev", <https://byfood.com/a>; rel="Canonical"`}, "https://byfood.com/a"},
+		{[]string{`<https://byfood.com/p>; title="a, b; rel=canonical"; rel="prev"`}, ""},
+		{[]string{`<https://byfood.com/p>; rel="prev"`, `< /a >;rel="canonical"`}, "/a"},
+		{[]string{`https://byfood.com/a; rel="canonical"`}, ""},
+		{nil, ""},
+	} {
+		if canonical := linkHeaderCanonical(test.values); canonical != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.values, test.expected, canonical)
+		}
+	}
+}
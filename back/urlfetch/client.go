@@ -0,0 +1,159 @@
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+/**
+HTTP client of the URL cleaner operations that reach the network
+The address is checked when the connection is made, after DNS resolution, so a host name can't point the
+server to its own network (SSRF) either directly or by changing what it resolves to between two lookups
+**/
+
+var ErrBlockedAddress = errors.New("URL points to an address that is not allowed")
+var ErrUnsupportedScheme = errors.New("only http and https URLs can be fetched")
+
+// wraps the errors of hosts that could not be reached or did not answer in time
+var ErrUnreachable = errors.New("URL could not be fetched")
+
+// Options of a Client, a field left at 0 takes its value from DefaultOptions
+type Options struct {
+	// most redirects followed by Resolve
+	MaxHops int `json:"max_hops"`
+	// time given to each request, the connection to a host included
+	HopTimeoutSeconds int `json:"hop_timeout_seconds"`
+	// most bytes of a page read by Fetch
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+	UserAgent    string `json:"user_agent"`
+	// lets requests reach private, loopback and link-local addresses, for tests and trusted networks only
+	AllowPrivate bool `json:"allow_private"`
+}
+
+var DefaultOptions = Options{MaxHops: 10, HopTimeoutSeconds: 5, MaxBodyBytes: 1 << 20, UserAgent: "BookIT-UrlCleaner/1.0"}
+
+// Client fetches URLs on behalf of the operations, safe for concurrent use
+type Client struct {
+	options Options
+	http    *http.Client
+}
+
+// ranges that are not reachable from the internet, on top of what netip.Addr reports as private, loopback...
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// carrier-grade NAT, some cloud metadata services live there (100.100.100.200)
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64, can map to any IPv4 address
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// New makes a client with the options
+func New(options Options) *Client {
+	if options.MaxHops <= 0 {
+		options.MaxHops = DefaultOptions.MaxHops
+	}
+	if options.HopTimeoutSeconds <= 0 {
+		options.HopTimeoutSeconds = DefaultOptions.HopTimeoutSeconds
+	}
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = DefaultOptions.MaxBodyBytes
+	}
+	if options.UserAgent == "" {
+		options.UserAgent = DefaultOptions.UserAgent
+	}
+
+	timeout := time.Duration(options.HopTimeoutSeconds) * time.Second
+	transport := NewTransport(timeout, options.AllowPrivate)
+	transport.ResponseHeaderTimeout = timeout
+	return &Client{
+		options: options,
+		http: &http.Client{
+			Transport: transport,
+			// redirects are followed by Resolve, one hop at a time
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// NewTransport makes the transport of the clients that reach the hosts of users or of the config: the webhooks,
+// the catalogues of the enrichment and the URL operations. The address of each connection is checked unless allowPrivate
+func NewTransport(timeout time.Duration, allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = checkAddress
+	}
+	return &http.Transport{
+		// a proxy from the environment would make the connection instead of the dialer, and skip the check
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     30 * time.Second,
+	}
+}
+
+// Options the client runs with, defaults filled in
+func (client *Client) Options() Options {
+	return client.options
+}
+
+// runs before every connection, with the resolved address
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// IsPublic reports whether the address can be reached from the internet, private, loopback, link-local
+// (cloud metadata at 169.254.169.254), multicast and reserved addresses are not
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// sends a request with the hop timeout, the caller closes the body
+func (client *Client) do(ctx context.Context, method, link string) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(client.options.HopTimeoutSeconds)*time.Second)
+	request, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		cancel()
+		return nil, nil, ErrUnsupportedScheme
+	}
+	request.Header.Set("User-Agent", client.options.UserAgent)
+	response, err := client.http.Do(request)
+	if err != nil {
+		cancel()
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrBlockedAddress, request.URL.Host)
+		}
+		return nil, nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	return response, cancel, nil
+}
@@ -0,0 +1,48 @@
+package urlfetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Page is a response read by Fetch
+type Page struct {
+	// URL the page was read from, after the redirects
+	Url    string
+	Status int
+	Header http.Header
+	// at most MaxBodyBytes of the body, Truncated is set when there was more
+	Body      []byte
+	Truncated bool
+}
+
+// Fetch reads the page at link with GET, following its redirects
+func (client *Client) Fetch(ctx context.Context, link string) (Page, []Hop, error) {
+	var page Page
+	chain, err := client.follow(link, func(link string) (Hop, error) {
+		hop := Hop{Url: link, Method: http.MethodGet}
+		response, cancel, err := client.do(ctx, http.MethodGet, link)
+		if err != nil {
+			return hop, err
+		}
+		defer cancel()
+		defer response.Body.Close()
+
+		hop.Status = response.StatusCode
+		if hop.Location, err = redirectLocation(response); err != nil || hop.Location != "" {
+			return hop, err
+		}
+		body, err := io.ReadAll(io.LimitReader(response.Body, client.options.MaxBodyBytes+1))
+		if err != nil {
+			return hop, fmt.Errorf("%w: %w", ErrUnreachable, err)
+		}
+		page = Page{Url: link, Status: response.StatusCode, Header: response.Header, Body: body}
+		if int64(len(body)) > client.options.MaxBodyBytes {
+			page.Body, page.Truncated = body[:client.options.MaxBodyBytes], true
+		}
+		return hop, nil
+	})
+	return page, chain, err
+}
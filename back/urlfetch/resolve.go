@@ -0,0 +1,113 @@
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// Hop is a request made while following redirects
+type Hop struct {
+	Url    string `json:"url"`
+	Method string `json:"method"`
+	Status int    `json:"status"`
+	// where the response redirects to, resolved against Url
+	Location string `json:"location,omitempty"`
+}
+
+// statuses that send the client somewhere else
+var redirectStatuses = map[int]bool{
+	http.StatusMovedPermanently: true, http.StatusFound: true, http.StatusSeeOther: true,
+	http.StatusTemporaryRedirect: true, http.StatusPermanentRedirect: true,
+}
+
+// statuses of servers that don't answer HEAD properly, the request is made again with GET
+var headFallbackStatuses = map[int]bool{
+	http.StatusBadRequest: true, http.StatusForbidden: true, http.StatusMethodNotAllowed: true, http.StatusNotImplemented: true,
+}
+
+// Resolve follows the redirects of link until a response that is not one, and returns every hop
+// the URL of the last hop is the destination, an error comes with the hops made before it
+func (client *Client) Resolve(ctx context.Context, link string) ([]Hop, error) {
+	return client.follow(link, func(link string) (Hop, error) { return client.hop(ctx, link) })
+}
+
+// follows the redirects of link, request makes the request of every hop
+func (client *Client) follow(link string, request func(link string) (Hop, error)) ([]Hop, error) {
+	var chain []Hop
+	visited := map[string]bool{}
+	for {
+		if visited[link] {
+			return chain, fmt.Errorf("%w, %s is visited twice", ErrRedirectLoop, link)
+		}
+		visited[link] = true
+		if len(chain) > client.options.MaxHops {
+			return chain, fmt.Errorf("%w, stopped after %d", ErrTooManyRedirects, client.options.MaxHops)
+		}
+
+		hop, err := request(link)
+		if err != nil {
+			return chain, err
+		}
+		chain = append(chain, hop)
+		if hop.Location == "" {
+			return chain, nil
+		}
+		link = hop.Location
+	}
+}
+
+// requests link with HEAD, or GET when HEAD is not supported
+func (client *Client) hop(ctx context.Context, link string) (Hop, error) {
+	hop := Hop{Url: link, Method: http.MethodHead}
+	response, cancel, err := client.do(ctx, http.MethodHead, link)
+	if err != nil {
+		return hop, err
+	}
+	if headFallbackStatuses[response.StatusCode] {
+		response.Body.Close()
+		cancel()
+		hop.Method = http.MethodGet
+		if response, cancel, err = client.do(ctx, http.MethodGet, link); err != nil {
+			return hop, err
+		}
+	}
+	defer cancel()
+	defer response.Body.Close()
+	// a little of the body is read so that the connection can be reused
+	io.CopyN(io.Discard, response.Body, 4<<10)
+
+	hop.Status = response.StatusCode
+	hop.Location, err = redirectLocation(response)
+	return hop, err
+}
+
+// where the response redirects to, empty when it is not a redirect
+func redirectLocation(response *http.Response) (string, error) {
+	location := response.Header.Get("Location")
+	if !redirectStatuses[response.StatusCode] || location == "" {
+		return "", nil
+	}
+	next, err := response.Request.URL.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+	// the fragment is not sent, but a redirect without one keeps the fragment of the request (RFC 9110 10.2.2)
+	if next.Fragment == "" && response.Request.URL.Fragment != "" {
+		next.Fragment = response.Request.URL.Fragment
+	}
+	return next.String(), nil
+}
+
+// Destination is the URL the chain ends at
+func Destination(chain []Hop) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	return chain[len(chain)-1].Url
+}
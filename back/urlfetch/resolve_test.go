@@ -0,0 +1,147 @@
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// httptest servers listen on 127.0.0.1, which the default options block
+var testOptions = Options{AllowPrivate: true, HopTimeoutSeconds: 1, MaxHops: 5}
+
+func redirect(w http.ResponseWriter, location string, status int) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(status)
+}
+
+func TestResolve(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/short":
+			redirect(w, "/legacy?id=1", http.StatusMovedPermanently)
+		case "/legacy":
+			redirect(w, destination.URL+"/page", http.StatusFound)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			redirect(w, "/short", http.StatusPermanentRedirect)
+		case "/loop-a":
+			redirect(w, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			redirect(w, "/loop-a", http.StatusFound)
+		case "/ftp":
+			redirect(w, "ftp://files.example.com/a", http.StatusFound)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			// /count/N redirects to /count/N+1 forever
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/count/"))
+			redirect(w, "/count/"+strconv.Itoa(n+1), http.StatusTemporaryRedirect)
+		}
+	}))
+	defer server.Close()
+
+	client := New(testOptions)
+	ctx := context.Background()
+
+	t.Run("Testing a chain of redirects across hosts", func(t *testing.T) {
+		chain, err := client.Resolve(ctx, server.URL+"/no-head")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Hop{
+			{Url: server.URL + "/no-head", Method: "GET", Status: 308, Location: server.URL + "/short"},
+			{Url: server.URL + "/short", Method: "HEAD", Status: 301, Location: server.URL + "/legacy?id=1"},
+			{Url: server.URL + "/legacy?id=1", Method: "HEAD", Status: 302, Location: destination.URL + "/page"},
+			{Url: destination.URL + "/page", Method: "HEAD", Status: 200},
+		}
+		if len(chain) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, chain)
+		}
+		for i := range expected {
+			if chain[i] != expected[i] {
+				t.Errorf("hop %d: expected %+v, got %+v", i, expected[i], chain[i])
+			}
+		}
+		if Destination(chain) != destination.URL+"/page" {
+			t.Errorf("unexpected destination %s", Destination(chain))
+		}
+	})
+
+	t.Run("Testing loops and too many redirects", func(t *testing.T) {
+		chain, err := client.Resolve(ctx, server.URL+"/loop-a")
+		if !errors.Is(err, ErrRedirectLoop) || len(chain) != 2 {
+			t.Errorf("expected a loop after 2 hops, got %v %v", chain, err)
+		}
+		chain, err = client.Resolve(ctx, server.URL+"/count/0")
+		if !errors.Is(err, ErrTooManyRedirects) || len(chain) != 6 {
+			t.Errorf("expected to stop after 6 hops, got %d %v", len(chain), err)
+		}
+		_, err = client.Resolve(ctx, server.URL+"/ftp")
+		if !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("expected %v, got %v", ErrUnsupportedScheme, err)
+		}
+	})
+
+	t.Run("Testing the hop timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := client.Resolve(ctx, server.URL+"/slow")
+		if !errors.Is(err, ErrUnreachable) || time.Since(start) > 3*time.Second {
+			t.Errorf("expected the request to time out after a second, got %v after %v", err, time.Since(start))
+		}
+	})
+
+	t.Run("Testing private addresses are blocked", func(t *testing.T) {
+		_, err := New(Options{}).Resolve(ctx, server.URL+"/short")
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("expected %v, got %v", ErrBlockedAddress, err)
+		}
+		// a public URL could redirect there as well, every hop is checked when it connects
+		_, err = New(Options{}).Resolve(ctx, "http://localhost:"+strings.Split(server.URL, ":")[2]+"/short")
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("expected %v, got %v", ErrBlockedAddress, err)
+		}
+	})
+}
+
+func TestIsPublic(t *testing.T) {
+	for address, public := range map[string]bool{
+		"8.8.8.8":                true,
+		"2606:4700:4700::1111":   true,
+		"127.0.0.1":              false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"100.100.100.200":        false,
+		"0.0.0.0":                false,
+		"224.0.0.1":              false,
+		"::1":                    false,
+		"::":                     false,
+		"fe80::1":                false,
+		"fd00:ec2::254":          false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+		"64:ff9b::a00:1":         false,
+	} {
+		if IsPublic(netip.MustParseAddr(address)) != public {
+			t.Errorf("%s: expected public %v", address, public)
+		}
+	}
+}
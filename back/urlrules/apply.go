@@ -0,0 +1,208 @@
+package urlrules
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrNoPath = errors.New("URL does not have a canonical format")
+
+// returned for a URL on another domain when the rule set has no domain_error
+var ErrDomain = errors.New("URL is not from an allowed domain")
+
+// the domain_error of a rule set, it matches ErrDomain with errors.Is
+type domainError string
+
+func (err domainError) Error() string {
+	return string(err)
+}
+
+func (err domainError) Is(target error) bool {
+	return target == ErrDomain
+}
+
+// applies the rule set called name, and the rule sets it chains, to the URL
+func (file *File) apply(name, link string) (string, error) {
+	set := file.RuleSets[name]
+	if len(set.Steps) > 0 {
+		var err error
+		for _, step := range set.Steps {
+			link, err = file.apply(step, link)
+			if err != nil {
+				return "", err
+			}
+		}
+		return link, nil
+	}
+	return set.apply(link)
+}
+
+func (set *RuleSet) apply(link string) (string, error) {
+	if set.Normalize {
+		var err error
+		if link, err = Normalize(link); err != nil {
+			return "", err
+		}
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	if !set.allowsHost(parsed.Hostname()) {
+		if set.DomainError != "" {
+			return "", domainError(set.DomainError)
+		}
+		return "", ErrDomain
+	}
+	path := parsed.EscapedPath()
+	if set.RequirePath && (path == "" || path == "/") {
+		return "", ErrNoPath
+	}
+
+	scheme := parsed.Scheme
+	if set.Scheme == Https || set.Scheme == Http {
+		scheme = set.Scheme
+	}
+
+	host := parsed.Host
+	hasWww := strings.HasPrefix(strings.ToLower(host), "www.")
+	switch {
+	case set.Www == Add && !hasWww:
+		host = "www." + host
+	case set.Www == Remove && hasWww:
+		host = host[len("www."):]
+	}
+	if set.Case == LowerHost {
+		host = strings.ToLower(host)
+	}
+
+	switch {
+	case set.TrailingSlash == Remove:
+		path = strings.TrimSuffix(path, "/")
+	case set.TrailingSlash == Add && !strings.HasSuffix(path, "/"):
+		path += "/"
+	}
+
+	query := set.Query.apply(parsed.RawQuery)
+	fragment := parsed.EscapedFragment()
+	if set.Fragment == Drop || (set.Fragment == Route && !isRoute(fragment)) {
+		fragment = ""
+	}
+
+	// the URL is put back together by hand, url.URL.String() would re-escape parts of it
+	var processed strings.Builder
+	processed.WriteString(scheme + "://")
+	if parsed.User != nil {
+		processed.WriteString(parsed.User.String() + "@")
+	}
+	processed.WriteString(host + path)
+	if query != "" {
+		processed.WriteString("?" + query)
+	}
+	if fragment != "" {
+		processed.WriteString("#" + fragment)
+	}
+	if set.Case == Lower {
+		return strings.ToLower(processed.String()), nil
+	}
+	return processed.String(), nil
+}
+
+// whether the host is one of the domains, or one of their allowed subdomains
+// international names are compared in punycode, whichever form the URL and the rules use
+func (set *RuleSet) allowsHost(host string) bool {
+	if len(set.Domains) == 0 {
+		return true
+	}
+	if ascii, err := normalizeHost(host); err == nil {
+		host = ascii
+	} else {
+		host = strings.ToLower(host)
+	}
+	for _, domain := range set.Domains {
+		if ascii, err := normalizeHost(domain); err == nil {
+			domain = ascii
+		}
+		if host == domain {
+			return true
+		}
+		subdomain, found := strings.CutSuffix(host, "."+domain)
+		if !found {
+			continue
+		}
+		for _, allowed := range set.Subdomains {
+			if allowed == "*" || allowed == subdomain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filters the raw query, parameters keep their encoding, and their order unless Sort is set
+func (query Query) apply(rawQuery string) string {
+	filtered := query.Mode == Allow || query.Mode == Deny
+	switch {
+	case query.Mode == Drop:
+		return ""
+	case !filtered && !query.Sort && !query.DropEmpty:
+		return rawQuery
+	}
+
+	type param struct{ name, pair string }
+	var kept []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if query.DropEmpty && value == "" {
+			continue
+		}
+		if filtered && query.matches(name) != (query.Mode == Allow) {
+			continue
+		}
+		kept = append(kept, param{name, pair})
+	}
+	if query.Sort {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].name < kept[j].name })
+	}
+	pairs := make([]string, len(kept))
+	for i, param := range kept {
+		pairs[i] = param.pair
+	}
+	return strings.Join(pairs, "&")
+}
+
+// whether the parameter is listed in Params
+func (query Query) matches(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range query.Params {
+		if param == TrackingList {
+			if (Query{Params: TrackingParams}).matches(name) {
+				return true
+			}
+			continue
+		}
+		param = strings.ToLower(param)
+		if prefix, wildcard := strings.CutSuffix(param, "*"); wildcard {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the fragment is a client-side route rather than an anchor in the page
+func isRoute(fragment string) bool {
+	return strings.HasPrefix(fragment, "/") || strings.HasPrefix(fragment, "!")
+}
@@ -0,0 +1,203 @@
+package urlrules
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+	"github.com/mimminou/BookIT-ByFood/back/utils"
+)
+
+var ErrInvalidUrl = errors.New("Url format invalid")
+var ErrInvalidOperation = errors.New("Invalid operation")
+
+// rules used when no rule file is configured, canonical, redirection and all for byfood.com
+//
+//go:embed default.yaml
+var DefaultRules []byte
+
+// Engine runs the operations of a rule file, the rules can be swapped while requests are being processed
+type Engine struct {
+	// rule file, empty for the default rules
+	path  string
+	rules atomic.Pointer[File]
+	// client of the network operations
+	fetcher *urlfetch.Client
+
+	// serializes reloads, and remembers what the file looked like when it was last read
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// Operation is a rule set, as listed by GET /url/operations
+type Operation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// NewEngine runs the rules of file, they can't be reloaded
+func NewEngine(file *File) *Engine {
+	engine := &Engine{fetcher: urlfetch.New(urlfetch.Options{})}
+	engine.rules.Store(file)
+	return engine
+}
+
+// Default runs the default rules
+func Default() *Engine {
+	file, err := Parse("default.yaml", DefaultRules)
+	if err != nil {
+		// checked by the tests
+		panic(err)
+	}
+	return NewEngine(file)
+}
+
+// Load reads the rule file at path, the default rules are used when path is empty
+func Load(path string) (*Engine, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	engine := &Engine{path: path, fetcher: urlfetch.New(urlfetch.Options{})}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Reload reads the rule file again, the current rules are kept if it is not valid
+func (engine *Engine) Reload() error {
+	if engine.path == "" {
+		return nil
+	}
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(engine.path)
+	if err != nil {
+		return err
+	}
+	file, err := Parse(engine.path, data)
+	if err != nil {
+		return err
+	}
+	engine.rules.Store(file)
+	engine.modTime, engine.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Watch reloads the rule file when it changes, checking every interval until ctx is done
+// onReload is called after every reload attempt, with the error that kept the previous rules if any
+func (engine *Engine) Watch(ctx context.Context, interval time.Duration, onReload func(error)) {
+	if engine.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !engine.changed() {
+				continue
+			}
+			err := engine.Reload()
+			if err != nil {
+				// don't retry an invalid file until it changes again
+				engine.remember()
+			}
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}
+}
+
+func (engine *Engine) changed() bool {
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return false
+	}
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return !info.ModTime().Equal(engine.modTime) || info.Size() != engine.size
+}
+
+func (engine *Engine) remember() {
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return
+	}
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.modTime, engine.size = info.ModTime(), info.Size()
+}
+
+// Result of an operation
+type Result struct {
+	Url string
+	// requests made by the network operations
+	Chain []urlfetch.Hop
+	// canonical URLs declared by the page, for html-canonical
+	Canonical *urlfetch.CanonicalReport
+}
+
+// Process runs the operation on the link and returns the processed URL
+func (engine *Engine) Process(link, operation string) (string, error) {
+	result, err := engine.Run(context.Background(), link, operation)
+	return result.Url, err
+}
+
+// Run runs the operation, a network operation or the rule set with that name, on the link
+// ctx bounds the network operations
+func (engine *Engine) Run(ctx context.Context, link, operation string) (Result, error) {
+	if !utils.IsUrl(link) {
+		return Result{}, ErrInvalidUrl
+	}
+	if network, found := networkOperations[operation]; found {
+		return network.run(ctx, engine, link)
+	}
+	rules := engine.rules.Load()
+	if rules.RuleSets[operation] == nil {
+		return Result{}, ErrInvalidOperation
+	}
+	processedUrl, err := rules.apply(operation, link)
+	return Result{Url: processedUrl}, err
+}
+
+// HasOperation reports whether Run knows the operation
+func (engine *Engine) HasOperation(operation string) bool {
+	if _, found := networkOperations[operation]; found {
+		return true
+	}
+	return engine.rules.Load().RuleSets[operation] != nil
+}
+
+// SetFetcher replaces the client of the network operations, call it before processing URLs
+func (engine *Engine) SetFetcher(fetcher *urlfetch.Client) {
+	engine.fetcher = fetcher
+}
+
+// Operations lists the rule sets and the network operations, by name
+func (engine *Engine) Operations() []Operation {
+	rules := engine.rules.Load()
+	operations := make([]Operation, 0, len(rules.RuleSets)+len(networkOperations))
+	for _, name := range rules.Names() {
+		operations = append(operations, Operation{Name: name, Description: rules.RuleSets[name].Description})
+	}
+	for name, network := range networkOperations {
+		operations = append(operations, Operation{Name: name, Description: network.description})
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].Name < operations[j].Name })
+	return operations
+}
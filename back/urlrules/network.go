@@ -0,0 +1,90 @@
+package urlrules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
+var ErrNoCanonical = errors.New("Page does not declare a canonical URL")
+
+// operations that fetch the URL instead of rewriting it, they are always available and their names can't be rule sets
+type networkOperation struct {
+	description string
+	run         func(ctx context.Context, engine *Engine, link string) (Result, error)
+}
+
+var networkOperations = map[string]networkOperation{
+	"resolve": {
+		description: "Follows the redirects of the URL (HEAD, or GET when HEAD is not supported) and returns where they end, with every hop and its status. Private, loopback and link-local addresses can't be reached",
+		run:         resolve,
+	},
+	"html-canonical": {
+		description: "Fetches the page and returns the canonical URL it declares, with <link rel=\"canonical\">, the Link header or og:url, and reports where they disagree with each other and with the canonical operation",
+		run:         htmlCanonical,
+	},
+}
+
+func resolve(ctx context.Context, engine *Engine, link string) (Result, error) {
+	chain, err := engine.fetcher.Resolve(ctx, link)
+	if err != nil {
+		return Result{Chain: chain}, err
+	}
+	return Result{Url: urlfetch.Destination(chain), Chain: chain}, nil
+}
+
+func htmlCanonical(ctx context.Context, engine *Engine, link string) (Result, error) {
+	page, chain, err := engine.fetcher.Fetch(ctx, link)
+	if err != nil {
+		return Result{Chain: chain}, err
+	}
+	if page.Status >= 400 {
+		return Result{Chain: chain}, fmt.Errorf("%w, the page answered with status %d", urlfetch.ErrUnreachable, page.Status)
+	}
+	report := urlfetch.ParseCanonical(page)
+	// a URL the canonical rule set rejects (no path...) has nothing computed to compare with
+	if rules := engine.rules.Load(); rules.RuleSets["canonical"] != nil {
+		report.Computed, _ = rules.apply("canonical", link)
+	}
+	report.Disagreements = disagreements(report)
+	declared := report.Declared()
+	if declared == "" {
+		return Result{Chain: chain, Canonical: &report}, ErrNoCanonical
+	}
+	return Result{Url: declared, Chain: chain, Canonical: &report}, nil
+}
+
+// the pairs of canonical URLs of the report that don't point to the same URL once normalised
+func disagreements(report urlfetch.CanonicalReport) []string {
+	declarations := []struct{ name, url string }{
+		{"<link rel=\"canonical\">", report.Link},
+		{"the Link header", report.Header},
+		{"og:url", report.OgUrl},
+	}
+	var found []string
+	for i, first := range declarations {
+		for _, second := range declarations[i+1:] {
+			if first.url != "" && second.url != "" && !sameUrl(first.url, second.url) {
+				found = append(found, fmt.Sprintf("%s (%s) and %s (%s) differ", first.name, first.url, second.name, second.url))
+			}
+		}
+	}
+	if declared := report.Declared(); declared != "" && report.Computed != "" && !sameUrl(declared, report.Computed) {
+		found = append(found, fmt.Sprintf("the declared canonical (%s) and the computed one (%s) differ", declared, report.Computed))
+	}
+	return found
+}
+
+func sameUrl(first, second string) bool {
+	if first == second {
+		return true
+	}
+	normalizedFirst, err := Normalize(first)
+	if err != nil {
+		return false
+	}
+	normalizedSecond, err := Normalize(second)
+	return err == nil && normalizedFirst == normalizedSecond
+}
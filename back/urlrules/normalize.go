@@ -0,0 +1,181 @@
+package urlrules
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+/**
+Normalisation of RFC 3986 (section 6.2.2 and 6.2.3), the normalised URL points to the same resource as the original:
+- scheme and host are lowercased, international host names are converted to punycode
+- the default port of the scheme is removed, and so is an empty port
+- percent-encoded unreserved characters are decoded, the hex digits of the other escapes are uppercased
+- "." and ".." segments of the path are resolved, an empty path becomes "/"
+The case of the path, query and fragment is kept, servers are free to treat them as case sensitive
+**/
+
+var ErrInvalidHost = errors.New("URL host is not valid")
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// the lookup profile of IDNA, without its ban on "_" that host names use in the wild
+var hostProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// Normalize returns the normal form of an absolute URL
+func Normalize(link string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme == "" {
+		return "", ErrInvalidUrl
+	}
+	if parsed.Host == "" {
+		return "", ErrInvalidHost
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	host, err := normalizeHost(parsed.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := parsed.Port(); port != "" && port != defaultPorts[scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6
+		host = "[" + host + "]"
+	}
+
+	path := removeDotSegments(normalizeEscapes(parsed.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+
+	// put back together by hand, url.URL.String() would escape the decoded characters again
+	var normalized strings.Builder
+	normalized.WriteString(scheme + "://")
+	if parsed.User != nil {
+		normalized.WriteString(normalizeEscapes(parsed.User.String()) + "@")
+	}
+	normalized.WriteString(host + path)
+	if parsed.ForceQuery || parsed.RawQuery != "" {
+		normalized.WriteString("?" + normalizeEscapes(parsed.RawQuery))
+	}
+	if parsed.Fragment != "" {
+		normalized.WriteString("#" + normalizeEscapes(parsed.EscapedFragment()))
+	}
+	return normalized.String(), nil
+}
+
+// lowercases the host, and converts an international domain name to punycode
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalidHost
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			// the shortest form of an IPv6 address
+			return ip.String(), nil
+		}
+		return strings.ToLower(host), nil
+	}
+	// only an IPv6 address has colons, and brackets are not part of the host name
+	if strings.ContainsAny(host, ":[]") {
+		return "", ErrInvalidHost
+	}
+	ascii, err := hostProfile.ToASCII(host)
+	// some characters (soft hyphens...) are mapped to nothing
+	if err != nil || ascii == "" {
+		return "", ErrInvalidHost
+	}
+	// bytes that aren't UTF-8 are mapped to U+FFFD, whose punycode is not a valid host name
+	if again, err := hostProfile.ToASCII(ascii); err != nil || again != ascii {
+		return "", ErrInvalidHost
+	}
+	// the mapping can also bring in characters (spaces...) a host name can't hold
+	for i := 0; i < len(ascii); i++ {
+		if !isUnreserved(ascii[i]) {
+			return "", ErrInvalidHost
+		}
+	}
+	return ascii, nil
+}
+
+// decodes the escapes of unreserved characters and uppercases the hex digits of the others
+// a % that does not start an escape is left as it is
+func normalizeEscapes(escaped string) string {
+	if !strings.Contains(escaped, "%") {
+		return escaped
+	}
+	var normalized strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '%' || i+2 >= len(escaped) || !isHex(escaped[i+1]) || !isHex(escaped[i+2]) {
+			normalized.WriteByte(escaped[i])
+			continue
+		}
+		decoded := unhex(escaped[i+1])<<4 | unhex(escaped[i+2])
+		if isUnreserved(decoded) {
+			normalized.WriteByte(decoded)
+		} else {
+			normalized.WriteString("%" + strings.ToUpper(escaped[i+1:i+3]))
+		}
+		i += 2
+	}
+	return normalized.String()
+}
+
+// resolves the "." and ".." segments of the path, RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	var output []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// the first segment is the empty one before the leading slash, it is never removed
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	resolved := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(resolved, "/") {
+		resolved = "/" + resolved
+	}
+	return resolved
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,219 @@
+package urlrules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/**
+Rule file of the URL cleaner, every operation of POST /url is a named rule set of the file
+A rule set either lists the policies applied to the URL, or chains other rule sets with steps
+Policies left empty keep that part of the URL as it is
+**/
+
+// Policy values, "keep" (or empty) leaves that part of the URL untouched
+const (
+	Keep = "keep"
+	// scheme
+	Https = "https"
+	Http  = "http"
+	// www prefix and trailing slash
+	Add    = "add"
+	Remove = "remove"
+	// case
+	Lower     = "lower"
+	LowerHost = "lower-host"
+	// query and fragment
+	Drop  = "drop"
+	Allow = "allow"
+	Deny  = "deny"
+	// fragment, keeps client-side routes (#/path or #!path) and drops anchors
+	Route = "route"
+)
+
+// File is the content of a rule file
+type File struct {
+	RuleSets map[string]*RuleSet `json:"rule_sets" yaml:"rule_sets"`
+}
+
+// RuleSet describes how an operation transforms a URL
+type RuleSet struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// names of other rule sets applied in order, a rule set with steps has no policies of its own
+	Steps []string `json:"steps,omitempty" yaml:"steps,omitempty"`
+
+	// domains the URL must be on, any domain when empty
+	Domains []string `json:"domains,omitempty" yaml:"domains,omitempty"`
+	// subdomains of Domains that are allowed besides the domain itself, "*" allows any
+	Subdomains []string `json:"subdomains,omitempty" yaml:"subdomains,omitempty"`
+	// error returned for a URL on another domain
+	DomainError string `json:"domain_error,omitempty" yaml:"domain_error,omitempty"`
+	// the URL must have a path besides "/"
+	RequirePath bool `json:"require_path,omitempty" yaml:"require_path,omitempty"`
+	// normalises the URL (see Normalize) before the other policies
+	Normalize bool `json:"normalize,omitempty" yaml:"normalize,omitempty"`
+
+	// keep, https or http
+	Scheme string `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	// keep, add or remove the www. prefix of the host
+	Www string `json:"www,omitempty" yaml:"www,omitempty"`
+	// keep, add or remove the trailing slash of the path
+	TrailingSlash string `json:"trailing_slash,omitempty" yaml:"trailing_slash,omitempty"`
+	// keep, lower (the whole URL) or lower-host
+	Case string `json:"case,omitempty" yaml:"case,omitempty"`
+	// what is kept of the query string
+	Query Query `json:"query,omitempty" yaml:"query,omitempty"`
+	// keep, drop or route
+	Fragment string `json:"fragment,omitempty" yaml:"fragment,omitempty"`
+}
+
+// Query describes what is kept of the query string
+type Query struct {
+	// keep, drop (the whole query), allow (only Params) or deny (all but Params)
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// parameter names, case insensitive, a trailing * matches any suffix (utm_*), @tracking is TrackingParams
+	Params []string `json:"params,omitempty" yaml:"params,omitempty"`
+	// sorts the parameters that are kept by name, repeated parameters keep their order
+	Sort bool `json:"sort,omitempty" yaml:"sort,omitempty"`
+	// removes parameters without a value (a= or a)
+	DropEmpty bool `json:"drop_empty,omitempty" yaml:"drop_empty,omitempty"`
+}
+
+// Parse reads a rule file, JSON when the name ends with .json, YAML otherwise, and checks it
+func Parse(name string, data []byte) (*File, error) {
+	var file File
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := file.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &file, nil
+}
+
+// Validate checks the policies of every rule set, and that steps name existing rule sets without cycles
+func (file *File) Validate() error {
+	if len(file.RuleSets) == 0 {
+		return fmt.Errorf("no rule sets")
+	}
+	for _, name := range file.Names() {
+		set := file.RuleSets[name]
+		if set == nil {
+			return fmt.Errorf("rule set %q is empty", name)
+		}
+		if _, found := networkOperations[name]; found {
+			return fmt.Errorf("rule set %q: the name of a network operation can't be used", name)
+		}
+		if err := set.validate(); err != nil {
+			return fmt.Errorf("rule set %q: %w", name, err)
+		}
+		for _, step := range set.Steps {
+			if file.RuleSets[step] == nil {
+				return fmt.Errorf("rule set %q: unknown step %q", name, step)
+			}
+		}
+		if file.hasCycle(name, map[string]bool{}) {
+			return fmt.Errorf("rule set %q: steps loop back to it", name)
+		}
+	}
+	return nil
+}
+
+// Names of the rule sets, sorted
+func (file *File) Names() []string {
+	names := make([]string, 0, len(file.RuleSets))
+	for name := range file.RuleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (file *File) hasCycle(name string, visiting map[string]bool) bool {
+	if visiting[name] {
+		return true
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	for _, step := range file.RuleSets[name].Steps {
+		if file.RuleSets[step] != nil && file.hasCycle(step, visiting) {
+			return true
+		}
+	}
+	return false
+}
+
+func (set *RuleSet) validate() error {
+	if len(set.Steps) > 0 {
+		if set.hasPolicies() {
+			return fmt.Errorf("a rule set with steps can not have policies")
+		}
+		return nil
+	}
+	for _, policy := range []struct {
+		field, value string
+		allowed      []string
+	}{
+		{"scheme", set.Scheme, []string{Https, Http}},
+		{"www", set.Www, []string{Add, Remove}},
+		{"trailing_slash", set.TrailingSlash, []string{Add, Remove}},
+		{"case", set.Case, []string{Lower, LowerHost}},
+		{"query.mode", set.Query.Mode, []string{Drop, Allow, Deny}},
+		{"fragment", set.Fragment, []string{Drop, Route}},
+	} {
+		if policy.value == "" || policy.value == Keep {
+			continue
+		}
+		if !contains(policy.allowed, policy.value) {
+			return fmt.Errorf("invalid %s %q, should be one of %s", policy.field, policy.value, strings.Join(append([]string{Keep}, policy.allowed...), ", "))
+		}
+	}
+	if (set.Query.Mode == Allow || set.Query.Mode == Deny) && len(set.Query.Params) == 0 {
+		return fmt.Errorf("query.mode %q needs params", set.Query.Mode)
+	}
+	for _, param := range set.Query.Params {
+		if strings.HasPrefix(param, "@") && param != TrackingList {
+			return fmt.Errorf("unknown parameter list %q, should be %s", param, TrackingList)
+		}
+	}
+	for _, domain := range set.Domains {
+		if domain == "" || domain != strings.ToLower(domain) || strings.ContainsAny(domain, ":/") {
+			return fmt.Errorf("invalid domain %q, should be a lowercase host name", domain)
+		}
+	}
+	if len(set.Subdomains) > 0 && len(set.Domains) == 0 {
+		return fmt.Errorf("subdomains need domains")
+	}
+	return nil
+}
+
+func (set *RuleSet) hasPolicies() bool {
+	return len(set.Domains) > 0 || len(set.Subdomains) > 0 || set.DomainError != "" || set.RequirePath || set.Normalize ||
+		set.Scheme != "" || set.Www != "" || set.TrailingSlash != "" || set.Case != "" ||
+		set.Query.Mode != "" || len(set.Query.Params) > 0 || set.Query.Sort || set.Query.DropEmpty || set.Fragment != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package urlrules
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
+func TestDefaultRules(t *testing.T) {
+	engine := Default()
+	for _, test := range []struct {
+		url, operation, expected string
+		err                      error
+	}{
+		{"https://byfood.com/Food/?a=b", "canonical", "https://byfood.com/Food", nil},
+		{"https://byfood.com/Food#top", "canonical", "https://byfood.com/Food", nil},
+		{"https://byfood.com/", "canonical", "", ErrNoPath},
+		{"https://BYFOOD.com/Food", "redirection", "https://www.byfood.com/Food", nil},
+		{"http://www.byfood.com/food/", "redirection", "https://www.byfood.com/food/", nil},
+		{"https://blog.byfood.com/food", "redirection", "", nil},
+		{"https://notbyfood.com/food", "redirection", "", nil},
+		{"https://byfood.com/Food/?a=b", "all", "https://www.byfood.com/Food", nil},
+		{"HTTP://BYFOOD.com:80/a/./b/../Food%7e", "redirection", "https://www.byfood.com/a/Food~", nil},
+		{"https://Example.com/Food/?utm_source=x&b=2&a=1&gclid=y", "clean", "https://example.com/Food/?a=1&b=2", nil},
+		{"https://example.com/?utm_medium=x#top", "clean", "https://example.com/", nil},
+		{"ftp://byfood.com/food", "all", "", ErrInvalidUrl},
+		{"https://byfood.com/food", "nothing", "", ErrInvalidOperation},
+	} {
+		processed, err := engine.Process(test.url, test.operation)
+		if processed != test.expected || (test.err != nil && err != test.err) || (test.expected == "" && err == nil) {
+			t.Errorf("%s %s: expected %q %v, got %q %v", test.operation, test.url, test.expected, test.err, processed, err)
+		}
+	}
+
+	_, err := engine.Process("https://blog.byfood.com/food", "redirection")
+	if err == nil || err.Error() != "URL is not from ByFood Domain" || !errors.Is(err, ErrDomain) {
+		t.Errorf("expected the domain error of the rule set, got %v", err)
+	}
+
+	var names []string
+	for _, operation := range engine.Operations() {
+		names = append(names, operation.Name)
+		if operation.Description == "" {
+			t.Errorf("operation %s has no description", operation.Name)
+		}
+	}
+	if strings.Join(names, ",") != "all,canonical,clean,html-canonical,normalize,redirection,resolve" {
+		t.Errorf("unexpected operations %v", names)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	file, err := Parse("rules.yaml", []byte(`
+rule_sets:
+  tracking:
+    query:
+      mode: deny
+      params: [utm_*, FBCLID]
+  only-id:
+    query:
+      mode: allow
+      params: [id]
+    fragment: keep
+  brand:
+    domains: [example.org, example.net]
+    subdomains: ["*"]
+    scheme: http
+    www: remove
+    trailing_slash: add
+    case: lower-host
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(file)
+	for _, test := range []struct {
+		url, operation, expected string
+	}{
+		{"https://a.com/p?utm_source=x&id=1&fbclid=y&UTM_medium=z", "tracking", "https://a.com/p?id=1"},
+		{"https://a.com/p?b=%20c&utm_source=x#Top", "tracking", "https://a.com/p?b=%20c#Top"},
+		{"https://a.com/p?x=1&id=2&id=3#f", "only-id", "https://a.com/p?id=2&id=3#f"},
+		{"https://WWW.Example.org/Path", "brand", "http://example.org/Path/"},
+		{"https://shop.example.net/a/", "brand", "http://shop.example.net/a/"},
+	} {
+		processed, err := engine.Process(test.url, test.operation)
+		if err != nil || processed != test.expected {
+			t.Errorf("%s %s: expected %q, got %q %v", test.operation, test.url, test.expected, processed, err)
+		}
+	}
+	if _, err := engine.Process("https://example.com/a", "brand"); err != ErrDomain {
+		t.Errorf("expected %v, got %v", ErrDomain, err)
+	}
+}
+
+func TestQueryCleaning(t *testing.T) {
+	for _, test := range []struct {
+		query    Query
+		raw      string
+		expected string
+	}{
+		{Query{}, "b=1&&a=", "b=1&&a="},
+		{Query{Sort: true}, "b=2&a=1&b=1&A=3", "A=3&a=1&b=2&b=1"},
+		{Query{DropEmpty: true}, "a=&b=1&c&d=%20", "b=1&d=%20"},
+		{Query{Mode: Deny, Params: []string{TrackingList}}, "MC_EID=1&page=2&Utm_Campaign=x&_hsenc=y&id=", "page=2&id="},
+		{Query{Mode: Deny, Params: []string{TrackingList, "ref"}, Sort: true, DropEmpty: true}, "ref=a&z=1&gclid=2&y=&x=3", "x=3&z=1"},
+		{Query{Mode: Allow, Params: []string{"page", "q*"}}, "query=a&page=1&utm_source=b", "query=a&page=1"},
+		{Query{Mode: Drop, Sort: true}, "b=1&a=2", ""},
+		{Query{Mode: Deny, Params: []string{"utm_*"}}, "utm%5Fsource=x&q=%26", "q=%26"},
+	} {
+		if cleaned := test.query.apply(test.raw); cleaned != test.expected {
+			t.Errorf("%+v %s: expected %q, got %q", test.query, test.raw, test.expected, cleaned)
+		}
+	}
+
+	for fragment, kept := range map[string]bool{"/food/1": true, "!/food": true, "reviews": false, "": false} {
+		if isRoute(fragment) != kept {
+			t.Errorf("fragment %q: expected route %v", fragment, kept)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	file, err := Parse("rules.json", []byte(`{"rule_sets": {"https": {"scheme": "https"}, "both": {"steps": ["https"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed, _ := NewEngine(file).Process("http://a.com/b", "both"); processed != "https://a.com/b" {
+		t.Errorf("unexpected url %s", processed)
+	}
+
+	for name, content := range map[string]string{
+		"no rule sets":          `rule_sets: {}`,
+		"unknown field":         `rule_sets: {a: {schema: https}}`,
+		"invalid policy":        `rule_sets: {a: {www: maybe}}`,
+		"unknown step":          `rule_sets: {a: {steps: [b]}}`,
+		"cycle":                 `rule_sets: {a: {steps: [b]}, b: {steps: [a]}}`,
+		"steps and policies":    `rule_sets: {a: {scheme: https}, b: {steps: [a], case: lower}}`,
+		"params missing":        `rule_sets: {a: {query: {mode: allow}}}`,
+		"uppercase domain":      `rule_sets: {a: {domains: [Example.com]}}`,
+		"subdomains no domains": `rule_sets: {a: {subdomains: [www]}}`,
+		"unknown param list":    `rule_sets: {a: {query: {mode: deny, params: ["@ads"]}}}`,
+		"network operation":     `rule_sets: {resolve: {scheme: https}}`,
+	} {
+		if _, err := Parse("rules.yaml", []byte(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Parse("rules.json", []byte(`{"rule_sets": {"a": {"case": "upper"}}}`)); err == nil {
+		t.Errorf("expected an error for an invalid JSON rule file")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rule_sets: {secure: {scheme: https}}")
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing rule file")
+	}
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed, _ := engine.Process("http://a.com/b", "secure"); processed != "https://a.com/b" {
+		t.Errorf("unexpected url %s", processed)
+	}
+
+	// an invalid file keeps the previous rules
+	write("rule_sets: {secure: {scheme: ftp}}")
+	if err := engine.Reload(); err == nil {
+		t.Errorf("expected an error for an invalid rule file")
+	}
+	if _, err := engine.Process("http://a.com/b", "secure"); err != nil {
+		t.Errorf("expected the previous rules to be kept, got %v", err)
+	}
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 10*time.Millisecond, func(err error) { reloads <- err })
+
+	write("rule_sets: {plain: {scheme: http}}")
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rule file was not reloaded")
+	}
+	if _, err := engine.Process("http://a.com/b", "secure"); err != ErrInvalidOperation {
+		t.Errorf("expected %v, got %v", ErrInvalidOperation, err)
+	}
+	if processed, _ := engine.Process("https://a.com/b", "plain"); processed != "http://a.com/b" {
+		t.Errorf("unexpected url %s", processed)
+	}
+}
+
+func TestResolveOperation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			w.Header().Set("Location", "/New")
+			w.WriteHeader(http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	engine := Default()
+	if _, err := engine.Run(context.Background(), server.URL+"/old", "resolve"); !errors.Is(err, urlfetch.ErrBlockedAddress) {
+		t.Errorf("expected %v, got %v", urlfetch.ErrBlockedAddress, err)
+	}
+	engine.SetFetcher(urlfetch.New(urlfetch.Options{AllowPrivate: true}))
+	result, err := engine.Run(context.Background(), server.URL+"/old", "resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Url != server.URL+"/New" || len(result.Chain) != 2 || result.Chain[0].Status != 301 || result.Chain[1].Status != 200 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestHtmlCanonicalOperation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/tour":
+			w.Header().Set("Link", `</tour>; rel="canonical"`)
+			w.Write([]byte(`<head><link rel="canonical" href="/tour?lang=en"><meta property="og:url" content="/Tour"></head>`))
+		case "/same":
+			w.Write([]byte(`<head><link rel="canonical" href="/same"><meta property="og:url" content="/same"></head>`))
+		case "/plain":
+			w.Write([]byte(`<head><title>Plain</title></head>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	engine := Default()
+	engine.SetFetcher(urlfetch.New(urlfetch.Options{AllowPrivate: true}))
+	ctx := context.Background()
+
+	result, err := engine.Run(ctx, server.URL+"/tour", "html-canonical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the HTML link wins, it disagrees with the header, og:url and the computed canonical (no query)
+	if result.Url != server.URL+"/tour?lang=en" || result.Canonical == nil || len(result.Canonical.Disagreements) != 4 {
+		t.Errorf("unexpected result %+v %+v", result, result.Canonical)
+	}
+
+	result, err = engine.Run(ctx, server.URL+"/same", "html-canonical")
+	if err != nil || result.Url != server.URL+"/same" || len(result.Canonical.Disagreements) != 0 {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+
+	if result, err = engine.Run(ctx, server.URL+"/plain", "html-canonical"); err != ErrNoCanonical || result.Canonical == nil {
+		t.Errorf("expected %v with a report, got %+v %v", ErrNoCanonical, result, err)
+	}
+	if _, err = engine.Run(ctx, server.URL+"/missing", "html-canonical"); !errors.Is(err, urlfetch.ErrUnreachable) {
+		t.Errorf("expected %v, got %v", urlfetch.ErrUnreachable, err)
+	}
+}
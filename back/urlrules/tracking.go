@@ -0,0 +1,23 @@
+package urlrules
+
+// name of the tracking parameter list in the params of a query policy, params: ["@tracking"]
+const TrackingList = "@tracking"
+
+// TrackingParams are the query parameters ad networks, analytics and mailing tools add to links
+// they never change the page that is served, keep the list sorted by source when adding to it
+var TrackingParams = []string{
+	// Google Analytics and Ads
+	"utm_*", "gclid", "gclsrc", "dclid", "gbraid", "wbraid", "_ga", "_gl",
+	// Meta
+	"fbclid", "igshid",
+	// Microsoft, Yandex, Twitter, TikTok, LinkedIn
+	"msclkid", "yclid", "twclid", "ttclid", "li_fat_id",
+	// Mailchimp
+	"mc_cid", "mc_eid",
+	// HubSpot
+	"_hsenc", "_hsmi", "__hstc", "__hssc", "__hsfp", "hsctatracking",
+	// Marketo, Vero, Olytics
+	"mkt_tok", "vero_conv", "vero_id", "oly_anon_id", "oly_enc_id",
+	// Adobe, Alibaba, misc referrers
+	"s_cid", "spm", "ref_src", "wickedid",
+}
@@ -1,11 +1,13 @@
 package utils
 
 import (
-	"fmt"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/mimminou/BookIT-ByFood/back/models"
 	"net/url"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -41,6 +43,65 @@ func ValidateDate(date string) bool {
 	return err == nil
 }
 
+// Validates a book against the same rules as the add endpoint, returns a list of problems, empty if the book is valid
+func ValidateBook(book models.Book) []string {
+	var problems []string
+	emptyFields := CheckEmptyFields(book)
+	if len(emptyFields) > 0 {
+		problems = append(problems, "The following fields are empty: "+strings.Join(emptyFields, ", "))
+	}
+	if book.Pub_Date != "" && !ValidateDate(book.Pub_Date) {
+		problems = append(problems, "Invalid date format. Should be YYYY-MM-DD")
+	}
+	if book.Num_Pages != nil && *book.Num_Pages < 0 {
+		problems = append(problems, "Number of pages can not be negative")
+	}
+	if book.Isbn != "" && !ValidateIsbn(book.Isbn) {
+		problems = append(problems, "Invalid ISBN, should be a valid ISBN-10 or ISBN-13")
+	}
+	return problems
+}
+
+// Removes the hyphens and spaces ISBNs are usually printed with, and upper cases the X check digit
+func NormalizeIsbn(isbn string) string {
+	isbn = strings.ToUpper(isbn)
+	return strings.NewReplacer("-", "", " ", "").Replace(isbn)
+}
+
+// check if isbn is a valid ISBN-10 or ISBN-13, including its check digit
+func ValidateIsbn(isbn string) bool {
+	isbn = NormalizeIsbn(isbn)
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, char := range isbn {
+			digit := int(char - '0')
+			if char == 'X' && i == 9 {
+				digit = 10
+			} else if char < '0' || char > '9' {
+				return false
+			}
+			sum += digit * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, char := range isbn {
+			if char < '0' || char > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += int(char-'0') * weight
+		}
+		return sum%10 == 0
+	default:
+		return false
+	}
+}
+
 // check if url is valid, and if it's http / https protocle
 func IsUrl(link string) bool {
 	parsed, err := url.Parse(link)
@@ -53,47 +114,24 @@ func IsUrl(link string) bool {
 	return true
 }
 
-func GetCanonicalUrl(link string) (string, error) {
-	regex := `(?i)^https?://[^/]+/[^\?]+`
-	re := regexp.MustCompile(regex)
-
-	isMatch := re.MatchString(link)
-	if !isMatch {
-		return "", fmt.Errorf("URL does not have a canonical format")
+// NewToken returns a random API token, 256 bits of entropy
+func NewToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
 	}
-
-	canonicalURL := re.FindString(link)
-	//remove trailing slash
-	canonicalURL = strings.TrimSuffix(canonicalURL, "/")
-	return canonicalURL, nil
+	return "bk_" + base64.RawURLEncoding.EncodeToString(random), nil
 }
 
-func GetRedirectionUrl(link string) (string, error) {
-
-	// match byfood.com, case insensitive on 'www' only because technically.
-	// a subdomain takeover attack can be performed so we don't match wildcard.
-	// a safe approach is to have a known list of active subdomains to match
-	FullRegex := `(?i)^https?:\/\/(www\.)?byfood\.com(?:\/.*)?$`
-	SubRegex := `(?:https?://)(.*)`
-	re := regexp.MustCompile(FullRegex)
-	subRegex := regexp.MustCompile(SubRegex)
-
-	isMatch := re.MatchString(link)
-	if !isMatch {
-		return "", fmt.Errorf("URL is not from ByFood Domain")
-	}
-
-	subLink := subRegex.FindStringSubmatch(link)
-
-	if len(subLink) < 2 {
-		return "", fmt.Errorf("URL not valid")
-	}
-	link = subLink[1] // get what's after https?://
+// HashToken is what is stored of a token, a plain hash is enough for random tokens that can't be guessed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	if !strings.HasPrefix(link, "www.") {
-		link = fmt.Sprintf("www.%s", link) // add www. if it's not there
-	}
-	processedURL := "https://" + link // add http(s)://
-	processedURL = strings.ToLower(processedURL)
-	return processedURL, nil
+// BearerToken reads the token of an Authorization value, "Bearer <token>"
+func BearerToken(authorization string) (string, bool) {
+	scheme, token, _ := strings.Cut(authorization, " ")
+	token = strings.TrimSpace(token)
+	return token, strings.EqualFold(scheme, "Bearer") && token != ""
 }
@@ -55,3 +55,58 @@ func TestCheckEmptyFields(t *testing.T) {
 	})
 
 }
+
+func TestValidateBook(t *testing.T) {
+
+	t.Run("Validate a correct book", func(t *testing.T) {
+		book := models.Book{
+			Title:    "test",
+			Author:   "test",
+			Pub_Date: "2001-02-03",
+		}
+		problems := ValidateBook(book)
+		if len(problems) != 0 {
+			t.Errorf("Expected no problems, got %v", problems)
+		}
+	})
+
+	t.Run("Validate a book with an empty field and a bad date", func(t *testing.T) {
+		book := models.Book{
+			Title:    "test",
+			Pub_Date: "03-02-2001",
+		}
+		problems := ValidateBook(book)
+		if len(problems) != 2 {
+			t.Errorf("Expected 2 problems, got %v", problems)
+		}
+	})
+
+	t.Run("Validate a book with negative pages", func(t *testing.T) {
+		pages := -5
+		book := models.Book{
+			Title:     "test",
+			Author:    "test",
+			Num_Pages: &pages,
+			Pub_Date:  "2001-02-03",
+		}
+		problems := ValidateBook(book)
+		if len(problems) != 1 {
+			t.Errorf("Expected 1 problem, got %v", problems)
+		}
+	})
+}
+
+func TestValidateIsbn(t *testing.T) {
+	valid := []string{"0-451-52493-4", "9780451524935", "978-0-451-52493-5", "0-8044-2957-X", "080442957x"}
+	for _, isbn := range valid {
+		if !ValidateIsbn(isbn) {
+			t.Errorf("Expected %s to be valid", isbn)
+		}
+	}
+	invalid := []string{"", "0-451-52493-5", "9780451524936", "97804515249", "abcdefghij"}
+	for _, isbn := range invalid {
+		if ValidateIsbn(isbn) {
+			t.Errorf("Expected %s to be invalid", isbn)
+		}
+	}
+}
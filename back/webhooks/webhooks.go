@@ -0,0 +1,258 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+	"github.com/mimminou/BookIT-ByFood/back/urlfetch"
+)
+
+/**
+Delivery of the book events to the webhooks: the changes of the books queue their deliveries in the outbox of the DB,
+the dispatcher polls it and POSTs the payload of each due delivery to the URL of its webhook
+A delivery is signed with the secret of the webhook, it is delivered when the receiver answers 2xx, otherwise it is
+attempted again later, after a wait that doubles with each failed attempt, until it runs out of attempts and fails
+**/
+
+// Options of the dispatcher, the config section "webhooks", a field left at 0 other than PollIntervalSeconds takes its value from DefaultOptions
+type Options struct {
+	// how often the outbox is checked for due deliveries, nothing is sent when 0
+	PollIntervalSeconds int `json:"poll_interval_seconds"`
+	// attempts made before a delivery fails
+	MaxAttempts int `json:"max_attempts"`
+	// wait after the first failed attempt, doubled after each next one
+	InitialBackoffSeconds int `json:"initial_backoff_seconds"`
+	// longest wait between two attempts
+	MaxBackoffSeconds int `json:"max_backoff_seconds"`
+	// time given to a receiver to answer
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// deliveries sent at the same time
+	Workers int `json:"workers"`
+	// lets the deliveries reach private, loopback and link-local addresses, for tests and trusted networks only
+	AllowPrivate bool `json:"allow_private"`
+}
+
+var DefaultOptions = Options{PollIntervalSeconds: 5, MaxAttempts: 10, InitialBackoffSeconds: 30, MaxBackoffSeconds: 3600, TimeoutSeconds: 10, Workers: 4}
+
+// headers of a delivery
+const (
+	EventHeader     = "X-Bookit-Event"
+	DeliveryHeader  = "X-Bookit-Delivery"
+	SignatureHeader = "X-Bookit-Signature"
+	userAgent       = "BookIT-Webhooks/1.0"
+)
+
+// most deliveries read from the outbox at each poll, the rest wait for the next one
+const batchSize = 100
+
+var (
+	ErrBadSignature     = errors.New("webhook signature does not match")
+	ErrExpiredSignature = errors.New("webhook signature is too old")
+)
+
+// Sign returns the signature header of a body sent at the time, "t=<unix time>,v1=<HMAC-SHA256 of "<unix time>.<body>", hex>"
+// the time is signed along with the body so that a receiver can refuse a delivery replayed later
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + mac(secret, timestamp, body)
+}
+
+func mac(secret, timestamp string, body []byte) string {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(timestamp + "."))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Verify checks the signature header of a delivery received at the time, for the receivers written in Go
+// a signature made more than tolerance before now is refused, tolerance 0 accepts any time
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	expected := []byte(mac(secret, timestamp, body))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), expected) {
+			if tolerance > 0 && now.Sub(time.Unix(unix, 0)) > tolerance {
+				return ErrExpiredSignature
+			}
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// Dispatcher sends the due deliveries of the outbox
+type Dispatcher struct {
+	db      *sql.DB
+	options Options
+	client  *http.Client
+	// the clock of the attempts, replaced by the tests
+	now func() time.Time
+}
+
+// New makes a dispatcher of the deliveries of the DB with the options
+func New(db *sql.DB, options Options) *Dispatcher {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if options.InitialBackoffSeconds <= 0 {
+		options.InitialBackoffSeconds = DefaultOptions.InitialBackoffSeconds
+	}
+	if options.MaxBackoffSeconds <= 0 {
+		options.MaxBackoffSeconds = DefaultOptions.MaxBackoffSeconds
+	}
+	if options.TimeoutSeconds <= 0 {
+		options.TimeoutSeconds = DefaultOptions.TimeoutSeconds
+	}
+	if options.Workers <= 0 {
+		options.Workers = DefaultOptions.Workers
+	}
+
+	timeout := time.Duration(options.TimeoutSeconds) * time.Second
+	return &Dispatcher{
+		db:      db,
+		options: options,
+		client: &http.Client{
+			// the receivers are checked like the URLs fetched by the URL cleaner
+			Transport: urlfetch.NewTransport(timeout, options.AllowPrivate),
+			Timeout:   timeout,
+			// a receiver that moved is a failed attempt, its webhook has to be updated
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		now: time.Now,
+	}
+}
+
+// Run sends the due deliveries every PollIntervalSeconds until the context is done
+// report is called after each poll that found deliveries to send, or failed
+func (dispatcher *Dispatcher) Run(ctx context.Context, report func(int, error)) {
+	if dispatcher.options.PollIntervalSeconds <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(dispatcher.options.PollIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sent, err := dispatcher.DeliverDue(ctx); sent > 0 || err != nil {
+				report(sent, err)
+			}
+		}
+	}
+}
+
+// DeliverDue makes an attempt of each delivery due now, Workers at a time, and returns the number of attempts made
+func (dispatcher *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	due, err := database.GetDueDeliveries(dispatcher.db, dispatcher.now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var wait sync.WaitGroup
+	var lock sync.Mutex
+	var errs []error
+	workers := make(chan struct{}, dispatcher.options.Workers)
+	for _, delivery := range due {
+		workers <- struct{}{}
+		wait.Add(1)
+		go func(delivery database.DueDelivery) {
+			defer func() { <-workers; wait.Done() }()
+			if err := dispatcher.attempt(ctx, delivery); err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(delivery)
+	}
+	wait.Wait()
+	return len(due), errors.Join(errs...)
+}
+
+// sends the delivery once and records the outcome, the error is the one of the DB, a failed attempt is recorded
+func (dispatcher *Dispatcher) attempt(ctx context.Context, due database.DueDelivery) error {
+	now := dispatcher.now().UTC().Truncate(time.Second)
+	delivery := due.WebhookDelivery
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.NextAttemptAt = nil
+	delivery.ResponseStatus, delivery.Error = 0, ""
+
+	status, err := dispatcher.send(ctx, due, now)
+	delivery.ResponseStatus = status
+	switch {
+	case err != nil:
+		delivery.Error = err.Error()
+	case status < 200 || status > 299:
+		delivery.Error = "receiver answered " + strconv.Itoa(status) + " " + http.StatusText(status)
+	}
+
+	switch {
+	case delivery.Error == "":
+		delivery.Status = models.DeliveryDelivered
+	case delivery.Attempts >= dispatcher.options.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+	default:
+		delivery.Status = models.DeliveryPending
+		next := now.Add(dispatcher.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	return database.RecordDeliveryAttempt(dispatcher.db, delivery)
+}
+
+// POSTs the payload to the receiver, returns the status it answered
+func (dispatcher *Dispatcher) send(ctx context.Context, due database.DueDelivery, at time.Time) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, due.Url, bytes.NewReader(due.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(EventHeader, due.Event)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(due.Delivery_Id))
+	request.Header.Set(SignatureHeader, Sign(due.Secret, at, due.Payload))
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// the answer is not used, reading a bit of it lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	return response.StatusCode, nil
+}
+
+// wait after the failed attempt, InitialBackoffSeconds doubled for each attempt after the first, up to MaxBackoffSeconds
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	wait := time.Duration(dispatcher.options.InitialBackoffSeconds) * time.Second
+	limit := time.Duration(dispatcher.options.MaxBackoffSeconds) * time.Second
+	for i := 1; i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mimminou/BookIT-ByFood/back/database"
+	"github.com/mimminou/BookIT-ByFood/back/models"
+)
+
+// a DB file with the schema of this build and no book
+func testDb(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "webhooks.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE Books (book_id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, author TEXT NOT NULL, num_pages INTEGER, pub_date DATE NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// receiver records the deliveries it accepts, and answers status to all of them
+type receiver struct {
+	lock       sync.Mutex
+	status     int
+	deliveries []models.BookEvent
+	headers    []http.Header
+}
+
+func (receiver *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if err := Verify("a-secret-of-16-chars", r.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event models.BookEvent
+	json.Unmarshal(body, &event)
+	receiver.deliveries = append(receiver.deliveries, event)
+	receiver.headers = append(receiver.headers, r.Header.Clone())
+	w.WriteHeader(receiver.status)
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event": "book.created"}`)
+	at := time.Now()
+	header := Sign("secret", at, body)
+	t.Log(header)
+
+	t.Run("Testing a valid signature", func(t *testing.T) {
+		if err := Verify("secret", header, body, time.Minute, at.Add(time.Second)); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("Testing the invalid signatures", func(t *testing.T) {
+		if err := Verify("other secret", header, body, time.Minute, at); err != ErrBadSignature {
+			t.Errorf("expected %v for another secret, got %v", ErrBadSignature, err)
+		}
+		if err := Verify("secret", header, []byte(`{"event": "book.deleted"}`), time.Minute, at); err != ErrBadSignature {
+			t.Errorf("expected %v for another body, got %v", ErrBadSignature, err)
+		}
+		if err := Verify("secret", "v1=abc", body, 0, at); err != ErrBadSignature {
+			t.Errorf("expected %v without a time, got %v", ErrBadSignature, err)
+		}
+		if err := Verify("secret", header, body, time.Minute, at.Add(time.Hour)); err != ErrExpiredSignature {
+			t.Errorf("expected %v an hour later, got %v", ErrExpiredSignature, err)
+		}
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	db := testDb(t)
+	hook := &receiver{status: http.StatusNoContent}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	id, err := database.AddWebhook(db, models.Webhook{Url: server.URL, Events: []string{models.EventBookCreated, models.EventBookDeleted},
+		Secret: "a-secret-of-16-chars", Active: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := New(db, Options{MaxAttempts: 3, InitialBackoffSeconds: 10, MaxBackoffSeconds: 15, AllowPrivate: true})
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	deliveries := func(status string) []models.WebhookDelivery {
+		deliveries, err := database.GetDeliveries(db, id, status, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deliveries
+	}
+
+	bookId, err := database.AddBookAudited(db, models.Book{Title: "Dune", Author: "Frank Herbert", Pub_Date: "1965-08-01"}, database.Change{Actor: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Testing the delivery of a change", func(t *testing.T) {
+		// not subscribed to updates
+		if err := database.UpdateBookAudited(db, models.Book{Book_Id: bookId, Title: "Dune", Author: "Frank Herbert", Pub_Date: "1965-08-01", Isbn: "0441013597"}, database.Change{}); err != nil {
+			t.Fatal(err)
+		}
+		if sent, err := dispatcher.DeliverDue(context.Background()); sent != 1 || err != nil {
+			t.Fatalf("expected 1 delivery, got %d %v", sent, err)
+		}
+		if len(hook.deliveries) != 1 || hook.deliveries[0].Event != models.EventBookCreated || hook.deliveries[0].Book_Id != bookId || hook.deliveries[0].Actor != "alice" {
+			t.Fatalf("expected the creation of the book, got %+v", hook.deliveries)
+		}
+		if event := hook.headers[0].Get(EventHeader); event != models.EventBookCreated {
+			t.Errorf("expected the event in the headers, got %q", event)
+		}
+		delivered := deliveries(models.DeliveryDelivered)
+		if len(delivered) != 1 || delivered[0].Attempts != 1 || delivered[0].ResponseStatus != http.StatusNoContent || delivered[0].NextAttemptAt != nil {
+			t.Errorf("expected a delivery made at the first attempt, got %+v", delivered)
+		}
+		if sent, _ := dispatcher.DeliverDue(context.Background()); sent != 0 {
+			t.Errorf("expected nothing left to send, got %d", sent)
+		}
+	})
+
+	t.Run("Testing the retries", func(t *testing.T) {
+		hook.status = http.StatusServiceUnavailable
+		if err := database.DeleteBookAudited(db, bookId, database.Change{}); err != nil {
+			t.Fatal(err)
+		}
+		dispatcher.DeliverDue(context.Background())
+		pending := deliveries(models.DeliveryPending)
+		if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].ResponseStatus != http.StatusServiceUnavailable || pending[0].Error == "" {
+			t.Fatalf("expected a failed attempt, got %+v", pending)
+		}
+		if wait := pending[0].NextAttemptAt.Sub(*pending[0].LastAttemptAt); wait != 10*time.Second {
+			t.Errorf("expected the next attempt in 10s, got %v", wait)
+		}
+		if sent, _ := dispatcher.DeliverDue(context.Background()); sent != 0 {
+			t.Errorf("expected no attempt before the backoff, got %d", sent)
+		}
+
+		now = now.Add(10 * time.Second)
+		dispatcher.DeliverDue(context.Background())
+		// doubled, up to the maximum
+		if pending := deliveries(models.DeliveryPending); len(pending) != 1 || pending[0].NextAttemptAt.Sub(*pending[0].LastAttemptAt) != 15*time.Second {
+			t.Errorf("expected the next attempt in 15s, got %+v", pending)
+		}
+		now = now.Add(15 * time.Second)
+		dispatcher.DeliverDue(context.Background())
+		failed := deliveries(models.DeliveryFailed)
+		if len(failed) != 1 || failed[0].Attempts != 3 || failed[0].NextAttemptAt != nil {
+			t.Errorf("expected the delivery to fail after 3 attempts, got %+v", failed)
+		}
+		t.Log(failed)
+	})
+
+	t.Run("Testing a redelivery", func(t *testing.T) {
+		hook.status = http.StatusOK
+		failed := deliveries(models.DeliveryFailed)[0]
+		redelivery, err := database.Redeliver(db, id, failed.Delivery_Id)
+		if err != nil || redelivery.RedeliveryOf != failed.Delivery_Id || redelivery.Status != models.DeliveryPending {
+			t.Fatalf("expected a new pending delivery, got %+v %v", redelivery, err)
+		}
+		dispatcher.DeliverDue(context.Background())
+		last := hook.deliveries[len(hook.deliveries)-1]
+		if last.Event != models.EventBookDeleted || last.Book == nil || last.Book.Title != "Dune" {
+			t.Errorf("expected the deleted book, got %+v", last)
+		}
+		if _, err := database.Redeliver(db, id+1, failed.Delivery_Id); err != sql.ErrNoRows {
+			t.Errorf("expected NoRows for the delivery of another webhook, got %v", err)
+		}
+	})
+
+	t.Run("Testing an inactive webhook", func(t *testing.T) {
+		webhook, _ := database.GetWebhook(db, id)
+		webhook.Active = false
+		if err := database.UpdateWebhook(db, webhook); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.AddBookAudited(db, models.Book{Title: "Emma", Author: "Jane Austen", Pub_Date: "1815-12-23"}, database.Change{}); err != nil {
+			t.Fatal(err)
+		}
+		if sent, _ := dispatcher.DeliverDue(context.Background()); sent != 0 {
+			t.Errorf("expected no delivery to an inactive webhook, got %d", sent)
+		}
+	})
+
+	t.Run("Testing the private addresses are refused by default", func(t *testing.T) {
+		webhook, _ := database.GetWebhook(db, id)
+		webhook.Active = true
+		database.UpdateWebhook(db, webhook)
+		database.Redeliver(db, id, deliveries(models.DeliveryDelivered)[0].Delivery_Id)
+		New(db, Options{}).DeliverDue(context.Background())
+		if pending := deliveries(models.DeliveryPending); len(pending) != 1 || pending[0].Attempts != 1 || pending[0].ResponseStatus != 0 {
+			t.Errorf("expected the attempt to be blocked, got %+v", pending)
+		} else {
+			t.Log(pending[0].Error)
+		}
+	})
+}
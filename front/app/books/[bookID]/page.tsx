@@ -5,10 +5,10 @@ import { Context } from '@/app/context'
 import { useContext } from 'react'
 import UpdateBookDialog from '@/app/components/UpdateBookDialog'
 import DeleteBookDialog from '@/app/components/DeleteBookDialog'
-import { useState, useEffect, Dispatch, SetStateAction } from 'react'
-import { Book, ErrMessage, ServerError } from '@/app/types'
+import { useState, useEffect, useRef, Dispatch, SetStateAction } from 'react'
+import { Book, Cover, ErrMessage, ServerError } from '@/app/types'
 import { toast } from '@/components/ui/use-toast'
-import { MouseEvent } from 'react'
+import { MouseEvent, ChangeEvent } from 'react'
 
 export default function BookDetails({ params }) {
 
@@ -17,6 +17,8 @@ export default function BookDetails({ params }) {
     const [updateDialogOpen, setUpdateDialogOpen] = useState(false)
     const [book, setBook] = useState({} as Book)
     const [error, setError] = useState({ msg: "" } as ErrMessage)
+    const [coverVersion, setCoverVersion] = useState("")
+    const coverInput = useRef<HTMLInputElement>(null)
 
     useEffect(() => {
         //maybe use a cached value here ?
@@ -44,13 +46,28 @@ export default function BookDetails({ params }) {
         setDeleteDialogOpen(true)
     }
 
+    const CoverSelected = (e: ChangeEvent<HTMLInputElement>) => {
+        const file = e.target.files?.[0]
+        e.target.value = ""
+        if (!file) {
+            return
+        }
+        UploadCover(book.book_id, file, ctx.toast).then((cover: Cover | ErrMessage) => {
+            if ("etag" in cover) {
+                setCoverVersion(cover.etag)
+            }
+        })
+    }
+
     return (
         <div>
             <div className='p-4 m-4'>
-                <BookCard book={book} />
+                <BookCard book={book} version={coverVersion} />
                 <Button className="bg-blue-500 hover:bg-blue-700 m-2" onClick={(e) => UpdateButtonClick(e)
                 }> Update </Button>
                 <Button className="bg-red-500 hover:bg-red-700 m-2" onClick={(e) => DeleteButtonClick(e)}> Delete </Button>
+                <Button className="m-2" onClick={() => coverInput.current?.click()}> Upload cover </Button>
+                <input ref={coverInput} type="file" accept="image/jpeg,image/png,image/webp" className="hidden" onChange={CoverSelected} />
             </div>
             < UpdateBookDialog open={updateDialogOpen} setOpen={setUpdateDialogOpen} setBook={setBook} />
             <DeleteBookDialog open={deleteDialogOpen} setOpen={setDeleteDialogOpen} shouldRoute={true} />
@@ -95,3 +112,31 @@ async function GetBook(bookID: number, toaster: typeof toast) {
         return { msg: "Network Error" } as ErrMessage
     }
 }
+
+// the file is sent as the body, the server finds out its type from its content
+async function UploadCover(bookID: number, file: File, toaster: typeof toast) {
+    try {
+        const resp = await fetch(`http://localhost:8046/books/${bookID}/cover`, {
+            method: "PUT",
+            body: file,
+        })
+        const jsonResponse = await resp.json()
+        if (!resp.ok) {
+            throw new ServerError(jsonResponse as ErrMessage)
+        }
+        toaster({
+            title: "Cover uploaded",
+            description: "The cover of the book was updated",
+        })
+        return jsonResponse as Cover
+    }
+
+    catch (error) {
+        toaster({
+            title: "Operation Failed",
+            description: "msg" in error ? error.msg : "Network Error, Could not connect to server",
+            variant: "destructive",
+        })
+        return { msg: error.msg ?? "Network Error" } as ErrMessage
+    }
+}
@@ -8,7 +8,7 @@ import React, { useState, useEffect } from 'react'
 import { useContext, Dispatch, SetStateAction } from 'react'
 import { useRouter } from 'next/navigation'
 import { Context } from '../context'
-import { Book, ErrMessage, ServerError } from '@/app/types'
+import { Book, BookEvent, ErrMessage, ServerError } from '@/app/types'
 import { toast } from '@/components/ui/use-toast'
 import { MouseEvent } from 'react'
 
@@ -47,6 +47,34 @@ export default function BookList() {
         })
     }, [])
 
+    // the changes made by others are streamed by the server, the list follows them without refetching
+    useEffect(() => {
+        const source = new EventSource("http://localhost:8046/events?topics=book")
+        const onChange = (message: MessageEvent) => {
+            const change = JSON.parse(message.data) as BookEvent
+            ctx.setBooks((books: Book[]) => {
+                const others = books.filter((book) => book.book_id !== change.book_id)
+                if (change.event === "book.deleted") {
+                    return others
+                }
+                const book = { ...change.book, pub_date: new Date(change.book.pub_date).toISOString().split('T')[0] }
+                return [...others, book].sort((a, b) => a.book_id - b.book_id)
+            })
+        }
+        for (const event of ["book.created", "book.updated", "book.deleted", "book.restored"]) {
+            source.addEventListener(event, onChange)
+        }
+        // some changes were missed while disconnected, and are no longer kept by the server
+        source.addEventListener("reset", () => {
+            GetBooks(ctx.toast).then((data: Book[] | ErrMessage) => {
+                if (data && !("msg" in data)) {
+                    ctx.setBooks(data)
+                }
+            })
+        })
+        return () => source.close()
+    }, [])
+
     return (
         <div className='p-4'>
             <h1 className='text-3xl text-gray-500'>Book List</h1>
@@ -1,21 +1,27 @@
+"use client"
 import { Card, CardContent, CardTitle, CardHeader } from "@/components/ui/card"
 import Image from 'next/image'
+import { useEffect, useState } from 'react'
 import type { Book } from '@/app/types'
 
-export default function BookCard({ book }: { book: Book }) {
+// version is the etag of a cover that was just uploaded, so that the browser doesn't show the one it has cached
+export default function BookCard({ book, version }: { book: Book, version?: string }) {
     return (
         <Card className="min-w-1/6">
             <CardHeader>
                 <CardTitle>{book.title}</CardTitle>
             </CardHeader>
             <CardContent>
-                <BookDetails book={book} />
+                <BookDetails book={book} version={version} />
             </CardContent>
         </Card>
     )
 }
 
-function BookDetails({ book }: { book: Book }) {
+function BookDetails({ book, version }: { book: Book, version?: string }) {
+    // the placeholder is shown for the books without a cover
+    const [noCover, setNoCover] = useState(false)
+    useEffect(() => setNoCover(false), [book.book_id, version])
     return (
         <div className="flex flex-col md:flex-row justify-between">
             <ul>
@@ -24,7 +30,10 @@ function BookDetails({ book }: { book: Book }) {
                 <li>Book publication date : {book.pub_date} </li>
                 <li>Book number of pages : {book.num_pages ? book.num_pages : "Not specified"} </li>
             </ul>
-            <Image src="/ByFoodCover.png" width={200} height={200} alt="ByFood" />
+            {noCover || book.book_id === undefined
+                ? <Image src="/ByFoodCover.png" width={200} height={200} alt="ByFood" />
+                : <img src={`http://localhost:8046/books/${book.book_id}/cover/medium${version ? `?v=${version}` : ""}`}
+                    width={200} alt={`Cover of ${book.title}`} loading="lazy" onError={() => setNoCover(true)} />}
         </div>
     )
 }
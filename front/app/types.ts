@@ -7,6 +7,27 @@ interface Book {
     num_pages: number | string
 }
 
+// a change of a book, streamed by GET /events
+interface BookEvent {
+    event: "book.created" | "book.updated" | "book.deleted" | "book.restored"
+    audit_id: number
+    book_id: number
+    actor: string
+    at: string
+    book: Book
+}
+
+// the cover of a book, answered by PUT /books/{id}/cover
+interface Cover {
+    book_id: number
+    content_type: string
+    width: number
+    height: number
+    etag: string
+    url: string
+    sizes: { small: string, medium: string, large: string }
+}
+
 interface ErrMessage {
     msg: string
 }
@@ -20,5 +41,5 @@ class ServerError extends Error {
     msg: string;
 }
 
-export type { Book, ErrMessage}
+export type { Book, BookEvent, Cover, ErrMessage}
 export {ServerError}